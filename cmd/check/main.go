@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"wispy-core/config"
+	_ "wispy-core/core/apiv1/forms" // registers the form template functions
+	"wispy-core/core/site"
+)
+
+const usage = `Check the layouts, pages and partials of tenant sites for template errors.
+
+Usage:
+  go run ./cmd/check
+  go run ./cmd/check -site example.com
+
+Reports missing templates, undefined functions, unknown layouts and classes
+wispytail cannot resolve as file:line:column, and exits with status 1 if any
+are found.
+`
+
+func main() {
+	domain := flag.String("site", "", "tenant domain, defaults to every site")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	globConf := config.LoadGlobalConfig()
+	siteManager := site.NewSiteManager(globConf.GetSitesPath())
+
+	var tenants []site.Site
+	if *domain != "" {
+		tenant, err := siteManager.LoadSiteByDomain(*domain)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		tenants = append(tenants, tenant)
+	} else {
+		sites, err := siteManager.LoadAllSites()
+		if err != nil {
+			log.Fatalf("Error loading sites: %v", err)
+		}
+		for _, tenant := range sites {
+			tenants = append(tenants, tenant)
+		}
+		sort.Slice(tenants, func(i, j int) bool { return tenants[i].GetDomain() < tenants[j].GetDomain() })
+	}
+
+	found := 0
+	for _, tenant := range tenants {
+		issues := site.CheckSite(tenant)
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d issue(s)\n", tenant.GetDomain(), len(issues))
+		found += len(issues)
+	}
+	if found > 0 {
+		os.Exit(1)
+	}
+}
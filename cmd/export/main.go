@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"wispy-core/config"
+	_ "wispy-core/core/apiv1/forms" // registers the form template functions
+	"wispy-core/core/site"
+)
+
+const usage = `Export a tenant site as static files, for hosting on a CDN.
+
+Usage:
+  go run ./cmd/export -site example.com -out dist
+  go run ./cmd/export -site example.com -out dist -base-url https://cdn.example.com
+  go run ./cmd/export -site example.com -out dist -relative
+
+Every page is rendered like for a visitor into <route>/index.html, with the
+sitemap, robots.txt, feeds, assets and public files. Exporting again only
+writes the files that changed and removes those the site no longer has.
+robots.txt keeps crawlers out unless ENV is production.
+`
+
+func main() {
+	domain := flag.String("site", "", "tenant domain")
+	out := flag.String("out", "", "directory the site is written to")
+	baseURL := flag.String("base-url", "", "URL the export is served from, defaults to the site's base_url")
+	relative := flag.Bool("relative", false, "make links within the site relative to the page")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *domain == "" || *out == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	globConf := config.LoadGlobalConfig()
+	siteManager := site.NewSiteManager(globConf.GetSitesPath())
+	tenant, err := siteManager.LoadSiteByDomain(*domain)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	site.ScaffoldTenantSiteRoutes(tenant)
+
+	result, err := site.ExportSite(tenant, site.ExportOptions{Dir: *out, BaseURL: *baseURL, Relative: *relative})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	for _, file := range result.Written {
+		fmt.Println("wrote   " + file)
+	}
+	for _, file := range result.Removed {
+		fmt.Println("removed " + file)
+	}
+	for _, err := range result.Failed {
+		fmt.Fprintf(os.Stderr, "failed  %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d written, %d unchanged, %d removed, %d failed\n", tenant.GetDomain(),
+		len(result.Written), result.Unchanged, len(result.Removed), len(result.Failed))
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+
+	"wispy-core/config"
+	"wispy-core/core/apiv1/forms"
+	"wispy-core/core/apiv1/privacy"
+	"wispy-core/core/site"
+)
+
+const usage = `Answer data subject requests for a tenant site.
+
+Usage:
+  go run ./cmd/privacy -site example.com -email person@example.com [-action find]
+  go run ./cmd/privacy -site example.com -email person@example.com -action export -format zip -out export.zip
+  go run ./cmd/privacy -site example.com -email person@example.com -action erase
+  go run ./cmd/privacy -site example.com -action log
+
+Actions: find, export, erase, anonymise, log
+`
+
+func main() {
+	domain := flag.String("site", "", "tenant domain")
+	email := flag.String("email", "", "email address of the data subject")
+	action := flag.String("action", "find", "find, export, erase, anonymise or log")
+	format := flag.String("format", privacy.FormatJSON, "export format: json or zip")
+	out := flag.String("out", "", "export file, defaults to stdout")
+	actor := flag.String("actor", "", "operator recorded in the audit log, defaults to the OS user")
+	yes := flag.Bool("yes", false, "skip the confirmation prompt when erasing")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *domain == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *actor == "" {
+		*actor = "cli"
+		if current, err := user.Current(); err == nil {
+			*actor = "cli:" + current.Username
+		}
+	}
+
+	globConf := config.LoadGlobalConfig()
+	siteManager := site.NewSiteManager(globConf.GetSitesPath())
+	if _, err := siteManager.LoadAllSites(); err != nil {
+		log.Fatalf("Error loading sites: %v", err)
+	}
+	tenant, err := siteManager.GetSite(*domain)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	switch *action {
+	case "find":
+		report, err := privacy.Find(tenant, *email)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		printCounts(report)
+	case "export":
+		report, err := privacy.Find(tenant, *email)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := writeExport(report, tenant, *format, *out); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		request := privacy.RecordExport(tenant, report, privacy.SourceCLI, *actor)
+		fmt.Fprintf(os.Stderr, "Exported %d record(s) and %d file(s), request %s\n", len(report.Records), len(report.Files), request.ID)
+	case privacy.ActionErase, privacy.ActionAnonymise:
+		report, err := privacy.Find(tenant, *email)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		printCounts(report)
+		if len(report.Records) == 0 {
+			return
+		}
+		if !*yes && !confirm(fmt.Sprintf("%s these records for %s? Type the email address to confirm: ", *action, report.Email), report.Email) {
+			log.Fatal("Aborted")
+		}
+		request, err := privacy.Erase(tenant, *email, *action, privacy.SourceCLI, *actor)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("Request %s %s\n", request.ID, request.Status)
+	case "log":
+		requests, err := privacy.ListRequests(tenant, *email, 100)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		for _, request := range requests {
+			fmt.Printf("%s  %-9s  %s  %-4s %-20s %s %v\n", request.CreatedAt.Format("2006-01-02 15:04"), request.Action,
+				request.EmailHash[:12], request.Source, request.Actor, request.Status, request.Summary)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func printCounts(report *privacy.Report) {
+	keys := make([]string, 0, len(report.Counts))
+	for key := range report.Counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("Records for %s on %s:\n", report.Email, report.Site)
+	for _, key := range keys {
+		fmt.Printf("  %-40s %d\n", key, report.Counts[key])
+	}
+	if len(keys) == 0 {
+		fmt.Println("  none")
+	}
+	fmt.Printf("Uploaded files: %d\n", len(report.Files))
+}
+
+func writeExport(report *privacy.Report, tenant site.Site, format, out string) error {
+	var w io.Writer = os.Stdout
+	if out != "" {
+		file, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if format == privacy.FormatZip {
+		return privacy.WriteZip(w, report, forms.UploadsDir(tenant))
+	}
+	return privacy.WriteJSON(w, report)
+}
+
+func confirm(prompt, expected string) bool {
+	fmt.Print(prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.EqualFold(strings.TrimSpace(answer), expected)
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+)
+
+// FormStateFlash is the flash cookie carrying form errors and values back to
+// the page after a classic (non-fetch) form post
+const FormStateFlash = "wispy_form_state"
+
+// maxFlashSize keeps flash cookies under the 4KB browser limit
+const maxFlashSize = 3800
+
+// SetFlash stores value in a short-lived signed cookie that is read once by ConsumeFlash
+func SetFlash(w http.ResponseWriter, name string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	token := NewSignedToken(base64.RawURLEncoding.EncodeToString(data))
+	if len(token) > maxFlashSize {
+		return NewErrorf("flash %s is too large (%d bytes)", name, len(token))
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   60,
+		HttpOnly: true,
+		Secure:   IsProduction(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// ConsumeFlash decodes the named flash cookie into dst and clears it.
+// It returns false when the cookie is missing or has been tampered with.
+func ConsumeFlash(w http.ResponseWriter, r *http.Request, name string, dst any) bool {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   IsProduction(),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	value, ok := ParseSignedToken(cookie.Value)
+	if !ok {
+		return false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(data, dst) == nil
+}
@@ -109,6 +109,15 @@ func RespondWithPlainText(w http.ResponseWriter, status int, msg string) {
 	}
 }
 
+// RequestBaseURL returns the scheme and host the request was made to, e.g. "https://example.com"
+func RequestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
 func NormalizeHost(host string) string {
 	// If the host contains a port, strip it
 	h := strings.Split(host, ":")[0]
@@ -151,3 +160,12 @@ func RequestLogger() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// WantsJSON reports whether the client asked for a JSON response, e.g. a fetch-based form
+// sending "Accept: application/json" or a legacy XMLHttpRequest
+func WantsJSON(r *http.Request) bool {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		return true
+	}
+	return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
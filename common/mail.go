@@ -0,0 +1,115 @@
+package common
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailMessage is a plain text email
+type MailMessage struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string // extra headers, e.g. List-Unsubscribe
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+var (
+	mailerOnce sync.Once
+	mailer     Mailer
+)
+
+// GetMailer returns the mailer configured through SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM. Without SMTP_HOST messages
+// are written to the log instead, which is enough for local development.
+func GetMailer() Mailer {
+	mailerOnce.Do(func() {
+		host := GetEnv("SMTP_HOST", "")
+		if host == "" {
+			if IsProduction() {
+				Warning("SMTP_HOST is not set, emails will only be logged")
+			}
+			mailer = &logMailer{}
+			return
+		}
+		mailer = &smtpMailer{
+			addr:     net.JoinHostPort(host, GetEnv("SMTP_PORT", "587")),
+			host:     host,
+			username: GetEnv("SMTP_USERNAME", ""),
+			password: GetEnv("SMTP_PASSWORD", ""),
+		}
+	})
+	return mailer
+}
+
+// SetMailer replaces the mailer, mainly for tests
+func SetMailer(m Mailer) {
+	mailerOnce.Do(func() {})
+	mailer = m
+}
+
+// DefaultMailFrom returns the sender address used when a message has none
+func DefaultMailFrom() string {
+	return GetEnv("MAIL_FROM", "no-reply@localhost")
+}
+
+type smtpMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+}
+
+func (m *smtpMailer) Send(msg MailMessage) error {
+	if msg.From == "" {
+		msg.From = DefaultMailFrom()
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	if err := smtp.SendMail(m.addr, auth, msg.From, []string{msg.To}, buildMailData(msg)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+type logMailer struct{}
+
+func (m *logMailer) Send(msg MailMessage) error {
+	Info("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// buildMailData renders the message headers and body, rejecting header injection
+func buildMailData(msg MailMessage) []byte {
+	clean := func(s string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + clean(msg.From) + "\r\n")
+	b.WriteString("To: " + clean(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", clean(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	for key, value := range msg.Headers {
+		b.WriteString(clean(key) + ": " + clean(value) + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -180,3 +180,8 @@ func PathToRoute(pagePath string) string {
 
 	return route
 }
+
+// EscapeLike escapes the LIKE wildcards in s, for a pattern with ESCAPE '\'
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -2,6 +2,8 @@ package apiv1
 
 import (
 	"wispy-core/core/apiv1/forms"
+	"wispy-core/core/apiv1/privacy"
+	"wispy-core/core/apiv1/subscribers"
 	"wispy-core/core/site"
 
 	"github.com/go-chi/chi/v5"
@@ -13,6 +15,12 @@ func MountApiV1(router chi.Router, siteManager site.SiteManager) chi.Router {
 		formApi := forms.NewFormApi(siteManager)
 
 		formApi.MountApi(r)
+
+		subscribersApi := subscribers.NewSubscribersApi(siteManager)
+		subscribersApi.MountApi(r)
+
+		privacyApi := privacy.NewPrivacyApi(siteManager)
+		privacyApi.MountApi(r)
 	})
 
 	return router
@@ -0,0 +1,275 @@
+package forms
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"wispy-core/common"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// draftField carries the resume token of a saved draft
+	draftField = "__draft__"
+	// stepField is the step the visitor has completed when a draft is saved
+	stepField = "__step__"
+	// resumeParam is the page query parameter that re-opens a draft
+	resumeParam = "resume"
+	// draftTTL is how long a partially completed form can be resumed
+	draftTTL        = 30 * 24 * time.Hour
+	draftTokenBytes = 24
+)
+
+// FormDraft is a partially completed multi-step submission
+type FormDraft struct {
+	Token     string            `json:"token"`
+	FormID    string            `json:"form_id"`
+	Step      int               `json:"step"` // last completed step
+	Values    map[string]string `json:"values"`
+	ResumeURL string            `json:"resume_url,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// SaveDraft stores the values of a multi-step form up to the posted step. The
+// fields of completed steps are validated, uploads are left for the final submit.
+func (f *FormApi) SaveDraft(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if isMultipartRequest(r) {
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+	} else if err := r.ParseForm(); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
+		return
+	}
+
+	form, err := getForm(db, r.FormValue("__form_id__"), site.GetDomain())
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form", err)
+		return
+	}
+	if !draftsEnabled(form) {
+		common.RespondWithError(w, r, http.StatusBadRequest, "This form does not save drafts", nil)
+		return
+	}
+
+	if err := verifyFormToken(form, r.FormValue(honeypotField), r.FormValue(tokenField)); err != nil {
+		common.RespondWithError(w, r, http.StatusForbidden, "This form has expired, please reload the page and try again", err)
+		return
+	}
+
+	step, _ := strconv.Atoi(r.FormValue(stepField))
+	step = min(max(step, 0), stepCount(form))
+
+	visible := visibleFields(form, r.Form)
+	if step > 0 {
+		if errs := f.validateFields(r.Form, form, visible, step); len(errs) > 0 {
+			f.respondWithValidationErrors(w, r, form, errs)
+			return
+		}
+	}
+
+	draft := FormDraft{
+		Token:  r.FormValue(draftField),
+		FormID: form.ID,
+		Step:   step,
+		Values: draftValues(r.Form, form, visible),
+	}
+	if err := saveDraft(db, &draft, draftEmail(form, draft.Values), common.GetIPAddress(r), r.UserAgent()); err != nil {
+		common.Error("Failed to save form draft: %v", err)
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to save your progress", err)
+		return
+	}
+
+	referer := sameHostReferer(r)
+	if referer != "" {
+		draft.ResumeURL = common.RequestBaseURL(r) + withResumeParam(referer, draft.Token)
+	}
+
+	if common.WantsJSON(r) || referer == "" {
+		common.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":    true,
+			"message":    "Your progress has been saved",
+			"token":      draft.Token,
+			"step":       draft.Step,
+			"resume_url": draft.ResumeURL,
+			"expires_at": draft.ExpiresAt,
+		})
+		return
+	}
+
+	http.Redirect(w, r, withResumeParam(referer, draft.Token), http.StatusSeeOther)
+}
+
+// GetDraft returns the values of a saved draft so a page can resume it
+func (f *FormApi) GetDraft(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	draft, err := getDraft(db, chi.URLParam(r, "token"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Draft not found or expired", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	common.RespondWithJSON(w, http.StatusOK, draft)
+}
+
+// draftsEnabled reports whether a form saves drafts, which multi-step forms do
+// unless their settings contain "drafts": false
+func draftsEnabled(form Form) bool {
+	if enabled, ok := form.Metadata["drafts"].(bool); ok {
+		return enabled
+	}
+	return stepCount(form) > 1
+}
+
+// draftValues collects the visible, non-file values of the form's own fields
+func draftValues(formData url.Values, form Form, visible map[string]bool) map[string]string {
+	values := make(map[string]string)
+	for _, field := range form.Fields {
+		if field.Type == "file" || !visible[field.Name] {
+			continue
+		}
+		if vals := nonEmptyValues(formData[field.Name]); len(vals) > 0 {
+			values[field.Name] = strings.Join(vals, ", ")
+		}
+	}
+	return values
+}
+
+// draftEmail returns the address entered so far, so drafts can be found for privacy requests
+func draftEmail(form Form, values map[string]string) string {
+	for _, field := range form.Fields {
+		if field.Type == "email" && values[field.Name] != "" {
+			return values[field.Name]
+		}
+	}
+	return values["email"]
+}
+
+// withResumeParam sets the resume query parameter on a request URI
+func withResumeParam(uri, token string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := u.Query()
+	query.Set(resumeParam, token)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// saveDraft updates the draft with the given token or, when there is none or it
+// has expired, creates a new one and sets its token
+func saveDraft(db *sql.DB, draft *FormDraft, email, ipAddress, userAgent string) error {
+	data, err := json.Marshal(draft.Values)
+	if err != nil {
+		return fmt.Errorf("failed to encode draft: %w", err)
+	}
+
+	now := time.Now()
+	draft.UpdatedAt = now
+	draft.ExpiresAt = now.Add(draftTTL)
+
+	// Expired drafts are removed as new ones come in
+	if _, err := db.Exec(`DELETE FROM form_submission_drafts WHERE expires_at < ?`, now); err != nil {
+		common.Warning("Failed to remove expired form drafts: %v", err)
+	}
+
+	if draft.Token != "" {
+		result, err := db.Exec(`
+			UPDATE form_submission_drafts
+			SET step = MAX(step, ?), data = ?, email = ?, ip_address = ?, user_agent = ?, updated_at = ?, expires_at = ?
+			WHERE token = ? AND form_id = (SELECT id FROM forms WHERE uuid = ?)`,
+			draft.Step, string(data), email, ipAddress, userAgent, now, draft.ExpiresAt, draft.Token, draft.FormID)
+		if err != nil {
+			return fmt.Errorf("failed to update draft: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			return db.QueryRow(`SELECT step FROM form_submission_drafts WHERE token = ?`, draft.Token).Scan(&draft.Step)
+		}
+	}
+
+	draft.Token = common.NewRandomToken(draftTokenBytes)
+	_, err = db.Exec(`
+		INSERT INTO form_submission_drafts (token, form_id, step, data, email, ip_address, user_agent, created_at, updated_at, expires_at)
+		VALUES (?, (SELECT id FROM forms WHERE uuid = ?), ?, ?, ?, ?, ?, ?, ?, ?)`,
+		draft.Token, draft.FormID, draft.Step, string(data), email, ipAddress, userAgent, now, now, draft.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save draft: %w", err)
+	}
+	return nil
+}
+
+// getDraft loads a draft that has not expired yet
+func getDraft(db *sql.DB, token string) (FormDraft, error) {
+	if token == "" {
+		return FormDraft{}, common.NewError("missing draft token")
+	}
+
+	var draft FormDraft
+	var data string
+	err := db.QueryRow(`
+		SELECT d.token, f.uuid, d.step, d.data, d.updated_at, d.expires_at
+		FROM form_submission_drafts d
+		JOIN forms f ON d.form_id = f.id
+		WHERE d.token = ?`, token).Scan(&draft.Token, &draft.FormID, &draft.Step, &data, &draft.UpdatedAt, &draft.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return FormDraft{}, common.NewError("draft not found")
+		}
+		return FormDraft{}, fmt.Errorf("failed to get draft: %w", err)
+	}
+	if time.Now().After(draft.ExpiresAt) {
+		return FormDraft{}, common.NewError("draft has expired")
+	}
+
+	draft.Values = make(map[string]string)
+	if err := json.Unmarshal([]byte(data), &draft.Values); err != nil {
+		return FormDraft{}, fmt.Errorf("failed to parse draft: %w", err)
+	}
+	return draft, nil
+}
+
+// deleteDraft removes a draft once its form has been submitted
+func deleteDraft(db *sql.DB, token, formID string) error {
+	_, err := db.Exec(`DELETE FROM form_submission_drafts WHERE token = ? AND form_id = (SELECT id FROM forms WHERE uuid = ?)`, token, formID)
+	if err != nil {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	return nil
+}
@@ -2,15 +2,20 @@ package forms
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"wispy-core/auth"
 	"wispy-core/common"
 	"wispy-core/config"
+	"wispy-core/core/apiv1/subscribers"
 	"wispy-core/core/site"
 
 	"github.com/go-chi/chi/v5"
@@ -37,6 +42,7 @@ type Form struct {
 	Name        string         `json:"name" db:"name" validate:"required"`
 	Slug        string         `json:"slug" db:"slug" validate:"required"`
 	Fields      []FormField    `json:"fields" db:"fields"`
+	Steps       []FormStep     `json:"steps,omitempty" db:"-"` // titles and conditions of multi-step forms, stored with the settings
 	RedirectURL string         `json:"redirect_url" db:"redirect_url"`
 	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
@@ -44,15 +50,56 @@ type Form struct {
 }
 
 type FormField struct {
-	Name        string `json:"name" validate:"required"`
-	Type        string `json:"type" validate:"required,oneof=text email tel number select checkbox radio textarea"`
-	Label       string `json:"label"`
-	Required    bool   `json:"required"`
-	Placeholder string `json:"placeholder"`
-	Options     []struct {
-		Value string `json:"value"`
-		Label string `json:"label"`
-	} `json:"options,omitempty"`
+	Name        string            `json:"name" validate:"required"`
+	Type        string            `json:"type" validate:"required,oneof=text email tel number url date time select checkbox radio textarea file"`
+	Label       string            `json:"label"`
+	Required    bool              `json:"required"`
+	Placeholder string            `json:"placeholder"`
+	Options     []FormFieldOption `json:"options,omitempty"`
+
+	// Validation rules, all optional
+	MinLength      int      `json:"min_length,omitempty"`
+	MaxLength      int      `json:"max_length,omitempty"`
+	Min            *float64 `json:"min,omitempty"`             // number fields only
+	Max            *float64 `json:"max,omitempty"`             // number fields only
+	Pattern        string   `json:"pattern,omitempty"`         // anchored like the HTML pattern attribute
+	PatternMessage string   `json:"pattern_message,omitempty"` // shown when Pattern does not match
+	Matches        string   `json:"matches,omitempty"`         // name of a field this value must equal, e.g. confirm email
+
+	// File fields only
+	MaxFileSize  int64    `json:"max_file_size,omitempty"` // bytes per file, defaults to defaultMaxFileSize
+	AllowedTypes []string `json:"allowed_types,omitempty"` // MIME types, e.g. "application/pdf" or "image/*"
+	MaxFiles     int      `json:"max_files,omitempty"`     // defaults to 1
+
+	// Multi-step and conditional forms
+	Step   int             `json:"step,omitempty"`    // 1-based page the field is shown on, 0 means the first
+	ShowIf *FieldCondition `json:"show_if,omitempty"` // the field is hidden, skipped by validation and not stored unless this matches
+}
+
+type FormFieldOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// UnmarshalJSON accepts both {"value": "a", "label": "A"} and plain "a" options
+func (o *FormFieldOption) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		o.Value = plain
+		o.Label = plain
+		return nil
+	}
+
+	type option FormFieldOption
+	var opt option
+	if err := json.Unmarshal(data, &opt); err != nil {
+		return err
+	}
+	if opt.Label == "" {
+		opt.Label = opt.Value
+	}
+	*o = FormFieldOption(opt)
+	return nil
 }
 
 type FormSubmission struct {
@@ -70,6 +117,13 @@ type FormSubmission struct {
 	IPAddress  string            `json:"ip_address" db:"ip_address"`
 	UserAgent  string            `json:"user_agent" db:"user_agent"`
 	CreatedAt  time.Time         `json:"created_at" db:"created_at"`
+	Status     string            `json:"status" db:"status"`                     // inbox state, see StatusNew
+	AssignedTo *string           `json:"assigned_to,omitempty" db:"assigned_to"` // CMS user id
+	ReadAt     *time.Time        `json:"read_at,omitempty" db:"read_at"`
+
+	// Set when a client sent an Idempotency-Key, see hashSubmissionRequest
+	IdempotencyKey string `json:"-" db:"idempotency_key"`
+	RequestHash    string `json:"-" db:"request_hash"`
 }
 
 type FormApi struct {
@@ -91,9 +145,27 @@ func NewFormApi(siteManager site.SiteManager) *FormApi {
 func (f *FormApi) MountApi(r chi.Router) {
 	r.Route("/forms", func(r chi.Router) {
 		r.Post("/submit", f.FormSubmission)
+		r.Options("/submit", f.SubmissionPreflight)
+		r.Post("/{formID}/submit", f.FormSubmission)
+		r.Options("/{formID}/submit", f.SubmissionPreflight)
+		r.Post("/drafts", f.SaveDraft)
+		r.Get("/drafts/{token}", f.GetDraft)
 		r.Group(func(r chi.Router) {
 			r.Use(f.authMiddleware.RequireAuth)
 
+			r.Get("/submissions", f.ListSubmissions)
+			r.Get("/submissions/search", f.SearchSubmissions)
+			r.Post("/submissions/bulk", f.BulkUpdateSubmissions)
+			r.Get("/submissions/{submissionID}", f.GetSubmission)
+			r.Delete("/submissions/{submissionID}", f.DeleteSubmission)
+			r.Post("/submissions/{submissionID}/status", f.UpdateSubmissionStatus)
+			r.Post("/submissions/{submissionID}/assign", f.AssignSubmission)
+			r.Post("/submissions/{submissionID}/tags", f.UpdateSubmissionTags)
+			r.Post("/submissions/{submissionID}/notes", f.AddSubmissionNote)
+			r.Delete("/submissions/{submissionID}/notes/{noteID}", f.DeleteSubmissionNote)
+			r.Get("/submissions/{submissionID}/files", f.ListSubmissionFiles)
+			r.Get("/files/{fileID}", f.DownloadSubmissionFile)
+
 			r.Get("/submissions/by-email/{email}", f.GetSubmissionsByEmail)
 			r.Get("/submissions/by-name/{name}", f.GetSubmissionsByName)
 			r.Get("/submissions/by-phone/{phone}", f.GetSubmissionsByPhone)
@@ -107,67 +179,139 @@ func (f *FormApi) MountApi(r chi.Router) {
 	})
 }
 
+// FormSubmission stores a submission posted as a classic form, multipart with files,
+// or as a JSON object from headless clients. JSON clients get structured responses,
+// CORS headers for allowed origins and may retry safely with an Idempotency-Key.
 func (f *FormApi) FormSubmission(w http.ResponseWriter, r *http.Request) {
 	domain := common.NormalizeHost(r.Host)
 	site, err := f.siteManager.GetSite(domain)
 	if err != nil {
-		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		respondWithSubmissionError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
 		return
 	}
+	// Until the form is found, only the origins the site allows get CORS headers
+	failEarly := func(status int, message string, err error) {
+		allowCORS(w, r, site, nil)
+		respondWithSubmissionError(w, r, status, message, err)
+	}
 
 	db, err := f.getDBConnection(site)
 	if err != nil {
 		common.Error("Database error: %v", err)
-		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		failEarly(http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer db.Close()
 
-	if err := r.ParseForm(); err != nil {
-		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
-		return
+	switch {
+	case isJSONRequest(r):
+		if err := parseJSONSubmission(w, r); err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			failEarly(status, "Invalid JSON body", err)
+			return
+		}
+	case isMultipartRequest(r):
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			failEarly(http.StatusBadRequest, "Invalid form data", err)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+	default:
+		if err := r.ParseForm(); err != nil {
+			failEarly(http.StatusBadRequest, "Invalid form data", err)
+			return
+		}
 	}
 
-	formID := r.FormValue("__form_id__")
+	formID := submissionFormID(r)
 	if formID == "" {
-		common.RespondWithError(w, r, http.StatusBadRequest, "Form ID is required", nil)
+		failEarly(http.StatusBadRequest, "Form ID is required", nil)
 		return
 	}
 
-	form, err := f.getForm(db, formID, site.GetDomain())
+	form, err := getForm(db, formID, site.GetDomain())
 	if err != nil {
-		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form", err)
+		status := http.StatusBadRequest
+		if chi.URLParam(r, "formID") != "" {
+			status = http.StatusNotFound
+		}
+		failEarly(status, "Invalid form", err)
+		return
+	}
+	allowCORS(w, r, site, &form)
+
+	if err := verifyFormToken(form, r.FormValue(honeypotField), r.FormValue(tokenField)); err != nil {
+		if r.FormValue(honeypotField) != "" {
+			// Don't tell bots they were caught
+			common.Info("Dropped spam submission for form %s: %v", form.ID, err)
+			if wantsJSONResponse(r) {
+				common.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{"success": true, "message": "Form submitted successfully"})
+				return
+			}
+			common.RespondWithPlainText(w, http.StatusOK, "Form submitted successfully")
+			return
+		}
+		respondWithSubmissionError(w, r, http.StatusForbidden, "This form has expired, please reload the page and try again", err)
 		return
 	}
 
-	submissionData, commonData, err := f.validateAndNormalizeSubmission(r.Form, form)
+	key, err := idempotencyKey(r)
 	if err != nil {
-		common.RespondWithError(w, r, http.StatusBadRequest, err.Error(), err)
+		respondWithSubmissionError(w, r, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	var requestHash string
+	if key != "" {
+		requestHash = hashSubmissionRequest(r.Form, r.MultipartForm)
+		if submissionID, storedHash, err := findIdempotentSubmission(db, form.ID, key); err == nil {
+			replaySubmission(w, r, submissionID, storedHash, requestHash)
+			return
+		} else if err != sql.ErrNoRows {
+			respondWithSubmissionError(w, r, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+	}
+
+	submissionData, commonData, errs := f.validateAndNormalizeSubmission(r.Form, form)
+	uploads, fileErrs := validateSubmissionFiles(form, r.MultipartForm, visibleFields(form, r.Form))
+	errs.Merge(fileErrs)
+	if _, ok := commonData[FieldEmail]; !ok && submissionData != nil && submissionData["email"] == "" {
+		errs.Add(FieldEmail, "is required")
+	}
+	if len(errs) > 0 {
+		f.respondWithValidationErrors(w, r, form, errs)
 		return
 	}
+	for fieldName, files := range uploads {
+		names := make([]string, 0, len(files))
+		for _, file := range files {
+			names = append(names, file.Filename)
+		}
+		submissionData[fieldName] = strings.Join(names, ", ")
+	}
 
 	submission := FormSubmission{
 		ID:         uuid.New().String(),
-		FormID:     formID,
+		FormID:     form.ID,
 		SiteDomain: site.GetDomain(),
 		Data:       submissionData,
 		IPAddress:  common.GetIPAddress(r),
 		UserAgent:  r.UserAgent(),
 		CreatedAt:  time.Now(),
+
+		IdempotencyKey: key,
+		RequestHash:    requestHash,
 	}
 
-	// Set email (required field)
+	// Set email (required field, checked above)
 	if email, ok := commonData[FieldEmail]; ok {
 		submission.Email = email
 	} else {
-		// If no email found in common data, check regular data
-		if emailVal, exists := submissionData["email"]; exists {
-			submission.Email = emailVal
-			delete(submissionData, "email") // Remove from data map since it's now a direct field
-		} else {
-			common.RespondWithError(w, r, http.StatusBadRequest, "Email is required", nil)
-			return
-		}
+		submission.Email = submissionData["email"]
+		delete(submissionData, "email") // Remove from data map since it's now a direct field
 	}
 
 	// Set optional fields
@@ -213,13 +357,52 @@ func (f *FormApi) FormSubmission(w http.ResponseWriter, r *http.Request) {
 		delete(submissionData, "message")
 	}
 
-	if err := f.saveSubmission(db, submission); err != nil {
+	if err := f.saveSubmissionWithFiles(db, submission, uploads, UploadsDir(site)); err != nil {
+		// A concurrent retry with the same key may have been saved in the meantime
+		if key != "" {
+			if submissionID, storedHash, findErr := findIdempotentSubmission(db, form.ID, key); findErr == nil {
+				replaySubmission(w, r, submissionID, storedHash, requestHash)
+				return
+			}
+		}
 		common.Error("Failed to save submission: %v", err)
-		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to save submission", err)
+		respondWithSubmissionError(w, r, http.StatusInternalServerError, "Failed to save submission", err)
+		return
+	}
+
+	// The draft is only removed once the submission is safely stored
+	if token := r.FormValue(draftField); token != "" {
+		if err := deleteDraft(db, token, form.ID); err != nil {
+			common.Warning("Failed to remove draft of submission %s: %v", submission.ID, err)
+		}
+	}
+
+	// Forms with a subscribe_list setting start a double opt-in for the submitted address
+	if list, ok := form.Metadata["subscribe_list"].(string); ok && list != "" {
+		err := subscribers.Subscribe(site, subscribers.SubscribeRequest{
+			Email:      submission.Email,
+			List:       list,
+			SourceForm: form.Name,
+			IPAddress:  submission.IPAddress,
+			UserAgent:  submission.UserAgent,
+			BaseURL:    common.RequestBaseURL(r),
+		})
+		if err != nil {
+			common.Error("Failed to subscribe %s to list %s: %v", submission.Email, list, err)
+		}
+	}
+
+	if wantsJSONResponse(r) {
+		common.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
+			"success":       true,
+			"message":       "Form submitted successfully",
+			"submission_id": submission.ID,
+		})
 		return
 	}
 
 	if form.RedirectURL != "" {
+		setSuccessState(w, form, "Form submitted successfully!")
 		common.RedirectWithMessage(w, r, form.RedirectURL, "Form submitted successfully!", "")
 		return
 	}
@@ -244,35 +427,49 @@ func (f *FormApi) FormSubmission(w http.ResponseWriter, r *http.Request) {
 	// queryParam redirect then redirect
 	redirectURL := r.URL.Query().Get("redirect")
 	if redirectURL != "" {
+		setSuccessState(w, form, "Form submitted successfully!")
 		common.RedirectWithMessage(w, r, redirectURL, "Form submitted successfully!", "")
+	} else if referer := sameHostReferer(r); referer != "" {
+		// Send classic posts back to the page so it can show the success state
+		setSuccessState(w, form, "Form submitted successfully!")
+		http.Redirect(w, r, referer, http.StatusSeeOther)
 	} else {
 		common.RespondWithPlainText(w, http.StatusOK, "Form submitted successfully")
 	}
 }
 
-func (f *FormApi) validateAndNormalizeSubmission(formData url.Values, form Form) (map[string]string, map[string]string, error) {
+func (f *FormApi) validateAndNormalizeSubmission(formData url.Values, form Form) (map[string]string, map[string]string, ValidationErrors) {
 	normalized := make(map[string]string)
 	commonFields := make(map[string]string)
 	fieldMap := make(map[string]FormField)
-
-	// Build field map from form definition
 	for _, field := range form.Fields {
 		fieldMap[field.Name] = field
 	}
 
+	// Fields hidden by show_if or on skipped steps are neither validated nor stored
+	visible := visibleFields(form, formData)
+	errs := f.validateFields(formData, form, visible, 0)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
 	for name, values := range formData {
 		// Skip form control fields
 		if strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__") {
 			continue
 		}
 
-		value := strings.TrimSpace(values[0])
-		if value == "" {
+		values = nonEmptyValues(values)
+		if len(values) == 0 {
 			continue // Skip empty values
 		}
+		value := strings.Join(values, ", ")
 
 		// Check if field is defined in form, otherwise allow it as a generic field
 		field, exists := fieldMap[name]
+		if exists && (field.Type == "file" || field.Matches != "" || !visible[name]) {
+			continue // Files are stored separately, confirmation fields duplicate another field
+		}
 		if !exists {
 			// Create a default field definition for undefined fields
 			field = FormField{
@@ -282,22 +479,11 @@ func (f *FormApi) validateAndNormalizeSubmission(formData url.Values, form Form)
 			}
 		}
 
-		// Validate required fields
-		if field.Required && value == "" {
-			return nil, nil, common.NewError("field '" + name + "' is required")
-		}
-
-		// Validate field types
+		// Map typed fields to their common columns
 		switch field.Type {
 		case "email":
-			if err := f.validate.Var(value, "email"); err != nil {
-				return nil, nil, common.NewError("field '" + name + "' must be a valid email")
-			}
 			commonFields[FieldEmail] = value
 		case "tel":
-			if err := validatePhoneNumber(value); err != nil {
-				return nil, nil, common.NewError("field '" + name + "' must be a valid phone number")
-			}
 			commonFields[FieldPhone] = value
 		}
 
@@ -330,7 +516,7 @@ func (f *FormApi) validateAndNormalizeSubmission(formData url.Values, form Form)
 		}
 	}
 
-	return normalized, commonFields, nil
+	return normalized, commonFields, errs
 }
 
 func (f *FormApi) GetSubmissionsByEmail(w http.ResponseWriter, r *http.Request) {
@@ -362,7 +548,6 @@ func (f *FormApi) querySubmissionsByField(w http.ResponseWriter, r *http.Request
 		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer db.Close()
 
 	submissions, err := f.getSubmissionsByField(db, site.GetDomain(), field, value)
 	if err != nil {
@@ -386,7 +571,6 @@ func (f *FormApi) CreateForm(w http.ResponseWriter, r *http.Request) {
 		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer db.Close()
 
 	if err := r.ParseForm(); err != nil {
 		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
@@ -435,6 +619,53 @@ func (f *FormApi) CreateForm(w http.ResponseWriter, r *http.Request) {
 			Placeholder: fieldPlaceholder,
 		}
 
+		field.Pattern = r.FormValue(fmt.Sprintf("field_%d_pattern", i))
+		field.PatternMessage = r.FormValue(fmt.Sprintf("field_%d_pattern_message", i))
+		field.Matches = r.FormValue(fmt.Sprintf("field_%d_matches", i))
+		if minLength, err := strconv.Atoi(r.FormValue(fmt.Sprintf("field_%d_min_length", i))); err == nil {
+			field.MinLength = minLength
+		}
+		if maxLength, err := strconv.Atoi(r.FormValue(fmt.Sprintf("field_%d_max_length", i))); err == nil {
+			field.MaxLength = maxLength
+		}
+		if min, err := strconv.ParseFloat(r.FormValue(fmt.Sprintf("field_%d_min", i)), 64); err == nil {
+			field.Min = &min
+		}
+		if max, err := strconv.ParseFloat(r.FormValue(fmt.Sprintf("field_%d_max", i)), 64); err == nil {
+			field.Max = &max
+		}
+		for _, option := range strings.Split(r.FormValue(fmt.Sprintf("field_%d_options", i)), ",") {
+			if option = strings.TrimSpace(option); option != "" {
+				field.Options = append(field.Options, FormFieldOption{Value: option, Label: option})
+			}
+		}
+
+		if step, err := strconv.Atoi(r.FormValue(fmt.Sprintf("field_%d_step", i))); err == nil {
+			field.Step = step
+		}
+		if showIf := r.FormValue(fmt.Sprintf("field_%d_show_if", i)); showIf != "" {
+			var condition FieldCondition
+			if err := json.Unmarshal([]byte(showIf), &condition); err != nil {
+				common.RespondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("field '%s' has an invalid show_if condition", fieldName), err)
+				return
+			}
+			field.ShowIf = &condition
+		}
+
+		if fieldType == "file" {
+			if maxSize, err := strconv.ParseInt(r.FormValue(fmt.Sprintf("field_%d_max_file_size", i)), 10, 64); err == nil {
+				field.MaxFileSize = maxSize
+			}
+			if maxFiles, err := strconv.Atoi(r.FormValue(fmt.Sprintf("field_%d_max_files", i))); err == nil {
+				field.MaxFiles = maxFiles
+			}
+			for _, t := range strings.Split(r.FormValue(fmt.Sprintf("field_%d_allowed_types", i)), ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					field.AllowedTypes = append(field.AllowedTypes, t)
+				}
+			}
+		}
+
 		fields = append(fields, field)
 		i++
 	}
@@ -442,11 +673,39 @@ func (f *FormApi) CreateForm(w http.ResponseWriter, r *http.Request) {
 	form.Fields = fields
 	form.RedirectURL = r.FormValue("redirect_url")
 
+	// Step titles: step_1_title, step_1_description, step_1_show_if, ...
+	for n := 1; r.FormValue(fmt.Sprintf("step_%d_title", n)) != ""; n++ {
+		step := FormStep{
+			Title:       r.FormValue(fmt.Sprintf("step_%d_title", n)),
+			Description: r.FormValue(fmt.Sprintf("step_%d_description", n)),
+		}
+		if showIf := r.FormValue(fmt.Sprintf("step_%d_show_if", n)); showIf != "" {
+			var condition FieldCondition
+			if err := json.Unmarshal([]byte(showIf), &condition); err != nil {
+				common.RespondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("step %d has an invalid show_if condition", n), err)
+				return
+			}
+			step.ShowIf = &condition
+		}
+		form.Steps = append(form.Steps, step)
+	}
+
 	if err := f.validate.Struct(form); err != nil {
 		common.RespondWithError(w, r, http.StatusBadRequest, common.ValidationErrorsToMessage(err), err)
 		return
 	}
 
+	for _, field := range form.Fields {
+		if err := validateFieldRules(field); err != nil {
+			common.RespondWithError(w, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+	if err := validateFormLogic(form); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
 	form.ID = uuid.New().String()
 	form.SiteDomain = site.GetDomain()
 	form.CreatedAt = time.Now()
@@ -473,7 +732,6 @@ func (f *FormApi) ListForms(w http.ResponseWriter, r *http.Request) {
 		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer db.Close()
 
 	forms, err := f.getAllForms(db, site.GetDomain())
 	if err != nil {
@@ -497,10 +755,9 @@ func (f *FormApi) GetForm(w http.ResponseWriter, r *http.Request) {
 		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer db.Close()
 
 	formID := chi.URLParam(r, "formID")
-	form, err := f.getForm(db, formID, site.GetDomain())
+	form, err := getForm(db, formID, site.GetDomain())
 	if err != nil {
 		common.RespondWithError(w, r, http.StatusNotFound, "Form not found", err)
 		return
@@ -522,7 +779,6 @@ func (f *FormApi) GetFormSubmissions(w http.ResponseWriter, r *http.Request) {
 		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
 		return
 	}
-	defer db.Close()
 
 	formID := chi.URLParam(r, "formID")
 	submissions, err := f.getFormSubmissions(db, site.GetDomain(), formID)
@@ -542,16 +798,18 @@ func (f *FormApi) getDBConnection(site site.Site) (*sql.DB, error) {
 	return dbManager.GetOrCreateConnection(formsDBName)
 }
 
-func (f *FormApi) getForm(db *sql.DB, formID, siteID string) (Form, error) {
+// getForm loads a form by its uuid or by its name (slug)
+func getForm(db *sql.DB, formID, siteID string) (Form, error) {
 	const getFormSQL = `
 		SELECT uuid, name, title, description, fields, settings, created_at, updated_at
 		FROM forms 
-		WHERE uuid = ?`
+		WHERE uuid = ? OR name = ?
+		LIMIT 1`
 
 	var form Form
 	var title, description, fieldsJSON, settingsJSON string
 
-	err := db.QueryRow(getFormSQL, formID).Scan(
+	err := db.QueryRow(getFormSQL, formID, formID).Scan(
 		&form.ID,
 		&form.Name,
 		&title,
@@ -572,40 +830,12 @@ func (f *FormApi) getForm(db *sql.DB, formID, siteID string) (Form, error) {
 	form.SiteDomain = siteID
 	form.Slug = form.Name // Use name as slug for compatibility
 
-	// Parse fields from the database
-	// The existing database stores fields as JSON, but we need to handle it without json package
-	// For the example form, we know it has an email field
-	if fieldsJSON != "" {
-		// Simple parsing for known patterns - this handles the example email form
-		if strings.Contains(fieldsJSON, `"email"`) {
-			emailField := FormField{
-				Name:     "email",
-				Type:     "email",
-				Label:    "Email Address",
-				Required: true,
-			}
-			form.Fields = append(form.Fields, emailField)
-		}
-		// Add more field types as needed
-		if strings.Contains(fieldsJSON, `"name"`) {
-			nameField := FormField{
-				Name:     "name",
-				Type:     "text",
-				Label:    "Name",
-				Required: false,
-			}
-			form.Fields = append(form.Fields, nameField)
-		}
-	}
-
-	// Handle settings
-	if settingsJSON != "" {
-		form.Metadata = make(map[string]any)
-		// Parse redirect URL from settings if present
-		if strings.Contains(settingsJSON, "confirmation_message") {
-			// Extract confirmation message or other settings as needed
-		}
+	form.Fields, err = parseFormFields(fieldsJSON)
+	if err != nil {
+		return Form{}, fmt.Errorf("failed to parse form fields: %w", err)
 	}
+	form.Metadata, form.RedirectURL = parseFormSettings(settingsJSON)
+	form.Steps = takeFormSteps(form.Metadata)
 
 	return form, nil
 }
@@ -615,32 +845,33 @@ func (f *FormApi) saveForm(db *sql.DB, form Form) error {
 		INSERT INTO forms (uuid, name, title, description, fields, settings, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	// Since we can't use JSON, we'll store fields as a simple string representation
-	// This is a simplified approach - in practice you might want a different serialization method
-	fieldsData := ""
-	for i, field := range form.Fields {
-		if i > 0 {
-			fieldsData += "|"
-		}
-		fieldsData += field.Name + ":" + field.Type + ":" + field.Label
-		if field.Required {
-			fieldsData += ":required"
-		}
+	fieldsData, err := json.Marshal(form.Fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode form fields: %w", err)
 	}
 
-	// Create a simple settings string
-	settingsData := ""
+	settings := make(map[string]any)
+	for key, value := range form.Metadata {
+		settings[key] = value
+	}
 	if form.RedirectURL != "" {
-		settingsData = "redirect_url:" + form.RedirectURL
+		settings["redirect_url"] = form.RedirectURL
+	}
+	if len(form.Steps) > 0 {
+		settings["steps"] = form.Steps
+	}
+	settingsData, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode form settings: %w", err)
 	}
 
-	_, err := db.Exec(saveFormSQL,
+	_, err = db.Exec(saveFormSQL,
 		form.ID,
 		form.Name,
 		form.Name,          // Use name as title
 		"Form description", // Default description
-		fieldsData,
-		settingsData,
+		string(fieldsData),
+		string(settingsData),
 		form.CreatedAt,
 		form.UpdatedAt,
 	)
@@ -686,20 +917,13 @@ func (f *FormApi) getAllForms(db *sql.DB, siteID string) ([]Form, error) {
 		form.SiteDomain = siteID
 		form.Slug = form.Name
 
-		// Parse fields from string format (simplified parsing)
-		form.Fields = []FormField{}
-		if fieldsData != "" {
-			// Simple parsing of field data
-			// This would need to be more robust in production
-		}
-
-		// Parse settings
-		if settingsData != "" && strings.Contains(settingsData, "redirect_url:") {
-			parts := strings.Split(settingsData, "redirect_url:")
-			if len(parts) > 1 {
-				form.RedirectURL = parts[1]
-			}
+		form.Fields, err = parseFormFields(fieldsData)
+		if err != nil {
+			common.Warning("Failed to parse fields for form %s: %v", form.ID, err)
+			form.Fields = []FormField{}
 		}
+		form.Metadata, form.RedirectURL = parseFormSettings(settingsData)
+		form.Steps = takeFormSteps(form.Metadata)
 
 		forms = append(forms, form)
 	}
@@ -711,10 +935,36 @@ func (f *FormApi) getAllForms(db *sql.DB, siteID string) ([]Form, error) {
 	return forms, nil
 }
 
-func (f *FormApi) saveSubmission(db *sql.DB, submission FormSubmission) error {
+// saveSubmissionWithFiles saves a submission and stores its uploads in one
+// transaction. When a file cannot be stored the submission is not saved either and
+// the files already written are removed, so a retry does not duplicate it.
+func (f *FormApi) saveSubmissionWithFiles(db *sql.DB, submission FormSubmission, uploads map[string][]*multipart.FileHeader, uploadsDir string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := f.saveSubmission(tx, submission); err != nil {
+		return err
+	}
+	if len(uploads) > 0 {
+		if err := storeSubmissionFiles(tx, uploadsDir, submission.ID, uploads); err != nil {
+			RemoveSubmissionUploads(uploadsDir, []string{submission.ID})
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		RemoveSubmissionUploads(uploadsDir, []string{submission.ID})
+		return fmt.Errorf("failed to commit submission: %w", err)
+	}
+	return nil
+}
+
+func (f *FormApi) saveSubmission(tx *sql.Tx, submission FormSubmission) error {
 	const saveSubmissionSQL = `
-		INSERT INTO form_submissions (uuid, form_id, first_name, last_name, email, tel, tags, subject, message, data, ip_address, user_agent, created_at)
-		VALUES (?, (SELECT id FROM forms WHERE uuid = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		INSERT INTO form_submissions (uuid, form_id, first_name, last_name, email, tel, tags, subject, message, data, ip_address, user_agent, created_at, idempotency_key, request_hash)
+		VALUES (?, (SELECT id FROM forms WHERE uuid = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	// Since we can't use JSON, serialize remaining submission data as key-value pairs
 	dataStr := ""
@@ -725,7 +975,7 @@ func (f *FormApi) saveSubmission(db *sql.DB, submission FormSubmission) error {
 		dataStr += key + ":" + value
 	}
 
-	_, err := db.Exec(saveSubmissionSQL,
+	_, err := tx.Exec(saveSubmissionSQL,
 		submission.ID,
 		submission.FormID,
 		submission.FirstName,
@@ -739,6 +989,8 @@ func (f *FormApi) saveSubmission(db *sql.DB, submission FormSubmission) error {
 		submission.IPAddress,
 		submission.UserAgent,
 		submission.CreatedAt,
+		sql.NullString{String: submission.IdempotencyKey, Valid: submission.IdempotencyKey != ""},
+		sql.NullString{String: submission.RequestHash, Valid: submission.IdempotencyKey != ""},
 	)
 
 	if err != nil {
@@ -755,7 +1007,8 @@ func (f *FormApi) getSubmissionsByField(db *sql.DB, siteID, field, value string)
 	switch field {
 	case FieldEmail:
 		query = `
-			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at
+			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+			       fs.status, fs.assigned_to, fs.read_at
 			FROM form_submissions fs
 			JOIN forms f ON fs.form_id = f.id
 			WHERE fs.email = ?
@@ -763,7 +1016,8 @@ func (f *FormApi) getSubmissionsByField(db *sql.DB, siteID, field, value string)
 		args = []interface{}{value}
 	case FieldName:
 		query = `
-			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at
+			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+			       fs.status, fs.assigned_to, fs.read_at
 			FROM form_submissions fs
 			JOIN forms f ON fs.form_id = f.id
 			WHERE fs.first_name = ? OR fs.last_name = ?
@@ -771,7 +1025,8 @@ func (f *FormApi) getSubmissionsByField(db *sql.DB, siteID, field, value string)
 		args = []interface{}{value, value}
 	case FieldPhone:
 		query = `
-			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at
+			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+			       fs.status, fs.assigned_to, fs.read_at
 			FROM form_submissions fs
 			JOIN forms f ON fs.form_id = f.id
 			WHERE fs.tel = ?
@@ -779,7 +1034,8 @@ func (f *FormApi) getSubmissionsByField(db *sql.DB, siteID, field, value string)
 		args = []interface{}{value}
 	case FieldTags:
 		query = `
-			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at
+			SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+			       fs.status, fs.assigned_to, fs.read_at
 			FROM form_submissions fs
 			JOIN forms f ON fs.form_id = f.id
 			WHERE fs.tags LIKE ?
@@ -797,44 +1053,10 @@ func (f *FormApi) getSubmissionsByField(db *sql.DB, siteID, field, value string)
 
 	var submissions []FormSubmission
 	for rows.Next() {
-		var submission FormSubmission
-		var dataStr string
-
-		err := rows.Scan(
-			&submission.ID,
-			&submission.FormID,
-			&submission.FirstName,
-			&submission.LastName,
-			&submission.Email,
-			&submission.Tel,
-			&submission.Tags,
-			&submission.Subject,
-			&submission.Message,
-			&dataStr,
-			&submission.IPAddress,
-			&submission.UserAgent,
-			&submission.CreatedAt,
-		)
+		submission, err := scanInboxSubmission(rows, siteID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan submission row: %w", err)
+			return nil, err
 		}
-
-		submission.SiteDomain = siteID
-		submission.Data = make(map[string]string)
-
-		// Parse additional data from string format
-		if dataStr != "" {
-			pairs := strings.Split(dataStr, "|")
-			for _, pair := range pairs {
-				if strings.Contains(pair, ":") {
-					parts := strings.SplitN(pair, ":", 2)
-					if len(parts) == 2 {
-						submission.Data[parts[0]] = parts[1]
-					}
-				}
-			}
-		}
-
 		submissions = append(submissions, submission)
 	}
 
@@ -847,7 +1069,8 @@ func (f *FormApi) getSubmissionsByField(db *sql.DB, siteID, field, value string)
 
 func (f *FormApi) getFormSubmissions(db *sql.DB, siteID, formID string) ([]FormSubmission, error) {
 	const getFormSubmissionsSQL = `
-		SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at
+		SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+			       fs.status, fs.assigned_to, fs.read_at
 		FROM form_submissions fs
 		JOIN forms f ON fs.form_id = f.id
 		WHERE f.uuid = ?
@@ -861,44 +1084,10 @@ func (f *FormApi) getFormSubmissions(db *sql.DB, siteID, formID string) ([]FormS
 
 	var submissions []FormSubmission
 	for rows.Next() {
-		var submission FormSubmission
-		var dataStr string
-
-		err := rows.Scan(
-			&submission.ID,
-			&submission.FormID,
-			&submission.FirstName,
-			&submission.LastName,
-			&submission.Email,
-			&submission.Tel,
-			&submission.Tags,
-			&submission.Subject,
-			&submission.Message,
-			&dataStr,
-			&submission.IPAddress,
-			&submission.UserAgent,
-			&submission.CreatedAt,
-		)
+		submission, err := scanInboxSubmission(rows, siteID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan submission row: %w", err)
-		}
-
-		submission.SiteDomain = siteID
-		submission.Data = make(map[string]string)
-
-		// Parse additional data from string format
-		if dataStr != "" {
-			pairs := strings.Split(dataStr, "|")
-			for _, pair := range pairs {
-				if strings.Contains(pair, ":") {
-					parts := strings.SplitN(pair, ":", 2)
-					if len(parts) == 2 {
-						submission.Data[parts[0]] = parts[1]
-					}
-				}
-			}
+			return nil, err
 		}
-
 		submissions = append(submissions, submission)
 	}
 
@@ -909,9 +1098,88 @@ func (f *FormApi) getFormSubmissions(db *sql.DB, siteID, formID string) ([]FormS
 	return submissions, nil
 }
 
+// parseSubmissionData parses the "key:value|key:value" format used for extra submission data
+func parseSubmissionData(dataStr string) map[string]string {
+	data := make(map[string]string)
+	if dataStr == "" {
+		return data
+	}
+	for _, pair := range strings.Split(dataStr, "|") {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) == 2 {
+			data[parts[0]] = parts[1]
+		}
+	}
+	return data
+}
+
 func validatePhoneNumber(phone string) error {
 	if len(phone) < 5 || len(phone) > 20 {
 		return common.NewError("phone: invalid length")
 	}
 	return nil
 }
+
+// parseFormFields decodes the stored field definitions of a form.
+// Older rows stored fields as "name:type:label[:required]|..." and are still understood.
+func parseFormFields(fieldsData string) ([]FormField, error) {
+	fields := []FormField{}
+	fieldsData = strings.TrimSpace(fieldsData)
+	if fieldsData == "" {
+		return fields, nil
+	}
+
+	if strings.HasPrefix(fieldsData, "[") {
+		if err := json.Unmarshal([]byte(fieldsData), &fields); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, def := range strings.Split(fieldsData, "|") {
+			parts := strings.Split(def, ":")
+			if len(parts) < 3 {
+				continue
+			}
+			fields = append(fields, FormField{
+				Name:     parts[0],
+				Type:     parts[1],
+				Label:    parts[2],
+				Required: len(parts) > 3 && parts[3] == "required",
+			})
+		}
+	}
+
+	// Fields without a name are keyed by their type, e.g. the example email form
+	for i := range fields {
+		if fields[i].Name == "" {
+			fields[i].Name = fields[i].Type
+		}
+	}
+
+	return fields, nil
+}
+
+// parseFormSettings decodes the stored form settings into metadata and the redirect URL
+func parseFormSettings(settingsData string) (map[string]any, string) {
+	metadata := make(map[string]any)
+	settingsData = strings.TrimSpace(settingsData)
+	if settingsData == "" {
+		return metadata, ""
+	}
+
+	if !strings.HasPrefix(settingsData, "{") {
+		// Legacy "redirect_url:<url>" settings
+		if redirectURL, ok := strings.CutPrefix(settingsData, "redirect_url:"); ok {
+			return metadata, redirectURL
+		}
+		return metadata, ""
+	}
+
+	if err := json.Unmarshal([]byte(settingsData), &metadata); err != nil {
+		common.Warning("Failed to parse form settings: %v", err)
+		return make(map[string]any), ""
+	}
+
+	redirectURL, _ := metadata["redirect_url"].(string)
+	delete(metadata, "redirect_url")
+	return metadata, redirectURL
+}
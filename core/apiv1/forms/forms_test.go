@@ -0,0 +1,660 @@
+package forms
+
+import (
+	"bytes"
+	"database/sql"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"wispy-core/common"
+	"wispy-core/core/site"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestParseFormFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantNames  []string
+		wantOption string
+		wantErr    bool
+	}{
+		{
+			name:      "Empty fields",
+			data:      "",
+			wantNames: []string{},
+		},
+		{
+			name:      "JSON field without name uses type",
+			data:      `[{"type": "email", "label": "Email Address", "required": true}]`,
+			wantNames: []string{"email"},
+		},
+		{
+			name:       "JSON options as plain strings",
+			data:       `[{"name": "rating", "type": "select", "options": ["Good", "Bad"]}]`,
+			wantNames:  []string{"rating"},
+			wantOption: "Good",
+		},
+		{
+			name:       "JSON options as objects",
+			data:       `[{"name": "plan", "type": "radio", "options": [{"value": "pro", "label": "Pro"}]}]`,
+			wantNames:  []string{"plan"},
+			wantOption: "pro",
+		},
+		{
+			name:      "Legacy pipe format",
+			data:      "email:email:Email:required|resume:file:Resume",
+			wantNames: []string{"email", "resume"},
+		},
+		{
+			name:    "Invalid JSON",
+			data:    `[{"name": }]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := parseFormFields(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFormFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(fields) != len(tt.wantNames) {
+				t.Fatalf("parseFormFields() returned %d fields, want %d", len(fields), len(tt.wantNames))
+			}
+			for i, name := range tt.wantNames {
+				if fields[i].Name != name {
+					t.Errorf("field %d name = %q, want %q", i, fields[i].Name, name)
+				}
+			}
+			if tt.wantOption != "" && (len(fields[0].Options) == 0 || fields[0].Options[0].Value != tt.wantOption) {
+				t.Errorf("first option = %+v, want value %q", fields[0].Options, tt.wantOption)
+			}
+		})
+	}
+}
+
+func TestIsAllowedContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		allowed     []string
+		want        bool
+	}{
+		{"No restrictions", "application/zip", nil, true},
+		{"Exact match", "application/pdf", []string{"application/pdf"}, true},
+		{"Wildcard match", "image/png", []string{"image/*"}, true},
+		{"Wildcard mismatch", "text/plain", []string{"image/*"}, false},
+		{"Not in list", "application/zip", []string{"application/pdf", "image/*"}, false},
+		{"Case insensitive list", "image/jpeg", []string{" Image/JPEG "}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAllowedContentType(tt.contentType, tt.allowed); got != tt.want {
+				t.Errorf("isAllowedContentType(%q, %v) = %v, want %v", tt.contentType, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAndNormalizeSubmission(t *testing.T) {
+	min, max := 1.0, 10.0
+	form := Form{
+		Fields: []FormField{
+			{Name: "email", Type: "email", Required: true},
+			{Name: "email_confirm", Type: "email", Matches: "email"},
+			{Name: "nickname", Type: "text", MinLength: 2, MaxLength: 5},
+			{Name: "quantity", Type: "number", Min: &min, Max: &max},
+			{Name: "code", Type: "text", Pattern: "[A-Z]{3}"},
+			{Name: "website", Type: "url"},
+			{Name: "start", Type: "date"},
+			{Name: "plan", Type: "select", Options: []FormFieldOption{{Value: "free"}, {Value: "pro"}}},
+		},
+	}
+	api := newTestFormApi()
+
+	tests := []struct {
+		name       string
+		values     url.Values
+		wantFields []string
+	}{
+		{
+			name:   "Valid submission",
+			values: url.Values{"email": {"a@example.com"}, "email_confirm": {"a@example.com"}, "nickname": {"bob"}, "quantity": {"3"}, "code": {"ABC"}, "website": {"https://example.com"}, "start": {"2024-01-31"}, "plan": {"pro"}},
+		},
+		{
+			name:       "Missing required field",
+			values:     url.Values{"nickname": {"bob"}},
+			wantFields: []string{"email"},
+		},
+		{
+			name:       "Confirmation mismatch",
+			values:     url.Values{"email": {"a@example.com"}, "email_confirm": {"b@example.com"}},
+			wantFields: []string{"email_confirm"},
+		},
+		{
+			name:       "Rule violations",
+			values:     url.Values{"email": {"a@example.com"}, "nickname": {"a"}, "quantity": {"11"}, "code": {"ABCD"}, "website": {"ftp://x"}, "start": {"31/01/2024"}, "plan": {"enterprise"}},
+			wantFields: []string{"nickname", "quantity", "code", "website", "start", "plan"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, errs := api.validateAndNormalizeSubmission(tt.values, form)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("got errors %v, want errors for %v", errs, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if len(errs[field]) == 0 {
+					t.Errorf("expected an error for field %q, got %v", field, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestConditionalSubmission(t *testing.T) {
+	form := Form{
+		Steps: []FormStep{
+			{Title: "About you"},
+			{Title: "Project", ShowIf: &FieldCondition{Field: "kind", Value: "business"}},
+		},
+		Fields: []FormField{
+			{Name: "email", Type: "email", Required: true},
+			{Name: "kind", Type: "radio", Required: true, Options: []FormFieldOption{{Value: "personal"}, {Value: "business"}}},
+			{Name: "company", Type: "text", Required: true, ShowIf: &FieldCondition{Field: "kind", Value: "business"}},
+			{Name: "budget", Type: "select", Step: 2, Required: true, Options: []FormFieldOption{{Value: "small"}, {Value: "large"}}},
+			{Name: "timeline", Type: "text", Step: 2, Required: true, ShowIf: &FieldCondition{Field: "budget", Op: OpIn, Values: []string{"large"}}},
+		},
+	}
+	api := newTestFormApi()
+
+	tests := []struct {
+		name       string
+		values     url.Values
+		wantFields []string
+		wantStored []string
+	}{
+		{
+			name:       "Skipped step and hidden field are not required",
+			values:     url.Values{"email": {"a@example.com"}, "kind": {"personal"}},
+			wantStored: []string{"kind"},
+		},
+		{
+			name:       "Values of hidden fields are dropped",
+			values:     url.Values{"email": {"a@example.com"}, "kind": {"personal"}, "company": {"Acme"}, "budget": {"large"}, "timeline": {"soon"}},
+			wantStored: []string{"kind"},
+		},
+		{
+			name:       "Shown fields are required",
+			values:     url.Values{"email": {"a@example.com"}, "kind": {"business"}},
+			wantFields: []string{"company", "budget"},
+		},
+		{
+			name:       "Nested condition",
+			values:     url.Values{"email": {"a@example.com"}, "kind": {"business"}, "company": {"Acme"}, "budget": {"large"}},
+			wantFields: []string{"timeline"},
+		},
+		{
+			name:       "Complete branch",
+			values:     url.Values{"email": {"a@example.com"}, "kind": {"business"}, "company": {"Acme"}, "budget": {"large"}, "timeline": {"soon"}},
+			wantStored: []string{"kind", "company", "budget", "timeline"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _, errs := api.validateAndNormalizeSubmission(tt.values, form)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("got errors %v, want errors for %v", errs, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if len(errs[field]) == 0 {
+					t.Errorf("expected an error for field %q, got %v", field, errs)
+				}
+			}
+			if len(tt.wantFields) > 0 {
+				return
+			}
+			if len(data) != len(tt.wantStored) {
+				t.Fatalf("stored %v, want %v", data, tt.wantStored)
+			}
+			for _, field := range tt.wantStored {
+				if _, ok := data[field]; !ok {
+					t.Errorf("expected %q to be stored, got %v", field, data)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFormLogic(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    Form
+		wantErr bool
+	}{
+		{
+			name: "Condition on an earlier field",
+			form: Form{Fields: []FormField{
+				{Name: "kind", Type: "text"},
+				{Name: "company", Type: "text", ShowIf: &FieldCondition{Field: "kind", Op: OpFilled}},
+			}},
+		},
+		{
+			name: "Condition on a later field",
+			form: Form{Fields: []FormField{
+				{Name: "company", Type: "text", ShowIf: &FieldCondition{Field: "kind", Op: OpFilled}},
+				{Name: "kind", Type: "text"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "Condition on a field of a later step",
+			form: Form{Fields: []FormField{
+				{Name: "kind", Type: "text", Step: 2},
+				{Name: "company", Type: "text", ShowIf: &FieldCondition{Field: "kind", Op: OpFilled}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown field",
+			form:    Form{Fields: []FormField{{Name: "company", Type: "text", ShowIf: &FieldCondition{Field: "kind"}}}},
+			wantErr: true,
+		},
+		{
+			name: "Unknown operator",
+			form: Form{Fields: []FormField{
+				{Name: "kind", Type: "text"},
+				{Name: "company", Type: "text", ShowIf: &FieldCondition{Field: "kind", Op: "contains"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "Step condition on its own field",
+			form: Form{
+				Steps:  []FormStep{{Title: "One"}, {Title: "Two", ShowIf: &FieldCondition{Field: "budget", Op: OpFilled}}},
+				Fields: []FormField{{Name: "budget", Type: "text", Step: 2}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFormLogic(tt.form)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateFormLogic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseJSONSubmission(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    url.Values
+		wantErr bool
+	}{
+		{
+			name: "Flat object",
+			body: `{"form_id": "contact", "email": "a@example.com", "quantity": 3, "newsletter": true, "phone": null, "terms": false}`,
+			want: url.Values{"__form_id__": {"contact"}, "email": {"a@example.com"}, "quantity": {"3"}, "newsletter": {"1"}},
+		},
+		{
+			name: "Lists",
+			body: `{"interests": ["a", "b", ""]}`,
+			want: url.Values{"interests": {"a", "b"}},
+		},
+		{name: "Nested object", body: `{"address": {"city": "Paris"}}`, wantErr: true},
+		{name: "Not an object", body: `["a"]`, wantErr: true},
+		{name: "Trailing data", body: `{"a": "b"} {"c": "d"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/forms/submit", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			err := parseJSONSubmission(httptest.NewRecorder(), r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONSubmission() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && r.Form.Encode() != tt.want.Encode() {
+				t.Errorf("parseJSONSubmission() = %v, want %v", r.Form, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"https://app.example.com", []string{"https://app.example.com"}, true},
+		{"https://APP.example.com", []string{"https://app.example.com/"}, true},
+		{"https://evil.example.com", []string{"https://app.example.com"}, false},
+		{"https://app.example.com", nil, false},
+		{"https://anything.test", []string{"*"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := originAllowed(tt.origin, tt.allowed); got != tt.want {
+			t.Errorf("originAllowed(%q, %v) = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestHashSubmissionRequest(t *testing.T) {
+	base := url.Values{"__form_id__": {"contact"}, "__csrf__": {"1.abc"}, "email": {"a@example.com"}}
+	retry := url.Values{"__form_id__": {"contact"}, "__csrf__": {"2.def"}, "email": {"a@example.com"}}
+	changed := url.Values{"__form_id__": {"contact"}, "email": {"b@example.com"}}
+
+	if hashSubmissionRequest(base, nil) != hashSubmissionRequest(retry, nil) {
+		t.Error("expected a retry with a fresh form token to hash the same")
+	}
+	if hashSubmissionRequest(base, nil) == hashSubmissionRequest(changed, nil) {
+		t.Error("expected different values to hash differently")
+	}
+}
+
+// newTestFormApi returns a FormApi without site or auth dependencies
+func newTestFormApi() *FormApi {
+	return &FormApi{validate: validator.New()}
+}
+
+func TestVerifyFormToken(t *testing.T) {
+	form := Form{ID: "form-1", Metadata: map[string]any{}}
+	strict := Form{ID: "form-1", Metadata: map[string]any{"require_token": true}}
+	expires, signature := common.SignExpiring("form-1", time.Now().Add(time.Hour))
+	valid := expires + "." + signature
+	otherExpires, otherSignature := common.SignExpiring("form-2", time.Now().Add(time.Hour))
+	expiredExpires, expiredSignature := common.SignExpiring("form-1", time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name     string
+		form     Form
+		honeypot string
+		token    string
+		wantErr  bool
+	}{
+		{"Valid token", form, "", valid, false},
+		{"No token on optional form", form, "", "", false},
+		{"No token on strict form", strict, "", "", true},
+		{"Honeypot filled", form, "http://spam.example", valid, true},
+		{"Token for another form", form, "", otherExpires + "." + otherSignature, true},
+		{"Expired token", form, "", expiredExpires + "." + expiredSignature, true},
+		{"Malformed token", form, "", "not-a-token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyFormToken(tt.form, tt.honeypot, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyFormToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{"Empty", "", []string{}},
+		{"Trims and drops blanks", " lead , ,follow-up ", []string{"lead", "follow-up"}},
+		{"Case insensitive duplicates", "Lead, lead, VIP", []string{"Lead", "VIP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeTags(tt.raw)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || len(got) != len(tt.want) {
+				t.Errorf("normalizeTags(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFtsMatchExpression(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "Single word", query: "roofing", want: `"roofing"`},
+		{name: "Words are ANDed", query: "leaking  pipe", want: `"leaking" "pipe"`},
+		{name: "Prefix", query: "roof*", want: `"roof"*`},
+		{name: "Phrase", query: `"leaking pipe"`, want: `"leaking pipe"`},
+		{name: "OR between terms", query: "roofing OR plumbing", want: `"roofing" OR "plumbing"`},
+		{name: "Dangling OR is dropped", query: "OR roofing OR", want: `"roofing"`},
+		{name: "Lowercase or is a word", query: "this or that", want: `"this" "or" "that"`},
+		{name: "FTS syntax is quoted", query: `name:jane NEAR(a b) -x`, want: `"name:jane" "NEAR(a" "b)" "-x"`},
+		{name: "Unterminated phrase", query: `jane "leaking pipe`, want: `"jane" "leaking pipe"`},
+		{name: "Only operators", query: "OR * \"\"", want: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ftsMatchExpression(parseSearchTerms(tt.query)); got != tt.want {
+				t.Errorf("ftsMatchExpression(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkNeedles(t *testing.T) {
+	got := markNeedles(`Quote for <b>Roofing</b>`, []string{"roof", "quote"})
+	want := `<mark>Quote</mark> for &lt;b&gt;<mark>Roof</mark>ing&lt;/b&gt;`
+	if got != want {
+		t.Errorf("markNeedles() = %q, want %q", got, want)
+	}
+}
+
+// multipartFiles returns the file headers of a multipart form with files of field
+func multipartFiles(t *testing.T, field string, files map[string]string) map[string][]*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, err := mw.CreateFormFile(field, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	mw.Close()
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File
+}
+
+func TestSaveSubmissionWithFiles(t *testing.T) {
+	dbManager := site.NewDatabaseManagerInDir("example.com", t.TempDir())
+	t.Cleanup(func() { dbManager.Close() })
+	db, err := dbManager.GetOrCreateConnection(formsDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO forms (uuid, name, title, fields) VALUES ('form-1', 'apply', 'Apply', '[]')`); err != nil {
+		t.Fatal(err)
+	}
+	f := newTestFormApi()
+	submission := FormSubmission{ID: "sub-1", FormID: "form-1", Email: "jane@example.com", Data: map[string]string{"cv": "cv.pdf"}, CreatedAt: time.Now()}
+	uploads := multipartFiles(t, "cv", map[string]string{"cv.pdf": "%PDF-1.4"})
+	countRows := func(table string) int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// Storage that cannot be written to keeps neither the submission nor its files
+	blocked := filepath.Join(t.TempDir(), "uploads")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.saveSubmissionWithFiles(db, submission, uploads, blocked); err == nil {
+		t.Fatal("expected storing the files to fail")
+	}
+	if n := countRows("form_submissions"); n != 0 {
+		t.Errorf("%d submissions saved after the files failed, want none", n)
+	}
+
+	// A retry saves the submission once, with its file
+	uploadsDir := t.TempDir()
+	if err := f.saveSubmissionWithFiles(db, submission, uploads, uploadsDir); err != nil {
+		t.Fatal(err)
+	}
+	if n, files := countRows("form_submissions"), countRows("form_submission_files"); n != 1 || files != 1 {
+		t.Errorf("saved %d submissions and %d files, want 1 and 1", n, files)
+	}
+	stored, err := getSubmissionFiles(db, "sub-1")
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("getSubmissionFiles() = %v, %v", stored, err)
+	}
+	if content, err := os.ReadFile(filepath.Join(uploadsDir, stored[0].StoredPath)); err != nil || string(content) != "%PDF-1.4" {
+		t.Errorf("stored file = %q, %v", content, err)
+	}
+}
+
+// newSearchDB returns a forms database of the site's database manager, with its
+// search index when the driver has FTS5, holding a few submissions
+func newSearchDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbManager := site.NewDatabaseManagerInDir("example.com", t.TempDir())
+	t.Cleanup(func() { dbManager.Close() })
+	db, err := dbManager.GetOrCreateConnection(formsDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO forms (id, uuid, name, title, fields) VALUES (101, 'form-contact', 'contact', 'Contact', '[]'), (102, 'form-order', 'order', 'Order', '[]');
+		INSERT INTO form_submissions (uuid, form_id, first_name, last_name, email, subject, message, data, ip_address, user_agent, created_at) VALUES
+			('sub-jane', 101, 'Jane', 'Doe', 'jane@example.com', 'Late delivery', 'My parcel never arrived', 'company:Acme', '', '', '2026-01-01 10:00:00'),
+			('sub-bob', 101, 'Bob', NULL, 'bob@example.com', 'Question', 'Is the café open on Sundays? Delivery is fine.', '', '', '', '2026-01-02 10:00:00'),
+			('sub-ann', 102, 'Ann', NULL, 'ann@example.com', 'New order', 'Please deliver it late', 'company:Initech', '', '', '2026-01-03 10:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// resultIDs returns the ids of search results, sorted
+func resultIDs(results SearchResults) []string {
+	ids := make([]string, 0, len(results.Results))
+	for _, result := range results.Results {
+		ids = append(ids, result.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TestFindSubmissions covers what both search engines do alike; the FTS5 engine
+// is tested further with -tags sqlite_fts5
+func TestFindSubmissions(t *testing.T) {
+	db := newSearchDB(t)
+	tests := []struct {
+		query  string
+		filter InboxFilter
+		want   []string
+	}{
+		{query: "acme", want: []string{"sub-jane"}},
+		{query: "delivery", want: []string{"sub-bob", "sub-jane"}},
+		{query: `"late delivery"`, want: []string{"sub-jane"}},
+		{query: "jane OR initech", want: []string{"sub-ann", "sub-jane"}},
+		{query: "delivery", filter: InboxFilter{FormID: "order"}, want: []string{}},
+		{query: "nothing-like-this", want: []string{}},
+	}
+	for _, tt := range tests {
+		results, err := FindSubmissions(db, "example.com", tt.query, tt.filter)
+		if err != nil {
+			t.Fatalf("FindSubmissions(%s) error = %v", tt.query, err)
+		}
+		if got := resultIDs(results); !slices.Equal(got, tt.want) {
+			t.Errorf("FindSubmissions(%s) with %s = %v, want %v", tt.query, results.Engine, got, tt.want)
+		}
+	}
+
+	results, err := FindSubmissions(db, "example.com", "acme", InboxFilter{})
+	if err != nil || len(results.Results) != 1 {
+		t.Fatalf("FindSubmissions(acme) = %v, %v", results, err)
+	}
+	if result := results.Results[0]; !strings.Contains(strings.ToLower(result.Snippet), "<mark>acme</mark>") || result.FormName != "contact" {
+		t.Errorf("result = snippet %q, form %q, want acme marked in contact", result.Snippet, result.FormName)
+	}
+}
+
+func TestListInboxSubmissionsTag(t *testing.T) {
+	db := newSearchDB(t)
+	if _, err := db.Exec(`UPDATE form_submissions SET tags = CASE uuid
+		WHEN 'sub-jane' THEN 'vip_a, urgent' WHEN 'sub-bob' THEN 'vipxa' ELSE '50%' END`); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{"vip_a", []string{"sub-jane"}},
+		{"urgent", []string{"sub-jane"}},
+		{"50%", []string{"sub-ann"}},
+		{"%", []string{}},
+		{"vip", []string{}},
+	}
+	for _, tt := range tests {
+		submissions, err := listInboxSubmissions(db, "example.com", InboxFilter{Status: "all", Tag: tt.tag})
+		if err != nil {
+			t.Fatalf("tag %s: %v", tt.tag, err)
+		}
+		got := []string{}
+		for _, submission := range submissions {
+			got = append(got, submission.ID)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("tag %s = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestSubmittedValuesTruncation(t *testing.T) {
+	long := strings.Repeat("a", maxFlashValueLength-1) + "é and more"
+	values := submittedValues(url.Values{
+		"message":   {long},
+		"name":      {"Zoë"},
+		"__token__": {"x"},
+	}, Form{})
+	if got := values["message"]; got != strings.Repeat("a", maxFlashValueLength-1) || !utf8.ValidString(got) {
+		t.Errorf("message = %q (%d bytes), want it cut before é", got, len(got))
+	}
+	if got := values["name"]; got != "Zoë" {
+		t.Errorf("name = %q, want Zoë", got)
+	}
+	if _, ok := values["__token__"]; ok {
+		t.Error("control field __token__ was kept")
+	}
+}
@@ -0,0 +1,318 @@
+package forms
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wispy-core/common"
+	"wispy-core/core/site"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// maxJSONBodySize limits JSON submissions, which cannot carry files
+	maxJSONBodySize = 1 << 20
+	// idempotencyHeader lets clients retry a submission without creating duplicates
+	idempotencyHeader       = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+	// corsMaxAge is how long browsers may cache a preflight response, in seconds
+	corsMaxAge = 600
+)
+
+// isJSONRequest reports whether the request body is JSON
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// wantsJSONResponse reports whether a submission should be answered with JSON
+// rather than a redirect: the client either sent JSON or asked for it
+func wantsJSONResponse(r *http.Request) bool {
+	return isJSONRequest(r) || common.WantsJSON(r)
+}
+
+// parseJSONSubmission decodes a flat JSON object into the request's form values,
+// e.g. {"form_id": "contact", "email": "a@example.com", "interests": ["a", "b"]}.
+// Numbers and true are stored as text, false and null are treated as empty.
+func parseJSONSubmission(w http.ResponseWriter, r *http.Request) error {
+	body := http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return common.NewError("invalid JSON body: unexpected data after the object")
+	}
+
+	values := make(url.Values, len(raw))
+	for name, value := range raw {
+		if name == "form_id" {
+			name = "__form_id__"
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, item := range list {
+			text, ok := jsonScalar(item)
+			if !ok {
+				return common.NewErrorf("field '%s' must be a string, number, boolean or a list of those", name)
+			}
+			if text != "" {
+				values.Add(name, text)
+			}
+		}
+	}
+
+	// Keep query parameters available like ParseForm does
+	for name, vals := range r.URL.Query() {
+		if _, exists := values[name]; !exists {
+			values[name] = vals
+		}
+	}
+
+	r.Form = values
+	r.PostForm = values
+	return nil
+}
+
+func jsonScalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+// respondWithSubmissionError answers JSON clients with {"success": false, "message": ...}
+// and everyone else with the usual plain text error
+func respondWithSubmissionError(w http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	if !wantsJSONResponse(r) {
+		common.RespondWithError(w, r, status, message, err)
+		return
+	}
+
+	if err != nil && status >= http.StatusInternalServerError {
+		common.Error("%s: %v", message, err)
+	}
+	response := map[string]interface{}{
+		"success": false,
+		"message": message,
+	}
+	if err != nil && common.ShouldIncludeDebugInfo(r) {
+		response["debug"] = err.Error()
+	}
+	common.RespondWithJSON(w, status, response)
+}
+
+// allowedOrigins returns the origins that may submit forms from another site:
+// cors_origins in the [forms] table of the site's config.toml, plus the
+// cors_origins setting of the form when there is one
+func allowedOrigins(s site.Site, form *Form) []string {
+	var origins []string
+	if formsConfig, ok := s.GetConfig()["forms"].(map[string]interface{}); ok {
+		origins = append(origins, stringList(formsConfig["cors_origins"])...)
+	}
+	if form != nil {
+		origins = append(origins, stringList(form.Metadata["cors_origins"])...)
+	}
+	return origins
+}
+
+// stringList reads a string or list of strings from decoded TOML or JSON
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// originAllowed matches an Origin header against the allowed origins, "*" allows any
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+	for _, a := range allowed {
+		a = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(a)), "/")
+		if a == "*" || a == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// allowCORS sets the CORS headers for a cross-origin submission when its origin is
+// allowed. Responses never allow credentials, headless clients do not need cookies.
+func allowCORS(w http.ResponseWriter, r *http.Request, s site.Site, form *Form) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !originAllowed(origin, allowedOrigins(s, form)) {
+		return false
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", "Origin")
+	header.Set("Access-Control-Expose-Headers", "Idempotent-Replayed")
+	return true
+}
+
+// SubmissionPreflight answers CORS preflight requests for form submissions.
+// Form specific origins apply on /forms/{formID}/submit.
+func (f *FormApi) SubmissionPreflight(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	var form *Form
+	if formID := submissionFormID(r); formID != "" {
+		db, err := f.getDBConnection(site)
+		if err != nil {
+			common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		if found, err := getForm(db, formID, site.GetDomain()); err == nil {
+			form = &found
+		}
+	}
+
+	if !allowCORS(w, r, site, form) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", "Content-Type, Accept, "+idempotencyHeader+", X-Requested-With")
+	header.Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// idempotencyKey returns the client supplied key of a submission, if any
+func idempotencyKey(r *http.Request) (string, error) {
+	key := strings.TrimSpace(r.Header.Get(idempotencyHeader))
+	if len(key) > maxIdempotencyKeyLength {
+		return "", common.NewErrorf("%s must be at most %d characters", idempotencyHeader, maxIdempotencyKeyLength)
+	}
+	return key, nil
+}
+
+// hashSubmissionRequest fingerprints the submitted values so a reused idempotency
+// key with a different payload can be told apart from a retry. Control fields
+// such as the form token are left out since a retry may carry a fresh one.
+func hashSubmissionRequest(formData url.Values, multipartForm *multipart.Form) string {
+	names := make([]string, 0, len(formData))
+	for name := range formData {
+		if !(strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		for _, value := range formData[name] {
+			fmt.Fprintf(hash, "%q=%q\n", name, value)
+		}
+	}
+
+	if multipartForm != nil {
+		fileFields := make([]string, 0, len(multipartForm.File))
+		for name := range multipartForm.File {
+			fileFields = append(fileFields, name)
+		}
+		sort.Strings(fileFields)
+		for _, name := range fileFields {
+			for _, file := range multipartForm.File[name] {
+				fmt.Fprintf(hash, "file %q=%q:%d\n", name, file.Filename, file.Size)
+			}
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// findIdempotentSubmission returns the uuid and request hash of the submission
+// made earlier with the same idempotency key
+func findIdempotentSubmission(db *sql.DB, formID, key string) (string, string, error) {
+	var submissionID, requestHash string
+	err := db.QueryRow(`
+		SELECT s.uuid, COALESCE(s.request_hash, '')
+		FROM form_submissions s
+		JOIN forms f ON s.form_id = f.id
+		WHERE f.uuid = ? AND s.idempotency_key = ?`, formID, key).Scan(&submissionID, &requestHash)
+	if err != nil {
+		return "", "", err
+	}
+	return submissionID, requestHash, nil
+}
+
+// replaySubmission answers a retried submission with the result of the first one,
+// or rejects the key when it was used for a different payload
+func replaySubmission(w http.ResponseWriter, r *http.Request, submissionID, storedHash, requestHash string) {
+	if storedHash != requestHash {
+		respondWithSubmissionError(w, r, http.StatusUnprocessableEntity,
+			idempotencyHeader+" was already used for a different submission", nil)
+		return
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	if wantsJSONResponse(r) {
+		common.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"message":       "Form submitted successfully",
+			"submission_id": submissionID,
+			"replayed":      true,
+		})
+		return
+	}
+	common.RespondWithPlainText(w, http.StatusOK, "Form submitted successfully")
+}
+
+// submissionFormID returns the form a submission or preflight is for: the
+// {formID} route parameter, then the __form_id__ value
+func submissionFormID(r *http.Request) string {
+	if formID := chi.URLParam(r, "formID"); formID != "" {
+		return formID
+	}
+	if r.Method == http.MethodOptions {
+		return r.URL.Query().Get("form")
+	}
+	return r.FormValue("__form_id__")
+}
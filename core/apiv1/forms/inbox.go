@@ -0,0 +1,811 @@
+package forms
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"wispy-core/auth"
+	"wispy-core/common"
+	"wispy-core/config"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Submission inbox states
+const (
+	StatusNew      = "new"
+	StatusRead     = "read"
+	StatusReplied  = "replied"
+	StatusArchived = "archived"
+	StatusSpam     = "spam"
+)
+
+// Bulk actions accepted by BulkUpdateSubmissions
+const (
+	BulkMarkRead = "mark_read"
+	BulkArchive  = "archive"
+	BulkSpam     = "spam"
+	BulkDelete   = "delete"
+	BulkTag      = "tag"
+	BulkStatus   = "status"
+)
+
+const (
+	defaultInboxLimit  = 50
+	maxInboxLimit      = 500
+	maxBulkSubmissions = 500
+	maxNoteLength      = 10000
+)
+
+// SubmissionNote is an internal note left on a submission by a CMS user
+type SubmissionNote struct {
+	ID           string    `json:"id" db:"uuid"`
+	SubmissionID string    `json:"submission_id" db:"submission_id"`
+	AuthorID     string    `json:"author_id" db:"author_id"`
+	AuthorName   string    `json:"author_name" db:"author_name"`
+	Body         string    `json:"body" db:"body"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// SubmissionDetail is a submission together with its notes and files
+type SubmissionDetail struct {
+	FormSubmission
+	Notes []SubmissionNote `json:"notes"`
+	Files []SubmissionFile `json:"files"`
+}
+
+// InboxFilter narrows down the submissions listed in the inbox
+type InboxFilter struct {
+	Status     string // a status, "unread" for new, "all", or empty for everything but archived and spam
+	FormID     string // form uuid or name
+	AssignedTo string // CMS user id
+	Tag        string
+	Since      time.Time // inclusive, zero for no lower bound
+	Until      time.Time // exclusive, zero for no upper bound
+	Limit      int
+	Offset     int
+}
+
+// where returns the SQL conditions for the filter, to append after "WHERE 1=1".
+// Submissions are aliased fs and forms f.
+func (filter InboxFilter) where() (string, []interface{}) {
+	var where strings.Builder
+	args := []interface{}{}
+
+	switch filter.Status {
+	case "":
+		where.WriteString(" AND fs.status NOT IN (?, ?)")
+		args = append(args, StatusArchived, StatusSpam)
+	case "all":
+	case "unread":
+		where.WriteString(" AND fs.status = ?")
+		args = append(args, StatusNew)
+	default:
+		where.WriteString(" AND fs.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.FormID != "" {
+		where.WriteString(" AND (f.uuid = ? OR f.name = ?)")
+		args = append(args, filter.FormID, filter.FormID)
+	}
+	if filter.AssignedTo != "" {
+		where.WriteString(" AND fs.assigned_to = ?")
+		args = append(args, filter.AssignedTo)
+	}
+	if filter.Tag != "" {
+		where.WriteString(" AND (',' || REPLACE(fs.tags, ', ', ',') || ',') LIKE ? ESCAPE '\\'")
+		args = append(args, "%,"+common.EscapeLike(filter.Tag)+",%")
+	}
+	if !filter.Since.IsZero() {
+		where.WriteString(" AND fs.created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where.WriteString(" AND fs.created_at < ?")
+		args = append(args, filter.Until)
+	}
+
+	return where.String(), args
+}
+
+// limit clamps the page size to the inbox bounds
+func (filter InboxFilter) limit() int {
+	if filter.Limit <= 0 {
+		return defaultInboxLimit
+	}
+	return min(filter.Limit, maxInboxLimit)
+}
+
+// IsSubmissionStatus reports whether status is a known inbox state
+func IsSubmissionStatus(status string) bool {
+	switch status {
+	case StatusNew, StatusRead, StatusReplied, StatusArchived, StatusSpam:
+		return true
+	}
+	return false
+}
+
+// ListSubmissions returns the inbox filtered by status, form, assignee and tag
+func (f *FormApi) ListSubmissions(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	filter, err := parseInboxFilter(r)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	submissions, err := listInboxSubmissions(db, site.GetDomain(), filter)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to list submissions", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, submissions)
+}
+
+// parseInboxFilter reads the inbox filter from the query string
+func parseInboxFilter(r *http.Request) (InboxFilter, error) {
+	query := r.URL.Query()
+	filter := InboxFilter{
+		Status:     query.Get("status"),
+		FormID:     query.Get("form"),
+		AssignedTo: query.Get("assigned_to"),
+		Tag:        query.Get("tag"),
+	}
+	if filter.Status != "" && filter.Status != "unread" && filter.Status != "all" && !IsSubmissionStatus(filter.Status) {
+		return InboxFilter{}, common.NewError("Invalid status " + filter.Status)
+	}
+	if filter.AssignedTo == "me" {
+		if user, err := auth.UserFromContext(r.Context()); err == nil {
+			filter.AssignedTo = user.ID
+		}
+	}
+	if from := query.Get("from"); from != "" {
+		since, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return InboxFilter{}, common.NewError("Invalid from date, expected YYYY-MM-DD")
+		}
+		filter.Since = since
+	}
+	if to := query.Get("to"); to != "" {
+		until, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return InboxFilter{}, common.NewError("Invalid to date, expected YYYY-MM-DD")
+		}
+		filter.Until = until.AddDate(0, 0, 1) // include the whole day
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil {
+		filter.Offset = offset
+	}
+	return filter, nil
+}
+
+// GetSubmission returns a submission with its notes and files and marks it as read
+func (f *FormApi) GetSubmission(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	submissionID := chi.URLParam(r, "submissionID")
+	submission, err := getSubmission(db, site.GetDomain(), submissionID)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Submission not found", err)
+		return
+	}
+
+	if submission.Status == StatusNew {
+		if err := setSubmissionStatus(db, []string{submission.ID}, StatusRead); err != nil {
+			common.Warning("Failed to mark submission %s as read: %v", submission.ID, err)
+		} else {
+			submission.Status = StatusRead
+		}
+	}
+
+	detail := SubmissionDetail{FormSubmission: submission}
+	if detail.Notes, err = getSubmissionNotes(db, submissionID); err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to get submission notes", err)
+		return
+	}
+	if detail.Files, err = getSubmissionFiles(db, submissionID); err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to get submission files", err)
+		return
+	}
+	for i := range detail.Files {
+		detail.Files[i].DownloadURL = SignedDownloadURL(detail.Files[i].ID)
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, detail)
+}
+
+// UpdateSubmissionStatus moves a submission to another inbox state
+func (f *FormApi) UpdateSubmissionStatus(w http.ResponseWriter, r *http.Request) {
+	f.withSubmission(w, r, func(db *sql.DB, submissionID string) (int, string, error) {
+		status := r.FormValue("status")
+		if !IsSubmissionStatus(status) {
+			return http.StatusBadRequest, "Invalid status " + status, nil
+		}
+		if err := setSubmissionStatus(db, []string{submissionID}, status); err != nil {
+			return http.StatusInternalServerError, "Failed to update status", err
+		}
+		return http.StatusOK, "Status updated", nil
+	})
+}
+
+// AssignSubmission assigns a submission to a CMS user, or unassigns it when assigned_to is empty
+func (f *FormApi) AssignSubmission(w http.ResponseWriter, r *http.Request) {
+	f.withSubmission(w, r, func(db *sql.DB, submissionID string) (int, string, error) {
+		assignee := r.FormValue("assigned_to")
+		if assignee == "me" {
+			user, err := auth.UserFromContext(r.Context())
+			if err != nil {
+				return http.StatusUnauthorized, "Unauthorized", err
+			}
+			assignee = user.ID
+		} else if assignee != "" {
+			if _, err := config.GetGlobalConfig().GetCoreAuth().GetUserStore().GetUserByID(r.Context(), assignee); err != nil {
+				return http.StatusBadRequest, "Unknown user " + assignee, err
+			}
+		}
+
+		if err := assignSubmission(db, submissionID, assignee); err != nil {
+			return http.StatusInternalServerError, "Failed to assign submission", err
+		}
+		return http.StatusOK, "Submission assigned", nil
+	})
+}
+
+// UpdateSubmissionTags replaces the tags of a submission with a comma separated list
+func (f *FormApi) UpdateSubmissionTags(w http.ResponseWriter, r *http.Request) {
+	f.withSubmission(w, r, func(db *sql.DB, submissionID string) (int, string, error) {
+		tags := normalizeTags(r.FormValue("tags"))
+		if err := setSubmissionTags(db, submissionID, tags); err != nil {
+			return http.StatusInternalServerError, "Failed to update tags", err
+		}
+		return http.StatusOK, "Tags updated", nil
+	})
+}
+
+// AddSubmissionNote adds an internal note authored by the current user
+func (f *FormApi) AddSubmissionNote(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.UserFromContext(r.Context())
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusUnauthorized, "Unauthorized", err)
+		return
+	}
+
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
+		return
+	}
+
+	body := strings.TrimSpace(r.FormValue("body"))
+	if body == "" {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Note body is required", nil)
+		return
+	}
+	if len(body) > maxNoteLength {
+		common.RespondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("Note must be at most %d characters", maxNoteLength), nil)
+		return
+	}
+
+	authorName := user.DisplayName
+	if authorName == "" {
+		authorName = user.Email
+	}
+	note := SubmissionNote{
+		ID:           uuid.New().String(),
+		SubmissionID: chi.URLParam(r, "submissionID"),
+		AuthorID:     user.ID,
+		AuthorName:   authorName,
+		Body:         body,
+		CreatedAt:    time.Now(),
+	}
+
+	if _, err := getSubmission(db, site.GetDomain(), note.SubmissionID); err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Submission not found", err)
+		return
+	}
+	if err := saveSubmissionNote(db, note); err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to add note", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusCreated, note)
+}
+
+// DeleteSubmissionNote removes a note from a submission
+func (f *FormApi) DeleteSubmissionNote(w http.ResponseWriter, r *http.Request) {
+	f.withSubmission(w, r, func(db *sql.DB, submissionID string) (int, string, error) {
+		if err := deleteSubmissionNote(db, submissionID, chi.URLParam(r, "noteID")); err != nil {
+			return http.StatusNotFound, "Note not found", err
+		}
+		return http.StatusOK, "Note deleted", nil
+	})
+}
+
+// DeleteSubmission removes a submission, its notes and its uploaded files
+func (f *FormApi) DeleteSubmission(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	submissionID := chi.URLParam(r, "submissionID")
+	deleted, err := deleteSubmissions(db, []string{submissionID})
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to delete submission", err)
+		return
+	}
+	if deleted == 0 {
+		common.RespondWithError(w, r, http.StatusNotFound, "Submission not found", nil)
+		return
+	}
+	RemoveSubmissionUploads(UploadsDir(site), []string{submissionID})
+
+	common.RespondWithPlainText(w, http.StatusOK, "Submission deleted")
+}
+
+// BulkUpdateSubmissions applies an action to several submissions at once.
+// Expects "action" and one or more "ids" (repeated or comma separated);
+// "tag" needs "tags" and "status" needs "status".
+func (f *FormApi) BulkUpdateSubmissions(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
+		return
+	}
+
+	ids := parseIDList(r.Form["ids"])
+	if len(ids) == 0 {
+		common.RespondWithError(w, r, http.StatusBadRequest, "No submissions selected", nil)
+		return
+	}
+	if len(ids) > maxBulkSubmissions {
+		common.RespondWithError(w, r, http.StatusBadRequest, fmt.Sprintf("At most %d submissions can be updated at once", maxBulkSubmissions), nil)
+		return
+	}
+
+	action := r.FormValue("action")
+	affected := 0
+	switch action {
+	case BulkMarkRead:
+		err = setSubmissionStatus(db, ids, StatusRead)
+	case BulkArchive:
+		err = setSubmissionStatus(db, ids, StatusArchived)
+	case BulkSpam:
+		err = setSubmissionStatus(db, ids, StatusSpam)
+	case BulkStatus:
+		status := r.FormValue("status")
+		if !IsSubmissionStatus(status) {
+			common.RespondWithError(w, r, http.StatusBadRequest, "Invalid status "+status, nil)
+			return
+		}
+		err = setSubmissionStatus(db, ids, status)
+	case BulkTag:
+		tags := normalizeTags(r.FormValue("tags"))
+		if len(tags) == 0 {
+			common.RespondWithError(w, r, http.StatusBadRequest, "At least one tag is required", nil)
+			return
+		}
+		err = addSubmissionTags(db, ids, tags)
+	case BulkDelete:
+		affected, err = deleteSubmissions(db, ids)
+		if err == nil {
+			RemoveSubmissionUploads(UploadsDir(site), ids)
+		}
+	default:
+		common.RespondWithError(w, r, http.StatusBadRequest, "Unknown action "+action, nil)
+		return
+	}
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Bulk action failed", err)
+		return
+	}
+	if action != BulkDelete {
+		affected = len(ids)
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"action":   action,
+		"affected": affected,
+	})
+}
+
+// withSubmission runs a single-submission update and writes a plain text response.
+// The callback returns the status code, the message and an optional error.
+func (f *FormApi) withSubmission(w http.ResponseWriter, r *http.Request, update func(db *sql.DB, submissionID string) (int, string, error)) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
+		return
+	}
+
+	submissionID := chi.URLParam(r, "submissionID")
+	if _, err := getSubmission(db, site.GetDomain(), submissionID); err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Submission not found", err)
+		return
+	}
+
+	status, message, err := update(db, submissionID)
+	if status >= http.StatusBadRequest {
+		common.RespondWithError(w, r, status, message, err)
+		return
+	}
+	common.RespondWithPlainText(w, status, message)
+}
+
+// normalizeTags splits a comma separated list, trimming and dropping duplicates
+func normalizeTags(raw string) []string {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// parseIDList accepts ids as repeated values and/or comma separated lists
+func parseIDList(values []string) []string {
+	var ids []string
+	for _, value := range values {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// placeholders returns "?, ?, ?" for n arguments
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+func listInboxSubmissions(db *sql.DB, siteID string, filter InboxFilter) ([]FormSubmission, error) {
+	query := `
+		SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+		       fs.status, fs.assigned_to, fs.read_at
+		FROM form_submissions fs
+		JOIN forms f ON fs.form_id = f.id
+		WHERE 1=1`
+	where, args := filter.where()
+	query += where
+
+	query += " ORDER BY fs.created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.limit(), max(filter.Offset, 0))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query submissions: %w", err)
+	}
+	defer rows.Close()
+
+	submissions := []FormSubmission{}
+	for rows.Next() {
+		submission, err := scanInboxSubmission(rows, siteID)
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, submission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over submission rows: %w", err)
+	}
+
+	return submissions, nil
+}
+
+func getSubmission(db *sql.DB, siteID, submissionID string) (FormSubmission, error) {
+	const getSubmissionSQL = `
+		SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+		       fs.status, fs.assigned_to, fs.read_at
+		FROM form_submissions fs
+		JOIN forms f ON fs.form_id = f.id
+		WHERE fs.uuid = ?`
+
+	submission, err := scanInboxSubmission(db.QueryRow(getSubmissionSQL, submissionID), siteID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return FormSubmission{}, common.NewError("submission not found")
+		}
+		return FormSubmission{}, err
+	}
+	return submission, nil
+}
+
+// scanInboxSubmission scans a row selected with the inbox columns
+func scanInboxSubmission(row interface{ Scan(...any) error }, siteID string) (FormSubmission, error) {
+	var submission FormSubmission
+	var dataStr string
+	var assignedTo sql.NullString
+	var readAt sql.NullTime
+
+	err := row.Scan(
+		&submission.ID,
+		&submission.FormID,
+		&submission.FirstName,
+		&submission.LastName,
+		&submission.Email,
+		&submission.Tel,
+		&submission.Tags,
+		&submission.Subject,
+		&submission.Message,
+		&dataStr,
+		&submission.IPAddress,
+		&submission.UserAgent,
+		&submission.CreatedAt,
+		&submission.Status,
+		&assignedTo,
+		&readAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return FormSubmission{}, err
+		}
+		return FormSubmission{}, fmt.Errorf("failed to scan submission row: %w", err)
+	}
+
+	submission.SiteDomain = siteID
+	if assignedTo.Valid {
+		submission.AssignedTo = &assignedTo.String
+	}
+	if readAt.Valid {
+		submission.ReadAt = &readAt.Time
+	}
+	submission.Data = parseSubmissionData(dataStr)
+
+	return submission, nil
+}
+
+func setSubmissionStatus(db *sql.DB, submissionIDs []string, status string) error {
+	query := `
+		UPDATE form_submissions
+		SET status = ?,
+		    read_at = CASE WHEN ? != 'new' THEN COALESCE(read_at, ?) ELSE NULL END,
+		    updated_at = ?
+		WHERE uuid IN (` + placeholders(len(submissionIDs)) + `)`
+
+	now := time.Now()
+	args := append([]interface{}{status, status, now, now}, stringArgs(submissionIDs)...)
+	if _, err := db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update submission status: %w", err)
+	}
+	return nil
+}
+
+func assignSubmission(db *sql.DB, submissionID, assignee string) error {
+	const assignSQL = `UPDATE form_submissions SET assigned_to = ?, updated_at = ? WHERE uuid = ?`
+
+	var assignedTo interface{}
+	if assignee != "" {
+		assignedTo = assignee
+	}
+	if _, err := db.Exec(assignSQL, assignedTo, time.Now(), submissionID); err != nil {
+		return fmt.Errorf("failed to assign submission: %w", err)
+	}
+	return nil
+}
+
+func setSubmissionTags(db *sql.DB, submissionID string, tags []string) error {
+	const setTagsSQL = `UPDATE form_submissions SET tags = ?, updated_at = ? WHERE uuid = ?`
+
+	var value interface{}
+	if len(tags) > 0 {
+		value = strings.Join(tags, ", ")
+	}
+	if _, err := db.Exec(setTagsSQL, value, time.Now(), submissionID); err != nil {
+		return fmt.Errorf("failed to update submission tags: %w", err)
+	}
+	return nil
+}
+
+// addSubmissionTags merges tags into the existing tags of each submission
+func addSubmissionTags(db *sql.DB, submissionIDs []string, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT uuid, COALESCE(tags, '') FROM form_submissions WHERE uuid IN (`+placeholders(len(submissionIDs))+`)`, stringArgs(submissionIDs)...)
+	if err != nil {
+		return fmt.Errorf("failed to query submission tags: %w", err)
+	}
+	current := make(map[string]string)
+	for rows.Next() {
+		var id, existing string
+		if err := rows.Scan(&id, &existing); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan submission tags: %w", err)
+		}
+		current[id] = existing
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over submission tags: %w", err)
+	}
+
+	now := time.Now()
+	for id, existing := range current {
+		merged := normalizeTags(existing + "," + strings.Join(tags, ","))
+		if _, err := tx.Exec(`UPDATE form_submissions SET tags = ?, updated_at = ? WHERE uuid = ?`, strings.Join(merged, ", "), now, id); err != nil {
+			return fmt.Errorf("failed to update submission tags: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteSubmissions removes submissions; notes and file records cascade
+func deleteSubmissions(db *sql.DB, submissionIDs []string) (int, error) {
+	result, err := db.Exec(`DELETE FROM form_submissions WHERE uuid IN (`+placeholders(len(submissionIDs))+`)`, stringArgs(submissionIDs)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete submissions: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted submissions: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// RemoveSubmissionUploads deletes the upload directories of deleted submissions
+func RemoveSubmissionUploads(dir string, submissionIDs []string) {
+	for _, id := range submissionIDs {
+		if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, id)); err != nil {
+			common.Warning("Failed to remove uploads for submission %s: %v", id, err)
+		}
+	}
+}
+
+func saveSubmissionNote(db *sql.DB, note SubmissionNote) error {
+	const saveNoteSQL = `
+		INSERT INTO form_submission_notes (uuid, submission_id, author_id, author_name, body, created_at)
+		SELECT ?, id, ?, ?, ?, ? FROM form_submissions WHERE uuid = ?`
+
+	if _, err := db.Exec(saveNoteSQL, note.ID, note.AuthorID, note.AuthorName, note.Body, note.CreatedAt, note.SubmissionID); err != nil {
+		return fmt.Errorf("failed to save note: %w", err)
+	}
+	return nil
+}
+
+func deleteSubmissionNote(db *sql.DB, submissionID, noteID string) error {
+	const deleteNoteSQL = `
+		DELETE FROM form_submission_notes
+		WHERE uuid = ? AND submission_id = (SELECT id FROM form_submissions WHERE uuid = ?)`
+
+	result, err := db.Exec(deleteNoteSQL, noteID, submissionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return common.NewError("note not found")
+	}
+	return nil
+}
+
+func getSubmissionNotes(db *sql.DB, submissionID string) ([]SubmissionNote, error) {
+	const getNotesSQL = `
+		SELECT n.uuid, s.uuid, n.author_id, COALESCE(n.author_name, ''), n.body, n.created_at
+		FROM form_submission_notes n
+		JOIN form_submissions s ON n.submission_id = s.id
+		WHERE s.uuid = ?
+		ORDER BY n.created_at ASC`
+
+	rows, err := db.Query(getNotesSQL, submissionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query submission notes: %w", err)
+	}
+	defer rows.Close()
+
+	notes := []SubmissionNote{}
+	for rows.Next() {
+		var note SubmissionNote
+		if err := rows.Scan(&note.ID, &note.SubmissionID, &note.AuthorID, &note.AuthorName, &note.Body, &note.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan submission note row: %w", err)
+		}
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over submission note rows: %w", err)
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,229 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"wispy-core/common"
+)
+
+// Condition operators for show_if
+const (
+	OpEquals    = "equals" // default
+	OpNotEquals = "not_equals"
+	OpIn        = "in"
+	OpNotIn     = "not_in"
+	OpFilled    = "filled"
+	OpEmpty     = "empty"
+)
+
+// FieldCondition shows a field or step only when another field's value matches,
+// e.g. {"field": "budget", "op": "in", "values": ["10k-50k", "50k+"]}
+type FieldCondition struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"` // in and not_in only
+}
+
+// FormStep describes one page of a multi-step form. Fields pick their page with FormField.Step.
+type FormStep struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	ShowIf      *FieldCondition `json:"show_if,omitempty"` // the whole step is skipped unless this matches
+}
+
+// matches reports whether the condition holds for the given values. A nil
+// condition always holds. Checkbox groups match when any checked value does.
+func (c *FieldCondition) matches(values url.Values) bool {
+	if c == nil {
+		return true
+	}
+
+	submitted := nonEmptyValues(values[c.Field])
+	switch c.Op {
+	case OpFilled:
+		return len(submitted) > 0
+	case OpEmpty:
+		return len(submitted) == 0
+	case OpNotEquals:
+		return !containsAny(submitted, []string{c.Value})
+	case OpIn:
+		return containsAny(submitted, c.Values)
+	case OpNotIn:
+		return !containsAny(submitted, c.Values)
+	default:
+		return containsAny(submitted, []string{c.Value})
+	}
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, value := range values {
+		for _, w := range wanted {
+			if value == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldStep returns the 1-based step a field is shown on
+func fieldStep(field FormField) int {
+	if field.Step < 1 {
+		return 1
+	}
+	return field.Step
+}
+
+// stepCount returns the number of steps of a form, 1 for single page forms
+func stepCount(form Form) int {
+	count := len(form.Steps)
+	for _, field := range form.Fields {
+		if step := fieldStep(field); step > count {
+			count = step
+		}
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// step returns the definition of a 1-based step, which may be empty
+func (form Form) step(n int) FormStep {
+	if n < 1 || n > len(form.Steps) {
+		return FormStep{}
+	}
+	return form.Steps[n-1]
+}
+
+// isConditional reports whether a form needs the multi-step or show_if behaviour
+func isConditional(form Form) bool {
+	if stepCount(form) > 1 {
+		return true
+	}
+	for _, field := range form.Fields {
+		if field.ShowIf != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedFields returns the fields sorted by step, keeping their order within a step
+func orderedFields(form Form) []FormField {
+	fields := make([]FormField, len(form.Fields))
+	copy(fields, form.Fields)
+	sort.SliceStable(fields, func(i, j int) bool { return fieldStep(fields[i]) < fieldStep(fields[j]) })
+	return fields
+}
+
+// visibleFields works out which fields apply to a submission. A field is hidden
+// when its show_if condition does not match or its step is skipped. Hidden fields
+// count as empty for the conditions that come after them, so branches nest.
+func visibleFields(form Form, values url.Values) map[string]bool {
+	visible := make(map[string]bool, len(form.Fields))
+	known := make(url.Values)
+	stepShown := make(map[int]bool)
+
+	for _, field := range orderedFields(form) {
+		step := fieldStep(field)
+		shown, seen := stepShown[step]
+		if !seen {
+			shown = form.step(step).ShowIf.matches(known)
+			stepShown[step] = shown
+		}
+		if shown && field.ShowIf.matches(known) {
+			visible[field.Name] = true
+			known[field.Name] = values[field.Name]
+		}
+	}
+
+	return visible
+}
+
+// validateFormLogic checks the steps and show_if conditions of a form definition.
+// Conditions may only depend on fields that come before them, so a form can be
+// evaluated top to bottom both in the browser and on the server.
+func validateFormLogic(form Form) error {
+	position := make(map[string]int)
+	fields := make(map[string]FormField)
+	for i, field := range orderedFields(form) {
+		position[field.Name] = i
+		fields[field.Name] = field
+	}
+
+	checkCondition := func(owner string, c *FieldCondition, before int) error {
+		if c == nil {
+			return nil
+		}
+		target, ok := fields[c.Field]
+		if !ok {
+			return common.NewErrorf("%s has a show_if condition on unknown field '%s'", owner, c.Field)
+		}
+		if target.Type == "file" {
+			return common.NewErrorf("%s has a show_if condition on file field '%s'", owner, c.Field)
+		}
+		if position[c.Field] >= before {
+			return common.NewErrorf("%s has a show_if condition on field '%s', which does not come before it", owner, c.Field)
+		}
+		switch c.Op {
+		case "", OpEquals, OpNotEquals, OpFilled, OpEmpty:
+		case OpIn, OpNotIn:
+			if len(c.Values) == 0 {
+				return common.NewErrorf("%s has a show_if condition without values", owner)
+			}
+		default:
+			return common.NewErrorf("%s has an unknown show_if operator '%s'", owner, c.Op)
+		}
+		return nil
+	}
+
+	for _, field := range form.Fields {
+		if field.Step < 0 {
+			return common.NewErrorf("field '%s' has a negative step", field.Name)
+		}
+		if err := checkCondition("field '"+field.Name+"'", field.ShowIf, position[field.Name]); err != nil {
+			return err
+		}
+	}
+
+	for i, step := range form.Steps {
+		// A step condition may use any field of an earlier step
+		first := len(form.Fields)
+		for _, field := range form.Fields {
+			if fieldStep(field) >= i+1 && position[field.Name] < first {
+				first = position[field.Name]
+			}
+		}
+		if err := checkCondition(fmt.Sprintf("step %d", i+1), step.ShowIf, first); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// takeFormSteps moves the step definitions out of the stored form settings
+func takeFormSteps(metadata map[string]any) []FormStep {
+	raw, ok := metadata["steps"]
+	if !ok {
+		return nil
+	}
+	delete(metadata, "steps")
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		common.Warning("Failed to read form steps: %v", err)
+		return nil
+	}
+	var steps []FormStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		common.Warning("Failed to parse form steps: %v", err)
+		return nil
+	}
+	return steps
+}
@@ -0,0 +1,561 @@
+package forms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"wispy-core/common"
+	"wispy-core/core/site"
+	"wispy-core/tpl"
+)
+
+const (
+	// honeypotField must stay empty, bots filling every input give themselves away
+	honeypotField = "__hp__"
+	// tokenField carries a signed token issued when the form was rendered
+	tokenField = "__csrf__"
+	// formTokenTTL is how long a rendered form can be submitted
+	formTokenTTL = 24 * time.Hour
+)
+
+func init() {
+	site.RegisterTemplateFuncs(formTemplateFuncs)
+}
+
+// formTemplateFuncs provides the `form "slug"` template function to tenant pages.
+//
+// The form is rendered with the tenant's "components/form" template when it exists,
+// otherwise with the built-in markup. Each field is rendered with "partials/forms/<type>",
+// then "components/form-field", then the built-in field markup.
+func formTemplateFuncs(s site.Site) tpl.FuncProvider {
+	return func(rs tpl.RenderState, tmpl *template.Template) template.FuncMap {
+		return template.FuncMap{
+			"form": func(slug string) (template.HTML, error) {
+				return renderForm(s, rs, tmpl, slug)
+			},
+		}
+	}
+}
+
+func renderForm(s site.Site, rs tpl.RenderState, tmpl *template.Template, slug string) (template.HTML, error) {
+	if rs == nil || tmpl == nil {
+		return "", fmt.Errorf("form %q called outside of a render", slug)
+	}
+
+	dbManager := s.GetDatabaseManager()
+	if dbManager == nil {
+		return "", common.NewError("database manager not available")
+	}
+	db, err := dbManager.GetOrCreateConnection(formsDBName)
+	if err != nil {
+		return "", fmt.Errorf("form %q: %w", slug, err)
+	}
+
+	form, err := getForm(db, slug, s.GetDomain())
+	if err != nil {
+		return "", fmt.Errorf("form %q: %w", slug, err)
+	}
+
+	state := formStateFromRender(rs, form.ID)
+
+	// A ?resume= link re-opens a saved draft on the step after the last completed one
+	if state.FormID == "" && draftsEnabled(form) {
+		if token, ok := rs.GetTemplateData().Data["FormDraft"].(string); ok && token != "" {
+			if draft, err := getDraft(db, token); err == nil && draft.FormID == form.ID {
+				state.Values = draft.Values
+				state.Step = draft.Step + 1
+				state.Draft = draft.Token
+			}
+		}
+	}
+
+	formDict := buildFormDict(form, state)
+	conditional := isConditional(form)
+
+	fields := formDict["fields"].([]map[string]interface{})
+	for _, field := range fields {
+		html, err := renderFormField(tmpl, field)
+		if err != nil {
+			return "", fmt.Errorf("form %q field %v: %w", slug, field["name"], err)
+		}
+		if conditional {
+			html = wrapConditionalField(field, html)
+		}
+		field["html"] = html
+	}
+
+	var buf bytes.Buffer
+	if tmpl.Lookup("components/form") != nil {
+		err = tmpl.ExecuteTemplate(&buf, "components/form", formDict)
+	} else {
+		err = defaultFormTemplate.ExecuteTemplate(&buf, "form", formDict)
+	}
+	if err != nil {
+		return "", fmt.Errorf("form %q: %w", slug, err)
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+// renderFormField renders one field with the most specific template available
+func renderFormField(tmpl *template.Template, field map[string]interface{}) (template.HTML, error) {
+	var buf bytes.Buffer
+	var err error
+
+	fieldType, _ := field["type"].(string)
+	switch {
+	case tmpl.Lookup("partials/forms/"+fieldType) != nil:
+		err = tmpl.ExecuteTemplate(&buf, "partials/forms/"+fieldType, field)
+	case tmpl.Lookup("components/form-field") != nil:
+		err = tmpl.ExecuteTemplate(&buf, "components/form-field", field)
+	default:
+		err = defaultFormTemplate.ExecuteTemplate(&buf, "field", field)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+// formStateFromRender returns the posted-back state for this form, if any
+func formStateFromRender(rs tpl.RenderState, formID string) FormState {
+	state := FormState{Errors: make(ValidationErrors), Values: make(map[string]string)}
+
+	raw, ok := rs.GetTemplateData().Data["FormState"].(map[string]interface{})
+	if !ok || raw["form_id"] != formID {
+		return state
+	}
+
+	state.FormID = formID
+	state.Success, _ = raw["success"].(bool)
+	state.Message, _ = raw["message"].(string)
+	state.Draft, _ = raw["draft"].(string)
+	if step, ok := raw["step"].(float64); ok {
+		state.Step = int(step)
+	}
+	if errs, ok := raw["errors"].(map[string]interface{}); ok {
+		for field, messages := range errs {
+			if list, ok := messages.([]interface{}); ok {
+				for _, message := range list {
+					state.Errors.Add(field, fmt.Sprint(message))
+				}
+			}
+		}
+	}
+	if values, ok := raw["values"].(map[string]interface{}); ok {
+		for field, value := range values {
+			state.Values[field] = fmt.Sprint(value)
+		}
+	}
+
+	return state
+}
+
+// buildFormDict builds the template data for a form. Keys follow the design system
+// components (components/form, components/form-field) so tenants can reuse them.
+func buildFormDict(form Form, state FormState) map[string]interface{} {
+	formID := "form-" + form.Name
+
+	enctype := ""
+	fields := make([]map[string]interface{}, 0, len(form.Fields))
+	for _, field := range orderedFields(form) {
+		if field.Type == "file" {
+			enctype = "multipart/form-data"
+		}
+		fields = append(fields, buildFieldDict(formID, field, state))
+	}
+
+	submitLabel := "Submit"
+	if label, ok := form.Metadata["submit_label"].(string); ok && label != "" {
+		submitLabel = label
+	}
+
+	title, _ := form.Metadata["title"].(string)
+	description, _ := form.Metadata["description"].(string)
+
+	expires, signature := common.SignExpiring(form.ID, time.Now().Add(formTokenTTL))
+	hidden := fmt.Sprintf(`<input type="hidden" name="__form_id__" value="%s" />`+
+		`<input type="hidden" name="%s" value="%s.%s" />`+
+		`<div style="position:absolute;left:-10000px;" aria-hidden="true">`+
+		`<label for="%s-%s">Leave this field empty</label>`+
+		`<input type="text" id="%s-%s" name="%s" value="" tabindex="-1" autocomplete="off" /></div>`,
+		template.HTMLEscapeString(form.ID),
+		tokenField, expires, signature,
+		formID, honeypotField, formID, honeypotField, honeypotField,
+	)
+	if isConditional(form) {
+		hidden += formLogicHTML(form, state)
+	}
+
+	dict := map[string]interface{}{
+		"id":            formID,
+		"name":          form.Name,
+		"title":         title,
+		"description":   description,
+		"action":        "/api/v1/forms/submit",
+		"method":        "POST",
+		"enctype":       enctype,
+		"fields":        fields,
+		"submitLabel":   submitLabel,
+		"customContent": template.HTML(hidden),
+		"actions": []map[string]interface{}{
+			{"text": submitLabel, "type": "submit", "style": "btn-primary"},
+		},
+	}
+
+	if state.Success {
+		dict["successMessage"] = state.Message
+	} else if len(state.Errors) > 0 {
+		dict["errorMessage"] = "Please correct the errors below."
+	}
+
+	return dict
+}
+
+func buildFieldDict(formID string, field FormField, state FormState) map[string]interface{} {
+	id := formID + "-" + field.Name
+	value := state.Values[field.Name]
+	selected := make(map[string]bool)
+	for _, v := range strings.Split(value, ", ") {
+		selected[v] = true
+	}
+
+	options := make([]map[string]interface{}, 0, len(field.Options))
+	for i, option := range field.Options {
+		options = append(options, map[string]interface{}{
+			"id":       id + "-" + strconv.Itoa(i),
+			"value":    option.Value,
+			"label":    option.Label,
+			"selected": selected[option.Value],
+		})
+	}
+
+	label := field.Label
+	if label == "" {
+		label = field.Name
+	}
+
+	dict := map[string]interface{}{
+		"id":          id,
+		"name":        field.Name,
+		"type":        field.Type,
+		"label":       label,
+		"required":    field.Required,
+		"placeholder": field.Placeholder,
+		"options":     options,
+		"value":       value,
+		"checked":     value != "" && len(field.Options) == 0,
+		"minlength":   positiveOrEmpty(field.MinLength),
+		"maxlength":   positiveOrEmpty(field.MaxLength),
+		"pattern":     field.Pattern,
+		"min":         floatOrEmpty(field.Min),
+		"max":         floatOrEmpty(field.Max),
+		"accept":      strings.Join(field.AllowedTypes, ","),
+		"multiple":    field.Type == "file" && field.MaxFiles > 1,
+		"step":        fieldStep(field),
+		"showIf":      "",
+	}
+
+	if field.ShowIf != nil {
+		if condition, err := json.Marshal(field.ShowIf); err == nil {
+			dict["showIf"] = string(condition)
+		}
+	}
+
+	if errs := state.Errors[field.Name]; len(errs) > 0 {
+		dict["error"] = label + " " + errs[0]
+		dict["errors"] = errs
+		dict["ariaDescribedBy"] = id + "-error"
+	}
+
+	return dict
+}
+
+// wrapConditionalField marks a rendered field with its step and show_if condition for the form script
+func wrapConditionalField(field map[string]interface{}, html template.HTML) template.HTML {
+	showIf := ""
+	if condition, _ := field["showIf"].(string); condition != "" {
+		showIf = ` data-show-if="` + template.HTMLEscapeString(condition) + `"`
+	}
+	return template.HTML(fmt.Sprintf(`<div class="form-field" data-form-field="%s" data-step="%d"%s>%s</div>`,
+		template.HTMLEscapeString(fmt.Sprint(field["name"])), field["step"], showIf, html))
+}
+
+// formLogicHTML returns the draft token input and the script that pages through
+// steps and shows or hides conditional fields. Without JavaScript every field
+// is shown and the server ignores the ones that do not apply.
+func formLogicHTML(form Form, state FormState) string {
+	steps := make([]FormStep, stepCount(form))
+	copy(steps, form.Steps)
+
+	config, err := json.Marshal(map[string]interface{}{
+		"step":      min(max(state.Step, 1), len(steps)),
+		"steps":     steps,
+		"drafts":    draftsEnabled(form),
+		"draftsUrl": "/api/v1/forms/drafts",
+	})
+	if err != nil {
+		common.Warning("Failed to encode form logic for %s: %v", form.ID, err)
+		return ""
+	}
+
+	return fmt.Sprintf(`<input type="hidden" name="%s" value="%s" />`, draftField, template.HTMLEscapeString(state.Draft)) +
+		"<script>" + formLogicScript + "(document.currentScript, " + string(config) + ");</script>"
+}
+
+func positiveOrEmpty(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func floatOrEmpty(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+// verifyFormToken checks the honeypot and the token added by the form template function.
+// Forms with "require_token" in their settings reject posts without a valid token.
+func verifyFormToken(form Form, honeypot, token string) error {
+	if honeypot != "" {
+		return common.NewError("honeypot field was filled in")
+	}
+
+	if token == "" {
+		if required, _ := form.Metadata["require_token"].(bool); required {
+			return common.NewError("form token is missing")
+		}
+		return nil
+	}
+
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok || !common.VerifyExpiring(form.ID, expires, signature) {
+		return common.NewError("form token is invalid or has expired")
+	}
+
+	return nil
+}
+
+// defaultFormTemplate is used when a tenant does not provide its own form templates
+var defaultFormTemplate = template.Must(template.New("form").Parse(`
+{{- define "form" -}}
+<form id="{{.id}}" class="form" action="{{.action}}" method="{{.method}}"{{if .enctype}} enctype="{{.enctype}}"{{end}}>
+	{{- if .title}}<h2 class="form-title">{{.title}}</h2>{{end}}
+	{{- if .description}}<p class="form-description">{{.description}}</p>{{end}}
+	{{- if .successMessage}}<div class="alert alert-success" role="status">{{.successMessage}}</div>{{end}}
+	{{- if .errorMessage}}<div class="alert alert-error" role="alert">{{.errorMessage}}</div>{{end}}
+	{{.customContent}}
+	{{- range .fields}}{{.html}}{{end}}
+	<button type="submit" class="btn btn-primary">{{.submitLabel}}</button>
+</form>
+{{- end -}}
+
+{{- define "label" -}}
+{{.label}}{{if .required}}<span class="text-error ml-1" aria-hidden="true">*</span>{{end}}
+{{- end -}}
+
+{{- define "error" -}}
+{{if .error}}<p id="{{.id}}-error" class="text-error text-sm">{{.error}}</p>{{end}}
+{{- end -}}
+
+{{- define "field" -}}
+{{- if or (eq .type "radio") (and (eq .type "checkbox") .options) -}}
+<fieldset class="form-control"{{if .ariaDescribedBy}} aria-describedby="{{.ariaDescribedBy}}"{{end}}>
+	<legend class="label">{{template "label" .}}</legend>
+	{{- range .options}}
+	<label class="label cursor-pointer" for="{{.id}}">
+		<input type="{{$.type}}" id="{{.id}}" name="{{$.name}}" value="{{.value}}" class="{{$.type}}"{{if .selected}} checked{{end}}{{if and $.required (eq $.type "radio")}} required{{end}} />
+		<span class="label-text">{{.label}}</span>
+	</label>
+	{{- end}}
+	{{template "error" .}}
+</fieldset>
+{{- else if eq .type "checkbox" -}}
+<div class="form-control">
+	<label class="label cursor-pointer" for="{{.id}}">
+		<input type="checkbox" id="{{.id}}" name="{{.name}}" value="1" class="checkbox"{{if .checked}} checked{{end}}{{if .required}} required{{end}}{{if .error}} aria-invalid="true" aria-describedby="{{.id}}-error"{{end}} />
+		<span class="label-text">{{template "label" .}}</span>
+	</label>
+	{{template "error" .}}
+</div>
+{{- else -}}
+<div class="form-control">
+	<label class="label" for="{{.id}}"><span class="label-text">{{template "label" .}}</span></label>
+	{{- if eq .type "textarea"}}
+	<textarea id="{{.id}}" name="{{.name}}" class="textarea textarea-bordered"{{if .placeholder}} placeholder="{{.placeholder}}"{{end}}{{if .required}} required{{end}}{{if .minlength}} minlength="{{.minlength}}"{{end}}{{if .maxlength}} maxlength="{{.maxlength}}"{{end}}{{if .error}} aria-invalid="true" aria-describedby="{{.id}}-error"{{end}}>{{.value}}</textarea>
+	{{- else if eq .type "select"}}
+	<select id="{{.id}}" name="{{.name}}" class="select select-bordered"{{if .required}} required{{end}}{{if .error}} aria-invalid="true" aria-describedby="{{.id}}-error"{{end}}>
+		<option value="">{{if .placeholder}}{{.placeholder}}{{else}}Choose an option{{end}}</option>
+		{{- range .options}}
+		<option value="{{.value}}"{{if .selected}} selected{{end}}>{{.label}}</option>
+		{{- end}}
+	</select>
+	{{- else if eq .type "file"}}
+	<input type="file" id="{{.id}}" name="{{.name}}" class="file-input file-input-bordered"{{if .accept}} accept="{{.accept}}"{{end}}{{if .multiple}} multiple{{end}}{{if .required}} required{{end}}{{if .error}} aria-invalid="true" aria-describedby="{{.id}}-error"{{end}} />
+	{{- else}}
+	<input type="{{.type}}" id="{{.id}}" name="{{.name}}" value="{{.value}}" class="input input-bordered"{{if .placeholder}} placeholder="{{.placeholder}}"{{end}}{{if .required}} required{{end}}{{if .minlength}} minlength="{{.minlength}}"{{end}}{{if .maxlength}} maxlength="{{.maxlength}}"{{end}}{{if .pattern}} pattern="{{.pattern}}"{{end}}{{if .min}} min="{{.min}}"{{end}}{{if .max}} max="{{.max}}"{{end}}{{if .error}} aria-invalid="true" aria-describedby="{{.id}}-error"{{end}} />
+	{{- end}}
+	{{template "error" .}}
+</div>
+{{- end -}}
+{{- end -}}
+`))
+
+// formLogicScript is called with its own script element and the form's step
+// configuration. It mirrors visibleFields: fields are evaluated in document order,
+// hidden ones are disabled so they are neither validated nor submitted.
+const formLogicScript = `(function (script, cfg) {
+	var form = script.closest("form");
+	if (!form) return;
+	// The script sits above the fields, wait for them to be parsed
+	if (document.readyState === "loading") document.addEventListener("DOMContentLoaded", start);
+	else start();
+
+	function start() {
+		var fields = [].slice.call(form.querySelectorAll("[data-form-field]"));
+		var submit = form.querySelector("[type=submit]");
+		var draft = form.querySelector("input[name=__draft__]");
+		var current = cfg.step, live = {};
+
+		function controls(el) { return [].slice.call(el.querySelectorAll("input, select, textarea")); }
+		function values(name) {
+			var out = [];
+			fields.forEach(function (el) {
+				if (el.dataset.formField !== name || el.dataset.off) return;
+				controls(el).forEach(function (c) {
+					if ((c.type === "checkbox" || c.type === "radio") && !c.checked) return;
+					if (c.type !== "file" && c.value.trim() !== "") out.push(c.value.trim());
+				});
+			});
+			return out;
+		}
+		function matches(c) {
+			if (!c) return true;
+			var v = values(c.field);
+			function any(list) { return v.some(function (x) { return list.indexOf(x) >= 0; }); }
+			switch (c.op) {
+			case "filled": return v.length > 0;
+			case "empty": return v.length === 0;
+			case "not_equals": return !any([c.value || ""]);
+			case "in": return any(c.values || []);
+			case "not_in": return !any(c.values || []);
+			default: return any([c.value || ""]);
+			}
+		}
+		function find(dir) {
+			for (var n = current + dir; n >= 1 && n <= cfg.steps.length; n += dir) if (live[n]) return n;
+			return 0;
+		}
+
+		var multi = cfg.steps.length > 1;
+		var title = document.createElement("p"), nav = document.createElement("div"), status = document.createElement("p");
+		var back = button("Back", "btn"), next = button("Next", "btn btn-primary"), save = button("Save and continue later", "btn btn-ghost");
+		title.className = "form-step-title font-semibold";
+		nav.className = "form-step-nav flex gap-2";
+		status.className = "form-draft-status text-sm";
+		status.setAttribute("role", "status");
+		function button(text, cls) {
+			var b = document.createElement("button");
+			b.type = "button";
+			b.className = cls;
+			b.textContent = text;
+			return b;
+		}
+
+		function update() {
+			var shown = {};
+			live = {};
+			fields.forEach(function (el) {
+				var n = +el.dataset.step || 1;
+				if (!(n in shown)) shown[n] = matches((cfg.steps[n - 1] || {}).show_if);
+				var on = shown[n] && matches(el.dataset.showIf ? JSON.parse(el.dataset.showIf) : null);
+				el.dataset.off = on ? "" : "1";
+				controls(el).forEach(function (c) { c.disabled = !on; });
+				if (on) live[n] = true;
+			});
+			if (!multi) {
+				fields.forEach(function (el) { el.hidden = !!el.dataset.off; });
+				return;
+			}
+			if (!live[current]) current = find(1) || find(-1) || current;
+			fields.forEach(function (el) { el.hidden = !!el.dataset.off || (+el.dataset.step || 1) !== current; });
+
+			var total = 0, position = 0, step = cfg.steps[current - 1] || {};
+			for (var n = 1; n <= cfg.steps.length; n++) if (live[n]) { total++; if (n <= current) position++; }
+			title.textContent = "Step " + position + " of " + total + (step.title ? ": " + step.title : "");
+			back.hidden = !find(-1);
+			next.hidden = !find(1);
+			save.hidden = !cfg.drafts || !find(1);
+			if (submit) submit.hidden = !!find(1);
+		}
+
+		function stepValid() {
+			return fields.every(function (el) {
+				return el.hidden || controls(el).every(function (c) { return c.reportValidity(); });
+			});
+		}
+		function saveDraft(completed, showLink) {
+			if (!cfg.drafts) return;
+			var data = new FormData(form), files = [];
+			data.set("__step__", String(completed));
+			data.forEach(function (v, k) { if (v instanceof File) files.push(k); });
+			files.forEach(function (k) { data.delete(k); });
+			fetch(cfg.draftsUrl, { method: "POST", body: data, credentials: "same-origin", headers: { Accept: "application/json" } })
+				.then(function (r) { return r.json(); })
+				.then(function (res) {
+					if (!res.success) throw new Error(res.message || "Your progress could not be saved");
+					draft.value = res.token;
+					if (!showLink) return;
+					status.textContent = "Your progress is saved. Continue later with this link: ";
+					var a = document.createElement("a");
+					a.href = a.textContent = res.resume_url || location.href;
+					status.appendChild(a);
+				})
+				.catch(function (err) { if (showLink) status.textContent = err.message; });
+		}
+
+		if (multi && fields.length) {
+			fields[0].parentNode.insertBefore(title, fields[0]);
+			nav.appendChild(back);
+			nav.appendChild(next);
+			nav.appendChild(save);
+			if (submit) submit.parentNode.insertBefore(nav, submit);
+			else form.appendChild(nav);
+			nav.parentNode.insertBefore(status, nav.nextSibling);
+
+			next.addEventListener("click", function () {
+				if (!stepValid()) return;
+				var done = current;
+				current = find(1);
+				update();
+				saveDraft(done, false);
+				form.scrollIntoView({ block: "start", behavior: "smooth" });
+			});
+			back.addEventListener("click", function () {
+				current = find(-1) || current;
+				update();
+			});
+			save.addEventListener("click", function () { saveDraft(find(-1), true); });
+			form.addEventListener("submit", function (e) {
+				// Enter in a text input should move on rather than submit early
+				if (find(1)) {
+					e.preventDefault();
+					next.click();
+				}
+			});
+		}
+
+		form.addEventListener("input", update);
+		form.addEventListener("change", update);
+		update();
+	}
+})`
@@ -0,0 +1,411 @@
+package forms
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"wispy-core/common"
+	"wispy-core/core/tenant/databases"
+)
+
+// Search engines reported in SearchResults
+const (
+	SearchEngineFTS5 = "fts5"
+	SearchEngineLike = "like"
+)
+
+const (
+	maxSearchQueryLength = 256
+	snippetTokens        = 12
+	snippetContext       = 60 // characters kept around a match by the LIKE fallback
+
+	// Sentinels placed around matches by SQLite, replaced after escaping
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+// SearchResult is a submission matching a search, with a highlighted excerpt.
+// Snippet is HTML: submission text is escaped and matches are wrapped in <mark>.
+type SearchResult struct {
+	FormSubmission
+	FormName string  `json:"form_name"`
+	Snippet  string  `json:"snippet"`
+	Rank     float64 `json:"rank"` // lower is better, zero for the LIKE fallback
+}
+
+// SearchResults is the response of a submission search
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Engine  string         `json:"engine"`
+	Results []SearchResult `json:"results"`
+}
+
+// searchTerm is a word or quoted phrase from a search query
+type searchTerm struct {
+	Text   string
+	Prefix bool // term* matches words starting with the term
+	Phrase bool
+	Or     bool // the OR operator between two terms
+}
+
+// SearchSubmissions handles GET /forms/submissions/search?q=...
+// It accepts the same filters as ListSubmissions.
+func (f *FormApi) SearchSubmissions(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Search query is required", nil)
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Search query is too long", nil)
+		return
+	}
+
+	filter, err := parseInboxFilter(r)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	results, err := FindSubmissions(db, site.GetDomain(), q, filter)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to search submissions", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, results)
+}
+
+// FindSubmissions searches names, emails, subjects, messages and submitted data.
+// Words are matched together, "quoted phrases" as a whole, word* as a prefix and
+// OR between terms matches either. Without FTS5 terms match anywhere in the text,
+// including inside longer words.
+func FindSubmissions(db *sql.DB, siteID, q string, filter InboxFilter) (SearchResults, error) {
+	terms := parseSearchTerms(q)
+	results := SearchResults{Query: q, Results: []SearchResult{}}
+
+	words := 0
+	for _, term := range terms {
+		if !term.Or {
+			words++
+		}
+	}
+	if words == 0 {
+		return results, nil
+	}
+
+	var err error
+	if databases.SubmissionSearchReady(db) {
+		results.Engine = SearchEngineFTS5
+		results.Results, err = searchSubmissionsFTS(db, siteID, terms, filter)
+	} else {
+		results.Engine = SearchEngineLike
+		results.Results, err = searchSubmissionsLike(db, siteID, terms, filter)
+	}
+	if err != nil {
+		return SearchResults{}, err
+	}
+	return results, nil
+}
+
+func searchSubmissionsFTS(db *sql.DB, siteID string, terms []searchTerm, filter InboxFilter) ([]SearchResult, error) {
+	where, filterArgs := filter.where()
+	query := `
+		SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+		       fs.status, fs.assigned_to, fs.read_at, f.name,
+		       snippet(form_submissions_fts, -1, ?, ?, '…', ?),
+		       bm25(form_submissions_fts, 5.0, 5.0, 3.0, 1.0, 1.0) AS rank
+		FROM form_submissions_fts
+		JOIN form_submissions fs ON fs.id = form_submissions_fts.rowid
+		JOIN forms f ON fs.form_id = f.id
+		WHERE form_submissions_fts MATCH ?` + where + `
+		ORDER BY rank LIMIT ? OFFSET ?`
+
+	args := []interface{}{highlightStart, highlightEnd, snippetTokens, ftsMatchExpression(terms)}
+	args = append(args, filterArgs...)
+	args = append(args, filter.limit(), max(filter.Offset, 0))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search submissions: %w", err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		var snippet sql.NullString
+		result.FormSubmission, err = scanInboxSubmission(withExtraColumns(rows, &result.FormName, &snippet, &result.Rank), siteID)
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = highlightSnippet(snippet.String)
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over search results: %w", err)
+	}
+
+	return results, nil
+}
+
+func searchSubmissionsLike(db *sql.DB, siteID string, terms []searchTerm, filter InboxFilter) ([]SearchResult, error) {
+	query := `
+		SELECT fs.uuid, f.uuid, fs.first_name, fs.last_name, fs.email, fs.tel, fs.tags, fs.subject, fs.message, fs.data, fs.ip_address, fs.user_agent, fs.created_at,
+		       fs.status, fs.assigned_to, fs.read_at, f.name
+		FROM form_submissions fs
+		JOIN forms f ON fs.form_id = f.id
+		WHERE 1=1`
+	args := []interface{}{}
+
+	// Terms joined by OR form one group, every group has to match
+	needles := []string{}
+	for _, group := range orGroups(terms) {
+		conditions := make([]string, 0, len(group))
+		for _, term := range group {
+			conditions = append(conditions, `(COALESCE(fs.first_name, '') || ' ' || COALESCE(fs.last_name, '') || ' ' || fs.email || ' ' ||
+				COALESCE(fs.subject, '') || ' ' || COALESCE(fs.message, '') || ' ' || fs.data) LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+common.EscapeLike(term.Text)+"%")
+			needles = append(needles, term.Text)
+		}
+		query += " AND (" + strings.Join(conditions, " OR ") + ")"
+	}
+
+	where, filterArgs := filter.where()
+	query += where + " ORDER BY fs.created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, filterArgs...)
+	args = append(args, filter.limit(), max(filter.Offset, 0))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search submissions: %w", err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		result.FormSubmission, err = scanInboxSubmission(withExtraColumns(rows, &result.FormName), siteID)
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = likeSnippet(result.FormSubmission, needles)
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over search results: %w", err)
+	}
+
+	return results, nil
+}
+
+// parseSearchTerms splits a query into words, "quoted phrases", prefix words
+// ending in * and OR operators. Everything else is treated as text.
+func parseSearchTerms(q string) []searchTerm {
+	terms := []searchTerm{}
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[i]):
+			i++
+		case runes[i] == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if text := strings.Join(strings.Fields(string(runes[i+1:end])), " "); text != "" {
+				terms = append(terms, searchTerm{Text: text, Phrase: true})
+			}
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			i = end
+
+			if word == "OR" {
+				// Only meaningful between two terms
+				if len(terms) > 0 && !terms[len(terms)-1].Or {
+					terms = append(terms, searchTerm{Or: true})
+				}
+				continue
+			}
+
+			prefix := strings.HasSuffix(word, "*")
+			word = strings.TrimRight(word, "*")
+			if word != "" {
+				terms = append(terms, searchTerm{Text: word, Prefix: prefix})
+			}
+		}
+	}
+
+	if len(terms) > 0 && terms[len(terms)-1].Or {
+		terms = terms[:len(terms)-1]
+	}
+	return terms
+}
+
+// orGroups splits terms at every term that is not joined to the previous one by OR
+func orGroups(terms []searchTerm) [][]searchTerm {
+	groups := [][]searchTerm{}
+	joined := false
+	for _, term := range terms {
+		if term.Or {
+			joined = true
+			continue
+		}
+		if joined && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+		} else {
+			groups = append(groups, []searchTerm{term})
+		}
+		joined = false
+	}
+	return groups
+}
+
+// ftsMatchExpression builds an FTS5 MATCH expression, quoting every term so
+// user input can never be read as FTS5 syntax
+func ftsMatchExpression(terms []searchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term.Or {
+			parts = append(parts, "OR")
+			continue
+		}
+		part := `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+		if term.Prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// highlightSnippet escapes an FTS5 snippet and turns the match sentinels into <mark> tags
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightEnd, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// likeSnippet cuts an excerpt around the first match in the submission's text
+// fields, then its custom fields, and highlights every needle in it
+func likeSnippet(submission FormSubmission, needles []string) string {
+	fields := []string{}
+	for _, field := range []*string{submission.Subject, submission.Message} {
+		if field != nil {
+			fields = append(fields, *field)
+		}
+	}
+	fields = append(fields, submission.Email)
+	for _, key := range slices.Sorted(maps.Keys(submission.Data)) {
+		fields = append(fields, submission.Data[key])
+	}
+
+	for _, text := range fields {
+		lower := strings.ToLower(text)
+		if len(lower) != len(text) {
+			// Case folding changed byte offsets, match case-sensitively instead
+			lower = text
+		}
+		for _, needle := range needles {
+			idx := strings.Index(lower, strings.ToLower(needle))
+			if idx < 0 {
+				continue
+			}
+
+			start := max(idx-snippetContext, 0)
+			end := min(idx+len(needle)+snippetContext, len(text))
+			for start > 0 && !isRuneStart(text[start]) {
+				start--
+			}
+			for end < len(text) && !isRuneStart(text[end]) {
+				end++
+			}
+
+			excerpt := markNeedles(text[start:end], needles)
+			if start > 0 {
+				excerpt = "…" + excerpt
+			}
+			if end < len(text) {
+				excerpt += "…"
+			}
+			return excerpt
+		}
+	}
+
+	return ""
+}
+
+// markNeedles escapes text and wraps every case-insensitive occurrence of a needle in <mark>
+func markNeedles(text string, needles []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return html.EscapeString(text)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := 0
+		for _, needle := range needles {
+			if needle != "" && strings.HasPrefix(lower[i:], strings.ToLower(needle)) && len(needle) > matched {
+				matched = len(needle)
+			}
+		}
+		if matched > 0 {
+			b.WriteString("<mark>" + html.EscapeString(text[i:i+matched]) + "</mark>")
+			i += matched
+			continue
+		}
+
+		next := i + 1
+		for next < len(text) && !isRuneStart(text[next]) {
+			next++
+		}
+		b.WriteString(html.EscapeString(text[i:next]))
+		i = next
+	}
+	return b.String()
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// extraColumnScanner appends destinations for columns selected after the
+// standard submission columns
+type extraColumnScanner struct {
+	row   interface{ Scan(...any) error }
+	extra []any
+}
+
+func withExtraColumns(row interface{ Scan(...any) error }, extra ...any) extraColumnScanner {
+	return extraColumnScanner{row: row, extra: extra}
+}
+
+func (s extraColumnScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
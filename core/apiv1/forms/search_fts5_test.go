@@ -0,0 +1,44 @@
+//go:build sqlite_fts5
+
+package forms
+
+import (
+	"slices"
+	"testing"
+)
+
+// Run with go test -tags sqlite_fts5, like the server is built
+func TestFindSubmissionsFTS5(t *testing.T) {
+	db := newSearchDB(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Words match whole, unlike the LIKE fallback
+		{query: "liver", want: []string{}},
+		{query: "deliv*", want: []string{"sub-ann", "sub-bob", "sub-jane"}},
+		// Diacritics are ignored
+		{query: "cafe", want: []string{"sub-bob"}},
+	}
+	for _, tt := range tests {
+		results, err := FindSubmissions(db, "example.com", tt.query, InboxFilter{})
+		if err != nil {
+			t.Fatalf("FindSubmissions(%s) error = %v", tt.query, err)
+		}
+		if results.Engine != SearchEngineFTS5 {
+			t.Fatalf("engine = %s, want %s", results.Engine, SearchEngineFTS5)
+		}
+		if got := resultIDs(results); !slices.Equal(got, tt.want) {
+			t.Errorf("FindSubmissions(%s) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// A match in the subject ranks above one in the message
+	results, err := FindSubmissions(db, "example.com", "delivery", InboxFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Results) != 2 || results.Results[0].ID != "sub-jane" || results.Results[0].Rank >= results.Results[1].Rank {
+		t.Errorf("results = %+v, want sub-jane ranked first", results.Results)
+	}
+}
@@ -0,0 +1,353 @@
+package forms
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wispy-core/common"
+	"wispy-core/config"
+	"wispy-core/core/site"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxFileSize = 10 << 20 // 10MB per file
+	defaultMaxFiles    = 1
+	maxUploadMemory    = 32 << 20 // Parts above this are spooled to disk by net/http
+	downloadLinkTTL    = 15 * time.Minute
+)
+
+// SubmissionFile represents a file uploaded with a form submission
+type SubmissionFile struct {
+	ID           string    `json:"id" db:"uuid"`
+	SubmissionID string    `json:"submission_id" db:"submission_id"`
+	FieldName    string    `json:"field_name" db:"field_name"`
+	OriginalName string    `json:"original_name" db:"original_name"`
+	StoredPath   string    `json:"-" db:"stored_path"`
+	ContentType  string    `json:"content_type" db:"content_type"`
+	Size         int64     `json:"size" db:"size"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	DownloadURL  string    `json:"download_url,omitempty"`
+}
+
+// ListSubmissionFiles returns the files attached to a submission with short-lived signed download links
+func (f *FormApi) ListSubmissionFiles(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	files, err := getSubmissionFiles(db, chi.URLParam(r, "submissionID"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to get submission files", err)
+		return
+	}
+
+	for i := range files {
+		files[i].DownloadURL = SignedDownloadURL(files[i].ID)
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, files)
+}
+
+// DownloadSubmissionFile streams an uploaded file if the link signature is valid and not expired
+func (f *FormApi) DownloadSubmissionFile(w http.ResponseWriter, r *http.Request) {
+	fileID := chi.URLParam(r, "fileID")
+	query := r.URL.Query()
+	if !common.VerifyExpiring(fileID, query.Get("expires"), query.Get("signature")) {
+		common.RespondWithError(w, r, http.StatusForbidden, "Download link is invalid or has expired", nil)
+		return
+	}
+
+	domain := common.NormalizeHost(r.Host)
+	site, err := f.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := f.getDBConnection(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	file, err := getSubmissionFile(db, fileID)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "File not found", err)
+		return
+	}
+
+	fh, err := os.Open(filepath.Join(UploadsDir(site), file.StoredPath))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "File not found", err)
+		return
+	}
+	defer fh.Close()
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.OriginalName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", file.CreatedAt, fh)
+}
+
+// SignedDownloadURL returns a download link for an uploaded file valid for downloadLinkTTL
+func SignedDownloadURL(fileID string) string {
+	expires, signature := common.SignExpiring(fileID, time.Now().Add(downloadLinkTTL))
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", signature)
+	return "/api/v1/forms/files/" + url.PathEscape(fileID) + "?" + query.Encode()
+}
+
+// isMultipartRequest reports whether the request body is multipart/form-data
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// validateSubmissionFiles checks uploaded files against the form's visible file fields
+// and returns the accepted files keyed by field name
+func validateSubmissionFiles(form Form, multipartForm *multipart.Form, visible map[string]bool) (map[string][]*multipart.FileHeader, ValidationErrors) {
+	accepted := make(map[string][]*multipart.FileHeader)
+	errs := make(ValidationErrors)
+
+	for _, field := range form.Fields {
+		if field.Type != "file" || !visible[field.Name] {
+			continue
+		}
+
+		var files []*multipart.FileHeader
+		if multipartForm != nil {
+			for _, file := range multipartForm.File[field.Name] {
+				if file.Size > 0 || file.Filename != "" {
+					files = append(files, file)
+				}
+			}
+		}
+
+		if len(files) == 0 {
+			if field.Required {
+				errs.Add(field.Name, "is required")
+			}
+			continue
+		}
+
+		maxFiles := field.MaxFiles
+		if maxFiles <= 0 {
+			maxFiles = defaultMaxFiles
+		}
+		if len(files) > maxFiles {
+			errs.Add(field.Name, fmt.Sprintf("accepts at most %d file(s)", maxFiles))
+			continue
+		}
+
+		maxSize := field.MaxFileSize
+		if maxSize <= 0 {
+			maxSize = defaultMaxFileSize
+		}
+
+		valid := true
+		for _, file := range files {
+			if file.Size > maxSize {
+				errs.Add(field.Name, fmt.Sprintf("file '%s' exceeds the maximum size of %d bytes", file.Filename, maxSize))
+				valid = false
+				continue
+			}
+
+			contentType, err := detectContentType(file)
+			if err != nil {
+				errs.Add(field.Name, fmt.Sprintf("file '%s' could not be read", file.Filename))
+				valid = false
+				continue
+			}
+			if !isAllowedContentType(contentType, field.AllowedTypes) {
+				errs.Add(field.Name, fmt.Sprintf("file '%s' has a type that is not allowed (%s)", file.Filename, contentType))
+				valid = false
+				continue
+			}
+			file.Header.Set("Content-Type", contentType)
+		}
+
+		if valid {
+			accepted[field.Name] = files
+		}
+	}
+
+	return accepted, errs
+}
+
+// detectContentType sniffs the MIME type from the file contents rather than trusting the client
+func detectContentType(file *multipart.FileHeader) (string, error) {
+	fh, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(fh, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "application/octet-stream", nil
+	}
+	return mediaType, nil
+}
+
+// isAllowedContentType matches a MIME type against a list that may contain wildcards like "image/*".
+// An empty list allows every type.
+func isAllowedContentType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == contentType || a == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UploadsDir returns the directory holding form uploads for a site
+func UploadsDir(s site.Site) string {
+	return filepath.Join(config.GetGlobalConfig().GetSitesPath(), s.GetDomain(), "uploads", "forms")
+}
+
+// storeSubmissionFiles writes uploaded files to the tenant's storage and links them to
+// the submission saved in tx. Files written before a failure are left for the caller
+// to remove with the submission's directory.
+func storeSubmissionFiles(tx *sql.Tx, uploadsDir, submissionID string, uploads map[string][]*multipart.FileHeader) error {
+	const saveFileSQL = `
+		INSERT INTO form_submission_files (uuid, submission_id, field_name, original_name, stored_path, content_type, size, created_at)
+		VALUES (?, (SELECT id FROM form_submissions WHERE uuid = ?), ?, ?, ?, ?, ?, ?)`
+
+	submissionDir := filepath.Join(uploadsDir, submissionID)
+	if err := common.EnsureDir(submissionDir); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	for fieldName, files := range uploads {
+		for _, file := range files {
+			fileID := uuid.New().String()
+			storedName := fileID + strings.ToLower(filepath.Ext(filepath.Base(file.Filename)))
+			storedPath := filepath.Join(submissionID, storedName)
+
+			size, err := copyUploadedFile(file, filepath.Join(submissionDir, storedName))
+			if err != nil {
+				return fmt.Errorf("failed to store file %s: %w", file.Filename, err)
+			}
+
+			_, err = tx.Exec(saveFileSQL,
+				fileID,
+				submissionID,
+				fieldName,
+				filepath.Base(file.Filename),
+				storedPath,
+				file.Header.Get("Content-Type"),
+				size,
+				time.Now(),
+			)
+			if err != nil {
+				os.Remove(filepath.Join(submissionDir, storedName))
+				return fmt.Errorf("failed to save file record: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func copyUploadedFile(file *multipart.FileHeader, dest string) (int64, error) {
+	src, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	return io.Copy(dst, src)
+}
+
+func getSubmissionFiles(db *sql.DB, submissionID string) ([]SubmissionFile, error) {
+	const getFilesSQL = `
+		SELECT f.uuid, s.uuid, f.field_name, f.original_name, f.stored_path, f.content_type, f.size, f.created_at
+		FROM form_submission_files f
+		JOIN form_submissions s ON f.submission_id = s.id
+		WHERE s.uuid = ?
+		ORDER BY f.created_at ASC`
+
+	rows, err := db.Query(getFilesSQL, submissionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query submission files: %w", err)
+	}
+	defer rows.Close()
+
+	files := []SubmissionFile{}
+	for rows.Next() {
+		var file SubmissionFile
+		if err := rows.Scan(&file.ID, &file.SubmissionID, &file.FieldName, &file.OriginalName, &file.StoredPath, &file.ContentType, &file.Size, &file.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan submission file row: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over submission file rows: %w", err)
+	}
+
+	return files, nil
+}
+
+func getSubmissionFile(db *sql.DB, fileID string) (SubmissionFile, error) {
+	const getFileSQL = `
+		SELECT f.uuid, s.uuid, f.field_name, f.original_name, f.stored_path, f.content_type, f.size, f.created_at
+		FROM form_submission_files f
+		JOIN form_submissions s ON f.submission_id = s.id
+		WHERE f.uuid = ?`
+
+	var file SubmissionFile
+	err := db.QueryRow(getFileSQL, fileID).Scan(&file.ID, &file.SubmissionID, &file.FieldName, &file.OriginalName, &file.StoredPath, &file.ContentType, &file.Size, &file.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SubmissionFile{}, common.NewError("file not found")
+		}
+		return SubmissionFile{}, fmt.Errorf("failed to get submission file: %w", err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,331 @@
+package forms
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"wispy-core/common"
+)
+
+// maxFlashValueLength limits how much of each submitted value is echoed back to the page
+const maxFlashValueLength = 500
+
+// ValidationErrors maps field names to their validation messages
+type ValidationErrors map[string][]string
+
+// Add records a validation message for a field
+func (e ValidationErrors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Merge adds all messages from other
+func (e ValidationErrors) Merge(other ValidationErrors) {
+	for field, messages := range other {
+		e[field] = append(e[field], messages...)
+	}
+}
+
+// Error implements the error interface with a plain text summary
+func (e ValidationErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var parts []string
+	for _, field := range fields {
+		for _, message := range e[field] {
+			parts = append(parts, "field '"+field+"' "+message)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// FormState is handed back to the page after a classic form post so it can
+// re-render errors, previously entered values or the success message
+type FormState struct {
+	FormID  string            `json:"form_id"`
+	Success bool              `json:"success"`
+	Message string            `json:"message,omitempty"`
+	Errors  ValidationErrors  `json:"errors,omitempty"`
+	Values  map[string]string `json:"values,omitempty"`
+	Step    int               `json:"step,omitempty"`  // step to re-open multi-step forms on
+	Draft   string            `json:"draft,omitempty"` // resume token of the visitor's draft
+}
+
+var (
+	patternCacheMu sync.RWMutex
+	patternCache   = make(map[string]*regexp.Regexp)
+)
+
+// compilePattern compiles a field pattern anchored like the HTML pattern attribute
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patternCacheMu.RLock()
+	re, ok := patternCache[pattern]
+	patternCacheMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	patternCacheMu.Lock()
+	patternCache[pattern] = re
+	patternCacheMu.Unlock()
+	return re, nil
+}
+
+// validateFieldRules checks the declarative rules of a field definition itself
+func validateFieldRules(field FormField) error {
+	if field.Pattern != "" {
+		if _, err := compilePattern(field.Pattern); err != nil {
+			return common.NewErrorf("field '%s' has an invalid pattern: %v", field.Name, err)
+		}
+	}
+	if field.MinLength > 0 && field.MaxLength > 0 && field.MinLength > field.MaxLength {
+		return common.NewErrorf("field '%s' has min_length greater than max_length", field.Name)
+	}
+	if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+		return common.NewErrorf("field '%s' has min greater than max", field.Name)
+	}
+	return nil
+}
+
+// validateFieldValues checks submitted values against a field's type and rules
+func (f *FormApi) validateFieldValues(field FormField, values []string) []string {
+	var messages []string
+
+	for _, value := range values {
+		switch field.Type {
+		case "email":
+			if err := f.validate.Var(value, "email"); err != nil {
+				messages = append(messages, "must be a valid email address")
+			}
+		case "tel":
+			if err := validatePhoneNumber(value); err != nil {
+				messages = append(messages, "must be a valid phone number")
+			}
+		case "url":
+			if u, err := url.ParseRequestURI(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				messages = append(messages, "must be a valid URL")
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				messages = append(messages, "must be a valid date (YYYY-MM-DD)")
+			}
+		case "time":
+			if _, err := time.Parse("15:04", value); err != nil {
+				if _, err := time.Parse("15:04:05", value); err != nil {
+					messages = append(messages, "must be a valid time (HH:MM)")
+				}
+			}
+		case "number":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				messages = append(messages, "must be a number")
+				break
+			}
+			if field.Min != nil && number < *field.Min {
+				messages = append(messages, "must be at least "+strconv.FormatFloat(*field.Min, 'f', -1, 64))
+			}
+			if field.Max != nil && number > *field.Max {
+				messages = append(messages, "must be at most "+strconv.FormatFloat(*field.Max, 'f', -1, 64))
+			}
+		case "select", "radio", "checkbox":
+			if len(field.Options) > 0 && !hasOption(field.Options, value) {
+				messages = append(messages, "has a value that is not one of the allowed options")
+			}
+		}
+
+		length := utf8.RuneCountInString(value)
+		if field.MinLength > 0 && length < field.MinLength {
+			messages = append(messages, "must be at least "+strconv.Itoa(field.MinLength)+" characters")
+		}
+		if field.MaxLength > 0 && length > field.MaxLength {
+			messages = append(messages, "must be at most "+strconv.Itoa(field.MaxLength)+" characters")
+		}
+
+		if field.Pattern != "" {
+			re, err := compilePattern(field.Pattern)
+			if err != nil {
+				common.Warning("Skipping invalid pattern on field %s: %v", field.Name, err)
+			} else if !re.MatchString(value) {
+				message := field.PatternMessage
+				if message == "" {
+					message = "is not in the expected format"
+				}
+				messages = append(messages, message)
+			}
+		}
+	}
+
+	return messages
+}
+
+func hasOption(options []FormFieldOption, value string) bool {
+	for _, option := range options {
+		if option.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nonEmptyValues trims values and drops the empty ones
+func nonEmptyValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// respondWithValidationErrors returns structured errors as JSON for fetch-based forms,
+// or stores them in a flash cookie and sends a classic post back to the page it came from
+func (f *FormApi) respondWithValidationErrors(w http.ResponseWriter, r *http.Request, form Form, errs ValidationErrors) {
+	if wantsJSONResponse(r) {
+		common.RespondWithJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"success": false,
+			"message": "Please correct the errors below",
+			"errors":  errs,
+		})
+		return
+	}
+
+	referer := sameHostReferer(r)
+	if referer == "" {
+		common.RespondWithError(w, r, http.StatusBadRequest, errs.Error(), errs)
+		return
+	}
+
+	state := FormState{
+		FormID: form.ID,
+		Errors: errs,
+		Values: submittedValues(r.Form, form),
+		Step:   firstErrorStep(form, errs),
+		Draft:  r.FormValue(draftField),
+	}
+	if err := common.SetFlash(w, common.FormStateFlash, state); err != nil {
+		// Too large to echo the values back, keep the errors only
+		state.Values = nil
+		if err := common.SetFlash(w, common.FormStateFlash, state); err != nil {
+			common.RespondWithError(w, r, http.StatusBadRequest, errs.Error(), errs)
+			return
+		}
+	}
+
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+// firstErrorStep returns the earliest step with a validation error, 0 for single page forms
+func firstErrorStep(form Form, errs ValidationErrors) int {
+	if stepCount(form) == 1 {
+		return 0
+	}
+	first := 0
+	for _, field := range form.Fields {
+		if step := fieldStep(field); len(errs[field.Name]) > 0 && (first == 0 || step < first) {
+			first = step
+		}
+	}
+	return first
+}
+
+// setSuccessState lets the page the visitor is redirected to render the form's success message
+func setSuccessState(w http.ResponseWriter, form Form, message string) {
+	if confirmation, ok := form.Metadata["confirmation_message"].(string); ok && confirmation != "" {
+		message = confirmation
+	}
+	if err := common.SetFlash(w, common.FormStateFlash, FormState{FormID: form.ID, Success: true, Message: message}); err != nil {
+		common.Warning("Failed to set form success state: %v", err)
+	}
+}
+
+// sameHostReferer returns the referring path when it belongs to the requesting host
+func sameHostReferer(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host == "" || referer.Host != r.Host {
+		return ""
+	}
+	return referer.RequestURI()
+}
+
+// submittedValues collects the values to pre-fill the form with, skipping control fields and files
+func submittedValues(formData url.Values, form Form) map[string]string {
+	skip := make(map[string]bool)
+	for _, field := range form.Fields {
+		if field.Type == "file" {
+			skip[field.Name] = true
+		}
+	}
+
+	values := make(map[string]string)
+	for name, vals := range formData {
+		if skip[name] || (strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__")) || len(vals) == 0 {
+			continue
+		}
+		value := strings.Join(vals, ", ")
+		if len(value) > maxFlashValueLength {
+			// Cut at the start of a character, so a multi-byte one is not split
+			cut := maxFlashValueLength
+			for cut > 0 && !utf8.RuneStart(value[cut]) {
+				cut--
+			}
+			value = value[:cut]
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// validateFields checks every visible field, including the ones missing from the submission.
+// With lastStep above zero only the fields up to and including that step are checked.
+func (f *FormApi) validateFields(formData url.Values, form Form, visible map[string]bool, lastStep int) ValidationErrors {
+	errs := make(ValidationErrors)
+	fieldMap := make(map[string]FormField)
+
+	for _, field := range form.Fields {
+		fieldMap[field.Name] = field
+		if field.Type == "file" || !visible[field.Name] {
+			continue // Files are validated separately from the multipart body
+		}
+		if lastStep > 0 && fieldStep(field) > lastStep {
+			continue
+		}
+
+		values := nonEmptyValues(formData[field.Name])
+		if len(values) == 0 {
+			if field.Required {
+				errs.Add(field.Name, "is required")
+			}
+			continue
+		}
+
+		for _, message := range f.validateFieldValues(field, values) {
+			errs.Add(field.Name, message)
+		}
+
+		if field.Matches != "" && values[0] != strings.TrimSpace(formData.Get(field.Matches)) {
+			label := field.Matches
+			if other, ok := fieldMap[field.Matches]; ok && other.Label != "" {
+				label = other.Label
+			}
+			errs.Add(field.Name, "must match "+label)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,165 @@
+package privacy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wispy-core/auth"
+	"wispy-core/common"
+	"wispy-core/config"
+	"wispy-core/core/apiv1/forms"
+	"wispy-core/core/site"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PrivacyApi struct {
+	siteManager    site.SiteManager
+	authMiddleware *auth.Middleware
+}
+
+func NewPrivacyApi(siteManager site.SiteManager) *PrivacyApi {
+	globalConfig := config.GetGlobalConfig()
+	return &PrivacyApi{
+		siteManager:    siteManager,
+		authMiddleware: globalConfig.GetCoreAuthMiddleware(),
+	}
+}
+
+// MountApi registers the data subject routes. Addresses are always sent in the
+// request body so they do not end up in access logs.
+func (a *PrivacyApi) MountApi(r chi.Router) {
+	r.Route("/privacy", func(r chi.Router) {
+		r.Use(a.authMiddleware.RequireAuth)
+
+		r.Post("/lookup", a.Lookup)
+		r.Post("/export", a.Export)
+		r.Post("/erase", a.Erase)
+		r.Get("/requests", a.ListRequests)
+	})
+}
+
+// Lookup returns every record held on the posted email
+func (a *PrivacyApi) Lookup(w http.ResponseWriter, r *http.Request) {
+	site, ok := a.siteForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := Find(site, r.FormValue("email"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Failed to look up data subject", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// Export downloads everything held on the posted email as JSON or, with format=zip,
+// as an archive that includes uploaded files
+func (a *PrivacyApi) Export(w http.ResponseWriter, r *http.Request) {
+	site, ok := a.siteForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := Find(site, r.FormValue("email"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Failed to export data subject", err)
+		return
+	}
+
+	RecordExport(site, report, SourceAPI, actorFromRequest(r))
+	ServeExport(w, r, site, report, r.FormValue("format"))
+}
+
+// Erase deletes or anonymises everything held on the posted email. The address
+// has to be repeated in confirm to guard against accidental requests.
+func (a *PrivacyApi) Erase(w http.ResponseWriter, r *http.Request) {
+	site, ok := a.siteForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	email := r.FormValue("email")
+	if !strings.EqualFold(strings.TrimSpace(r.FormValue("confirm")), strings.TrimSpace(email)) {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Repeat the email address in confirm to erase its data", nil)
+		return
+	}
+
+	action := r.FormValue("action")
+	if action == "" {
+		action = ActionErase
+	}
+
+	request, err := Erase(site, email, action, SourceAPI, actorFromRequest(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if request == nil {
+			status = http.StatusBadRequest
+		}
+		common.RespondWithError(w, r, status, "Failed to "+action+" data subject", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, request)
+}
+
+// ListRequests returns the audit log, newest first
+func (a *PrivacyApi) ListRequests(w http.ResponseWriter, r *http.Request) {
+	site, ok := a.siteForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	requests, err := ListRequests(site, "", limit)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to list data subject requests", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, requests)
+}
+
+// ServeExport writes a report as a JSON or ZIP download
+func ServeExport(w http.ResponseWriter, r *http.Request, s site.Site, report *Report, format string) {
+	filename := fmt.Sprintf("data-export-%s-%s", HashEmail(report.Email)[:8], time.Now().Format("2006-01-02"))
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if format == FormatZip {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		if err := WriteZip(w, report, forms.UploadsDir(s)); err != nil {
+			common.Error("Failed to write data export: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	if err := WriteJSON(w, report); err != nil {
+		common.Error("Failed to write data export: %v", err)
+	}
+}
+
+func (a *PrivacyApi) siteForRequest(w http.ResponseWriter, r *http.Request) (site.Site, bool) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := a.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return nil, false
+	}
+	return site, true
+}
+
+// actorFromRequest identifies the CMS user making a request for the audit log
+func actorFromRequest(r *http.Request) string {
+	if user, err := auth.UserFromContext(r.Context()); err == nil {
+		return user.ID
+	}
+	return "unknown"
+}
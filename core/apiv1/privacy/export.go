@@ -0,0 +1,98 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"wispy-core/common"
+)
+
+// Export formats
+const (
+	FormatJSON = "json"
+	FormatZip  = "zip"
+)
+
+const exportReadme = `This archive holds the personal data %s stores about %s,
+generated on %s.
+
+data.json   every database record tied to the address, grouped by database and table
+files/      files uploaded through the site's forms
+
+Secrets such as password hashes and session tokens are shown as [redacted].
+`
+
+// WriteJSON writes the report as indented JSON
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("failed to encode export: %w", err)
+	}
+	return nil
+}
+
+// WriteZip writes the report together with the subject's uploaded files.
+// uploadsDir is the site's form uploads directory, see forms.UploadsDir.
+func WriteZip(w io.Writer, report *Report, uploadsDir string) error {
+	archive := zip.NewWriter(w)
+
+	readme, err := archive.Create("README.txt")
+	if err != nil {
+		return fmt.Errorf("failed to add README: %w", err)
+	}
+	if _, err := fmt.Fprintf(readme, exportReadme, report.Site, report.Email, report.GeneratedAt.Format("2006-01-02 15:04 MST")); err != nil {
+		return fmt.Errorf("failed to write README: %w", err)
+	}
+
+	data, err := archive.Create("data.json")
+	if err != nil {
+		return fmt.Errorf("failed to add data.json: %w", err)
+	}
+	if err := WriteJSON(data, report); err != nil {
+		return err
+	}
+
+	for _, file := range report.Files {
+		if err := addUploadedFile(archive, uploadsDir, file); err != nil {
+			// A missing upload should not keep the rest of the data from the subject
+			common.Warning("Skipping %s in data export: %v", file.Path, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+func addUploadedFile(archive *zip.Writer, uploadsDir string, file File) error {
+	relPath := filepath.Clean(file.Path)
+	if filepath.IsAbs(relPath) || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return common.NewError("invalid upload path")
+	}
+
+	src, err := os.Open(filepath.Join(uploadsDir, relPath))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Keep the submission directory so files with the same name stay apart
+	base := filepath.Base(file.Name)
+	if base == "." || base == string(filepath.Separator) {
+		base = filepath.Base(relPath)
+	}
+	name := filepath.ToSlash(filepath.Join("files", filepath.Dir(relPath), base))
+	dest, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dest, src)
+	return err
+}
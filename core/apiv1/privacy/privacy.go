@@ -0,0 +1,709 @@
+package privacy
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"wispy-core/common"
+	"wispy-core/core/apiv1/forms"
+	"wispy-core/core/site"
+	"wispy-core/core/tenant/databases"
+
+	"github.com/google/uuid"
+)
+
+const privacyDBName = "privacy"
+
+// uploadsDir locates a site's form uploads, replaced in tests
+var uploadsDir = forms.UploadsDir
+
+// Data subject request actions
+const (
+	ActionExport    = "export"
+	ActionErase     = "erase"
+	ActionAnonymise = "anonymise"
+)
+
+// Where a request was made from
+const (
+	SourceCMS = "cms"
+	SourceAPI = "api"
+	SourceCLI = "cli"
+)
+
+// Audit log states
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// redactedColumns are secrets that are never included in an export
+var redactedColumns = map[string]bool{
+	"password_hash":     true,
+	"session_token":     true,
+	"confirm_token":     true,
+	"unsubscribe_token": true,
+	"token":             true, // form draft resume tokens
+}
+
+// Record is a database row tied to a data subject
+type Record struct {
+	Database string                 `json:"database"`
+	Table    string                 `json:"table"`
+	Fields   map[string]interface{} `json:"fields"`
+}
+
+// File is an uploaded file tied to a data subject
+type File struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"` // relative to the site's form uploads directory
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Report lists everything a site holds on a data subject
+type Report struct {
+	Email       string         `json:"email"`
+	Site        string         `json:"site"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Counts      map[string]int `json:"counts"` // rows per "database.table"
+	Records     []Record       `json:"records"`
+	Files       []File         `json:"files"`
+}
+
+// Request is an entry of the data subject request audit log
+type Request struct {
+	ID        string         `json:"id"`
+	EmailHash string         `json:"email_hash"`
+	Action    string         `json:"action"`
+	Source    string         `json:"source"`
+	Actor     string         `json:"actor"`
+	Status    string         `json:"status"`
+	Summary   map[string]int `json:"summary"`
+	Error     string         `json:"error,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// subject identifies the person a request is about
+type subject struct {
+	Email      string   // normalised address
+	SessionIDs []string // user session ids and tokens, used to find analytics rows
+}
+
+// rule locates the rows of one table that are tied to a subject
+type rule struct {
+	database string
+	table    string
+	// where returns the condition matching the subject, or "" when nothing can match
+	where func(s subject) (string, []interface{})
+	// anonymise holds the SET clause used instead of deleting rows when
+	// anonymising. Rules without one are deleted in both modes.
+	anonymise     string
+	anonymiseArgs func(s subject) []interface{}
+}
+
+// submissionMatchSQL selects the submissions made with an address or holding it in
+// a custom field. Their data is stored as "key:value|key:value", see
+// forms.parseSubmissionData, so a field value sits between a colon and a bar.
+const submissionMatchSQL = `
+	SELECT id FROM form_submissions
+	WHERE LOWER(email) = ?
+	   OR '|' || LOWER(data) || '|' LIKE ? ESCAPE '\'`
+
+func submissionMatchArgs(s subject) []interface{} {
+	return []interface{}{s.Email, "%:" + common.EscapeLike(s.Email) + "|%"}
+}
+
+func byEmail(s subject) (string, []interface{}) {
+	return "LOWER(email) = ?", []interface{}{s.Email}
+}
+
+func bySubmission(s subject) (string, []interface{}) {
+	return "submission_id IN (" + submissionMatchSQL + ")", submissionMatchArgs(s)
+}
+
+func bySession(s subject) (string, []interface{}) {
+	if len(s.SessionIDs) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(s.SessionIDs))
+	for i, id := range s.SessionIDs {
+		args[i] = id
+	}
+	return "session_id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ") + ")", args
+}
+
+func erasedEmailArg(s subject) []interface{} {
+	return []interface{}{erasedEmail(s.Email)}
+}
+
+// rules lists the known personal data of a tenant, parents before children.
+// Tables with an email column that are not listed here are handled generically.
+var rules = []rule{
+	{
+		database: "forms",
+		table:    "form_submissions",
+		where: func(s subject) (string, []interface{}) {
+			return "id IN (" + submissionMatchSQL + ")", submissionMatchArgs(s)
+		},
+		anonymise: `first_name = NULL, last_name = NULL, email = ?, tel = NULL, tags = NULL, subject = NULL, message = NULL,
+			data = '', ip_address = '', user_agent = ''`,
+		anonymiseArgs: erasedEmailArg,
+	},
+	{database: "forms", table: "form_submission_notes", where: bySubmission},
+	{database: "forms", table: "form_submission_files", where: bySubmission},
+	{
+		database: "forms",
+		table:    "form_submission_drafts",
+		// Unlike submissions, drafts keep their values as JSON, see forms.saveDraft
+		where: func(s subject) (string, []interface{}) {
+			return `LOWER(email) = ?
+				OR (json_valid(data) AND EXISTS (SELECT 1 FROM json_each(form_submission_drafts.data) WHERE LOWER(CAST(json_each.value AS TEXT)) = ?))`,
+				[]interface{}{s.Email, s.Email}
+		},
+	},
+	{
+		database: "users",
+		table:    "users",
+		where:    byEmail,
+		anonymise: `username = 'erased-' || uuid, email = ?, password_hash = '', first_name = NULL, last_name = NULL,
+			active = 0, email_verified = 0, updated_at = CURRENT_TIMESTAMP`,
+		anonymiseArgs: erasedEmailArg,
+	},
+	{
+		database: "users",
+		table:    "user_sessions",
+		where: func(s subject) (string, []interface{}) {
+			return "user_id IN (SELECT id FROM users WHERE LOWER(email) = ?)", []interface{}{s.Email}
+		},
+	},
+	{
+		database:  "analytics",
+		table:     "page_views",
+		where:     bySession,
+		anonymise: "ip_address = NULL, user_agent = NULL, session_id = NULL",
+	},
+	{
+		database: "analytics",
+		table:    "events",
+		where: func(s subject) (string, []interface{}) {
+			where, args := bySession(s)
+			if where != "" {
+				where += " OR "
+			}
+			where += `LOWER(event_data) LIKE ? ESCAPE '\'`
+			return where, append(args, "%"+common.EscapeLike(s.Email)+"%")
+		},
+		anonymise: "ip_address = NULL, session_id = NULL, event_data = NULL",
+	},
+	{
+		database: "subscribers",
+		table:    "subscribers",
+		where:    byEmail,
+		anonymise: `email = ?, status = 'unsubscribed', consent_ip = NULL, consent_user_agent = NULL,
+			confirmed_ip = NULL, unsubscribed_at = COALESCE(unsubscribed_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP`,
+		anonymiseArgs: erasedEmailArg,
+	},
+	{
+		database: "subscribers",
+		table:    "subscriber_list_members",
+		where: func(s subject) (string, []interface{}) {
+			return "subscriber_id IN (SELECT id FROM subscribers WHERE LOWER(email) = ?)", []interface{}{s.Email}
+		},
+		anonymise: `status = 'unsubscribed', confirm_token = NULL, consent_ip = NULL, consent_user_agent = NULL, confirmed_ip = NULL,
+			unsubscribed_at = COALESCE(unsubscribed_at, CURRENT_TIMESTAMP)`,
+	},
+}
+
+// NormalizeEmail trims and lowercases an address, rejecting anything that is not one
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", common.NewError("email is required")
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "", common.NewError("invalid email address")
+	}
+	return email, nil
+}
+
+// HashEmail returns the hex SHA-256 of a normalised address, as stored in the audit log
+func HashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// erasedEmail is the placeholder address left in rows that were anonymised
+func erasedEmail(email string) string {
+	return "erased-" + HashEmail(email)[:16] + "@erased.invalid"
+}
+
+// Find collects every record the site's databases hold on email
+func Find(s site.Site, email string) (*Report, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	dbManager := s.GetDatabaseManager()
+	if dbManager == nil {
+		return nil, common.NewError("database manager not available")
+	}
+	dbNames, err := tenantDatabases(dbManager)
+	if err != nil {
+		return nil, err
+	}
+
+	subj, err := loadSubject(dbManager, dbNames, email)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Email:       email,
+		Site:        s.GetDomain(),
+		GeneratedAt: time.Now(),
+		Counts:      map[string]int{},
+		Records:     []Record{},
+		Files:       []File{},
+	}
+
+	for _, dbName := range dbNames {
+		db, err := dbManager.GetConnection(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s database: %w", dbName, err)
+		}
+
+		dbRules, err := rulesFor(db, dbName)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range dbRules {
+			where, args := rule.where(subj)
+			if where == "" {
+				continue
+			}
+			records, err := queryRecords(db, dbName, rule.table, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if len(records) > 0 {
+				report.Counts[dbName+"."+rule.table] = len(records)
+				report.Records = append(report.Records, records...)
+			}
+		}
+	}
+
+	for _, record := range report.Records {
+		if record.Database == "forms" && record.Table == "form_submission_files" {
+			report.Files = append(report.Files, File{
+				Name:        fmt.Sprint(record.Fields["original_name"]),
+				Path:        fmt.Sprint(record.Fields["stored_path"]),
+				ContentType: fmt.Sprint(record.Fields["content_type"]),
+				Size:        toInt64(record.Fields["size"]),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Erase deletes (ActionErase) or anonymises (ActionAnonymise) everything the
+// site's databases hold on email, and records the request in the audit log.
+// Each database is changed in its own transaction.
+func Erase(s site.Site, email, action, source, actor string) (*Request, error) {
+	if action != ActionErase && action != ActionAnonymise {
+		return nil, common.NewError("invalid action " + action)
+	}
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	dbManager := s.GetDatabaseManager()
+	if dbManager == nil {
+		return nil, common.NewError("database manager not available")
+	}
+	dbNames, err := tenantDatabases(dbManager)
+	if err != nil {
+		return nil, err
+	}
+
+	subj, err := loadSubject(dbManager, dbNames, email)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := map[string]int{}
+	var submissionIDs []string
+	for _, dbName := range dbNames {
+		ids, err := eraseDatabase(dbManager, dbName, subj, action, summary)
+		if err != nil {
+			request := recordRequest(s, email, action, source, actor, summary, err)
+			return request, err
+		}
+		submissionIDs = append(submissionIDs, ids...)
+	}
+
+	// Uploaded files go in both modes, their rows were deleted
+	if len(submissionIDs) > 0 {
+		forms.RemoveSubmissionUploads(uploadsDir(s), submissionIDs)
+	}
+
+	common.Info("Data subject %s completed for %s: %v", action, s.GetDomain(), summary)
+	return recordRequest(s, email, action, source, actor, summary, nil), nil
+}
+
+// eraseDatabase applies the rules of one database, children first, and returns the
+// uuids of the form submissions whose uploads should be removed
+func eraseDatabase(dbManager databases.Manager, dbName string, subj subject, action string, summary map[string]int) ([]string, error) {
+	db, err := dbManager.GetConnection(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", dbName, err)
+	}
+
+	dbRules, err := rulesFor(db, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction on %s: %w", dbName, err)
+	}
+	defer tx.Rollback()
+
+	var submissionIDs []string
+	if dbName == "forms" {
+		rows, err := tx.Query("SELECT uuid FROM form_submissions WHERE id IN ("+submissionMatchSQL+")", submissionMatchArgs(subj)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find submissions: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan submission id: %w", err)
+			}
+			submissionIDs = append(submissionIDs, id)
+		}
+		rows.Close()
+	}
+
+	counts := map[string]int{}
+	for i := len(dbRules) - 1; i >= 0; i-- {
+		rule := dbRules[i]
+		where, args := rule.where(subj)
+		if where == "" {
+			continue
+		}
+
+		query := "DELETE FROM " + quoteIdent(rule.table) + " WHERE " + where
+		if action == ActionAnonymise && rule.anonymise != "" {
+			var setArgs []interface{}
+			if rule.anonymiseArgs != nil {
+				setArgs = rule.anonymiseArgs(subj)
+			}
+			query = "UPDATE " + quoteIdent(rule.table) + " SET " + rule.anonymise + " WHERE " + where
+			args = append(setArgs, args...)
+		}
+
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to %s %s.%s: %w", action, dbName, rule.table, err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+			counts[dbName+"."+rule.table] = int(affected)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit %s: %w", dbName, err)
+	}
+	for key, count := range counts {
+		summary[key] = count
+	}
+	return submissionIDs, nil
+}
+
+// tenantDatabases returns the site's existing databases, the audit log excluded
+func tenantDatabases(dbManager databases.Manager) ([]string, error) {
+	names, err := dbManager.ListDatabases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	dbNames := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != privacyDBName {
+			dbNames = append(dbNames, name)
+		}
+	}
+	sort.Strings(dbNames)
+	return dbNames, nil
+}
+
+// loadSubject collects the identifiers linked to email in other databases
+func loadSubject(dbManager databases.Manager, dbNames []string, email string) (subject, error) {
+	subj := subject{Email: email}
+
+	hasUsers := false
+	for _, name := range dbNames {
+		hasUsers = hasUsers || name == "users"
+	}
+	if !hasUsers {
+		return subj, nil
+	}
+
+	db, err := dbManager.GetConnection("users")
+	if err != nil {
+		return subj, fmt.Errorf("failed to open users database: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT uuid, session_token FROM user_sessions
+		WHERE user_id IN (SELECT id FROM users WHERE LOWER(email) = ?)`, email)
+	if err != nil {
+		return subj, fmt.Errorf("failed to look up sessions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, token string
+		if err := rows.Scan(&id, &token); err != nil {
+			return subj, fmt.Errorf("failed to scan session: %w", err)
+		}
+		subj.SessionIDs = append(subj.SessionIDs, id, token)
+	}
+	return subj, rows.Err()
+}
+
+// rulesFor returns the rules of a database that apply to its tables, followed by
+// generic rules for any other table with an email column
+func rulesFor(db *sql.DB, dbName string) ([]rule, error) {
+	tables, err := tableNames(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables of %s: %w", dbName, err)
+	}
+
+	covered := map[string]bool{}
+	dbRules := []rule{}
+	for _, r := range rules {
+		if r.database == dbName && tables[r.table] {
+			dbRules = append(dbRules, r)
+			covered[r.table] = true
+		}
+	}
+
+	generic := []string{}
+	for table := range tables {
+		if covered[table] {
+			continue
+		}
+		var hasEmail bool
+		if err := db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE LOWER(name) = 'email'", table).Scan(&hasEmail); err != nil {
+			return nil, fmt.Errorf("failed to inspect %s.%s: %w", dbName, table, err)
+		}
+		if hasEmail {
+			generic = append(generic, table)
+		}
+	}
+	sort.Strings(generic)
+
+	for _, table := range generic {
+		dbRules = append(dbRules, rule{
+			database:      dbName,
+			table:         table,
+			where:         byEmail,
+			anonymise:     "email = ?",
+			anonymiseArgs: erasedEmailArg,
+		})
+	}
+	return dbRules, nil
+}
+
+// tableNames returns the ordinary tables of a database, leaving out SQLite's own
+// tables and virtual tables such as the submission search index
+func tableNames(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables[name] = true
+	}
+	return tables, rows.Err()
+}
+
+// queryRecords selects every column of the matching rows, redacting secrets
+func queryRecords(db *sql.DB, dbName, table, where string, args []interface{}) ([]Record, error) {
+	rows, err := db.Query("SELECT * FROM "+quoteIdent(table)+" WHERE "+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s.%s: %w", dbName, table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s.%s: %w", dbName, table, err)
+	}
+
+	records := []Record{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s.%s: %w", dbName, table, err)
+		}
+
+		fields := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			switch value := values[i].(type) {
+			case []byte:
+				fields[column] = string(value)
+			default:
+				fields[column] = value
+			}
+			if redactedColumns[column] && values[i] != nil {
+				fields[column] = "[redacted]"
+			}
+		}
+		records = append(records, Record{Database: dbName, Table: table, Fields: fields})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over %s.%s: %w", dbName, table, err)
+	}
+	return records, nil
+}
+
+// RecordExport logs an export in the audit log
+func RecordExport(s site.Site, report *Report, source, actor string) *Request {
+	return recordRequest(s, report.Email, ActionExport, source, actor, report.Counts, nil)
+}
+
+// recordRequest writes an audit log entry. Failing to write it is logged but
+// does not undo the request.
+func recordRequest(s site.Site, email, action, source, actor string, summary map[string]int, requestErr error) *Request {
+	request := &Request{
+		ID:        uuid.New().String(),
+		EmailHash: HashEmail(email),
+		Action:    action,
+		Source:    source,
+		Actor:     actor,
+		Status:    StatusCompleted,
+		Summary:   summary,
+		CreatedAt: time.Now(),
+	}
+	if requestErr != nil {
+		request.Status = StatusFailed
+		request.Error = requestErr.Error()
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		summaryJSON = []byte("{}")
+	}
+
+	db, err := getDB(s)
+	if err != nil {
+		common.Error("Failed to open privacy database, %s request %s not audited: %v", action, request.ID, err)
+		return request
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO data_subject_requests (uuid, email_hash, action, source, actor, status, summary, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		request.ID, request.EmailHash, request.Action, request.Source, request.Actor, request.Status, string(summaryJSON), request.Error, request.CreatedAt)
+	if err != nil {
+		common.Error("Failed to audit %s request %s: %v", action, request.ID, err)
+	}
+	return request
+}
+
+// ListRequests returns the most recent audit log entries, optionally for one address
+func ListRequests(s site.Site, email string, limit int) ([]Request, error) {
+	db, err := getDB(s)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT uuid, email_hash, action, source, actor, status, summary, COALESCE(error, ''), created_at
+		FROM data_subject_requests`
+	args := []interface{}{}
+	if email != "" {
+		query += " WHERE email_hash = ?"
+		args = append(args, HashEmail(email))
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	query += " ORDER BY created_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data subject requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []Request{}
+	for rows.Next() {
+		var request Request
+		var summaryJSON string
+		if err := rows.Scan(&request.ID, &request.EmailHash, &request.Action, &request.Source, &request.Actor,
+			&request.Status, &summaryJSON, &request.Error, &request.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan data subject request: %w", err)
+		}
+		if err := json.Unmarshal([]byte(summaryJSON), &request.Summary); err != nil {
+			request.Summary = map[string]int{}
+		}
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over data subject requests: %w", err)
+	}
+	return requests, nil
+}
+
+func getDB(s site.Site) (*sql.DB, error) {
+	dbManager := s.GetDatabaseManager()
+	if dbManager == nil {
+		return nil, common.NewError("database manager not available")
+	}
+	return dbManager.GetOrCreateConnection(privacyDBName)
+}
+
+// quoteIdent quotes a table name read from sqlite_master
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
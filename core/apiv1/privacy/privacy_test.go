@@ -0,0 +1,222 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"wispy-core/core/site"
+	"wispy-core/core/tenant/databases"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Lowercases and trims", email: "  Jane@Example.COM ", want: "jane@example.com"},
+		{name: "Empty", email: " ", wantErr: true},
+		{name: "Missing domain", email: "jane@", wantErr: true},
+		{name: "Display name is rejected", email: "Jane <jane@example.com>", wantErr: true},
+		{name: "SQL wildcard is not an address", email: "%", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeEmail(%q) error = %v, wantErr %v", tt.email, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErasedEmail(t *testing.T) {
+	got := erasedEmail("jane@example.com")
+	if got != erasedEmail(" Jane@Example.com") {
+		t.Errorf("erasedEmail() should not depend on case or spacing")
+	}
+	if strings.Contains(got, "jane") || !strings.HasSuffix(got, "@erased.invalid") {
+		t.Errorf("erasedEmail() = %q, want an address that does not reveal the original", got)
+	}
+	if len(HashEmail("jane@example.com")) != 64 {
+		t.Errorf("HashEmail() should return a hex SHA-256")
+	}
+}
+
+// testSite keeps its databases in a temporary directory
+type testSite struct {
+	site.Site
+	dbs site.DatabaseManager
+}
+
+func (s *testSite) GetDomain() string                     { return "example.com" }
+func (s *testSite) GetDatabaseManager() databases.Manager { return s.dbs }
+
+// newPrivacySite returns a site whose forms and subscribers databases hold data on
+// jane@example.com, and on john@example.com who should be left alone
+func newPrivacySite(t *testing.T) *testSite {
+	t.Helper()
+	s := &testSite{dbs: site.NewDatabaseManagerInDir("example.com", t.TempDir())}
+	t.Cleanup(func() { s.dbs.Close() })
+	uploads := t.TempDir()
+	previous := uploadsDir
+	uploadsDir = func(site.Site) string { return uploads }
+	t.Cleanup(func() { uploadsDir = previous })
+
+	forms, err := s.dbs.GetOrCreateConnection("forms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forms.Exec(`INSERT INTO forms (uuid, name, title, fields) VALUES ('form-1', 'contact', 'Contact', '[]')`); err != nil {
+		t.Fatal(err)
+	}
+	// The submission data is stored the way forms.saveSubmission does
+	for _, row := range [][]string{
+		{"sub-own", "Jane@Example.com", "company:Acme"},
+		{"sub-field", "office@example.com", "company:Acme|Contact Email:JANE@example.com"},
+		{"sub-other", "john@example.com", "company:Acme|referrer:ajane@example.com"},
+		{"sub-wildcard", "john@example.com", "note:jane@example_com"},
+	} {
+		if _, err := forms.Exec(`INSERT INTO form_submissions (uuid, form_id, email, message, data) VALUES (?, 1, ?, 'Hello', ?)`, row[0], row[1], row[2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(uploads, row[0]), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := forms.Exec(`INSERT INTO form_submission_files (uuid, submission_id, field_name, original_name, stored_path, content_type, size)
+		SELECT 'file-1', id, 'cv', 'cv.pdf', 'sub-field/cv.pdf', 'application/pdf', 3 FROM form_submissions WHERE uuid = 'sub-field'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(uploads, "sub-field", "cv.pdf"), []byte("pdf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	subscribers, err := s.dbs.GetOrCreateConnection("subscribers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subscribers.Exec(`INSERT INTO subscribers (uuid, email, unsubscribe_token) VALUES ('s-1', 'jane@example.com', 'u-1'), ('s-2', 'john@example.com', 'u-2')`); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// submissionIDs returns the uuids of the records of form_submissions
+func submissionIDs(records []Record) []string {
+	ids := []string{}
+	for _, record := range records {
+		if record.Table == "form_submissions" {
+			ids = append(ids, fmt.Sprint(record.Fields["uuid"]))
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestFind(t *testing.T) {
+	s := newPrivacySite(t)
+	report, err := Find(s, " JANE@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submissions are found by their email column and by custom fields holding the address
+	if got, want := submissionIDs(report.Records), []string{"sub-field", "sub-own"}; !slices.Equal(got, want) {
+		t.Errorf("submissions = %v, want %v", got, want)
+	}
+	if report.Counts["forms.form_submission_files"] != 1 || report.Counts["subscribers.subscribers"] != 1 {
+		t.Errorf("counts = %v", report.Counts)
+	}
+	if len(report.Files) != 1 || report.Files[0].Path != "sub-field/cv.pdf" {
+		t.Errorf("files = %v, want sub-field/cv.pdf", report.Files)
+	}
+	for _, record := range report.Records {
+		if record.Table == "subscribers" && record.Fields["unsubscribe_token"] != "[redacted]" {
+			t.Errorf("unsubscribe_token is not redacted: %v", record.Fields)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	s := newPrivacySite(t)
+	report, err := Find(s, "jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteZip(&buf, report, uploadsDir(s)); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	for _, want := range []string{"README.txt", "data.json", "files/sub-field/cv.pdf"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("archive = %v, want %s", names, want)
+		}
+	}
+}
+
+func TestErase(t *testing.T) {
+	for _, action := range []string{ActionErase, ActionAnonymise} {
+		t.Run(action, func(t *testing.T) {
+			s := newPrivacySite(t)
+			request, err := Erase(s, "jane@example.com", action, SourceCLI, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if request.Status != StatusCompleted || request.Summary["forms.form_submissions"] != 2 {
+				t.Errorf("request = %+v, want 2 submissions", request)
+			}
+
+			report, err := Find(s, "jane@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Records) != 0 {
+				t.Errorf("records left after %s: %v", action, report.Records)
+			}
+			others, err := Find(s, "john@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := submissionIDs(others.Records), []string{"sub-other", "sub-wildcard"}; !slices.Equal(got, want) || others.Counts["subscribers.subscribers"] != 1 {
+				t.Errorf("other submissions = %v, counts = %v, want %v", got, others.Counts, want)
+			}
+
+			// Uploads of erased submissions are removed in both modes
+			for id, want := range map[string]bool{"sub-own": false, "sub-field": false, "sub-other": true} {
+				if _, err := os.Stat(filepath.Join(uploadsDir(s), id)); (err == nil) != want {
+					t.Errorf("uploads of %s exist = %v, want %v", id, err == nil, want)
+				}
+			}
+
+			requests, err := ListRequests(s, "jane@example.com", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(requests) != 1 || requests[0].Action != action {
+				t.Errorf("audit log = %+v, want one %s request", requests, action)
+			}
+		})
+	}
+}
@@ -0,0 +1,806 @@
+package subscribers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"wispy-core/auth"
+	"wispy-core/common"
+	"wispy-core/config"
+	"wispy-core/core/site"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const (
+	subscribersDBName = "subscribers"
+	confirmTokenTTL   = 48 * time.Hour
+	tokenBytes        = 24
+)
+
+// Subscriber states
+const (
+	StatusPending      = "pending"
+	StatusConfirmed    = "confirmed"
+	StatusUnsubscribed = "unsubscribed"
+)
+
+// List membership states
+const (
+	MemberPending      = "pending"
+	MemberSubscribed   = "subscribed"
+	MemberUnsubscribed = "unsubscribed"
+)
+
+// List is a named mailing list
+type List struct {
+	ID           string    `json:"id" db:"uuid"`
+	Name         string    `json:"name" db:"name" validate:"required,max=64"`
+	Title        string    `json:"title" db:"title" validate:"required"`
+	Description  string    `json:"description" db:"description"`
+	WelcomeURL   string    `json:"welcome_url" db:"welcome_url"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	Subscribed   int       `json:"subscribed"`
+	Pending      int       `json:"pending"`
+	Unsubscribed int       `json:"unsubscribed"`
+}
+
+// Subscriber is an email address with its consent record.
+// List fields are only set when listed through a specific list.
+type Subscriber struct {
+	ID               string     `json:"id" db:"uuid"`
+	Email            string     `json:"email" db:"email"`
+	Status           string     `json:"status" db:"status"`
+	ConsentIP        string     `json:"consent_ip" db:"consent_ip"`
+	ConsentUserAgent string     `json:"consent_user_agent" db:"consent_user_agent"`
+	ConsentAt        *time.Time `json:"consent_at,omitempty" db:"consent_at"`
+	SourceForm       string     `json:"source_form" db:"source_form"`
+	ConfirmedAt      *time.Time `json:"confirmed_at,omitempty" db:"confirmed_at"`
+	ConfirmedIP      string     `json:"confirmed_ip,omitempty" db:"confirmed_ip"`
+	UnsubscribedAt   *time.Time `json:"unsubscribed_at,omitempty" db:"unsubscribed_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ListStatus       string     `json:"list_status,omitempty"`
+	SubscribedAt     *time.Time `json:"subscribed_at,omitempty"`
+}
+
+// SubscribeRequest describes a visitor asking to join a list
+type SubscribeRequest struct {
+	Email      string
+	List       string // list name or uuid
+	SourceForm string
+	IPAddress  string
+	UserAgent  string
+	BaseURL    string // scheme and host used to build the confirmation link
+}
+
+type SubscribersApi struct {
+	siteManager    site.SiteManager
+	validate       *validator.Validate
+	authMiddleware *auth.Middleware
+}
+
+func NewSubscribersApi(siteManager site.SiteManager) *SubscribersApi {
+	globalConfig := config.GetGlobalConfig()
+	return &SubscribersApi{
+		siteManager:    siteManager,
+		validate:       validator.New(),
+		authMiddleware: globalConfig.GetCoreAuthMiddleware(),
+	}
+}
+
+func (a *SubscribersApi) MountApi(r chi.Router) {
+	r.Route("/subscribers", func(r chi.Router) {
+		r.Get("/confirm", a.ConfirmForm)
+		r.Post("/confirm", a.Confirm)
+		r.Get("/unsubscribe", a.UnsubscribeForm)
+		r.Post("/unsubscribe", a.Unsubscribe) // RFC 8058 one-click unsubscribe
+		r.Group(func(r chi.Router) {
+			r.Use(a.authMiddleware.RequireAuth)
+
+			r.Get("/lists", a.ListLists)
+			r.Post("/lists", a.CreateList)
+			r.Get("/lists/{listID}/subscribers", a.ListSubscribers)
+			r.Get("/lists/{listID}/export", a.ExportList)
+			r.Delete("/{subscriberID}", a.DeleteSubscriber)
+		})
+	})
+}
+
+// GetDB returns the subscribers database of a site
+func GetDB(s site.Site) (*sql.DB, error) {
+	dbManager := s.GetDatabaseManager()
+	if dbManager == nil {
+		return nil, common.NewError("database manager not available")
+	}
+	return dbManager.GetOrCreateConnection(subscribersDBName)
+}
+
+// Subscribe records consent for req.Email on a list and sends a confirmation link
+// for it. Every list is confirmed from its own email, also by addresses that
+// confirmed another list, and nothing is sent for a list they are already on.
+// Visitors subscribe through a form with a subscribe_list setting, which checks the
+// form token and honeypot first; there is no public endpoint of its own.
+func Subscribe(s site.Site, req SubscribeRequest) error {
+	db, err := GetDB(s)
+	if err != nil {
+		return err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return common.NewError("email is required")
+	}
+
+	list, err := getList(db, req.List)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var subscriberID int64
+	var status, unsubscribeToken string
+	err = tx.QueryRow(`SELECT id, status, unsubscribe_token FROM subscribers WHERE email = ?`, email).Scan(&subscriberID, &status, &unsubscribeToken)
+	switch {
+	case err == sql.ErrNoRows:
+		unsubscribeToken = common.NewRandomToken(tokenBytes)
+		result, err := tx.Exec(`
+			INSERT INTO subscribers (uuid, email, status, unsubscribe_token, consent_ip, consent_user_agent, consent_at, source_form, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(), email, StatusPending, unsubscribeToken, req.IPAddress, req.UserAgent, now, req.SourceForm, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to save subscriber: %w", err)
+		}
+		if subscriberID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get subscriber id: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to look up subscriber: %w", err)
+	case status != StatusConfirmed:
+		// Record the new consent, the previous one was never confirmed or was withdrawn
+		_, err := tx.Exec(`
+			UPDATE subscribers
+			SET status = ?, consent_ip = ?, consent_user_agent = ?, consent_at = ?, source_form = ?, unsubscribed_at = NULL, updated_at = ?
+			WHERE id = ?`,
+			StatusPending, req.IPAddress, req.UserAgent, now, req.SourceForm, now, subscriberID)
+		if err != nil {
+			return fmt.Errorf("failed to update subscriber: %w", err)
+		}
+	}
+
+	var memberStatus string
+	err = tx.QueryRow(`
+		SELECT status FROM subscriber_list_members
+		WHERE subscriber_id = ? AND list_id = (SELECT id FROM subscriber_lists WHERE uuid = ?)`, subscriberID, list.ID).Scan(&memberStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up list membership: %w", err)
+	}
+	if memberStatus == MemberSubscribed {
+		return tx.Commit()
+	}
+
+	confirmToken := common.NewRandomToken(tokenBytes)
+	_, err = tx.Exec(`
+		INSERT INTO subscriber_list_members (subscriber_id, list_id, status, confirm_token, confirm_sent_at,
+			consent_ip, consent_user_agent, consent_at, source_form, created_at)
+		VALUES (?, (SELECT id FROM subscriber_lists WHERE uuid = ?), ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (subscriber_id, list_id) DO UPDATE SET
+			status = excluded.status, confirm_token = excluded.confirm_token, confirm_sent_at = excluded.confirm_sent_at,
+			consent_ip = excluded.consent_ip, consent_user_agent = excluded.consent_user_agent,
+			consent_at = excluded.consent_at, source_form = excluded.source_form, unsubscribed_at = NULL`,
+		subscriberID, list.ID, MemberPending, confirmToken, now, req.IPAddress, req.UserAgent, now, req.SourceForm, now)
+	if err != nil {
+		return fmt.Errorf("failed to add subscriber to list: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit subscription: %w", err)
+	}
+
+	msg := confirmationMessage(s, list, email, req.BaseURL, confirmToken, unsubscribeToken)
+	go func() {
+		if err := common.GetMailer().Send(msg); err != nil {
+			common.Error("Failed to send confirmation email: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func confirmationMessage(s site.Site, list List, email, baseURL, confirmToken, unsubscribeToken string) common.MailMessage {
+	name := siteName(s)
+	confirmURL := baseURL + "/api/v1/subscribers/confirm?token=" + url.QueryEscape(confirmToken)
+	unsubscribeURL := baseURL + "/api/v1/subscribers/unsubscribe?token=" + url.QueryEscape(unsubscribeToken)
+
+	body := fmt.Sprintf("Hi,\n\nPlease confirm that you want to receive %s from %s by opening this link:\n\n%s\n\n"+
+		"The link expires in %d hours. If you did not sign up, you can ignore this email.\n\n"+
+		"Unsubscribe at any time: %s\n",
+		list.Title, name, confirmURL, int(confirmTokenTTL.Hours()), unsubscribeURL)
+
+	return common.MailMessage{
+		To:      email,
+		Subject: "Please confirm your subscription to " + name,
+		Body:    body,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
+
+// ConfirmForm renders the page the emailed confirmation link opens. It posts back
+// to the same URL, see Confirm.
+func (a *SubscribersApi) ConfirmForm(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := a.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := GetDB(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	listTitle, err := pendingConfirmation(db, r.URL.Query().Get("token"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "This confirmation link is invalid or has expired", err)
+		return
+	}
+	renderActionPage(w, r, "Confirm", fmt.Sprintf("Do you want to receive %s from %s?", listTitle, siteName(site)))
+}
+
+// pendingConfirmation returns the title of the list a confirmation token that can
+// still be used was sent for
+func pendingConfirmation(db *sql.DB, token string) (string, error) {
+	if token == "" {
+		return "", common.NewError("missing token")
+	}
+	var title string
+	var sentAt time.Time
+	err := db.QueryRow(`
+		SELECT l.title, m.confirm_sent_at
+		FROM subscriber_list_members m
+		JOIN subscriber_lists l ON m.list_id = l.id
+		WHERE m.confirm_token = ? AND m.status = ?`, token, MemberPending).Scan(&title, &sentAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", common.NewError("unknown confirmation token")
+		}
+		return "", fmt.Errorf("failed to look up confirmation token: %w", err)
+	}
+	if time.Since(sentAt) > confirmTokenTTL {
+		return "", common.NewError("confirmation token expired")
+	}
+	return title, nil
+}
+
+// Confirm completes a double opt-in, from the form of ConfirmForm
+func (a *SubscribersApi) Confirm(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := a.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := GetDB(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	welcomeURL, err := confirmSubscription(db, r.URL.Query().Get("token"), common.GetIPAddress(r))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "This confirmation link is invalid or has expired", err)
+		return
+	}
+
+	if welcomeURL != "" && strings.HasPrefix(welcomeURL, "/") && !strings.HasPrefix(welcomeURL, "//") {
+		http.Redirect(w, r, welcomeURL, http.StatusSeeOther)
+		return
+	}
+	common.RespondWithPlainText(w, http.StatusOK, "Your subscription is confirmed, thank you!")
+}
+
+// confirmSubscription subscribes the list membership a token was sent for, confirms
+// its subscriber when this is the first list they confirm, and returns the welcome
+// URL of the list
+func confirmSubscription(db *sql.DB, token, ipAddress string) (string, error) {
+	if token == "" {
+		return "", common.NewError("missing token")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var subscriberID, listID int64
+	var sentAt time.Time
+	var welcomeURL sql.NullString
+	err = tx.QueryRow(`
+		SELECT m.subscriber_id, m.list_id, m.confirm_sent_at, l.welcome_url
+		FROM subscriber_list_members m
+		JOIN subscriber_lists l ON m.list_id = l.id
+		WHERE m.confirm_token = ? AND m.status = ?`, token, MemberPending).Scan(&subscriberID, &listID, &sentAt, &welcomeURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", common.NewError("unknown confirmation token")
+		}
+		return "", fmt.Errorf("failed to look up confirmation token: %w", err)
+	}
+	if time.Since(sentAt) > confirmTokenTTL {
+		return "", common.NewError("confirmation token expired")
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		UPDATE subscriber_list_members
+		SET status = ?, subscribed_at = ?, confirmed_at = ?, confirmed_ip = ?, confirm_token = NULL
+		WHERE subscriber_id = ? AND list_id = ?`, MemberSubscribed, now, now, ipAddress, subscriberID, listID)
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm list membership: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE subscribers
+		SET status = ?, confirmed_at = ?, confirmed_ip = ?, updated_at = ?
+		WHERE id = ? AND status != ?`, StatusConfirmed, now, ipAddress, now, subscriberID, StatusConfirmed)
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm subscriber: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit confirmation: %w", err)
+	}
+	return welcomeURL.String, nil
+}
+
+// actionPage asks before confirming or unsubscribing. Mail scanners and prefetching
+// clients open the emailed links, so only posting the form changes anything.
+var actionPage = template.Must(template.New("action").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p>{{.Question}}</p>
+<form method="post" action="{{.Action}}">
+<button type="submit">{{.Title}}</button>
+</form>
+</main>
+</body>
+</html>
+`))
+
+// renderActionPage answers with an actionPage that posts back to the requested URL
+func renderActionPage(w http.ResponseWriter, r *http.Request, title, question string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	err := actionPage.Execute(w, map[string]string{
+		"Title":    title,
+		"Question": question,
+		"Action":   r.URL.RequestURI(),
+	})
+	if err != nil {
+		common.Error("Failed to render %s page: %v", strings.ToLower(title), err)
+	}
+}
+
+// siteName is the name of a site in the pages and emails sent to subscribers
+func siteName(s site.Site) string {
+	if name := s.GetName(); name != "" {
+		return name
+	}
+	return s.GetDomain()
+}
+
+// UnsubscribeForm renders the page the emailed unsubscribe link opens. It posts
+// back to the same URL, see Unsubscribe.
+func (a *SubscribersApi) UnsubscribeForm(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := a.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := GetDB(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	query := r.URL.Query()
+	var known bool
+	if token := query.Get("token"); token != "" {
+		err = db.QueryRow(`SELECT COUNT(*) > 0 FROM subscribers WHERE unsubscribe_token = ?`, token).Scan(&known)
+	}
+	if err != nil || !known {
+		common.RespondWithError(w, r, http.StatusBadRequest, "This unsubscribe link is invalid", err)
+		return
+	}
+
+	listTitle := "all emails"
+	if listName := query.Get("list"); listName != "" {
+		listTitle = listName
+		if list, err := getList(db, listName); err == nil {
+			listTitle = list.Title
+		}
+	}
+	renderActionPage(w, r, "Unsubscribe", fmt.Sprintf("Do you want to stop receiving %s from %s?", listTitle, siteName(site)))
+}
+
+// Unsubscribe removes a subscriber from one list (?list=name) or from everything.
+// It answers the form of UnsubscribeForm and RFC 8058 one-click requests alike.
+func (a *SubscribersApi) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := a.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return
+	}
+
+	db, err := GetDB(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	query := r.URL.Query()
+	if err := unsubscribe(db, query.Get("token"), query.Get("list")); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "This unsubscribe link is invalid", err)
+		return
+	}
+
+	common.RespondWithPlainText(w, http.StatusOK, "You have been unsubscribed")
+}
+
+func unsubscribe(db *sql.DB, token, listName string) error {
+	if token == "" {
+		return common.NewError("missing token")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var subscriberID int64
+	if err := tx.QueryRow(`SELECT id FROM subscribers WHERE unsubscribe_token = ?`, token).Scan(&subscriberID); err != nil {
+		if err == sql.ErrNoRows {
+			return common.NewError("unknown unsubscribe token")
+		}
+		return fmt.Errorf("failed to look up unsubscribe token: %w", err)
+	}
+
+	now := time.Now()
+	if listName != "" {
+		_, err = tx.Exec(`
+			UPDATE subscriber_list_members SET status = ?, unsubscribed_at = ?, confirm_token = NULL
+			WHERE subscriber_id = ? AND list_id = (SELECT id FROM subscriber_lists WHERE name = ? OR uuid = ?)`,
+			MemberUnsubscribed, now, subscriberID, listName, listName)
+		if err != nil {
+			return fmt.Errorf("failed to unsubscribe from list: %w", err)
+		}
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec(`UPDATE subscriber_list_members SET status = ?, unsubscribed_at = ?, confirm_token = NULL WHERE subscriber_id = ? AND status != ?`,
+		MemberUnsubscribed, now, subscriberID, MemberUnsubscribed); err != nil {
+		return fmt.Errorf("failed to unsubscribe from lists: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE subscribers SET status = ?, unsubscribed_at = ?, updated_at = ? WHERE id = ?`,
+		StatusUnsubscribed, now, now, subscriberID); err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ListLists returns every list with its member counts
+func (a *SubscribersApi) ListLists(w http.ResponseWriter, r *http.Request) {
+	db, ok := a.dbForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	lists, err := GetLists(db)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to list subscriber lists", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, lists)
+}
+
+// CreateList adds a new mailing list
+func (a *SubscribersApi) CreateList(w http.ResponseWriter, r *http.Request) {
+	db, ok := a.dbForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, "Invalid form data", err)
+		return
+	}
+
+	list := List{
+		ID:          uuid.New().String(),
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: r.FormValue("description"),
+		WelcomeURL:  r.FormValue("welcome_url"),
+		CreatedAt:   time.Now(),
+	}
+	if list.Title == "" {
+		list.Title = list.Name
+	}
+	if err := a.validate.Struct(list); err != nil {
+		common.RespondWithError(w, r, http.StatusBadRequest, common.ValidationErrorsToMessage(err), err)
+		return
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO subscriber_lists (uuid, name, title, description, welcome_url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		list.ID, list.Name, list.Title, list.Description, list.WelcomeURL, list.CreatedAt, list.CreatedAt)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusConflict, "A list with this name already exists", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusCreated, list)
+}
+
+// ListSubscribers returns the members of a list, optionally filtered by ?status=
+func (a *SubscribersApi) ListSubscribers(w http.ResponseWriter, r *http.Request) {
+	db, ok := a.dbForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	subscribers, err := GetListSubscribers(db, chi.URLParam(r, "listID"), r.URL.Query().Get("status"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Failed to list subscribers", err)
+		return
+	}
+
+	common.RespondWithJSON(w, http.StatusOK, subscribers)
+}
+
+// ExportList downloads the members of a list as CSV including their consent record
+func (a *SubscribersApi) ExportList(w http.ResponseWriter, r *http.Request) {
+	db, ok := a.dbForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	listID := chi.URLParam(r, "listID")
+	list, err := getList(db, listID)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "List not found", err)
+		return
+	}
+
+	subscribers, err := GetListSubscribers(db, list.ID, r.URL.Query().Get("status"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to export subscribers", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-subscribers-%s.csv", list.Name, time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if err := WriteSubscribersCSV(w, subscribers); err != nil {
+		common.Error("Failed to write subscribers export: %v", err)
+	}
+}
+
+// WriteSubscribersCSV writes subscribers with their consent timestamps as CSV
+func WriteSubscribersCSV(w io.Writer, subscribers []Subscriber) error {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"email", "status", "list_status", "consent_at", "consent_ip", "source_form", "confirmed_at", "confirmed_ip", "subscribed_at", "unsubscribed_at"})
+	for _, s := range subscribers {
+		cw.Write([]string{
+			csvSafe(s.Email),
+			s.Status,
+			s.ListStatus,
+			formatTime(s.ConsentAt),
+			csvSafe(s.ConsentIP),
+			csvSafe(s.SourceForm),
+			formatTime(s.ConfirmedAt),
+			csvSafe(s.ConfirmedIP),
+			formatTime(s.SubscribedAt),
+			formatTime(s.UnsubscribedAt),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafe keeps spreadsheet applications from evaluating visitor supplied values as formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// DeleteSubscriber removes a subscriber and its consent record entirely
+func (a *SubscribersApi) DeleteSubscriber(w http.ResponseWriter, r *http.Request) {
+	db, ok := a.dbForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(`DELETE FROM subscribers WHERE uuid = ?`, chi.URLParam(r, "subscriberID"))
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to delete subscriber", err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		common.RespondWithError(w, r, http.StatusNotFound, "Subscriber not found", nil)
+		return
+	}
+
+	common.RespondWithPlainText(w, http.StatusOK, "Subscriber deleted")
+}
+
+func (a *SubscribersApi) dbForRequest(w http.ResponseWriter, r *http.Request) (*sql.DB, bool) {
+	domain := common.NormalizeHost(r.Host)
+	site, err := a.siteManager.GetSite(domain)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusNotFound, "Site not found for domain "+domain, err)
+		return nil, false
+	}
+
+	db, err := GetDB(site)
+	if err != nil {
+		common.RespondWithError(w, r, http.StatusInternalServerError, "Database error", err)
+		return nil, false
+	}
+	return db, true
+}
+
+// getList loads a list by its uuid or name
+func getList(db *sql.DB, listID string) (List, error) {
+	var list List
+	var description, welcomeURL sql.NullString
+	err := db.QueryRow(`
+		SELECT uuid, name, title, description, welcome_url, created_at
+		FROM subscriber_lists WHERE uuid = ? OR name = ? LIMIT 1`, listID, listID).
+		Scan(&list.ID, &list.Name, &list.Title, &description, &welcomeURL, &list.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return List{}, common.NewErrorf("list '%s' not found", listID)
+		}
+		return List{}, fmt.Errorf("failed to get list: %w", err)
+	}
+	list.Description = description.String
+	list.WelcomeURL = welcomeURL.String
+	return list, nil
+}
+
+// GetLists returns all lists with their member counts
+func GetLists(db *sql.DB) ([]List, error) {
+	rows, err := db.Query(`
+		SELECT l.uuid, l.name, l.title, l.description, l.welcome_url, l.created_at,
+		       COUNT(CASE WHEN m.status = 'subscribed' THEN 1 END),
+		       COUNT(CASE WHEN m.status = 'pending' THEN 1 END),
+		       COUNT(CASE WHEN m.status = 'unsubscribed' THEN 1 END)
+		FROM subscriber_lists l
+		LEFT JOIN subscriber_list_members m ON m.list_id = l.id
+		GROUP BY l.id
+		ORDER BY l.created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lists: %w", err)
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		var list List
+		var description, welcomeURL sql.NullString
+		if err := rows.Scan(&list.ID, &list.Name, &list.Title, &description, &welcomeURL, &list.CreatedAt, &list.Subscribed, &list.Pending, &list.Unsubscribed); err != nil {
+			return nil, fmt.Errorf("failed to scan list row: %w", err)
+		}
+		list.Description = description.String
+		list.WelcomeURL = welcomeURL.String
+		lists = append(lists, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over list rows: %w", err)
+	}
+
+	return lists, nil
+}
+
+// GetListSubscribers returns the members of a list with the consent and confirmation
+// of their membership; memberStatus filters by membership state
+func GetListSubscribers(db *sql.DB, listID, memberStatus string) ([]Subscriber, error) {
+	query := `
+		SELECT s.uuid, s.email, s.status, COALESCE(m.consent_ip, ''), COALESCE(m.consent_user_agent, ''), m.consent_at,
+		       COALESCE(m.source_form, ''), m.confirmed_at, COALESCE(m.confirmed_ip, ''), s.created_at,
+		       m.status, m.subscribed_at, COALESCE(m.unsubscribed_at, s.unsubscribed_at)
+		FROM subscriber_list_members m
+		JOIN subscribers s ON m.subscriber_id = s.id
+		JOIN subscriber_lists l ON m.list_id = l.id
+		WHERE (l.uuid = ? OR l.name = ?)`
+	args := []interface{}{listID, listID}
+	if memberStatus != "" {
+		query += " AND m.status = ?"
+		args = append(args, memberStatus)
+	}
+	query += " ORDER BY s.email ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscribers: %w", err)
+	}
+	defer rows.Close()
+
+	subscribers := []Subscriber{}
+	for rows.Next() {
+		var s Subscriber
+		var consentAt, confirmedAt, subscribedAt, unsubscribedAt sql.NullTime
+		err := rows.Scan(&s.ID, &s.Email, &s.Status, &s.ConsentIP, &s.ConsentUserAgent, &consentAt,
+			&s.SourceForm, &confirmedAt, &s.ConfirmedIP, &s.CreatedAt,
+			&s.ListStatus, &subscribedAt, &unsubscribedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscriber row: %w", err)
+		}
+		s.ConsentAt = nullTime(consentAt)
+		s.ConfirmedAt = nullTime(confirmedAt)
+		s.SubscribedAt = nullTime(subscribedAt)
+		s.UnsubscribedAt = nullTime(unsubscribedAt)
+		subscribers = append(subscribers, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over subscriber rows: %w", err)
+	}
+
+	return subscribers, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,283 @@
+package subscribers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"wispy-core/common"
+	"wispy-core/core/site"
+	"wispy-core/core/tenant/databases"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestCsvSafe(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "Empty", value: "", want: ""},
+		{name: "Plain email", value: "jane@example.com", want: "jane@example.com"},
+		{name: "Formula", value: "=HYPERLINK(\"x\")", want: "'=HYPERLINK(\"x\")"},
+		{name: "Plus sign", value: "+1 555", want: "'+1 555"},
+		{name: "Minus sign", value: "-2", want: "'-2"},
+		{name: "At sign", value: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "Leading tab", value: "\tcmd", want: "'\tcmd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvSafe(tt.value); got != tt.want {
+				t.Errorf("csvSafe(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+type testSite struct {
+	site.Site
+	dbs site.DatabaseManager
+}
+
+func (s *testSite) GetName() string                       { return "Example" }
+func (s *testSite) GetDomain() string                     { return "example.com" }
+func (s *testSite) GetDatabaseManager() databases.Manager { return s.dbs }
+
+type testSiteManager struct {
+	site.SiteManager
+	site *testSite
+}
+
+func (m *testSiteManager) GetSite(domain string) (site.Site, error) {
+	if domain != m.site.GetDomain() {
+		return nil, common.NewError("unknown site " + domain)
+	}
+	return m.site, nil
+}
+
+// testMailer hands sent messages to the test
+type testMailer chan common.MailMessage
+
+func (m testMailer) Send(msg common.MailMessage) error {
+	m <- msg
+	return nil
+}
+
+// newTestApi returns the API of a site with a "news" list
+func newTestApi(t *testing.T) (*SubscribersApi, *testSite, *sql.DB, testMailer) {
+	t.Helper()
+	s := &testSite{dbs: site.NewDatabaseManagerInDir("example.com", t.TempDir())}
+	t.Cleanup(func() { s.dbs.Close() })
+	db, err := GetDB(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO subscriber_lists (uuid, name, title) VALUES ('list-1', 'news', 'Our newsletter')`); err != nil {
+		t.Fatal(err)
+	}
+	mailer := make(testMailer, 1)
+	common.SetMailer(mailer)
+	return &SubscribersApi{siteManager: &testSiteManager{site: s}, validate: validator.New()}, s, db, mailer
+}
+
+func serve(a *SubscribersApi, method, target string, form url.Values) *httptest.ResponseRecorder {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	r := httptest.NewRequest(method, "http://example.com/api/v1"+target, body)
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	router := chi.NewRouter()
+	router.Route("/api/v1", a.MountApi)
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// memberStatus returns the subscriber's status and its membership of the news list
+func memberStatus(t *testing.T, db *sql.DB, email string) (string, string) {
+	t.Helper()
+	return listMemberStatus(t, db, email, "news")
+}
+
+// listMemberStatus returns the subscriber's status and its membership of a list
+func listMemberStatus(t *testing.T, db *sql.DB, email, list string) (string, string) {
+	t.Helper()
+	var status, member string
+	err := db.QueryRow(`
+		SELECT s.status, m.status FROM subscribers s
+		JOIN subscriber_list_members m ON m.subscriber_id = s.id
+		JOIN subscriber_lists l ON m.list_id = l.id
+		WHERE s.email = ? AND l.name = ?`, email, list).Scan(&status, &member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, member
+}
+
+// linkToken returns the token of the link to path in body
+func linkToken(t *testing.T, body, path string) string {
+	t.Helper()
+	start := strings.Index(body, path+"?token=")
+	if start < 0 {
+		t.Fatalf("no %s link in %s", path, body)
+	}
+	link := strings.Fields(body[start:])[0]
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestSubscribeConfirmUnsubscribe(t *testing.T) {
+	a, s, db, mailer := newTestApi(t)
+
+	if err := Subscribe(s, SubscribeRequest{Email: " Jane@Example.com ", List: "news", BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if status, member := memberStatus(t, db, "jane@example.com"); status != StatusPending || member != MemberPending {
+		t.Errorf("after subscribing status = %s, %s, want pending", status, member)
+	}
+	msg := <-mailer
+	if msg.To != "jane@example.com" || msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("confirmation message = %+v", msg)
+	}
+
+	if w := serve(a, http.MethodGet, "/subscribers/confirm?token=wrong", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm page with an unknown token = %d, want 400", w.Code)
+	}
+	if w := serve(a, http.MethodPost, "/subscribers/confirm?token=wrong", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm with an unknown token = %d, want 400", w.Code)
+	}
+
+	// Opening the link only asks, like the unsubscribe link
+	confirmURL := "/subscribers/confirm?token=" + url.QueryEscape(linkToken(t, msg.Body, "/api/v1/subscribers/confirm"))
+	w := serve(a, http.MethodGet, confirmURL, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post" action="/api/v1`+confirmURL+`">`) || !strings.Contains(w.Body.String(), "Our newsletter") {
+		t.Fatalf("confirm page = %d\n%s", w.Code, w.Body)
+	}
+	if status, member := memberStatus(t, db, "jane@example.com"); status != StatusPending || member != MemberPending {
+		t.Errorf("opening the confirmation link changed the status to %s, %s", status, member)
+	}
+	if w := serve(a, http.MethodPost, confirmURL, url.Values{}); w.Code != http.StatusOK {
+		t.Fatalf("confirm = %d %s", w.Code, w.Body)
+	}
+	if status, member := memberStatus(t, db, "jane@example.com"); status != StatusConfirmed || member != MemberSubscribed {
+		t.Errorf("after confirming status = %s, %s, want confirmed and subscribed", status, member)
+	}
+
+	// Opening the link only asks, the form posts back to it
+	unsubscribeURL := "/subscribers/unsubscribe?token=" + url.QueryEscape(linkToken(t, msg.Body, "/api/v1/subscribers/unsubscribe")) + "&list=news"
+	w = serve(a, http.MethodGet, unsubscribeURL, nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("unsubscribe page = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{`<form method="post" action="/api/v1` + strings.ReplaceAll(unsubscribeURL, "&", "&amp;") + `">`, "Our newsletter", "Example"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("unsubscribe page does not contain %s\n%s", want, w.Body)
+		}
+	}
+	if _, member := memberStatus(t, db, "jane@example.com"); member != MemberSubscribed {
+		t.Errorf("opening the unsubscribe link changed the membership to %s", member)
+	}
+	if w := serve(a, http.MethodGet, "/subscribers/unsubscribe?token=wrong", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unsubscribe page with an unknown token = %d, want 400", w.Code)
+	}
+
+	// RFC 8058 one-click unsubscribe
+	w = serve(a, http.MethodPost, unsubscribeURL, url.Values{"List-Unsubscribe": {"One-Click"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unsubscribe = %d %s", w.Code, w.Body)
+	}
+	if status, member := memberStatus(t, db, "jane@example.com"); status != StatusConfirmed || member != MemberUnsubscribed {
+		t.Errorf("after unsubscribing from the list status = %s, %s, want confirmed and unsubscribed", status, member)
+	}
+	if w := serve(a, http.MethodPost, "/subscribers/unsubscribe?token=wrong", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unsubscribe with an unknown token = %d, want 400", w.Code)
+	}
+}
+
+func TestSubscribeConfirmsEachList(t *testing.T) {
+	a, s, db, mailer := newTestApi(t)
+	if _, err := db.Exec(`INSERT INTO subscriber_lists (uuid, name, title) VALUES ('list-2', 'offers', 'Offers')`); err != nil {
+		t.Fatal(err)
+	}
+	confirm := func(msg common.MailMessage) {
+		t.Helper()
+		token := linkToken(t, msg.Body, "/api/v1/subscribers/confirm")
+		if w := serve(a, http.MethodPost, "/subscribers/confirm?token="+url.QueryEscape(token), url.Values{}); w.Code != http.StatusOK {
+			t.Fatalf("confirm = %d %s", w.Code, w.Body)
+		}
+	}
+
+	if err := Subscribe(s, SubscribeRequest{Email: "jane@example.com", List: "news", BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	confirm(<-mailer)
+
+	// A confirmed address is asked again for another list, which stays pending until then
+	if err := Subscribe(s, SubscribeRequest{Email: "jane@example.com", List: "offers", SourceForm: "promo", IPAddress: "192.0.2.7", BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if status, member := listMemberStatus(t, db, "jane@example.com", "offers"); status != StatusConfirmed || member != MemberPending {
+		t.Errorf("after subscribing to offers status = %s, %s, want confirmed and pending", status, member)
+	}
+	msg := <-mailer
+	if !strings.Contains(msg.Body, "Offers") {
+		t.Errorf("confirmation is not for the offers list:\n%s", msg.Body)
+	}
+	confirm(msg)
+	if _, member := listMemberStatus(t, db, "jane@example.com", "offers"); member != MemberSubscribed {
+		t.Errorf("after confirming offers membership = %s, want subscribed", member)
+	}
+	subscribers, err := GetListSubscribers(db, "offers", "")
+	if err != nil || len(subscribers) != 1 || subscribers[0].SourceForm != "promo" || subscribers[0].ConsentIP != "192.0.2.7" || subscribers[0].ConfirmedAt == nil {
+		t.Errorf("offers subscribers = %+v, %v, want the consent of that list", subscribers, err)
+	}
+
+	// Nothing is sent for a list the address is already on
+	if err := Subscribe(s, SubscribeRequest{Email: "jane@example.com", List: "offers", BaseURL: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-mailer:
+		t.Errorf("sent %+v for a list the address is on", msg)
+	default:
+	}
+}
+
+func TestSubscribeRejectsInvalidRequests(t *testing.T) {
+	_, s, _, _ := newTestApi(t)
+	tests := []struct {
+		name string
+		req  SubscribeRequest
+	}{
+		{name: "Missing email", req: SubscribeRequest{Email: " ", List: "news"}},
+		{name: "Unknown list", req: SubscribeRequest{Email: "jane@example.com", List: "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Subscribe(s, tt.req); err == nil {
+				t.Error("Subscribe() succeeded")
+			}
+		})
+	}
+}
+
+func TestNoPublicSubscribe(t *testing.T) {
+	a, _, _, _ := newTestApi(t)
+	w := serve(a, http.MethodPost, "/subscribers/subscribe", url.Values{"email": {"jane@example.com"}, "list": {"news"}})
+	if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("subscribe = %d, want no such route", w.Code)
+	}
+}
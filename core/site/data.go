@@ -0,0 +1,141 @@
+package site
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// dataDecoders parse the data files, by extension
+var dataDecoders = map[string]func([]byte, interface{}) error{
+	".toml": toml.Unmarshal,
+	".json": json.Unmarshal,
+	".yaml": yaml.Unmarshal,
+	".yml":  yaml.Unmarshal,
+}
+
+// dataKey matches the file and directory names under data/, which must work as
+// template fields: .Site.Data.team.members
+var dataKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// siteData holds the files under a site's data/ directory and the [params] of its
+// config.toml, reloaded when one of them changes
+type siteData struct {
+	files *reloadable[siteDataValues]
+}
+
+// siteDataValues are the data files and params loaded together, so a change is only
+// used when all of them are valid
+type siteDataValues struct {
+	data   map[string]interface{}
+	params map[string]interface{}
+}
+
+// newSiteData loads the data files of the site in sitePath and the params of its config
+func newSiteData(sitePath string, config *configFile) (*siteData, error) {
+	dataDir := filepath.Join(sitePath, "data")
+	files, err := newReloadable("site data", func() (siteDataValues, error) {
+		data, err := loadDataDir(dataDir)
+		if err != nil {
+			return siteDataValues{}, err
+		}
+		tables, err := config.current()
+		if err != nil {
+			return siteDataValues{}, err
+		}
+		return siteDataValues{data: data, params: tables.Params}, nil
+	}, config.path, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return &siteData{files: files}, nil
+}
+
+// current returns the data and params, reloading them when a file changed
+func (sd *siteData) current() (map[string]interface{}, map[string]interface{}) {
+	values := sd.files.current()
+	return values.data, values.params
+}
+
+// loadDataDir reads the data files under dir into a tree namespaced by their path,
+// so data/team/members.yaml becomes data["team"]["members"]. Files of other types
+// and hidden files are ignored; a missing directory gives an empty tree.
+func loadDataDir(dir string) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	sources := make(map[string]string) // namespace -> file or directory that defined it
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasPrefix(name, ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+
+		ext := strings.ToLower(filepath.Ext(name))
+		decode := dataDecoders[ext]
+		if !d.IsDir() && decode == nil {
+			return nil
+		}
+
+		key := name
+		if !d.IsDir() {
+			key = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		if !dataKey.MatchString(key) {
+			return fmt.Errorf("data %s: %q cannot be used as a template field, use letters, digits and underscores", rel, key)
+		}
+		namespace := strings.TrimPrefix(filepath.ToSlash(filepath.Dir(rel))+"/"+key, "./")
+		if other, ok := sources[namespace]; ok {
+			return fmt.Errorf("data %s: %s already defines %s", rel, other, namespace)
+		}
+		sources[namespace] = rel
+
+		parent := tree
+		if dirs := filepath.ToSlash(filepath.Dir(rel)); dirs != "." {
+			for _, segment := range strings.Split(dirs, "/") {
+				parent = parent[segment].(map[string]interface{})
+			}
+		}
+
+		if d.IsDir() {
+			parent[key] = make(map[string]interface{})
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if err := decode(content, &value); err != nil {
+			return fmt.Errorf("invalid data file %s: %w", rel, err)
+		}
+		parent[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
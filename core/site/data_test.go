@@ -0,0 +1,188 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func writeDataFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestSite sets up the routes of a site in English and French with the files
+// under root and the given content types
+func newTestSite(t *testing.T, root string, contentTypes ...ContentType) (*site, chi.Router) {
+	t.Helper()
+	locales, err := newLocales(i18nConfig{DefaultLocale: "en", Locales: []string{"en", "fr"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &site{Name: "Example", Domain: "example.com", BaseURL: "https://example.com", locales: locales, contentTypes: contentTypes}
+	if s.errorPages, err = newErrorPages(s, newConfigFile(root)); err != nil {
+		t.Fatal(err)
+	}
+	router := chi.NewRouter()
+	scaffoldRoutes(router, s, root)
+	return s, router
+}
+
+func TestLoadDataDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "Formats are namespaced by path",
+			files: map[string]string{
+				"data/team.toml":          "lead = \"Ada\"\n[[members]]\nname = \"Ada\"",
+				"data/nav.json":           `[{"href": "/"}]`,
+				"data/social/links.yaml":  "github: wispberry\n",
+				"data/social/.draft.yaml": "ignored: true\n",
+				"data/notes.txt":          "ignored",
+			},
+			want: map[string]interface{}{
+				"team": map[string]interface{}{
+					"lead":    "Ada",
+					"members": []interface{}{map[string]interface{}{"name": "Ada"}},
+				},
+				"nav":    []interface{}{map[string]interface{}{"href": "/"}},
+				"social": map[string]interface{}{"links": map[string]interface{}{"github": "wispberry"}},
+			},
+		},
+		{
+			name:  "Missing directory",
+			files: map[string]string{"config.toml": ""},
+			want:  map[string]interface{}{},
+		},
+		{
+			name:    "Invalid file",
+			files:   map[string]string{"data/team.json": `{"members": [}`},
+			wantErr: "invalid data file team.json",
+		},
+		{
+			name:    "Same name in two formats",
+			files:   map[string]string{"data/team.json": `{}`, "data/team.yaml": "a: 1\n"},
+			wantErr: "team.json already defines team",
+		},
+		{
+			name:    "File and directory of the same name",
+			files:   map[string]string{"data/team.json": `{}`, "data/team/members.json": `[]`},
+			wantErr: "team.json",
+		},
+		{
+			name:    "Name that is not a template field",
+			files:   map[string]string{"data/team-members.json": `[]`},
+			wantErr: `"team-members" cannot be used as a template field`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeDataFiles(t, root, tt.files)
+
+			got, err := loadDataDir(filepath.Join(root, "data"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadDataDir() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{name: "Params table", config: "[site]\nname = \"x\"\n[params]\ntagline = \"Hi\"\n[params.social]\ngithub = \"wispberry\"", want: map[string]interface{}{
+			"tagline": "Hi",
+			"social":  map[string]interface{}{"github": "wispberry"},
+		}},
+		{name: "No params", config: "[site]\nname = \"x\"", want: map[string]interface{}{}},
+		{name: "Params that are not a table", config: "params = 1", wantErr: true},
+		{name: "Invalid config", config: "[params", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeDataFiles(t, root, map[string]string{"config.toml": tt.config})
+
+			tables, err := readConfigTables(filepath.Join(root, "config.toml"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tables.Params, tt.want) {
+				t.Errorf("params = %#v, want %#v", tables.Params, tt.want)
+			}
+		})
+	}
+}
+
+func TestSiteDataReload(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"config.toml":    "[params]\ntagline = \"Hi\"",
+		"data/team.json": `{"lead": "Ada"}`,
+	})
+	sd, err := newSiteData(root, newConfigFile(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change writes files with a later modification time and lets the next call look at them
+	change := func(files map[string]string) {
+		writeDataFiles(t, root, files)
+		later := time.Now().Add(time.Minute)
+		for name := range files {
+			if err := os.Chtimes(filepath.Join(root, name), later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sd.files.checkedAt = time.Time{}
+	}
+
+	change(map[string]string{"data/team.json": `{"lead": "Grace"}`, "config.toml": "[params]\ntagline = \"Hello\""})
+	data, params := sd.current()
+	if lead := data["team"].(map[string]interface{})["lead"]; lead != "Grace" {
+		t.Errorf("lead after change = %v, want Grace", lead)
+	}
+	if params["tagline"] != "Hello" {
+		t.Errorf("tagline after change = %v, want Hello", params["tagline"])
+	}
+
+	// An invalid file keeps the data that was loaded before
+	change(map[string]string{"data/team.json": `{"lead": `})
+	data, _ = sd.current()
+	if lead := data["team"].(map[string]interface{})["lead"]; lead != "Grace" {
+		t.Errorf("lead after invalid change = %v, want Grace", lead)
+	}
+}
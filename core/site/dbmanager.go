@@ -60,7 +60,11 @@ func NewDatabaseManager(siteDomain string) DatabaseManager {
 		siteDomain,
 		"databases",
 	)
+	return NewDatabaseManagerInDir(siteDomain, dbDir)
+}
 
+// NewDatabaseManagerInDir creates a database manager keeping a site's databases in dbDir
+func NewDatabaseManagerInDir(siteDomain, dbDir string) DatabaseManager {
 	// Ensure database directory exists
 	if err := common.EnsureDir(dbDir); err != nil {
 		common.Error("Failed to create database directory %s: %v", dbDir, err)
@@ -148,6 +152,17 @@ func (dm *databaseManager) getConnectionInternal(dbName string) (*sql.DB, error)
 		return nil, fmt.Errorf("failed to create database connection: %v", err)
 	}
 
+	// Bring the schema up to date before handing out the connection
+	if err := databases.ApplyMigrations(db, dbName); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database %s: %v", dbName, err)
+	}
+
+	// Hooks only maintain optional structures, a failure should not block the site
+	if err := databases.RunOpenHook(db, dbName); err != nil {
+		common.Warning("Open hook for database %s failed: %v", dbName, err)
+	}
+
 	// Cache the connection
 	dm.connections[dbName] = &dbConnection{
 		db:         db,
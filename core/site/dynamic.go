@@ -0,0 +1,226 @@
+package site
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"wispy-core/common"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ErrPageNotFound is returned by a PageLoader when no content matches the route
+// params of a request, which is answered with a 404
+var ErrPageNotFound = errors.New("page not found")
+
+// PageLoader loads the content entry a dynamic page renders in a locale, e.g. the
+// post of pages/blog/[slug].html for params["slug"]. The entry is available to the
+// page as .Entry.
+type PageLoader func(r *http.Request, s Site, locale string, params map[string]string) (interface{}, error)
+
+var (
+	pageLoadersMu sync.RWMutex
+	pageLoaders   = make(map[string]PageLoader)
+)
+
+// RegisterPageLoader sets the loader of a dynamic page, named by its path in the
+// pages directory, e.g. "blog/[slug].html", which also covers its locale variants.
+// Like RegisterTemplateFuncs it applies to every tenant site; the loader gets the
+// site of the request.
+func RegisterPageLoader(page string, loader PageLoader) {
+	pageLoadersMu.Lock()
+	defer pageLoadersMu.Unlock()
+	pageLoaders[page] = loader
+}
+
+func pageLoader(page string) PageLoader {
+	pageLoadersMu.RLock()
+	defer pageLoadersMu.RUnlock()
+	return pageLoaders[page]
+}
+
+// ContentEntry is a published entry of the content database, the .Entry of the
+// pages loaded by ContentPageLoader
+type ContentEntry struct {
+	UUID        string
+	Slug        string
+	Title       string
+	Content     template.HTML
+	PublishedAt time.Time
+	UpdatedAt   time.Time
+	Meta        map[string]string // content_meta by key, e.g. .Entry.Meta.summary
+}
+
+// ContentPageLoader loads the published entry of a content type of the site's
+// content database whose slug is the value of param. Missing and unpublished
+// entries are a 404. It pairs with ContentSitemapEntries:
+//
+//	site.RegisterPageLoader("blog/[slug].html", site.ContentPageLoader("post", "slug"))
+//	site.RegisterSitemapEntries("blog/[slug].html", site.ContentSitemapEntries("post", "slug"))
+func ContentPageLoader(contentType, param string) PageLoader {
+	return func(r *http.Request, s Site, locale string, params map[string]string) (interface{}, error) {
+		manager := s.GetDatabaseManager()
+		if manager == nil {
+			return nil, errors.New("the site has no databases")
+		}
+		db, err := manager.GetOrCreateConnection("content")
+		if err != nil {
+			return nil, err
+		}
+		return queryContentEntry(db, contentType, params[param])
+	}
+}
+
+// queryContentEntry returns the published entry of a content type with a slug and
+// its meta, or ErrPageNotFound
+func queryContentEntry(db *sql.DB, contentType, slug string) (*ContentEntry, error) {
+	var id int64
+	var content string
+	var publishedAt, updatedAt sql.NullTime
+	entry := &ContentEntry{Meta: make(map[string]string)}
+	err := db.QueryRow(`SELECT id, uuid, slug, title, content, published_at, updated_at FROM content
+		WHERE status = 'published' AND content_type = ? AND slug = ?`, contentType, slug).
+		Scan(&id, &entry.UUID, &entry.Slug, &entry.Title, &content, &publishedAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Content = template.HTML(content)
+	entry.PublishedAt, entry.UpdatedAt = publishedAt.Time, updatedAt.Time
+	if !publishedAt.Valid {
+		entry.PublishedAt = entry.UpdatedAt
+	}
+
+	rows, err := db.Query(`SELECT meta_key, meta_value FROM content_meta WHERE content_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		entry.Meta[key] = value.String
+	}
+	return entry, rows.Err()
+}
+
+// dynamicSegment matches a route param in a page path, [slug], or a catch-all, [...path]
+var dynamicSegment = regexp.MustCompile(`^\[(\.\.\.)?([A-Za-z_][A-Za-z0-9_]*)\]$`)
+
+// routeParam is a dynamic segment of a page route
+type routeParam struct {
+	name     string
+	catchAll bool // the rest of the path, which may span segments
+}
+
+// pageRoute is the chi route of a page file. Dynamic segments become URL params:
+// blog/[slug].html is /blog/{slug} and docs/[...path].html is /docs/*.
+type pageRoute struct {
+	pattern string
+	params  []routeParam
+}
+
+// parsePageRoute returns the route of a page file, rejecting dynamic segments
+// that are malformed, repeated, or a catch-all that is not the last segment
+func parsePageRoute(pagePath string) (pageRoute, error) {
+	route := common.PathToRoute(pagePath)
+	if !strings.ContainsAny(route, "[]") {
+		return pageRoute{pattern: route}, nil
+	}
+
+	segments := strings.Split(strings.TrimPrefix(route, "/"), "/")
+	pr := pageRoute{}
+	seen := make(map[string]bool)
+	for i, segment := range segments {
+		if !strings.ContainsAny(segment, "[]") {
+			continue
+		}
+		match := dynamicSegment.FindStringSubmatch(segment)
+		if match == nil {
+			return pr, fmt.Errorf("invalid route segment %q in %s, expected [name] or [...name]", segment, pagePath)
+		}
+		param := routeParam{name: match[2], catchAll: match[1] != ""}
+		if seen[param.name] {
+			return pr, fmt.Errorf("route param %q appears twice in %s", param.name, pagePath)
+		}
+		seen[param.name] = true
+		if param.catchAll {
+			if i != len(segments)-1 {
+				return pr, fmt.Errorf("catch-all %q must be the last segment of %s", segment, pagePath)
+			}
+			segments[i] = "*"
+		} else {
+			segments[i] = "{" + param.name + "}"
+		}
+		pr.params = append(pr.params, param)
+	}
+	pr.pattern = "/" + strings.Join(segments, "/")
+	return pr, nil
+}
+
+// paramPattern matches the URL params of a chi route
+var paramPattern = regexp.MustCompile(`\{[^}]*\}`)
+
+// shape returns the pattern without param names. Routes of the same shape match
+// the same requests, e.g. blog/[slug].html and blog/[id].html.
+func (pr pageRoute) shape() string {
+	return paramPattern.ReplaceAllString(pr.pattern, "{}")
+}
+
+// values returns the route params of a request by name, unescaped
+func (pr pageRoute) values(r *http.Request) map[string]string {
+	if len(pr.params) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(pr.params))
+	for _, param := range pr.params {
+		key := param.name
+		if param.catchAll {
+			key = "*"
+		}
+		value := chi.URLParam(r, key)
+		// chi matches the escaped path when it differs from the decoded one
+		if r.URL.RawPath != "" {
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
+			}
+		}
+		values[param.name] = value
+	}
+	return values
+}
+
+// path returns the path of the route for the given params, e.g. /blog/hello for
+// slug "hello", for canonical and alternate URLs
+func (pr pageRoute) path(values map[string]string) string {
+	if len(pr.params) == 0 {
+		return pr.pattern
+	}
+	segments := strings.Split(pr.pattern, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "*":
+			rest := strings.Split(values[pr.params[len(pr.params)-1].name], "/")
+			for j := range rest {
+				rest[j] = url.PathEscape(rest[j])
+			}
+			segments[i] = strings.Join(rest, "/")
+		case strings.HasPrefix(segment, "{"):
+			segments[i] = url.PathEscape(values[strings.Trim(segment, "{}")])
+		}
+	}
+	return strings.Join(segments, "/")
+}
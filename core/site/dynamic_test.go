@@ -0,0 +1,190 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"wispy-core/tpl"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParsePageRoute(t *testing.T) {
+	tests := []struct {
+		page    string
+		want    pageRoute
+		wantErr string
+	}{
+		{page: "about.html", want: pageRoute{pattern: "/about"}},
+		{page: "blog/[slug].html", want: pageRoute{pattern: "/blog/{slug}", params: []routeParam{{name: "slug"}}}},
+		{
+			page: "shop/[category]/[id]/index.html",
+			want: pageRoute{pattern: "/shop/{category}/{id}", params: []routeParam{{name: "category"}, {name: "id"}}},
+		},
+		{page: "docs/[...path].html", want: pageRoute{pattern: "/docs/*", params: []routeParam{{name: "path", catchAll: true}}}},
+		{page: "blog/post-[id].html", wantErr: `invalid route segment "post-[id]"`},
+		{page: "blog/[slug-name].html", wantErr: `invalid route segment "[slug-name]"`},
+		{page: "[id]/[id].html", wantErr: `route param "id" appears twice`},
+		{page: "docs/[...path]/edit.html", wantErr: "must be the last segment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			got, err := parsePageRoute(tt.page)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePageRoute() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageRoutePath(t *testing.T) {
+	tests := []struct {
+		page   string
+		values map[string]string
+		want   string
+	}{
+		{"about.html", nil, "/about"},
+		{"blog/[slug].html", map[string]string{"slug": "hello world"}, "/blog/hello%20world"},
+		{"docs/[...path].html", map[string]string{"path": "guides/setup"}, "/docs/guides/setup"},
+	}
+	for _, tt := range tests {
+		pr, err := parsePageRoute(tt.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pr.path(tt.values); got != tt.want {
+			t.Errorf("path(%s, %v) = %q, want %q", tt.page, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestDynamicPageRoutes(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"layouts/default.html":      `<body>{{block "body" .}}{{end}}</body>`,
+		"pages/blog/new.html":       `{{define "body"}}<p>New post</p>{{end}}`,
+		"pages/blog/[slug].html":    `{{define "body"}}<h1>{{.Entry.title}}</h1><p>{{.Params.slug}}</p>{{end}}`,
+		"pages/docs/[...path].html": `{{define "body"}}<p>{{.Params.path}}</p>{{end}}`,
+	})
+
+	posts := map[string]string{"hello-world": "Hello world"}
+	RegisterPageLoader("blog/[slug].html", func(r *http.Request, s Site, locale string, params map[string]string) (interface{}, error) {
+		title, ok := posts[params["slug"]]
+		if !ok {
+			return nil, ErrPageNotFound
+		}
+		return map[string]string{"title": title}, nil
+	})
+	t.Cleanup(func() {
+		pageLoadersMu.Lock()
+		delete(pageLoaders, "blog/[slug].html")
+		pageLoadersMu.Unlock()
+	})
+
+	locales, _ := newLocales(i18nConfig{})
+	s := &site{Name: "Example", Domain: "example.com", BaseURL: "https://example.com", locales: locales}
+	engine := tpl.NewTemplateEngine(filepath.Join(root, "layouts"), filepath.Join(root, "pages"))
+	router := chi.NewRouter()
+	for _, page := range localizePages([]string{"blog/new.html", "blog/[slug].html", "docs/[...path].html"}, locales) {
+		createPageRoutes(router, s, engine, page)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   []string
+	}{
+		{"/blog/hello-world", http.StatusOK, []string{`<h1>Hello world</h1><p>hello-world</p>`, `<link rel="canonical" href="https://example.com/blog/hello-world">`}},
+		{"/blog/new", http.StatusOK, []string{`<p>New post</p>`}},
+		{"/blog/missing", http.StatusNotFound, nil},
+		{"/docs/guides/setup%20steps", http.StatusOK, []string{`<p>guides/setup steps</p>`, `href="https://example.com/docs/guides/setup%20steps"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body does not contain %s\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestContentPageLoader(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"layouts/default.html":   `<body>{{block "body" .}}{{end}}</body>`,
+		"pages/blog/[slug].html": `{{define "body"}}<h1>{{.Entry.Title}}</h1>{{.Entry.Content}}<p>{{.Entry.Meta.summary}}</p>{{end}}`,
+	})
+	RegisterPageLoader("blog/[slug].html", ContentPageLoader("post", "slug"))
+	t.Cleanup(func() {
+		pageLoadersMu.Lock()
+		delete(pageLoaders, "blog/[slug].html")
+		pageLoadersMu.Unlock()
+	})
+
+	locales, _ := newLocales(i18nConfig{})
+	s := &site{Name: "Example", Domain: "example.com", BaseURL: "https://example.com", locales: locales}
+	s.DbManager = NewDatabaseManagerInDir(s.Domain, t.TempDir())
+	t.Cleanup(func() { s.DbManager.Close() })
+	db, err := s.DbManager.GetOrCreateConnection("content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO content (id, uuid, slug, title, content, content_type, status) VALUES
+		(1, 'a1', 'first', 'First', '<p>One</p>', 'post', 'published'),
+		(2, 'b2', 'draft', 'Draft', '', 'post', 'draft'),
+		(3, 'c3', 'about', 'About', '', 'page', 'published');
+		INSERT INTO content_meta (content_id, meta_key, meta_value) VALUES (1, 'summary', 'The first')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := tpl.NewTemplateEngine(filepath.Join(root, "layouts"), filepath.Join(root, "pages"))
+	router := chi.NewRouter()
+	for _, page := range localizePages([]string{"blog/[slug].html"}, locales) {
+		createPageRoutes(router, s, engine, page)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/blog/first", http.StatusOK, `<h1>First</h1><p>One</p><p>The first</p>`},
+		{"/blog/draft", http.StatusNotFound, ""},
+		{"/blog/missing", http.StatusNotFound, ""},
+		// Entries of other content types are not served by the page
+		{"/blog/about", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.wantStatus)
+		}
+		if !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: body does not contain %s\n%s", tt.path, tt.wantBody, w.Body.String())
+		}
+	}
+}
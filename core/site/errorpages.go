@@ -0,0 +1,261 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"wispy-core/common"
+	"wispy-core/tpl"
+	"wispy-core/wispytail"
+)
+
+// errorPageStatuses are the statuses a site can design a page for, e.g. pages/404.html
+// or pages/404/index.html
+var errorPageStatuses = []int{
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusInternalServerError,
+	http.StatusServiceUnavailable,
+}
+
+// errorPageStatus returns the status a page is the error page of. Error pages are
+// not served at a route of their own.
+func errorPageStatus(pagePath string) (int, bool) {
+	name := strings.TrimSuffix(filepath.ToSlash(pagePath), ".html")
+	name = strings.TrimSuffix(name, "/index")
+	for _, status := range errorPageStatuses {
+		if name == strconv.Itoa(status) {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// maintenanceConfig is the [maintenance] table of config.toml
+type maintenanceConfig struct {
+	Enabled    bool     `toml:"enabled"`
+	RetryAfter int      `toml:"retry_after"` // seconds, sent as Retry-After
+	Allow      []string `toml:"allow"`       // path prefixes served as usual
+}
+
+// ErrorPages answers requests that fail with the site's own page for the status,
+// rendered with its layout and theme, and answers every request with the 503 page
+// while the site is in maintenance. A built-in page is used when the site has no
+// page for a status, or its page fails to render.
+type ErrorPages struct {
+	site   Site
+	config *reloadable[maintenanceConfig]
+
+	mu     sync.Mutex
+	engine tpl.TemplateEngine
+	pages  map[int]localizedPage
+}
+
+// newErrorPages reads the maintenance config of a site from its config file. Its
+// pages are added as the site's routes are scaffolded.
+func newErrorPages(s Site, config *configFile) (*ErrorPages, error) {
+	maintenance, err := newReloadable("the maintenance config", func() (maintenanceConfig, error) {
+		return loadMaintenance(config)
+	}, config.path)
+	if err != nil {
+		return nil, err
+	}
+	return &ErrorPages{site: s, config: maintenance, pages: make(map[int]localizedPage)}, nil
+}
+
+// loadMaintenance reads and checks the [maintenance] table of a config file
+func loadMaintenance(config *configFile) (maintenanceConfig, error) {
+	tables, err := config.current()
+	if err != nil {
+		return maintenanceConfig{}, err
+	}
+	maintenance := tables.Maintenance
+	if maintenance.RetryAfter < 0 {
+		return maintenance, fmt.Errorf("maintenance retry_after must not be negative, got %d", maintenance.RetryAfter)
+	}
+	for _, prefix := range maintenance.Allow {
+		if !strings.HasPrefix(prefix, "/") {
+			return maintenance, fmt.Errorf("maintenance allow %q must be a path", prefix)
+		}
+	}
+	return maintenance, nil
+}
+
+// setEngine sets the template engine the pages are rendered with
+func (ep *ErrorPages) setEngine(engine tpl.TemplateEngine) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.engine = engine
+}
+
+// add makes page the error page of status
+func (ep *ErrorPages) add(status int, page localizedPage) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.pages[status] = page
+}
+
+// maintenance returns the maintenance config, reloading it when config.toml changed
+func (ep *ErrorPages) maintenance() maintenanceConfig {
+	return ep.config.current()
+}
+
+// InMaintenance reports whether the site answers with its maintenance page
+func (ep *ErrorPages) InMaintenance() bool {
+	return ep.maintenance().Enabled
+}
+
+// Handler answers requests with the 503 page while the site is in maintenance,
+// except for its assets and the paths the config allows
+func (ep *ErrorPages) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := ep.maintenance()
+		if !config.Enabled || maintenanceAllows(config, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if config.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(config.RetryAfter))
+		}
+		ep.Serve(w, r, http.StatusServiceUnavailable, nil)
+	})
+}
+
+// maintenanceAllows reports whether a path is served during maintenance
+func maintenanceAllows(config maintenanceConfig, path string) bool {
+	if strings.HasPrefix(path, "/assets/") || strings.HasPrefix(path, "/public/") {
+		return true
+	}
+	for _, prefix := range config.Allow {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// NotFound answers requests no route matches, for the router's NotFound handler
+func (ep *ErrorPages) NotFound(w http.ResponseWriter, r *http.Request) {
+	ep.Serve(w, r, http.StatusNotFound, nil)
+}
+
+// Serve answers a request with the error page of status, in the locale of the
+// request. err is logged, and only shown when debug info is requested. Sites
+// without error pages answer with the built-in page.
+func (ep *ErrorPages) Serve(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status >= http.StatusInternalServerError && status != http.StatusServiceUnavailable {
+		common.Error("%s %s: %d %v", r.Method, r.URL.Path, status, err)
+	} else if err != nil {
+		common.Debug("%s %s: %d %v", r.Method, r.URL.Path, status, err)
+	}
+
+	if ep == nil {
+		writeFallbackErrorPage(w, r, status, err)
+		return
+	}
+	ep.mu.Lock()
+	engine := ep.engine
+	page, ok := ep.pages[status]
+	ep.mu.Unlock()
+
+	if ok && engine != nil {
+		locale := ep.requestLocale(r)
+		if pagePath, ok := page.file(locale); ok {
+			body, renderErr := ep.render(engine, pagePath, status, locale)
+			if renderErr == nil {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(status)
+				w.Write(body)
+				return
+			}
+			common.Error("Failed to render the %d page %s of site %s: %v", status, pagePath, ep.site.GetName(), renderErr)
+		}
+	}
+	writeFallbackErrorPage(w, r, status, err)
+}
+
+// render renders an error page with the site's layout and theme. Nothing is
+// written until the whole page rendered, so a failure can fall back.
+func (ep *ErrorPages) render(engine tpl.TemplateEngine, pagePath string, status int, locale string) ([]byte, error) {
+	s := ep.site
+	templateData := tpl.TemplateData{
+		Title:       http.StatusText(status) + " | " + s.GetName(),
+		Description: s.GetSEO().Description,
+		Site: tpl.SiteData{
+			Name:    s.GetName(),
+			Domain:  s.GetDomain(),
+			BaseURL: s.GetBaseURL(),
+			Data:    s.GetData(),
+			Params:  s.GetParams(),
+		},
+		Data:   make(map[string]interface{}),
+		Locale: locale,
+	}
+	templateData.Data["Site"] = templateData.Site
+	templateData.Data["Locale"] = templateData.Locale
+	templateData.Data["Status"] = status
+	templateData.Data["StatusText"] = http.StatusText(status)
+
+	themeConfig := wispytail.DefaultThemeConfig()
+	trie := engine.GetWispyTailTrie()
+	classes := wispytail.NewClassCollector()
+
+	var buf bytes.Buffer
+	_, err := engine.RenderWithLayoutTo(&buf, pagePath, defaultPageLayout, templateData, tpl.StreamHooks{
+		Head: func(rs tpl.RenderState) {
+			rs.AddHeadInlineCSS(wispytail.GenerateThemeLayer(themeConfig) + "\n" + siteThemeCSS(s))
+			rs.SetHeadTitle(templateData.Title)
+			// Error pages take the site's head tags, but are not indexed
+			if err := s.GetSEO().Apply(rs); err != nil {
+				common.Warning("Failed to apply the seo config of site %s: %v", s.GetName(), err)
+			}
+			rs.SetHeadMeta(tpl.MetaTag{Name: "robots", Content: "noindex"})
+		},
+		Body: classes,
+		Deferred: func(rs tpl.RenderState) {
+			rs.AddHeadInlineCSS(wispytail.GenerateFromClasses(classes.Classes(), themeConfig, trie))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// requestLocale returns the locale of a request from its domain or path prefix,
+// as no route matched it
+func (ep *ErrorPages) requestLocale(r *http.Request) string {
+	locales := ep.site.GetLocales()
+	if locale, ok := locales.ForHost(r.Host); ok {
+		return locale
+	}
+	for _, locale := range locales.All {
+		if prefix := locales.Prefix(locale); prefix != "" && (r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/")) {
+			return locale
+		}
+	}
+	return locales.Default
+}
+
+// writeFallbackErrorPage writes the built-in error page, which depends on nothing
+// the site provides
+func writeFallbackErrorPage(w http.ResponseWriter, r *http.Request, status int, err error) {
+	text := html.EscapeString(http.StatusText(status))
+	var debug string
+	if err != nil && common.ShouldIncludeDebugInfo(r) {
+		debug = `<pre>` + html.EscapeString(err.Error()) + `</pre>`
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html><html lang="en"><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1"><meta name="robots" content="noindex"><title>%d %s</title>`+
+		`<style>body{font-family:system-ui,sans-serif;display:grid;place-items:center;min-height:100vh;margin:0;color:#1f2937;background:#f9fafb}main{text-align:center;padding:2rem}h1{font-size:3rem;margin:0}pre{text-align:left;white-space:pre-wrap}</style>`+
+		`</head><body><main><h1>%d</h1><p>%s</p>%s</main></body></html>`, status, text, status, text, debug)
+}
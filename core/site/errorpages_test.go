@@ -0,0 +1,143 @@
+package site
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorPageStatus(t *testing.T) {
+	tests := []struct {
+		page   string
+		want   int
+		wantOk bool
+	}{
+		{"404.html", http.StatusNotFound, true},
+		{"404/index.html", http.StatusNotFound, true},
+		{"500.html", http.StatusInternalServerError, true},
+		{"503/index.html", http.StatusServiceUnavailable, true},
+		{"403.html", http.StatusForbidden, true},
+		{"418.html", 0, false},
+		{"docs/404.html", 0, false},
+		{"index.html", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := errorPageStatus(tt.page); got != tt.want || ok != tt.wantOk {
+			t.Errorf("errorPageStatus(%s) = %d, %v, want %d, %v", tt.page, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"layouts/default.html":    `<body class="site">{{block "body" .}}{{end}}</body>`,
+		"pages/about.html":        `{{define "body"}}<p>About</p>{{end}}`,
+		"pages/broken.html":       "+++\nunknown = 1\n+++\n{{define \"body\"}}{{end}}",
+		"pages/404/index.html":    `{{define "body"}}<h1 class="text-5xl">{{.Status}} {{.StatusText}}</h1>{{end}}`,
+		"pages/404/index.fr.html": `{{define "body"}}<h1>Page introuvable</h1>{{end}}`,
+		"pages/500.html":          `{{define "body"}}<h1>Something broke</h1>{{end}}`,
+		"pages/403.html":          `{{define "body"}}{{template "nope" .}}{{end}}`,
+	})
+	s, router := newTestSite(t, root)
+	router.Get("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		s.GetErrorPages().Serve(w, r, http.StatusForbidden, errors.New("no access"))
+	})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   []string
+	}{
+		{"/about", http.StatusOK, []string{"<p>About</p>"}},
+		{"/missing", http.StatusNotFound, []string{`<body class="site"><h1 class="text-5xl">404 Not Found</h1>`, `<meta name="robots" content="noindex">`, ".text-5xl"}},
+		{"/fr/missing", http.StatusNotFound, []string{`<html lang="fr">`, `<h1>Page introuvable</h1>`}},
+		{"/404", http.StatusNotFound, []string{"404 Not Found"}},
+		{"/broken", http.StatusInternalServerError, []string{`<body class="site"><h1>Something broke</h1>`}},
+		// The site's 403 page fails to render, so the built-in page is used
+		{"/forbidden", http.StatusForbidden, []string{"<h1>403</h1><p>Forbidden</p>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body does not contain %s\n%s", want, w.Body.String())
+				}
+			}
+			if strings.Contains(w.Body.String(), "no access") {
+				t.Errorf("body shows the error without debug info requested\n%s", w.Body.String())
+			}
+		})
+	}
+
+	// Without any error page the built-in one is used
+	var none *ErrorPages
+	w := httptest.NewRecorder()
+	none.Serve(w, httptest.NewRequest("GET", "/?__include_debug_info__=true", nil), http.StatusInternalServerError, errors.New("db <down>"))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<pre>db &lt;down&gt;</pre>") {
+		t.Errorf("built-in page = %d\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"config.toml": `
+[maintenance]
+enabled = true
+retry_after = 600
+allow = ["/status"]`,
+		"layouts/default.html": `<body>{{block "body" .}}{{end}}</body>`,
+		"pages/about.html":     `{{define "body"}}<p>About</p>{{end}}`,
+		"pages/status.html":    `{{define "body"}}<p>Up</p>{{end}}`,
+		"pages/503.html":       `{{define "body"}}<h1>Back soon</h1>{{end}}`,
+		"assets/site.css":      `body { margin: 0 }`,
+	})
+	_, router := newTestSite(t, root)
+
+	tests := []struct {
+		path           string
+		wantStatus     int
+		wantRetryAfter string
+		wantBody       string
+	}{
+		{"/about", http.StatusServiceUnavailable, "600", "<h1>Back soon</h1>"},
+		{"/missing", http.StatusServiceUnavailable, "600", "<h1>Back soon</h1>"},
+		{"/status", http.StatusOK, "", "<p>Up</p>"},
+		{"/assets/site.css", http.StatusOK, "", "body { margin: 0 }"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %s\n%s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	if _, err := loadMaintenance(writeConfig(t, "[maintenance]\nallow = [\"status\"]")); err == nil {
+		t.Error("loadMaintenance() accepted an allowed path without a leading slash")
+	}
+}
+
+// writeConfig writes a config.toml with content and returns it
+func writeConfig(t *testing.T, content string) *configFile {
+	t.Helper()
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{"config.toml": content})
+	return newConfigFile(root)
+}
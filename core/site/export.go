@@ -0,0 +1,457 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"wispy-core/common"
+)
+
+// exportContextKey is the type of the context keys of export requests
+type exportContextKey string
+
+// exportRenderErrorKey holds the *error a page sets when its render fails after
+// the response started, see reportStreamError
+const exportRenderErrorKey exportContextKey = "export_render_error"
+
+// exportManifestName is the file of an export listing the files it wrote, so a
+// later export removes those it no longer has without touching other files
+const exportManifestName = ".wispy-export.json"
+
+// ExportOptions configures a static export of a site
+type ExportOptions struct {
+	Dir string // directory the site is written to
+	// BaseURL the export is served from, the site's base URL by default. Absolute
+	// URLs of the site and links rooted at / are rewritten to it.
+	BaseURL string
+	// Relative writes links within the site relative to the page instead, so the
+	// export also works from a subdirectory or from disk
+	Relative bool
+}
+
+// ExportResult lists what an export did, with paths relative to its directory
+type ExportResult struct {
+	Written   []string
+	Unchanged int
+	Removed   []string
+	Failed    []error // routes that could not be rendered, which are left out
+}
+
+// ExportSite renders every route of a site into a directory tree of index.html
+// files, with its sitemap, robots.txt, feeds, assets and public files. The
+// routes of the site must have been set up with ScaffoldTenantSiteRoutes; pages
+// are rendered by them like for a visitor. Files that did not change are not
+// written again.
+func ExportSite(tenantSite Site, opts ExportOptions) (*ExportResult, error) {
+	return exportSite(tenantSite.GetRouter(), tenantSite, tenantSitePath(tenantSite), opts)
+}
+
+// exporter renders the routes of a site through its handler
+type exporter struct {
+	handler  http.Handler
+	site     Site
+	sitePath string
+	opts     ExportOptions
+	siteBase string // base URL of absolute URLs in rendered output
+	base     string // base URL of the export
+
+	files  map[string][]byte // path relative to the export directory -> content
+	pages  map[string]string // route of an exported page -> its file
+	result *ExportResult
+}
+
+func exportSite(handler http.Handler, s Site, sitePath string, opts ExportOptions) (*ExportResult, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("no export directory")
+	}
+	e := &exporter{
+		handler:  handler,
+		site:     s,
+		sitePath: sitePath,
+		opts:     opts,
+		siteBase: strings.TrimSuffix(s.GetBaseURL(), "/"),
+		base:     strings.TrimSuffix(opts.BaseURL, "/"),
+		files:    make(map[string][]byte),
+		pages:    make(map[string]string),
+		result:   &ExportResult{},
+	}
+	if e.siteBase == "" {
+		// Rendered without a base URL of its own, the site uses that of the request
+		e.siteBase = "http://" + s.GetDomain()
+	}
+	if e.base == "" {
+		e.base = strings.TrimSuffix(s.GetBaseURL(), "/")
+	}
+	if e.base == "" {
+		return nil, errors.New("the site has no base_url, one is needed for the export")
+	}
+
+	pages, err := ScanPages(filepath.Join(sitePath, "pages"))
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range e.pageRoutes(localizePages(pages, s.GetLocales())) {
+		e.exportPage(route)
+	}
+	e.exportErrorPage()
+	e.exportSitemap()
+	for _, ct := range s.GetContentTypes() {
+		if ct.Feed.Disabled {
+			continue
+		}
+		for _, format := range feedFormats {
+			e.exportFile("/" + ct.Name + "/" + format.file)
+		}
+	}
+
+	// Links are rewritten once every page is known, collecting the assets pages use
+	var assets []string
+	for file, content := range e.files {
+		content = e.rebase(content)
+		if strings.HasSuffix(file, ".html") {
+			assets = append(assets, referencedAssets(content)...)
+			content = e.rewriteLinks(file, content)
+		}
+		e.files[file] = content
+	}
+	e.copyDir("assets")
+	e.copyDir("public")
+	// Fingerprinted asset URLs are answered by the site's routes
+	for _, asset := range assets {
+		if _, ok := e.files[strings.TrimPrefix(asset, "/")]; !ok {
+			e.exportFile(asset)
+		}
+	}
+
+	if err := e.write(); err != nil {
+		return e.result, err
+	}
+	return e.result, nil
+}
+
+// pageRoutes lists the routes of pages in each locale of the site, of the entries
+// of dynamic pages with sitemap entries and of the sitemap sources, like the
+// site's content types. Dynamic pages without sitemap entries are left out, as
+// are locales served from their own domain.
+func (e *exporter) pageRoutes(pages []localizedPage) []string {
+	locales := e.site.GetLocales()
+	var routes []string
+	seen := make(map[string]bool)
+	add := func(route string) {
+		if !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	for _, page := range pages {
+		if _, ok := errorPageStatus(page.path); ok {
+			continue
+		}
+		route, err := parsePageRoute(page.path)
+		if err != nil {
+			continue
+		}
+		lister := sitemapLister(page.path)
+		if len(route.params) > 0 && lister == nil {
+			common.Warning("Dynamic page %s has no sitemap entries, only the routes of sitemap sources like content types are exported", page.path)
+			continue
+		}
+		for _, locale := range locales.All {
+			if _, ok := page.file(locale); !ok || locales.Domains[locale] != "" {
+				continue
+			}
+			prefix := locales.Prefix(locale)
+			if len(route.params) == 0 {
+				add(localizedRoute(route.path(nil), prefix))
+				continue
+			}
+			entries, err := lister(e.site, locale)
+			if err != nil {
+				e.fail(fmt.Errorf("page %s: %w", page.path, err))
+				continue
+			}
+			for _, entry := range entries {
+				if sitemapEntryComplete(route, entry) {
+					add(localizedRoute(route.path(entry.Params), prefix))
+				}
+			}
+		}
+	}
+
+	for _, source := range siteSitemapSources(pages) {
+		for _, locale := range locales.All {
+			if locales.Domains[locale] != "" {
+				continue
+			}
+			entries, err := source(e.site, locale)
+			if err != nil {
+				e.fail(err)
+				continue
+			}
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Path, "/") {
+					add(localizedRoute(entry.Path, locales.Prefix(locale)))
+				}
+			}
+		}
+	}
+	return routes
+}
+
+// get requests a path of the site
+func (e *exporter) get(path string) *httptest.ResponseRecorder {
+	w, _ := e.request(path)
+	return w
+}
+
+// request requests a path of the site and returns the error of a page that failed
+// while streaming, which still answers 200 with a notice in place of its content
+func (e *exporter) request(path string) (*httptest.ResponseRecorder, error) {
+	var renderErr error
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r = r.WithContext(context.WithValue(r.Context(), exportRenderErrorKey, &renderErr))
+	r.Host = e.site.GetDomain()
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, r)
+	return w, renderErr
+}
+
+// reportStreamError hands the failure of a streamed page to the export that
+// requested it, visitors only get the notice in the page
+func reportStreamError(r *http.Request, err error) {
+	if slot, ok := r.Context().Value(exportRenderErrorKey).(*error); ok {
+		*slot = err
+	}
+}
+
+// exportPage renders the page at route to its index.html. Pages are rendered
+// twice, so the CSS of their classes is in the head rather than after the body
+// like on a first visit.
+func (e *exporter) exportPage(route string) {
+	file, err := routeFile(route)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	e.get(route)
+	w, err := e.request(route)
+	if w.Code != http.StatusOK {
+		e.fail(fmt.Errorf("%s: %d %s", route, w.Code, http.StatusText(w.Code)))
+		return
+	}
+	if err != nil {
+		e.fail(fmt.Errorf("%s: %w", route, err))
+		return
+	}
+	e.files[file] = w.Body.Bytes()
+	e.pages[route] = file
+}
+
+// exportErrorPage renders the page of unknown paths to 404.html, where static
+// hosts look for it
+func (e *exporter) exportErrorPage() {
+	if w := e.get("/404.html"); w.Code == http.StatusNotFound {
+		e.files["404.html"] = w.Body.Bytes()
+	}
+}
+
+// exportSitemap writes the sitemap with its parts, and robots.txt
+func (e *exporter) exportSitemap() {
+	e.exportFile("/sitemap.xml")
+	for n := 1; ; n++ {
+		w := e.get("/sitemap-" + strconv.Itoa(n) + ".xml")
+		if w.Code != http.StatusOK {
+			break
+		}
+		e.files["sitemap-"+strconv.Itoa(n)+".xml"] = w.Body.Bytes()
+	}
+	e.exportFile("/robots.txt")
+}
+
+// exportFile writes the response of a path that is a file, e.g. /post/feed.xml
+func (e *exporter) exportFile(filePath string) {
+	file, err := routeFile(filePath)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	w := e.get(filePath)
+	if w.Code != http.StatusOK {
+		e.fail(fmt.Errorf("%s: %d %s", filePath, w.Code, http.StatusText(w.Code)))
+		return
+	}
+	e.files[file] = w.Body.Bytes()
+}
+
+// copyDir copies a directory of the site, e.g. public, to the same path of the export
+func (e *exporter) copyDir(dir string) {
+	root := filepath.Join(e.sitePath, dir)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(e.sitePath, p)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		e.files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		e.fail(fmt.Errorf("copying %s: %w", dir, err))
+	}
+}
+
+func (e *exporter) fail(err error) {
+	e.result.Failed = append(e.result.Failed, err)
+}
+
+// routeFile returns the file of the export a route is written to: pages go in
+// the index.html of their directory, paths with an extension are files
+func routeFile(route string) (string, error) {
+	p, err := url.PathUnescape(route)
+	if err != nil || !strings.HasPrefix(p, "/") || path.Clean(p) != p || strings.Contains(p, "\\") {
+		return "", fmt.Errorf("%s: not a path that can be exported", route)
+	}
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return "index.html", nil
+	}
+	if path.Ext(p) != "" {
+		return p, nil
+	}
+	return p + "/index.html", nil
+}
+
+// rebase makes absolute URLs of the site absolute URLs of the export
+func (e *exporter) rebase(content []byte) []byte {
+	if e.siteBase == e.base {
+		return content
+	}
+	for _, end := range []string{"/", `"`, "<", "'"} {
+		content = bytes.ReplaceAll(content, []byte(e.siteBase+end), []byte(e.base+end))
+	}
+	return content
+}
+
+// rootedLink matches links and sources of HTML rooted at /, but not at //
+var rootedLink = regexp.MustCompile(`\b(href|src|action|poster)=(["'])(/(?:[^/"'][^"']*)?)["']`)
+
+// referencedAssets returns the paths of the assets a page links to
+func referencedAssets(content []byte) []string {
+	var assets []string
+	for _, match := range rootedLink.FindAllSubmatch(content, -1) {
+		link := string(match[3])
+		if strings.HasPrefix(link, "/assets/") {
+			if i := strings.IndexAny(link, "?#"); i >= 0 {
+				link = link[:i]
+			}
+			assets = append(assets, link)
+		}
+	}
+	slices.Sort(assets)
+	return slices.Compact(assets)
+}
+
+// rewriteLinks roots the links of a page at the base URL of the export, or makes
+// them relative to the page's file
+func (e *exporter) rewriteLinks(file string, content []byte) []byte {
+	return rootedLink.ReplaceAllFunc(content, func(match []byte) []byte {
+		sub := rootedLink.FindSubmatch(match)
+		attr, quote, link := string(sub[1]), string(sub[2]), string(sub[3])
+		if e.opts.Relative {
+			link = e.relativeLink(file, link)
+		} else {
+			link = e.base + link
+		}
+		return []byte(attr + "=" + quote + link + quote)
+	})
+}
+
+// relativeLink returns a link rooted at / relative to the directory of file
+func (e *exporter) relativeLink(file, link string) string {
+	target, suffix := link, ""
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		target, suffix = link[:i], link[i:]
+	}
+	targetFile, ok := e.pages[strings.TrimSuffix(target, "/")]
+	if !ok && target == "/" {
+		targetFile, ok = e.pages["/"]
+	}
+	if !ok {
+		targetFile = strings.TrimPrefix(target, "/")
+	}
+	rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(file)), filepath.FromSlash(targetFile))
+	if err != nil || targetFile == "" {
+		return link
+	}
+	return filepath.ToSlash(rel) + suffix
+}
+
+// write writes the files of the export that changed and removes the files an
+// earlier export wrote that it no longer has
+func (e *exporter) write() error {
+	manifestPath := filepath.Join(e.opts.Dir, exportManifestName)
+	var previous []string
+	if data, err := os.ReadFile(manifestPath); err == nil {
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return fmt.Errorf("invalid export manifest %s: %w", manifestPath, err)
+		}
+	}
+
+	files := make([]string, 0, len(e.files))
+	for file := range e.files {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+	for _, file := range files {
+		target := filepath.Join(e.opts.Dir, filepath.FromSlash(file))
+		if existing, err := os.ReadFile(target); err == nil && bytes.Equal(existing, e.files[file]) {
+			e.result.Unchanged++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, e.files[file], 0644); err != nil {
+			return err
+		}
+		e.result.Written = append(e.result.Written, file)
+	}
+
+	for _, file := range previous {
+		if _, ok := e.files[file]; ok || !filepath.IsLocal(filepath.FromSlash(file)) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(e.opts.Dir, filepath.FromSlash(file))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		e.result.Removed = append(e.result.Removed, file)
+	}
+
+	if slices.Equal(files, previous) {
+		return nil
+	}
+	manifest, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, manifest, 0644)
+}
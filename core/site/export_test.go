@@ -0,0 +1,139 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRouteFile(t *testing.T) {
+	tests := []struct {
+		route   string
+		want    string
+		wantErr bool
+	}{
+		{"/", "index.html", false},
+		{"/about", "about/index.html", false},
+		{"/fr", "fr/index.html", false},
+		{"/blog/hello%20world", "blog/hello world/index.html", false},
+		{"/post/feed.xml", "post/feed.xml", false},
+		{"/blog/../secret", "", true},
+		{"/blog/%2E%2E/secret", "", true},
+		{"/docs/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := routeFile(tt.route)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("routeFile(%s) = %q, %v, want %q, error %v", tt.route, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestExportSite(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"layouts/default.html":   `<body><a href="/">Home</a> <a href="/about#team">About</a> <img src="/assets/logo.svg"> <a href="//cdn.example.com/x">CDN</a>{{block "body" .}}{{end}}</body>`,
+		"pages/index.html":       `{{define "body"}}<p class="text-xl">Welcome</p>{{end}}`,
+		"pages/about.html":       `{{define "body"}}<p>About</p>{{end}}`,
+		"pages/about.fr.html":    `{{define "body"}}<p>À propos</p>{{end}}`,
+		"pages/blog/[slug].html": `{{define "body"}}<p>Post</p>{{end}}`,
+		"pages/404.html":         `{{define "body"}}<h1>Lost</h1>{{end}}`,
+		"pages/broken.html":      `{{define "body"}}<p>Start</p>{{index .Data.Missing 3}}{{end}}`,
+		"assets/logo.svg":        `<svg></svg>`,
+		"public/files/doc.txt":   "doc",
+	})
+	// Entries of content types are exported at their path, when a page serves it
+	s, router := newTestSite(t, root,
+		ContentType{Name: "post", Path: "/blog", Feed: FeedConfig{Disabled: true}},
+		ContentType{Name: "note", Feed: FeedConfig{Disabled: true}})
+	s.DbManager = NewDatabaseManagerInDir(s.Domain, t.TempDir())
+	t.Cleanup(func() { s.DbManager.Close() })
+	db, err := s.DbManager.GetOrCreateConnection("content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO content (uuid, slug, title, content, content_type, status) VALUES ('a1', 'first', 'First', '', 'post', 'published'), ('b2', 'second', 'Second', '', 'note', 'published')`); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeDataFiles(t, dir, map[string]string{"CNAME": "www.example.com"})
+
+	result, err := exportSite(router, s, root, ExportOptions{Dir: dir, BaseURL: "https://cdn.example.com/site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A page failing part way through answers 200 with a notice, it is not exported
+	if len(result.Failed) != 2 || !strings.HasPrefix(result.Failed[0].Error(), "/broken: ") || !strings.HasPrefix(result.Failed[1].Error(), "/fr/broken: ") {
+		t.Fatalf("failed = %v, want /broken and /fr/broken", result.Failed)
+	}
+	want := []string{"404.html", "about/index.html", "assets/logo.svg", "blog/first/index.html", "fr/about/index.html", "fr/index.html", "index.html", "public/files/doc.txt", "robots.txt", "sitemap.xml"}
+	if !slices.Equal(result.Written, want) {
+		t.Errorf("written = %v, want %v", result.Written, want)
+	}
+
+	about := readExport(t, dir, "about/index.html")
+	for _, want := range []string{
+		`<a href="https://cdn.example.com/site/">Home</a>`,
+		`<a href="https://cdn.example.com/site/about#team">About</a>`,
+		`<img src="https://cdn.example.com/site/assets/logo.svg">`,
+		`<a href="//cdn.example.com/x">CDN</a>`,
+		`<link rel="canonical" href="https://cdn.example.com/site/about">`,
+		"<p>About</p>",
+	} {
+		if !strings.Contains(about, want) {
+			t.Errorf("about/index.html does not contain %s\n%s", want, about)
+		}
+	}
+	// The CSS of the page's classes is in the head
+	if index := readExport(t, dir, "index.html"); !strings.Contains(index[:strings.Index(index, "<body")], ".text-xl") {
+		t.Errorf("index.html does not style .text-xl in the head\n%s", index)
+	}
+	if sitemap := readExport(t, dir, "sitemap.xml"); !strings.Contains(sitemap, "<loc>https://cdn.example.com/site/fr/about</loc>") {
+		t.Errorf("sitemap.xml is not of the export's base URL\n%s", sitemap)
+	}
+	if notFound := readExport(t, dir, "404.html"); !strings.Contains(notFound, "<h1>Lost</h1>") {
+		t.Errorf("404.html = %s", notFound)
+	}
+
+	// Exporting again with relative links only writes the pages
+	result, err = exportSite(router, s, root, ExportOptions{Dir: dir, BaseURL: "https://cdn.example.com/site", Relative: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"404.html", "about/index.html", "blog/first/index.html", "fr/about/index.html", "fr/index.html", "index.html"}; !slices.Equal(result.Written, want) || result.Unchanged != 4 {
+		t.Errorf("written = %v, unchanged = %d, want %v and 4", result.Written, result.Unchanged, want)
+	}
+	frAbout := readExport(t, dir, "fr/about/index.html")
+	for _, want := range []string{`<a href="../../index.html">Home</a>`, `<a href="../../about/index.html#team">About</a>`, `<img src="../../assets/logo.svg">`} {
+		if !strings.Contains(frAbout, want) {
+			t.Errorf("fr/about/index.html does not contain %s\n%s", want, frAbout)
+		}
+	}
+
+	// Files the site no longer has are removed, files the export did not write are kept
+	if err := os.Remove(filepath.Join(root, "public/files/doc.txt")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = exportSite(router, s, root, ExportOptions{Dir: dir, BaseURL: "https://cdn.example.com/site", Relative: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Written) != 0 || !slices.Equal(result.Removed, []string{"public/files/doc.txt"}) {
+		t.Errorf("written = %v, removed = %v, want none and public/files/doc.txt", result.Written, result.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "CNAME")); err != nil {
+		t.Errorf("CNAME was removed: %v", err)
+	}
+}
+
+// readExport reads a file of an export
+func readExport(t *testing.T, dir, file string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
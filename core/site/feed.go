@@ -0,0 +1,596 @@
+package site
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultFeedLimit is how many entries a feed lists when its content type does not say
+	defaultFeedLimit = 20
+	// feedSummaryLength is the most characters of a summary made from the content
+	feedSummaryLength = 300
+)
+
+// FeedConfig is the [content_types.feed] table of a content type in config.toml
+type FeedConfig struct {
+	Disabled    bool   `toml:"disabled"`
+	Title       string `toml:"title"` // the site's name and the content type by default
+	Description string `toml:"description"`
+	Author      string `toml:"author"`       // of entries without an author of their own, the site's name by default
+	Limit       int    `toml:"limit"`        // newest entries listed, 20 by default
+	FullContent bool   `toml:"full_content"` // the whole content of entries rather than their summary
+}
+
+// ContentType is a [[content_types]] table of config.toml, the kind of entries of
+// the content database:
+//
+//	[[content_types]]
+//	name = "post"
+//	path = "/blog"  # entries are at /blog/{slug}, /post/{slug} by default
+//	[content_types.feed]
+//	title = "Joosy Jools blog"
+//	full_content = true
+type ContentType struct {
+	Name string     `toml:"name"`
+	Path string     `toml:"path"`
+	Feed FeedConfig `toml:"feed"`
+}
+
+// EntryPath returns the path of the entry with slug
+func (ct ContentType) EntryPath(slug string) string {
+	return strings.TrimSuffix(ct.basePath(), "/") + "/" + slug
+}
+
+// basePath returns the path the entries of the content type are under
+func (ct ContentType) basePath() string {
+	if ct.Path != "" {
+		return ct.Path
+	}
+	return "/" + ct.Name
+}
+
+// validateContentTypes reports content types without a name, named twice or with
+// a path that is not one
+func validateContentTypes(contentTypes []ContentType) error {
+	seen := make(map[string]bool)
+	for i, ct := range contentTypes {
+		if ct.Name == "" {
+			return fmt.Errorf("content type %d has no name", i+1)
+		}
+		if seen[ct.Name] {
+			return fmt.Errorf("content type %s is declared twice", ct.Name)
+		}
+		seen[ct.Name] = true
+		if ct.Path != "" && !strings.HasPrefix(ct.Path, "/") {
+			return fmt.Errorf("content type %s: path %q must start with /", ct.Name, ct.Path)
+		}
+		if ct.Feed.Limit < 0 {
+			return fmt.Errorf("content type %s: feed limit must not be negative", ct.Name)
+		}
+	}
+	return nil
+}
+
+// feedEntry is a published content entry listed in a feed
+type feedEntry struct {
+	UUID        string
+	Slug        string
+	Title       string
+	Content     string // HTML
+	Summary     string // HTML, the summary meta of the entry
+	Author      string
+	AuthorURL   string
+	Categories  []string
+	PublishedAt time.Time
+	UpdatedAt   time.Time
+}
+
+// feedEntriesLoader loads the newest published entries of a content type
+type feedEntriesLoader func(s Site, ct ContentType, limit int) ([]feedEntry, error)
+
+// feedEntries loads the entries of the feeds set up with a site's routes, replaced in tests
+var feedEntries feedEntriesLoader = loadFeedEntries
+
+// loadFeedEntries loads the entries of a feed from the site's content database
+func loadFeedEntries(s Site, ct ContentType, limit int) ([]feedEntry, error) {
+	manager := s.GetDatabaseManager()
+	if manager == nil {
+		return nil, errors.New("the site has no databases")
+	}
+	db, err := manager.GetOrCreateConnection("content")
+	if err != nil {
+		return nil, err
+	}
+	return queryFeedEntries(db, ct.Name, limit)
+}
+
+// queryFeedEntries returns the newest published entries of a content type, with
+// their summary, author, author_url and categories from content_meta. Categories
+// are separated by commas.
+func queryFeedEntries(db *sql.DB, contentType string, limit int) ([]feedEntry, error) {
+	rows, err := db.Query(`SELECT id, uuid, slug, title, content, published_at, updated_at FROM content
+		WHERE status = 'published' AND content_type = ?
+		ORDER BY COALESCE(published_at, updated_at) DESC, id DESC LIMIT ?`, contentType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []feedEntry
+	index := make(map[int64]int) // content id -> entry
+	for rows.Next() {
+		var id int64
+		var entry feedEntry
+		var publishedAt, updatedAt sql.NullTime
+		if err := rows.Scan(&id, &entry.UUID, &entry.Slug, &entry.Title, &entry.Content, &publishedAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		entry.PublishedAt, entry.UpdatedAt = publishedAt.Time, updatedAt.Time
+		if !publishedAt.Valid {
+			entry.PublishedAt = entry.UpdatedAt
+		}
+		index[id] = len(entries)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return entries, nil
+	}
+
+	ids := make([]interface{}, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	metaRows, err := db.Query(`SELECT content_id, meta_key, meta_value FROM content_meta
+		WHERE meta_key IN ('summary', 'author', 'author_url', 'categories')
+		AND content_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer metaRows.Close()
+	for metaRows.Next() {
+		var id int64
+		var key string
+		var value sql.NullString
+		if err := metaRows.Scan(&id, &key, &value); err != nil {
+			return nil, err
+		}
+		entry := &entries[index[id]]
+		switch key {
+		case "summary":
+			entry.Summary = value.String
+		case "author":
+			entry.Author = value.String
+		case "author_url":
+			entry.AuthorURL = value.String
+		case "categories":
+			for _, category := range strings.Split(value.String, ",") {
+				if category = strings.TrimSpace(category); category != "" {
+					entry.Categories = append(entry.Categories, category)
+				}
+			}
+		}
+	}
+	return entries, metaRows.Err()
+}
+
+// feedFormat is a format feeds are served in
+type feedFormat struct {
+	file        string
+	contentType string
+	write       func(f *feed) ([]byte, error)
+}
+
+var feedFormats = []feedFormat{
+	{"feed.xml", "application/rss+xml; charset=utf-8", (*feed).rss},
+	{"atom.xml", "application/atom+xml; charset=utf-8", (*feed).atom},
+	{"feed.json", "application/feed+json; charset=utf-8", (*feed).jsonFeed},
+}
+
+// feed is a feed of a content type, with absolute URLs of the base URL
+type feed struct {
+	contentType ContentType
+	title       string
+	description string
+	author      string
+	language    string
+	baseURL     string
+	homeURL     string
+	feedURL     string
+	fullContent bool
+	entries     []feedEntry
+	updated     time.Time
+}
+
+// newFeed makes the feed of a content type, at the feed URL of its format
+func newFeed(s Site, ct ContentType, baseURL, file string, entries []feedEntry) *feed {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	f := &feed{
+		contentType: ct,
+		title:       ct.Feed.Title,
+		description: ct.Feed.Description,
+		author:      ct.Feed.Author,
+		language:    s.GetLocales().Default,
+		baseURL:     baseURL,
+		homeURL:     baseURL + ct.basePath(),
+		feedURL:     baseURL + "/" + ct.Name + "/" + file,
+		fullContent: ct.Feed.FullContent,
+		entries:     entries,
+	}
+	if f.title == "" {
+		f.title = strings.TrimSpace(s.GetName() + " " + ct.Name)
+	}
+	if f.description == "" {
+		f.description = f.title
+	}
+	if f.author == "" {
+		f.author = s.GetName()
+	}
+	for _, entry := range entries {
+		if entry.UpdatedAt.After(f.updated) {
+			f.updated = entry.UpdatedAt
+		}
+	}
+	return f
+}
+
+// entryURL returns the absolute URL of an entry
+func (f *feed) entryURL(entry feedEntry) string {
+	return f.baseURL + f.contentType.EntryPath(entry.Slug)
+}
+
+// entryID returns the permanent ID of an entry, which outlives a change of its slug
+func (f *feed) entryID(entry feedEntry) string {
+	return "urn:uuid:" + entry.UUID
+}
+
+// entryAuthor returns the author of an entry, the feed's when it has none
+func (f *feed) entryAuthor(entry feedEntry) string {
+	if entry.Author != "" {
+		return entry.Author
+	}
+	return f.author
+}
+
+// entrySummary returns the summary of an entry, the start of its content when it has none
+func (f *feed) entrySummary(entry feedEntry) string {
+	if entry.Summary != "" {
+		return f.absoluteURLs(entry.Summary)
+	}
+	return html.EscapeString(summarize(entry.Content, feedSummaryLength))
+}
+
+// entryContent returns the content of an entry, empty unless the feed has full content
+func (f *feed) entryContent(entry feedEntry) string {
+	if !f.fullContent {
+		return ""
+	}
+	return f.absoluteURLs(entry.Content)
+}
+
+// rootRelativeURL matches links and sources of HTML relative to the root of the site
+var rootRelativeURL = regexp.MustCompile(`\b(href|src|poster)=(["'])/([^/])`)
+
+// absoluteURLs makes the root relative URLs of HTML absolute, as feed readers
+// show content away from the site
+func (f *feed) absoluteURLs(content string) string {
+	return rootRelativeURL.ReplaceAllString(content, "${1}=${2}"+strings.ReplaceAll(f.baseURL, "$", "$$")+"/${3}")
+}
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// summarize returns the text of HTML, cut to at most n characters at a word
+func summarize(content string, n int) string {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(content, " "))
+	text = strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	cut := string([]rune(text)[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+type rssFeed struct {
+	XMLName      xml.Name   `xml:"rss"`
+	Version      string     `xml:"version,attr"`
+	XMLNSAtom    string     `xml:"xmlns:atom,attr"`
+	XMLNSContent string     `xml:"xmlns:content,attr"`
+	XMLNSDC      string     `xml:"xmlns:dc,attr"`
+	Channel      rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"content:encoded,omitempty"`
+}
+
+// rss writes the feed as RSS 2.0
+func (f *feed) rss() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.title,
+		Link:        f.homeURL,
+		Description: f.description,
+		Language:    f.language,
+		AtomLink:    atomLink{Href: f.feedURL, Rel: "self", Type: "application/rss+xml"},
+	}
+	if !f.updated.IsZero() {
+		channel.LastBuildDate = f.updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, entry := range f.entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        f.entryURL(entry),
+			GUID:        rssGUID{IsPermaLink: "false", Value: f.entryID(entry)},
+			Creator:     f.entryAuthor(entry),
+			Categories:  entry.Categories,
+			Description: f.entrySummary(entry),
+			Content:     f.entryContent(entry),
+		}
+		if !entry.PublishedAt.IsZero() {
+			item.PubDate = entry.PublishedAt.UTC().Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return marshalFeedXML(rssFeed{
+		Version:      "2.0",
+		XMLNSAtom:    "http://www.w3.org/2005/Atom",
+		XMLNSContent: "http://purl.org/rss/1.0/modules/content/",
+		XMLNSDC:      "http://purl.org/dc/elements/1.1/",
+		Channel:      channel,
+	})
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	Lang     string      `xml:"xml:lang,attr,omitempty"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Links    []atomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    atomText       `xml:"summary"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+// atom writes the feed as Atom 1.0
+func (f *feed) atom() ([]byte, error) {
+	af := atomFeed{
+		XMLNS:    "http://www.w3.org/2005/Atom",
+		Lang:     f.language,
+		Title:    f.title,
+		Subtitle: f.description,
+		ID:       f.feedURL,
+		Links: []atomLink{
+			{Href: f.feedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.homeURL, Rel: "alternate", Type: "text/html"},
+		},
+		Updated: atomTime(f.updated),
+		Author:  atomAuthor{Name: f.author},
+	}
+	for _, entry := range f.entries {
+		ae := atomEntry{
+			Title:   entry.Title,
+			ID:      f.entryID(entry),
+			Link:    atomLink{Href: f.entryURL(entry), Rel: "alternate", Type: "text/html"},
+			Updated: atomTime(entry.UpdatedAt),
+			Author:  atomAuthor{Name: f.entryAuthor(entry), URI: entry.AuthorURL},
+			Summary: atomText{Type: "html", Value: f.entrySummary(entry)},
+		}
+		if !entry.PublishedAt.IsZero() {
+			ae.Published = atomTime(entry.PublishedAt)
+		}
+		for _, category := range entry.Categories {
+			ae.Categories = append(ae.Categories, atomCategory{Term: category})
+		}
+		if content := f.entryContent(entry); content != "" {
+			ae.Content = &atomText{Type: "html", Value: content}
+		}
+		af.Entries = append(af.Entries, ae)
+	}
+	return marshalFeedXML(af)
+}
+
+// atomTime formats a date of an Atom feed, which requires one even when it is not known
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// marshalFeedXML writes an XML feed with its header
+func marshalFeedXML(v interface{}) ([]byte, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedDocument struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+// jsonFeed writes the feed as JSON Feed 1.1
+func (f *feed) jsonFeed() ([]byte, error) {
+	doc := jsonFeedDocument{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.title,
+		HomePageURL: f.homeURL,
+		FeedURL:     f.feedURL,
+		Description: f.description,
+		Language:    f.language,
+		Authors:     []jsonFeedAuthor{{Name: f.author}},
+		Items:       []jsonFeedItem{},
+	}
+	for _, entry := range f.entries {
+		item := jsonFeedItem{
+			ID:            f.entryID(entry),
+			URL:           f.entryURL(entry),
+			Title:         entry.Title,
+			ContentHTML:   f.entryContent(entry),
+			DatePublished: jsonFeedTime(entry.PublishedAt),
+			DateModified:  jsonFeedTime(entry.UpdatedAt),
+			Authors:       []jsonFeedAuthor{{Name: f.entryAuthor(entry), URL: entry.AuthorURL}},
+			Tags:          entry.Categories,
+		}
+		// Items need content, which is the summary in feeds without full content
+		if item.ContentHTML == "" {
+			item.ContentHTML = f.entrySummary(entry)
+		} else {
+			item.Summary = summarize(f.entrySummary(entry), feedSummaryLength)
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// jsonFeedTime formats a date of a JSON feed, empty when it is not known
+func jsonFeedTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// setupFeedRoutes serves the feeds of the site's content types at
+// /{content type}/feed.xml, atom.xml and feed.json
+func setupFeedRoutes(router chi.Router, s Site, load feedEntriesLoader) {
+	for _, ct := range s.GetContentTypes() {
+		if ct.Feed.Disabled {
+			continue
+		}
+		for _, format := range feedFormats {
+			router.Get("/"+ct.Name+"/"+format.file, feedHandler(s, ct, format, load))
+		}
+	}
+}
+
+// feedHandler serves a feed with an ETag of its content and the Last-Modified of
+// its newest entry, answering conditional requests with 304 Not Modified
+func feedHandler(s Site, ct ContentType, format feedFormat, load feedEntriesLoader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := ct.Feed.Limit
+		if limit == 0 {
+			limit = defaultFeedLimit
+		}
+		entries, err := load(s, ct, limit)
+		if err != nil {
+			s.GetErrorPages().Serve(w, r, http.StatusInternalServerError, fmt.Errorf("failed to load the %s feed: %w", ct.Name, err))
+			return
+		}
+		f := newFeed(s, ct, siteBaseURL(s, r), format.file, entries)
+		body, err := format.write(f)
+		if err != nil {
+			s.GetErrorPages().Serve(w, r, http.StatusInternalServerError, fmt.Errorf("failed to write the %s feed: %w", ct.Name, err))
+			return
+		}
+
+		sum := sha256.Sum256(body)
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		http.ServeContent(w, r, format.file, f.updated, bytes.NewReader(body))
+	}
+}
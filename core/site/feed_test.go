@@ -0,0 +1,255 @@
+package site
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wispy-core/core/tenant/databases"
+
+	"github.com/go-chi/chi/v5"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestQueryFeedEntries(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := databases.ScaffoldContentDatabase(db); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO content (id, uuid, slug, title, content, content_type, status, published_at, updated_at) VALUES
+		(1, 'a1', 'first', 'First', '<p>One</p>', 'post', 'published', '2026-01-01 10:00:00', '2026-01-02 10:00:00'),
+		(2, 'b2', 'second', 'Second', '<p>Two</p>', 'post', 'published', '2026-02-01 10:00:00', '2026-02-01 10:00:00'),
+		(3, 'c3', 'draft', 'Draft', '', 'post', 'draft', NULL, '2026-03-01 10:00:00'),
+		(4, 'd4', 'about', 'About', '', 'page', 'published', '2026-03-01 10:00:00', '2026-03-01 10:00:00'),
+		(5, 'e5', 'old', 'Old', '', 'post', 'published', '2025-01-01 10:00:00', '2025-01-01 10:00:00');
+		INSERT INTO content_meta (content_id, meta_key, meta_value) VALUES
+		(1, 'summary', 'The <em>first</em> one'),
+		(1, 'author', 'Ada'),
+		(1, 'categories', 'news, releases,'),
+		(2, 'image', '/assets/two.png');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := queryFeedEntries(db, "post", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Slug != "second" || entries[1].Slug != "first" {
+		t.Fatalf("queryFeedEntries() = %+v, want second and first", entries)
+	}
+	first := entries[1]
+	if first.Summary != "The <em>first</em> one" || first.Author != "Ada" || strings.Join(first.Categories, "|") != "news|releases" {
+		t.Errorf("meta of first = %q, %q, %q", first.Summary, first.Author, first.Categories)
+	}
+	if want := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC); !first.UpdatedAt.Equal(want) {
+		t.Errorf("UpdatedAt = %v, want %v", first.UpdatedAt, want)
+	}
+
+	if entries, err := queryFeedEntries(db, "event", 20); err != nil || len(entries) != 0 {
+		t.Errorf("queryFeedEntries(event) = %v, %v, want no entries", entries, err)
+	}
+}
+
+func TestValidateContentTypes(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentTypes []ContentType
+		wantErr      bool
+	}{
+		{"valid", []ContentType{{Name: "page"}, {Name: "post", Path: "/blog", Feed: FeedConfig{Limit: 10}}}, false},
+		{"no name", []ContentType{{Path: "/blog"}}, true},
+		{"twice", []ContentType{{Name: "post"}, {Name: "post"}}, true},
+		{"relative path", []ContentType{{Name: "post", Path: "blog"}}, true},
+		{"negative limit", []ContentType{{Name: "post", Feed: FeedConfig{Limit: -1}}}, true},
+	}
+	for _, tt := range tests {
+		if err := validateContentTypes(tt.contentTypes); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateContentTypes() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// newFeedSite sets up the routes of a site with content types, whose entries are
+// entries, and no pages
+func newFeedSite(t *testing.T, contentTypes []ContentType, entries []feedEntry) chi.Router {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "pages"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	feedEntries = func(s Site, ct ContentType, limit int) ([]feedEntry, error) {
+		if ct.Name == "broken" {
+			return nil, errors.New("no database")
+		}
+		return entries[:min(limit, len(entries))], nil
+	}
+	t.Cleanup(func() { feedEntries = loadFeedEntries })
+
+	_, router := newTestSite(t, root, contentTypes...)
+	return router
+}
+
+func TestFeeds(t *testing.T) {
+	entries := []feedEntry{
+		{
+			UUID: "b2", Slug: "second", Title: "Second & last",
+			Content:     `<p>Two <img src="/assets/two.png"> <a href="//cdn.example.com/x">cdn</a></p>`,
+			PublishedAt: time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC),
+			UpdatedAt:   time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			UUID: "a1", Slug: "first", Title: "First",
+			Content: `<p>One</p>`, Summary: `The <a href="/about">first</a> one`,
+			Author: "Ada", AuthorURL: "https://ada.example.com", Categories: []string{"news", "releases"},
+			PublishedAt: time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC),
+			UpdatedAt:   time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC),
+		},
+	}
+	router := newFeedSite(t, []ContentType{
+		{Name: "post", Path: "/blog", Feed: FeedConfig{Title: "Blog", FullContent: true}},
+		{Name: "news", Feed: FeedConfig{Limit: 1}},
+		{Name: "page", Feed: FeedConfig{Disabled: true}},
+		{Name: "broken"},
+	}, entries)
+
+	tests := []struct {
+		path            string
+		wantStatus      int
+		wantContentType string
+		wantBody        []string
+		unwantedBody    []string
+	}{
+		{"/post/feed.xml", http.StatusOK, "application/rss+xml; charset=utf-8", []string{
+			`<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"`,
+			"<title>Blog</title><link>https://example.com/blog</link>",
+			`<atom:link href="https://example.com/post/feed.xml" rel="self" type="application/rss+xml"></atom:link>`,
+			"<language>en</language>",
+			"<lastBuildDate>Tue, 03 Feb 2026 10:00:00 +0000</lastBuildDate>",
+			"<title>Second &amp; last</title><link>https://example.com/blog/second</link>",
+			`<guid isPermaLink="false">urn:uuid:b2</guid><pubDate>Sun, 01 Feb 2026 10:00:00 +0000</pubDate><dc:creator>Example</dc:creator>`,
+			`&lt;img src=&#34;https://example.com/assets/two.png&#34;&gt;`,
+			`href=&#34;//cdn.example.com/x&#34;`,
+			"<dc:creator>Ada</dc:creator><category>news</category><category>releases</category>",
+			`<description>The &lt;a href=&#34;https://example.com/about&#34;&gt;first&lt;/a&gt; one</description>`,
+		}, nil},
+		{"/post/atom.xml", http.StatusOK, "application/atom+xml; charset=utf-8", []string{
+			`<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="en"><title>Blog</title>`,
+			`<id>https://example.com/post/atom.xml</id>`,
+			`<link href="https://example.com/blog" rel="alternate" type="text/html"></link>`,
+			"<updated>2026-02-03T10:00:00Z</updated><author><name>Example</name></author>",
+			`<id>urn:uuid:a1</id><link href="https://example.com/blog/first" rel="alternate" type="text/html"></link><published>2026-01-01T10:00:00Z</published><updated>2026-01-02T10:00:00Z</updated>`,
+			"<author><name>Ada</name><uri>https://ada.example.com</uri></author>",
+			`<category term="news"></category>`,
+			`<content type="html">&lt;p&gt;One&lt;/p&gt;</content>`,
+		}, nil},
+		{"/news/feed.xml", http.StatusOK, "application/rss+xml; charset=utf-8", []string{
+			"<title>Example news</title><link>https://example.com/news</link>",
+			"<link>https://example.com/news/second</link>",
+			"<description>Two cdn</description>",
+		}, []string{"content:encoded>", "news/first"}},
+		{"/page/feed.xml", http.StatusNotFound, "", nil, nil},
+		{"/broken/feed.json", http.StatusInternalServerError, "", nil, []string{"no database"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantContentType != "" && w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Content-Type = %s, want %s", w.Header().Get("Content-Type"), tt.wantContentType)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body does not contain %s\n%s", want, w.Body.String())
+				}
+			}
+			for _, unwanted := range tt.unwantedBody {
+				if strings.Contains(w.Body.String(), unwanted) {
+					t.Errorf("body contains %s\n%s", unwanted, w.Body.String())
+				}
+			}
+		})
+	}
+
+	// JSON Feed
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/post/feed.json", nil))
+	var doc jsonFeedDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("feed.json is not JSON: %v\n%s", err, w.Body.String())
+	}
+	if doc.Version != "https://jsonfeed.org/version/1.1" || doc.FeedURL != "https://example.com/post/feed.json" || len(doc.Items) != 2 {
+		t.Fatalf("feed.json = %+v", doc)
+	}
+	item := doc.Items[1]
+	if item.ID != "urn:uuid:a1" || item.URL != "https://example.com/blog/first" || item.ContentHTML != "<p>One</p>" ||
+		item.Summary != "The first one" || item.Authors[0].Name != "Ada" || strings.Join(item.Tags, ",") != "news,releases" ||
+		item.DatePublished != "2026-01-01T10:00:00Z" {
+		t.Errorf("feed.json item = %+v", item)
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	updated := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	router := newFeedSite(t, []ContentType{{Name: "post"}}, []feedEntry{
+		{UUID: "a1", Slug: "first", Title: "First", Content: "<p>One</p>", UpdatedAt: updated},
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/post/atom.xml", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Last-Modified") != updated.Format(http.TimeFormat) {
+		t.Fatalf("status = %d, ETag = %q, Last-Modified = %q", w.Code, etag, w.Header().Get("Last-Modified"))
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"same ETag", "If-None-Match", etag, http.StatusNotModified},
+		{"other ETag", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", updated.Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", "If-Modified-Since", updated.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/post/atom.xml", nil)
+		r.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		content string
+		n       int
+		want    string
+	}{
+		{"<p>Fish &amp; chips</p>\n<p>today</p>", 50, "Fish & chips today"},
+		{"<p>one two three four</p>", 12, "one two…"},
+		{"<p>été été</p>", 5, "été…"},
+	}
+	for _, tt := range tests {
+		if got := summarize(tt.content, tt.n); got != tt.want {
+			t.Errorf("summarize(%q, %d) = %q, want %q", tt.content, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package site
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"wispy-core/common"
+	"wispy-core/tpl"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// defaultLocale is the locale of sites without an [i18n] table
+const defaultLocale = "en"
+
+// i18nConfig is the [i18n] table of a site's config.toml:
+//
+//	[i18n]
+//	default_locale = "en"
+//	locales = ["en", "fr"]
+//	[i18n.domains]
+//	fr = "example.fr"
+type i18nConfig struct {
+	DefaultLocale string            `toml:"default_locale"`
+	Locales       []string          `toml:"locales"`
+	Domains       map[string]string `toml:"domains"`
+}
+
+// Locales are the languages a site is served in
+type Locales struct {
+	Default string            // served without a path prefix
+	All     []string          // every locale, the default first
+	Domains map[string]string // locales served from their own domain rather than a path prefix
+}
+
+// newLocales validates the [i18n] table of a site's config.toml
+func newLocales(config i18nConfig) (Locales, error) {
+	l := Locales{Default: config.DefaultLocale, Domains: make(map[string]string)}
+	if l.Default == "" {
+		l.Default = defaultLocale
+		if len(config.Locales) > 0 {
+			l.Default = config.Locales[0]
+		}
+	}
+
+	for _, locale := range append([]string{l.Default}, config.Locales...) {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return Locales{}, fmt.Errorf("invalid locale %q: %w", locale, err)
+		}
+		if tag.String() != locale {
+			return Locales{}, fmt.Errorf("locale %q should be written %q", locale, tag.String())
+		}
+		if !slices.Contains(l.All, locale) {
+			l.All = append(l.All, locale)
+		}
+	}
+
+	for locale, domain := range config.Domains {
+		if !slices.Contains(l.All, locale) {
+			return Locales{}, fmt.Errorf("domain %s is for locale %q, which is not one of the site's locales", domain, locale)
+		}
+		if locale == l.Default {
+			return Locales{}, fmt.Errorf("the default locale %q is served from the site's domain", locale)
+		}
+		l.Domains[locale] = common.NormalizeHost(domain)
+	}
+	return l, nil
+}
+
+// Has reports whether the site is served in locale
+func (l Locales) Has(locale string) bool {
+	return slices.Contains(l.All, locale)
+}
+
+// Prefix returns the path prefix of a locale's routes: "/fr", or nothing for the
+// default locale and locales with their own domain
+func (l Locales) Prefix(locale string) string {
+	if locale == l.Default || l.Domains[locale] != "" {
+		return ""
+	}
+	return "/" + locale
+}
+
+// ForHost returns the locale served from a host, if the host is one of the locale domains
+func (l Locales) ForHost(host string) (string, bool) {
+	host = common.NormalizeHost(host)
+	for locale, domain := range l.Domains {
+		if domain == host {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// Match returns the locale that best matches an Accept-Language header
+func (l Locales) Match(acceptLanguage string) string {
+	preferred, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(preferred) == 0 {
+		return l.Default
+	}
+	tags := make([]language.Tag, len(l.All))
+	for i, locale := range l.All {
+		tags[i] = language.MustParse(locale)
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(preferred...)
+	if confidence == language.No {
+		return l.Default
+	}
+	return l.All[index]
+}
+
+// URL returns the absolute URL of a route in a locale, on the locale's domain or
+// under its path prefix of baseURL
+func (l Locales) URL(baseURL, locale, route string) string {
+	base := strings.TrimSuffix(baseURL, "/")
+	if domain := l.Domains[locale]; domain != "" {
+		scheme := "https"
+		if u, err := url.Parse(baseURL); err == nil && u.Scheme != "" {
+			scheme = u.Scheme
+		}
+		base = scheme + "://" + domain
+	}
+	return base + localizedRoute(route, l.Prefix(locale))
+}
+
+// localizedRoute puts a route under a locale's path prefix: "/about" becomes "/fr/about"
+func localizedRoute(route, prefix string) string {
+	if prefix != "" && route == "/" {
+		return prefix
+	}
+	return prefix + route
+}
+
+// pluralSelector matches the keys of a table of plural forms
+var pluralSelector = regexp.MustCompile(`^(zero|one|two|few|many|other|[=<]\d+)$`)
+
+// translations holds the translation catalogs of a site, locales/<locale>.toml or
+// .json, reloaded when one of them changes
+type translations struct {
+	locales  Locales
+	messages *reloadable[translationCatalog]
+}
+
+// translationCatalog is the catalog of every locale and the keys of its messages
+type translationCatalog struct {
+	catalog *catalog.Builder
+	keys    map[string]map[string]bool // locale -> keys of its messages
+}
+
+// newTranslations loads the translation catalogs of the site in sitePath
+func newTranslations(sitePath string, locales Locales) (*translations, error) {
+	dir := filepath.Join(sitePath, "locales")
+	messages, err := newReloadable("translations", func() (translationCatalog, error) {
+		return loadTranslations(dir, locales)
+	}, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &translations{locales: locales, messages: messages}, nil
+}
+
+// current returns the catalog and the message keys of each locale, reloading them
+// when a file changed
+func (tr *translations) current() (*catalog.Builder, map[string]map[string]bool) {
+	messages := tr.messages.current()
+	return messages.catalog, messages.keys
+}
+
+// loadTranslations reads the catalog of every locale in dir, failing when one of
+// them is invalid
+func loadTranslations(dir string, locales Locales) (translationCatalog, error) {
+	cat := catalog.NewBuilder()
+	keys := make(map[string]map[string]bool)
+
+	for _, locale := range locales.All {
+		var file string
+		for _, ext := range []string{".toml", ".json"} {
+			path := filepath.Join(dir, locale+ext)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if file != "" {
+				return translationCatalog{}, fmt.Errorf("translations %s and %s are both for locale %s", filepath.Base(file), filepath.Base(path), locale)
+			}
+			file = path
+		}
+		if file == "" {
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return translationCatalog{}, err
+		}
+		var messages map[string]interface{}
+		if err := dataDecoders[filepath.Ext(file)](content, &messages); err != nil {
+			return translationCatalog{}, fmt.Errorf("invalid translations %s: %w", filepath.Base(file), err)
+		}
+		keys[locale] = make(map[string]bool)
+		if err := addMessages(cat, keys[locale], language.MustParse(locale), "", messages); err != nil {
+			return translationCatalog{}, fmt.Errorf("translations %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	return translationCatalog{catalog: cat, keys: keys}, nil
+}
+
+// addMessages adds the messages of a catalog file to cat. Tables are namespaces,
+// nav.home for [nav] home = "...", unless their keys are plural forms:
+//
+//	[items]
+//	"=0" = "No items"
+//	one = "%d item"
+//	other = "%d items"
+func addMessages(cat *catalog.Builder, keys map[string]bool, tag language.Tag, prefix string, messages map[string]interface{}) error {
+	for name, value := range messages {
+		key := prefix + name
+		switch value := value.(type) {
+		case string:
+			if err := cat.SetString(tag, key, value); err != nil {
+				return fmt.Errorf("message %s: %w", key, err)
+			}
+		case map[string]interface{}:
+			if !isPluralForms(value) {
+				if err := addMessages(cat, keys, tag, key+".", value); err != nil {
+					return err
+				}
+				continue
+			}
+			cases, err := pluralCases(value)
+			if err != nil {
+				return fmt.Errorf("message %s: %w", key, err)
+			}
+			if err := cat.Set(tag, key, plural.Selectf(1, "", cases...)); err != nil {
+				return fmt.Errorf("message %s: %w", key, err)
+			}
+		default:
+			return fmt.Errorf("message %s must be text or a table, got %T", key, value)
+		}
+		keys[key] = true
+	}
+	return nil
+}
+
+// isPluralForms reports whether a table holds the plural forms of one message
+func isPluralForms(table map[string]interface{}) bool {
+	if _, ok := table["other"]; !ok {
+		return false
+	}
+	for selector := range table {
+		if !pluralSelector.MatchString(selector) {
+			return false
+		}
+	}
+	return true
+}
+
+// pluralCases orders plural forms for plural.Selectf, which uses the first that
+// matches: exact values first and "other" last
+func pluralCases(forms map[string]interface{}) ([]interface{}, error) {
+	order := []string{"zero", "one", "two", "few", "many", "other"}
+	selectors := make([]string, 0, len(forms))
+	for selector := range forms {
+		selectors = append(selectors, selector)
+	}
+	slices.SortFunc(selectors, func(a, b string) int {
+		ia, ib := slices.Index(order, a), slices.Index(order, b)
+		if ia != ib {
+			return ia - ib
+		}
+		return strings.Compare(a, b)
+	})
+
+	cases := make([]interface{}, 0, 2*len(selectors))
+	for _, selector := range selectors {
+		text, ok := forms[selector].(string)
+		if !ok {
+			return nil, fmt.Errorf("plural form %s must be text, got %T", selector, forms[selector])
+		}
+		cases = append(cases, selector, text)
+	}
+	return cases, nil
+}
+
+// translate formats the message of key in locale with args, falling back to the
+// default locale and then to the key itself
+func (tr *translations) translate(locale, key string, args ...interface{}) string {
+	cat, keys := tr.current()
+	if !keys[locale][key] {
+		locale = tr.locales.Default
+		if !keys[locale][key] {
+			return key
+		}
+	}
+	return message.NewPrinter(language.MustParse(locale), message.Catalog(cat)).Sprintf(key, args...)
+}
+
+// translateFuncs returns the t template function, which translates a message of
+// the site's catalogs into the locale of the page:
+//
+//	{{t "nav.home"}}
+//	{{t "cart.items" .Count}}
+func translateFuncs(s Site) tpl.FuncProvider {
+	return func(rs tpl.RenderState, tmpl *template.Template) template.FuncMap {
+		locale := s.GetLocales().Default
+		if rs != nil && rs.GetTemplateData().Locale != "" {
+			locale = rs.GetTemplateData().Locale
+		}
+		return template.FuncMap{
+			"t": func(key string, args ...interface{}) string {
+				return s.Translate(locale, key, args...)
+			},
+		}
+	}
+}
+
+// localizedPage is a page and its variants for other locales, e.g. about.fr.html
+// for about.html
+type localizedPage struct {
+	path     string            // the page, which gives the route
+	base     bool              // whether the page itself exists, rather than only its variants
+	variants map[string]string // locale -> page file
+}
+
+// localizePages groups pages with their locale variants, in the order of pages.
+// Files only count as variants for the site's locales.
+func localizePages(pages []string, locales Locales) []localizedPage {
+	var grouped []localizedPage
+	index := make(map[string]int)
+	for _, pagePath := range pages {
+		path, locale := pagePath, ""
+		name := strings.TrimSuffix(pagePath, ".html")
+		if ext := filepath.Ext(name); ext != "" && locales.Has(ext[1:]) {
+			path, locale = strings.TrimSuffix(name, ext)+".html", ext[1:]
+		}
+
+		i, ok := index[path]
+		if !ok {
+			i = len(grouped)
+			index[path] = i
+			grouped = append(grouped, localizedPage{path: path, variants: make(map[string]string)})
+		}
+		if locale == "" {
+			grouped[i].base = true
+		} else {
+			grouped[i].variants[locale] = pagePath
+		}
+	}
+	return grouped
+}
+
+// file returns the page file for a locale: its variant, or the page itself
+func (p localizedPage) file(locale string) (string, bool) {
+	if variant, ok := p.variants[locale]; ok {
+		return variant, true
+	}
+	return p.path, p.base
+}
+
+// files returns the page files served in any of the locales
+func (p localizedPage) files(locales Locales) []string {
+	var files []string
+	for _, locale := range locales.All {
+		if file, ok := p.file(locale); ok && !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// alternates returns the URLs of the page in each locale it exists in, for hreflang
+// links and language switchers. Sites with a single locale have none.
+func (p localizedPage) alternates(locales Locales, baseURL, route string) []tpl.Alternate {
+	if len(locales.All) < 2 {
+		return nil
+	}
+	var alternates []tpl.Alternate
+	for _, locale := range locales.All {
+		if _, ok := p.file(locale); ok {
+			alternates = append(alternates, tpl.Alternate{Locale: locale, URL: locales.URL(baseURL, locale, route)})
+		}
+	}
+	if _, ok := p.file(locales.Default); ok {
+		alternates = append(alternates, tpl.Alternate{Locale: "x-default", URL: locales.URL(baseURL, locales.Default, route)})
+	}
+	return alternates
+}
+
+// fromSite reports whether a request follows a link on the site, from a visitor who
+// has picked a locale already
+func fromSite(r *http.Request, locales Locales) bool {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host == "" {
+		return false
+	}
+	if referer.Host == r.Host {
+		return true
+	}
+	_, ok := locales.ForHost(referer.Host)
+	return ok
+}
@@ -0,0 +1,291 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"wispy-core/tpl"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewLocales(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  i18nConfig
+		want    Locales
+		wantErr string
+	}{
+		{
+			name:   "No i18n table",
+			config: i18nConfig{},
+			want:   Locales{Default: "en", All: []string{"en"}, Domains: map[string]string{}},
+		},
+		{
+			name:   "Default from the locales",
+			config: i18nConfig{Locales: []string{"fr", "en"}},
+			want:   Locales{Default: "fr", All: []string{"fr", "en"}, Domains: map[string]string{}},
+		},
+		{
+			name:   "Domains",
+			config: i18nConfig{DefaultLocale: "en", Locales: []string{"fr", "de"}, Domains: map[string]string{"de": "example.de:443"}},
+			want:   Locales{Default: "en", All: []string{"en", "fr", "de"}, Domains: map[string]string{"de": "example.de"}},
+		},
+		{name: "Invalid locale", config: i18nConfig{Locales: []string{"english!"}}, wantErr: `invalid locale "english!"`},
+		{name: "Locale not in canonical form", config: i18nConfig{Locales: []string{"pt_br"}}, wantErr: `should be written "pt-BR"`},
+		{name: "Domain of an unknown locale", config: i18nConfig{Domains: map[string]string{"fr": "example.fr"}}, wantErr: "not one of the site's locales"},
+		{name: "Domain of the default locale", config: i18nConfig{Domains: map[string]string{"en": "example.co.uk"}}, wantErr: "served from the site's domain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newLocales(tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newLocales() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocales(t *testing.T) {
+	locales, err := newLocales(i18nConfig{Locales: []string{"en", "fr", "de"}, Domains: map[string]string{"de": "example.de"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := map[string]string{
+		"":                      "en",
+		"fr-CA,fr;q=0.9,en;q=0": "fr",
+		"de-AT":                 "de",
+		"ja":                    "en",
+		"ja, fr;q=0.5":          "fr",
+	}
+	for header, want := range matches {
+		if got := locales.Match(header); got != want {
+			t.Errorf("Match(%q) = %q, want %q", header, got, want)
+		}
+	}
+
+	urls := []struct{ locale, route, want string }{
+		{"en", "/about", "https://example.com/about"},
+		{"fr", "/about", "https://example.com/fr/about"},
+		{"fr", "/", "https://example.com/fr"},
+		{"de", "/about", "https://example.de/about"},
+	}
+	for _, u := range urls {
+		if got := locales.URL("https://example.com/", u.locale, u.route); got != u.want {
+			t.Errorf("URL(%s, %s) = %q, want %q", u.locale, u.route, got, u.want)
+		}
+	}
+
+	if locale, ok := locales.ForHost("example.de:8080"); !ok || locale != "de" {
+		t.Errorf("ForHost(example.de) = %q, %v, want de", locale, ok)
+	}
+}
+
+func TestTranslations(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"locales/en.toml": `
+welcome = "Welcome to %s"
+only_en = "Only in English"
+[nav]
+home = "Home"
+[cart.items]
+"=0" = "Your cart is empty"
+one = "%d item"
+other = "%d items"`,
+		"locales/fr.json": `{"welcome": "Bienvenue sur %s", "nav": {"home": "Accueil"},
+			"cart": {"items": {"=0": "Votre panier est vide", "one": "%d article", "other": "%d articles"}}}`,
+	})
+	locales, _ := newLocales(i18nConfig{Locales: []string{"en", "fr"}})
+	tr, err := newTranslations(root, locales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		locale string
+		key    string
+		args   []interface{}
+		want   string
+	}{
+		{"en", "welcome", []interface{}{"Wispy"}, "Welcome to Wispy"},
+		{"fr", "welcome", []interface{}{"Wispy"}, "Bienvenue sur Wispy"},
+		{"fr", "nav.home", nil, "Accueil"},
+		{"en", "cart.items", []interface{}{0}, "Your cart is empty"},
+		{"en", "cart.items", []interface{}{1}, "1 item"},
+		{"en", "cart.items", []interface{}{3}, "3 items"},
+		{"fr", "cart.items", []interface{}{1}, "1 article"},
+		{"fr", "cart.items", []interface{}{2}, "2 articles"},
+		{"fr", "only_en", nil, "Only in English"},
+		{"fr", "missing.key", []interface{}{1}, "missing.key"},
+	}
+	for _, tt := range tests {
+		if got := tr.translate(tt.locale, tt.key, tt.args...); got != tt.want {
+			t.Errorf("translate(%s, %s, %v) = %q, want %q", tt.locale, tt.key, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestTranslationsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{name: "Two files for a locale", files: map[string]string{"locales/en.toml": "", "locales/en.json": "{}"}, wantErr: "both for locale en"},
+		{name: "Invalid file", files: map[string]string{"locales/en.json": "{"}, wantErr: "invalid translations en.json"},
+		{name: "Message that is not text", files: map[string]string{"locales/en.toml": "count = 3"}, wantErr: "message count must be text"},
+		{name: "Plural form that is not text", files: map[string]string{"locales/en.toml": "[items]\none = 1\nother = \"%d items\""}, wantErr: "plural form one must be text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeDataFiles(t, root, tt.files)
+			locales, _ := newLocales(i18nConfig{})
+			_, err := newTranslations(root, locales)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalizePages(t *testing.T) {
+	locales, _ := newLocales(i18nConfig{Locales: []string{"en", "fr"}})
+	pages := []string{"about.html", "about.fr.html", "index/index.html", "contact.fr.html", "notes.v2.html"}
+
+	want := []localizedPage{
+		{path: "about.html", base: true, variants: map[string]string{"fr": "about.fr.html"}},
+		{path: "index/index.html", base: true, variants: map[string]string{}},
+		{path: "contact.html", variants: map[string]string{"fr": "contact.fr.html"}},
+		{path: "notes.v2.html", base: true, variants: map[string]string{}},
+	}
+	if got := localizePages(pages, locales); !reflect.DeepEqual(got, want) {
+		t.Errorf("localizePages() = %#v, want %#v", got, want)
+	}
+}
+
+func TestLocalizedPageRoutes(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"layouts/default.html":  `<body>{{block "body" .}}{{end}}</body>`,
+		"pages/index.html":      `{{define "body"}}<h1>{{t "welcome"}}</h1>{{end}}`,
+		"pages/about.html":      `{{define "body"}}<p>{{title "about us"}}</p>{{end}}`,
+		"pages/about.fr.html":   `{{define "body"}}<p>À propos</p>{{end}}`,
+		"pages/contact.fr.html": `{{define "body"}}<p>Contact</p>{{end}}`,
+		"locales/en.toml":       `welcome = "Welcome"`,
+		"locales/fr.toml":       `welcome = "Bienvenue"`,
+		"locales/de.toml":       `welcome = "Willkommen"`,
+	})
+	locales, err := newLocales(i18nConfig{Locales: []string{"en", "fr", "de"}, Domains: map[string]string{"de": "example.de"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	translations, err := newTranslations(root, locales)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &site{Name: "Example", Domain: "example.com", BaseURL: "https://example.com", locales: locales, translations: translations,
+		seo: tpl.PageMeta{Description: "An example site"}}
+
+	engine := tpl.NewTemplateEngine(filepath.Join(root, "layouts"), filepath.Join(root, "pages"))
+	engine.RegisterFuncs(translateFuncs(s))
+	router := chi.NewRouter()
+	for _, page := range localizePages([]string{"index.html", "about.html", "about.fr.html", "contact.fr.html"}, locales) {
+		createPageRoutes(router, s, engine, page)
+	}
+
+	tests := []struct {
+		name         string
+		host         string
+		path         string
+		headers      map[string]string
+		wantStatus   int
+		wantLocation string
+		wantBody     []string
+	}{
+		{
+			name:       "Default locale",
+			path:       "/about",
+			wantStatus: http.StatusOK,
+			wantBody: []string{`<html lang="en">`, `<p>About Us</p>`,
+				`<meta name="description" content="An example site">`,
+				`<link rel="canonical" href="https://example.com/about">`,
+				`<link rel="alternate" hreflang="fr" href="https://example.com/fr/about">`,
+				`<link rel="alternate" hreflang="de" href="https://example.de/about">`,
+				`<link rel="alternate" hreflang="x-default" href="https://example.com/about">`},
+		},
+		{
+			name:       "Locale variant",
+			path:       "/fr/about",
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`<html lang="fr">`, `<p>À propos</p>`, `<link rel="canonical" href="https://example.com/fr/about">`},
+		},
+		{name: "Locale domain", host: "example.de", path: "/about", wantStatus: http.StatusOK, wantBody: []string{`<html lang="de">`, `<p>About Us</p>`}},
+		{name: "Translations", path: "/fr", wantStatus: http.StatusOK, wantBody: []string{`<h1>Bienvenue</h1>`}},
+		{name: "Page only in another locale", path: "/contact", wantStatus: http.StatusNotFound},
+		{
+			name:         "Root redirects to the preferred locale",
+			path:         "/?ref=ad",
+			headers:      map[string]string{"Accept-Language": "fr-CA,fr;q=0.9"},
+			wantStatus:   http.StatusFound,
+			wantLocation: "/fr?ref=ad",
+		},
+		{
+			name:         "Root redirects to a locale domain",
+			path:         "/",
+			headers:      map[string]string{"Accept-Language": "de"},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.de/",
+		},
+		{
+			name:       "Root keeps visitors coming from the site",
+			path:       "/",
+			headers:    map[string]string{"Accept-Language": "fr", "Referer": "https://example.com/fr/about"},
+			wantStatus: http.StatusOK,
+			wantBody:   []string{`<h1>Welcome</h1>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Host = "example.com"
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d\n%s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("body does not contain %s\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package site
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +10,7 @@ import (
 	"time"
 	"wispy-core/auth"
 	"wispy-core/common"
+	"wispy-core/tpl"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -139,6 +142,14 @@ func (sm *siteManager) LoadAllSites() (map[string]Site, error) {
 
 			// Register domain
 			sm.domains.AddDomain(domain)
+
+			// Locales served from their own domain are served by the same site
+			for _, localeDomain := range site.GetLocales().Domains {
+				sm.mu.Lock()
+				sm.sites[localeDomain] = site
+				sm.mu.Unlock()
+				sm.domains.AddDomain(localeDomain)
+			}
 			mu.Unlock()
 		}(entry)
 	}
@@ -180,6 +191,10 @@ func (sm *siteManager) LoadSiteByDomain(domain string) (Site, error) {
 			CreatedAt time.Time `toml:"created_at"`
 			UpdatedAt time.Time `toml:"updated_at"`
 		} `toml:"site"`
+		I18n         i18nConfig    `toml:"i18n"`
+		SEO          tpl.PageMeta  `toml:"seo"`
+		Robots       RobotsConfig  `toml:"robots"`
+		ContentTypes []ContentType `toml:"content_types"`
 	}
 
 	if err := toml.Unmarshal(data, &siteConfig); err != nil {
@@ -205,6 +220,57 @@ func (sm *siteManager) LoadSiteByDomain(domain string) (Site, error) {
 		UpdatedAt: siteConfig.Site.UpdatedAt,
 	}
 
+	// Data files and params, validated before the site is used. The tables of
+	// config.toml that are reloaded share one reader of the file.
+	sitePath := filepath.Join(sm.tenantsRootDir, normalizedDomain)
+	config := newConfigFile(sitePath)
+	files, err := newSiteData(sitePath, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load site data: %w", err)
+	}
+	s.files = files
+
+	// Locales and their translations
+	if s.locales, err = newLocales(siteConfig.I18n); err != nil {
+		return nil, fmt.Errorf("invalid i18n config: %w", err)
+	}
+	if s.translations, err = newTranslations(sitePath, s.locales); err != nil {
+		return nil, fmt.Errorf("failed to load translations: %w", err)
+	}
+
+	// Redirects, with their hits saved to the analytics database
+	if s.redirects, err = newRedirects(sitePath, config, func() (*sql.DB, error) {
+		return s.GetDatabaseManager().GetOrCreateConnection(redirectHitsDBName)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid redirects: %w", err)
+	}
+
+	// Error pages and maintenance mode
+	if s.errorPages, err = newErrorPages(s, config); err != nil {
+		return nil, fmt.Errorf("invalid maintenance config: %w", err)
+	}
+
+	// Head tags of every page
+	if siteConfig.SEO.Title != "" || siteConfig.SEO.Canonical != "" {
+		return nil, errors.New("invalid seo config: title and canonical are set by each page")
+	}
+	if err := siteConfig.SEO.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid seo config: %w", err)
+	}
+	s.seo = siteConfig.SEO
+
+	// Rules of robots.txt
+	if err := siteConfig.Robots.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid robots config: %w", err)
+	}
+	s.robots = siteConfig.Robots
+
+	// Content types and their feeds
+	if err := validateContentTypes(siteConfig.ContentTypes); err != nil {
+		return nil, fmt.Errorf("invalid content types: %w", err)
+	}
+	s.contentTypes = siteConfig.ContentTypes
+
 	// Setup Database manager
 	s.DbManager = NewDatabaseManager(s.Domain)
 
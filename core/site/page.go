@@ -1,12 +1,13 @@
 package site
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"wispy-core/common"
-	"wispy-core/config"
 	"wispy-core/tpl"
 	"wispy-core/wispytail"
 
@@ -33,7 +34,7 @@ func LoadPage(site Site, path string, tenantsRoot string) (*Page, error) {
 	// 	return nil, err
 	// }
 	page := Page{
-		Title:       getPageTitle(path, site.GetName()),
+		Title:       getPageTitle(path, site.GetName(), site.GetLocales().Default),
 		Slug:        strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
 		Path:        path,
 		Layout:      "default",
@@ -47,84 +48,280 @@ func LoadPage(site Site, path string, tenantsRoot string) (*Page, error) {
 
 // createPageRoute creates a route for a specific page
 func CreatePageRoute(router chi.Router, s Site, templateEngine tpl.TemplateEngine, pagePath string) {
-	route := common.PathToRoute(pagePath)
-	router.Get(route, func(w http.ResponseWriter, r *http.Request) {
+	createPageRoutes(router, s, templateEngine, localizedPage{path: pagePath, base: true})
+}
+
+// createPageRoutes creates the routes of a page in the site's locales: the default
+// locale and locales with their own domain at the page's route, the other locales
+// under their path prefix, e.g. /fr/about. Dynamic segments of the page path
+// become URL params, see parsePageRoute.
+func createPageRoutes(router chi.Router, s Site, templateEngine tpl.TemplateEngine, page localizedPage) {
+	route, err := parsePageRoute(page.path)
+	if err != nil {
+		common.Warning("Skipping page %s: %v", page.path, err)
+		return
+	}
+	locales := s.GetLocales()
+
+	// Compile the page up front so template errors show at startup rather than on the first visit
+	for _, pagePath := range page.files(locales) {
+		if err := templateEngine.Precompile(pagePath, defaultPageLayout); err != nil {
+			common.Warning("Failed to compile page %s: %v", pagePath, err)
+		}
+	}
+
+	router.Get(route.pattern, pageHandler(s, templateEngine, page, route, func(r *http.Request) string {
+		if locale, ok := locales.ForHost(r.Host); ok {
+			return locale
+		}
+		return locales.Default
+	}))
+	for _, locale := range locales.All {
+		prefix := locales.Prefix(locale)
+		if _, ok := page.file(locale); !ok || prefix == "" {
+			continue
+		}
+		router.Get(localizedRoute(route.pattern, prefix), pageHandler(s, templateEngine, page, route, func(*http.Request) string {
+			return locale
+		}))
+	}
+}
+
+// pageHandler renders a page in the locale requestLocale picks for a request
+func pageHandler(s Site, templateEngine tpl.TemplateEngine, page localizedPage, pr pageRoute, requestLocale func(*http.Request) string) http.HandlerFunc {
+	locales := s.GetLocales()
+	loader := pageLoader(page.path)
+	var known pageClasses
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale := requestLocale(r)
+		params := pr.values(r)
+		route := pr.path(params)
+
+		// Visitors arriving at the home page are sent to the locale they prefer
+		if route == "/" && locale == locales.Default && len(locales.All) > 1 {
+			w.Header().Add("Vary", "Accept-Language")
+			preferred := locales.Match(r.Header.Get("Accept-Language"))
+			if _, ok := page.file(preferred); ok && preferred != locale && !fromSite(r, locales) {
+				target := localizedRoute(route, locales.Prefix(preferred))
+				if locales.Domains[preferred] != "" {
+					target = locales.URL(s.GetBaseURL(), preferred, route)
+				}
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+		}
+
+		pagePath, ok := page.file(locale)
+		if !ok {
+			s.GetErrorPages().Serve(w, r, http.StatusNotFound, nil)
+			return
+		}
+
+		// Content entry of a dynamic page
+		var entry interface{}
+		if loader != nil {
+			var err error
+			if entry, err = loader(r, s, locale, params); errors.Is(err, ErrPageNotFound) {
+				s.GetErrorPages().Serve(w, r, http.StatusNotFound, err)
+				return
+			} else if err != nil {
+				common.Error("Failed to load the content of page %s: %v", pagePath, err)
+				s.GetErrorPages().Serve(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
 		// Prepare template data
 		templateData := tpl.TemplateData{
-			Title:       getPageTitle(pagePath, s.GetName()),
-			Description: getPageDescription(pagePath),
+			Title:       getPageTitle(page.path, s.GetName(), locale),
+			Description: s.GetSEO().Description,
 			Site: tpl.SiteData{
 				Name:    s.GetName(),
 				Domain:  s.GetDomain(),
 				BaseURL: s.GetBaseURL(),
+				Data:    s.GetData(),
+				Params:  s.GetParams(),
 			},
-			Data: make(map[string]interface{}),
+			Data:       make(map[string]interface{}),
+			Locale:     locale,
+			Alternates: page.alternates(locales, s.GetBaseURL(), route),
+			Params:     params,
+		}
+		templateData.Data["Site"] = templateData.Site
+		templateData.Data["Locale"] = templateData.Locale
+		templateData.Data["Alternates"] = templateData.Alternates
+		templateData.Data["Params"] = templateData.Params
+		if loader != nil {
+			templateData.Data["Entry"] = entry
 		}
 
-		state, err := templateEngine.RenderWithLayout(pagePath, "default.html", templateData)
-		if err != nil {
-			common.Error("Failed to render page %s: %v", pagePath, err)
-			common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to render page", err)
-			return
+		// Errors, values or the success message from a classic form post
+		var formState map[string]interface{}
+		if common.ConsumeFlash(w, r, common.FormStateFlash, &formState) {
+			templateData.Data["FormState"] = formState
+		}
+		// Resume token of a partially completed multi-step form
+		if token := r.URL.Query().Get("resume"); token != "" {
+			templateData.Data["FormDraft"] = token
 		}
 
 		// TODO: proper page context handling
-		themeCss, err := s.GetTheme("default")
-		if err != nil {
-			common.Error("Failed to get theme for site %s: %v", s.GetName(), err)
-			themeCss = wispytail.DefaultCssTheme
-		}
+		themeCss := siteThemeCSS(s)
 		themeConfig := wispytail.DefaultThemeConfig()
 		trie := templateEngine.GetWispyTailTrie()
 		baseTwCss := wispytail.GenerateThemeLayer(themeConfig)
-		css := wispytail.Generate(state.GetBody(), themeConfig, trie)
-
-		state.AddHeadInlineCSS(baseTwCss + "\n" + themeCss + "\n" + css)
-		state.SetHeadTitle(templateData.Title)
+		classes := wispytail.NewClassCollector()
 
 		// Set content type
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		tpl.HtmlBaseRender(w, state)
-	})
+		w.Header().Add("Vary", tpl.FragmentVary)
+
+		// Partial page update, e.g. from htmx
+		if fragment, explicit := tpl.RequestedFragment(r); fragment != "" {
+			rs, err := templateEngine.RenderFragment(pagePath, defaultPageLayout, fragment, templateData)
+			switch {
+			case err == nil:
+				// The page already has the theme, only the fragment's classes are styled
+				rs.AddHeadInlineCSS(wispytail.Generate(rs.GetBody(), themeConfig, trie))
+				tpl.FragmentRender(w, rs)
+				return
+			case errors.Is(err, tpl.ErrFragmentNotFound) && !explicit:
+				// The htmx target is not a fragment of this page, send the whole page
+			case errors.Is(err, tpl.ErrFragmentNotFound):
+				common.RespondWithError(w, r, http.StatusNotFound, "Fragment not found", err)
+				return
+			default:
+				common.Error("Failed to render fragment %s of page %s: %v", fragment, pagePath, err)
+				common.RespondWithError(w, r, http.StatusInternalServerError, "Failed to render page", err)
+				return
+			}
+		}
+
+		_, err := templateEngine.RenderWithLayoutTo(w, pagePath, defaultPageLayout, templateData, tpl.StreamHooks{
+			Head: func(rs tpl.RenderState) {
+				rs.AddHeadInlineCSS(baseTwCss + "\n" + themeCss + "\n" + known.css())
+				rs.SetHeadTitle(templateData.Title)
+				// Site-wide head tags, which the page's front matter overrides
+				seo := s.GetSEO()
+				if seo.Canonical == "" && s.GetBaseURL() != "" {
+					seo.Canonical = locales.URL(s.GetBaseURL(), locale, route)
+				}
+				if err := seo.Apply(rs); err != nil {
+					common.Warning("Failed to apply the seo config of site %s: %v", s.GetName(), err)
+				}
+			},
+			Body: classes,
+			Deferred: func(rs tpl.RenderState) {
+				// Classes this page has not used before are styled after the body
+				if fresh := known.learn(classes.Classes(), themeConfig, trie); len(fresh) > 0 {
+					rs.AddHeadInlineCSS(wispytail.GenerateFromClasses(fresh, themeConfig, trie))
+				}
+			},
+		})
+		if err != nil {
+			common.Error("Failed to render page %s: %v", pagePath, err)
+			// Once the page is streaming the failure has been noted in it already
+			var streamErr *tpl.StreamError
+			if errors.As(err, &streamErr) {
+				reportStreamError(r, err)
+			} else {
+				s.GetErrorPages().Serve(w, r, http.StatusInternalServerError, err)
+			}
+		}
+	}
 }
 
-// setupStaticRoutes configures static file serving
-func SetupStaticRoutes(router chi.Router, s Site) {
-	gConfig := config.GetGlobalConfig()
-	// Assets route
-	router.Get("/assets/*", func(w http.ResponseWriter, r *http.Request) {
-		// Serve assets from the tenant's assets directory
-		gConfig.GetCoreAuthMiddleware().RequireAuthFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			path := r.URL.Path[len("/assets/"):]
-			assetPath := filepath.Join("_data/tenants", s.GetDomain(), "assets", path)
-			http.ServeFile(w, r, assetPath)
-		}))
-	})
+// siteThemeCSS returns the CSS of the site's default theme, or the built-in theme
+func siteThemeCSS(s Site) string {
+	themeCss, err := s.GetTheme("default")
+	if err != nil {
+		common.Error("Failed to get theme for site %s: %v", s.GetName(), err)
+		return wispytail.DefaultCssTheme
+	}
+	return themeCss
+}
+
+// maxPageClasses bounds the classes remembered per page, e.g. when classes come from user content
+const maxPageClasses = 4096
+
+// pageClasses remembers the classes a page used in earlier renders, so the CSS for
+// them can go in the head of a streamed page instead of after the body
+type pageClasses struct {
+	mu      sync.RWMutex
+	seen    map[string]bool
+	classes []string
+	cssText string
+}
+
+// css returns the CSS for the classes seen so far
+func (pc *pageClasses) css() string {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.cssText
+}
+
+// learn records classes and returns the ones the page had not used before
+func (pc *pageClasses) learn(classes []string, themeConfig wispytail.ThemeConf, trie *common.Trie) []string {
+	pc.mu.RLock()
+	var fresh []string
+	for _, class := range classes {
+		if !pc.seen[class] {
+			fresh = append(fresh, class)
+		}
+	}
+	pc.mu.RUnlock()
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.seen == nil {
+		pc.seen = make(map[string]bool)
+	}
+	added := false
+	for _, class := range fresh {
+		if !pc.seen[class] && len(pc.classes) < maxPageClasses {
+			pc.seen[class] = true
+			pc.classes = append(pc.classes, class)
+			added = true
+		}
+	}
+	if added {
+		pc.cssText = wispytail.GenerateFromClasses(pc.classes, themeConfig, trie)
+	}
+	return fresh
+}
+
+// SetupStaticRoutes serves the assets of a site and the files under public/ in sitePath
+func SetupStaticRoutes(router chi.Router, sitePath string, assets *tpl.AssetManager) {
+	// Assets route, fingerprinted URLs are cached for good
+	router.Get("/assets/*", assets.ServeHTTP)
 
 	// Public files route
 	router.Get("/public/*", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path[len("/public/"):]
-		publicPath := filepath.Join(gConfig.GetSitesPath(), s.GetDomain(), "public", path)
+		publicPath := filepath.Join(sitePath, "public", path)
 		http.ServeFile(w, r, publicPath)
 	})
 }
 
 // Helper functions
-func getPageTitle(pagePath, siteName string) string {
+func getPageTitle(pagePath, siteName, locale string) string {
+	caser := cases.Title(language.Make(locale))
+
 	// Extract title from page path
 	title := strings.TrimSuffix(filepath.Base(pagePath), ".html")
 	title = strings.ReplaceAll(title, "_", " ")
 	title = strings.ReplaceAll(title, "-", " ")
-	title = cases.Title(language.English).String(title)
+	title = caser.String(title)
 
 	if title == "Index" {
-		return cases.Title(language.English).String(siteName)
+		return caser.String(siteName)
 	}
 
 	return title + " | " + siteName
 }
-
-func getPageDescription(pagePath string) string {
-	// Default description - could be enhanced to read from front matter
-	return "Page content for " + strings.TrimSuffix(filepath.Base(pagePath), ".html")
-}
@@ -0,0 +1,477 @@
+package site
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"wispy-core/common"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// redirectsFileName is the file of redirects managed from the CMS, next to config.toml
+const redirectsFileName = "redirects.toml"
+
+// redirectHitsDBName is the database of the redirect_hits table
+const redirectHitsDBName = "analytics"
+
+// redirectHitsFlushInterval is how long hits are counted in memory before they are saved
+const redirectHitsFlushInterval = 5 * time.Second
+
+// How a redirect rule matches the path of a request
+const (
+	MatchExact    = "exact"    // the path itself, the default
+	MatchPrefix   = "prefix"   // the path and the paths below it, which keep their rest: /blog/a -> /news/a
+	MatchWildcard = "wildcard" // * matches any text, used in the target as $1, $2...
+	MatchRegex    = "regex"    // a regular expression of the whole path, with $1 or ${name} in the target
+)
+
+// RedirectRule sends requests for a path elsewhere, as a redirect or an internal rewrite
+type RedirectRule struct {
+	From      string `toml:"from"`
+	To        string `toml:"to"`
+	Match     string `toml:"match,omitempty"`
+	Status    int    `toml:"status,omitempty"`     // 301, the default, 302, 307 or 308
+	Rewrite   bool   `toml:"rewrite,omitempty"`    // serve the target's page at the requested URL
+	DropQuery bool   `toml:"drop_query,omitempty"` // the query string is passed on unless set
+	Source    string `toml:"-"`                    // the file the rule comes from
+}
+
+// Key identifies a rule by what it matches, e.g. for its hit counter
+func (rule RedirectRule) Key() string {
+	return rule.Match + " " + rule.From
+}
+
+// redirectsConfig is the [[redirects]] of redirects.toml
+type redirectsConfig struct {
+	Redirects []RedirectRule `toml:"redirects"`
+}
+
+// compiledRedirect is a validated rule and its pattern, for wildcards and regexes
+type compiledRedirect struct {
+	rule    RedirectRule
+	pattern *regexp.Regexp
+	literal string // the pattern's literal prefix, checked before running it
+}
+
+// redirectMatcher finds the rule of a path: exact rules and prefixes by map lookup,
+// then wildcard and regex rules in the order they were written
+type redirectMatcher struct {
+	rules    []RedirectRule // with their defaults, in the order they were written
+	exact    map[string]*compiledRedirect
+	prefix   map[string]*compiledRedirect
+	patterns []*compiledRedirect
+}
+
+// compileRedirects validates rules and builds their matcher
+func compileRedirects(rules []RedirectRule) (*redirectMatcher, error) {
+	m := &redirectMatcher{exact: make(map[string]*compiledRedirect), prefix: make(map[string]*compiledRedirect)}
+	seen := make(map[string]string)
+	var errs []error
+	for i, rule := range rules {
+		compiled, err := compileRedirect(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s rule %d (%s): %w", rule.Source, i+1, rule.From, err))
+			continue
+		}
+		rule = compiled.rule
+		m.rules = append(m.rules, rule)
+		if source, ok := seen[rule.Key()]; ok {
+			errs = append(errs, fmt.Errorf("%s rule %d: %s %s is already a rule of %s", rule.Source, i+1, rule.Match, rule.From, source))
+			continue
+		}
+		seen[rule.Key()] = rule.Source
+
+		switch rule.Match {
+		case MatchExact:
+			m.exact[rule.From] = compiled
+		case MatchPrefix:
+			m.prefix[rule.From] = compiled
+		default:
+			m.patterns = append(m.patterns, compiled)
+		}
+	}
+	return m, errors.Join(errs...)
+}
+
+// compileRedirect fills in the defaults of a rule and checks it
+func compileRedirect(rule RedirectRule) (*compiledRedirect, error) {
+	if rule.Match == "" {
+		rule.Match = MatchExact
+	}
+	if rule.From == "" || rule.To == "" {
+		return nil, errors.New("from and to are required")
+	}
+	if rule.Match != MatchRegex && !strings.HasPrefix(rule.From, "/") {
+		return nil, errors.New("from must be a path starting with /")
+	}
+	if rule.Rewrite {
+		if rule.Status != 0 {
+			return nil, errors.New("a rewrite has no status")
+		}
+		if !strings.HasPrefix(rule.To, "/") || strings.HasPrefix(rule.To, "//") {
+			return nil, errors.New("a rewrite must point to a path of the site")
+		}
+	} else {
+		switch rule.Status {
+		case 0:
+			rule.Status = http.StatusMovedPermanently
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("status %d is not one of 301, 302, 307 or 308", rule.Status)
+		}
+	}
+
+	compiled := &compiledRedirect{rule: rule}
+	switch rule.Match {
+	case MatchExact, MatchPrefix:
+		compiled.rule.From = cleanRedirectPath(rule.From)
+		if rule.Match == MatchExact && compiled.rule.From == cleanRedirectPath(rule.To) {
+			return nil, errors.New("the rule redirects to itself")
+		}
+		return compiled, nil
+	case MatchWildcard:
+		parts := strings.Split(cleanRedirectPath(rule.From), "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		compiled.pattern = regexp.MustCompile("^" + strings.Join(parts, "(.*)") + "$")
+	case MatchRegex:
+		pattern, err := regexp.Compile("^(?:" + rule.From + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		compiled.pattern = pattern
+	default:
+		return nil, fmt.Errorf("unknown match %q, expected exact, prefix, wildcard or regex", rule.Match)
+	}
+	compiled.literal, _ = compiled.pattern.LiteralPrefix()
+	compiled.literal = strings.TrimPrefix(compiled.literal, "^")
+	return compiled, nil
+}
+
+// cleanRedirectPath drops the trailing slash of a path, so /old/ and /old match alike
+func cleanRedirectPath(p string) string {
+	if len(p) > 1 {
+		return strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// match returns the rule for a path and the target it sends the path to
+func (m *redirectMatcher) match(urlPath string) (*compiledRedirect, string, bool) {
+	p := cleanRedirectPath(urlPath)
+	if rule, ok := m.exact[p]; ok {
+		return rule, rule.rule.To, true
+	}
+
+	// The longest prefix wins, so walk up from the path itself
+	for prefix := p; len(m.prefix) > 0; {
+		if rule, ok := m.prefix[prefix]; ok {
+			rest := strings.TrimPrefix(p, strings.TrimSuffix(prefix, "/"))
+			target, ok := siteRedirectTarget(rule.rule.To, strings.TrimSuffix(rule.rule.To, "/")+rest)
+			return rule, target, ok
+		}
+		if prefix == "/" {
+			break
+		}
+		prefix = prefix[:strings.LastIndex(prefix, "/")]
+		if prefix == "" {
+			prefix = "/"
+		}
+	}
+
+	for _, rule := range m.patterns {
+		if !strings.HasPrefix(p, rule.literal) {
+			continue
+		}
+		if match := rule.pattern.FindStringSubmatchIndex(p); match != nil {
+			target, ok := siteRedirectTarget(rule.rule.To, string(rule.pattern.ExpandString(nil, rule.rule.To, p, match)))
+			return rule, target, ok
+		}
+	}
+	return nil, "", false
+}
+
+// siteRedirectTarget keeps a target built from the request path on the site when
+// the rule's own target is a path. Leading slashes are collapsed, so /old//evil.example
+// does not become the protocol-relative //evil.example, and a target that turned
+// into an absolute URL is rejected.
+func siteRedirectTarget(to, target string) (string, bool) {
+	if u, err := url.Parse(to); err == nil && (u.Scheme != "" || u.Host != "") {
+		return target, true
+	}
+	if trimmed := strings.TrimLeft(target, `/\`); trimmed != target || target == "" {
+		return "/" + trimmed, true
+	}
+	if u, err := url.Parse(target); err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+	return target, true
+}
+
+// Redirects holds the redirect rules of a site, the [[redirects]] of its config.toml
+// and its redirects.toml, reloaded when one of them changes
+type Redirects struct {
+	config   *configFile
+	filePath string
+	hits     *redirectHits
+	matcher  *reloadable[*redirectMatcher]
+}
+
+// newRedirects loads the redirects of the site in sitePath and its config file. db
+// opens the database hits are saved to; with a nil db they are only counted in memory.
+func newRedirects(sitePath string, config *configFile, db func() (*sql.DB, error)) (*Redirects, error) {
+	rd := &Redirects{
+		config:   config,
+		filePath: filepath.Join(sitePath, redirectsFileName),
+		hits:     &redirectHits{db: db, pending: make(map[string]int64)},
+	}
+	matcher, err := newReloadable("redirects", rd.load, config.path, rd.filePath)
+	if err != nil {
+		return nil, err
+	}
+	rd.matcher = matcher
+	return rd, nil
+}
+
+// load reads and compiles the rules, failing when one of them is invalid
+func (rd *Redirects) load() (*redirectMatcher, error) {
+	tables, err := rd.config.current()
+	if err != nil {
+		return nil, err
+	}
+	fileRules, err := readRedirects(rd.filePath)
+	if err != nil {
+		return nil, err
+	}
+	return compileRedirects(slices.Concat(tables.Redirects, fileRules))
+}
+
+// readRedirects reads the [[redirects]] of a file, which may not exist
+func readRedirects(path string) ([]RedirectRule, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var config redirectsConfig
+	if err := toml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid redirects in %s: %w", filepath.Base(path), err)
+	}
+	for i := range config.Redirects {
+		config.Redirects[i].Source = filepath.Base(path)
+	}
+	return config.Redirects, nil
+}
+
+// current returns the matcher, reloading the rules when a file changed
+func (rd *Redirects) current() *redirectMatcher {
+	return rd.matcher.current()
+}
+
+// Rules returns the rules in the order they were written, those of config.toml first
+func (rd *Redirects) Rules() []RedirectRule {
+	return slices.Clone(rd.current().rules)
+}
+
+// Add appends a rule to redirects.toml
+func (rd *Redirects) Add(rule RedirectRule) error {
+	return rd.update(func(rules []RedirectRule) ([]RedirectRule, error) {
+		return append(rules, rule), nil
+	})
+}
+
+// Remove deletes the rule with the given key from redirects.toml. Rules of
+// config.toml are edited in the file.
+func (rd *Redirects) Remove(key string) error {
+	return rd.update(func(rules []RedirectRule) ([]RedirectRule, error) {
+		for i, rule := range rules {
+			if compiled, err := compileRedirect(rule); err == nil && compiled.rule.Key() == key {
+				return slices.Delete(rules, i, i+1), nil
+			}
+		}
+		return nil, fmt.Errorf("no rule %q in %s", key, redirectsFileName)
+	})
+}
+
+// update changes the rules of redirects.toml, writing the file only when all rules
+// are still valid
+func (rd *Redirects) update(change func([]RedirectRule) ([]RedirectRule, error)) error {
+	return rd.matcher.update(func(*redirectMatcher) (*redirectMatcher, error) {
+		fileRules, err := readRedirects(rd.filePath)
+		if err != nil {
+			return nil, err
+		}
+		if fileRules, err = change(fileRules); err != nil {
+			return nil, err
+		}
+		tables, err := rd.config.current()
+		if err != nil {
+			return nil, err
+		}
+		for i := range fileRules {
+			fileRules[i].Source = redirectsFileName
+		}
+		matcher, err := compileRedirects(slices.Concat(tables.Redirects, fileRules))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := toml.Marshal(redirectsConfig{Redirects: fileRules})
+		if err != nil {
+			return nil, err
+		}
+		tmp := rd.filePath + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", redirectsFileName, err)
+		}
+		if err := os.Rename(tmp, rd.filePath); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", redirectsFileName, err)
+		}
+		return matcher, nil
+	})
+}
+
+// Hits returns how often each rule was used, by key
+func (rd *Redirects) Hits() map[string]int64 {
+	return rd.hits.counts()
+}
+
+// Handler redirects or rewrites the requests a rule matches, before they reach the
+// page routes, and passes on the others
+func (rd *Redirects) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, target, ok := rd.current().match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rd.hits.add(rule.rule.Key())
+
+		query := ""
+		if !rule.rule.DropQuery && r.URL.RawQuery != "" {
+			query = r.URL.RawQuery
+		}
+
+		if rule.rule.Rewrite {
+			targetPath, targetQuery, _ := strings.Cut(target, "?")
+			r.URL.Path = targetPath
+			r.URL.RawPath = ""
+			r.URL.RawQuery = strings.Trim(targetQuery+"&"+query, "&")
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				rctx.RoutePath = targetPath
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if query != "" {
+			if strings.Contains(target, "?") {
+				target += "&" + query
+			} else {
+				target += "?" + query
+			}
+		}
+		http.Redirect(w, r, target, rule.rule.Status)
+	})
+}
+
+// redirectHits counts the hits of each rule in memory and adds them to the
+// redirect_hits table of the analytics database in batches
+type redirectHits struct {
+	db func() (*sql.DB, error)
+
+	mu        sync.Mutex
+	pending   map[string]int64
+	scheduled bool
+}
+
+func (h *redirectHits) add(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending[key]++
+	if h.db != nil && !h.scheduled {
+		h.scheduled = true
+		time.AfterFunc(redirectHitsFlushInterval, h.flush)
+	}
+}
+
+// flush saves the hits counted since the last flush, keeping them for the next
+// one when the database cannot be written
+func (h *redirectHits) flush() {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = make(map[string]int64)
+	h.scheduled = false
+	h.mu.Unlock()
+
+	err := h.save(pending)
+	if err == nil {
+		return
+	}
+	common.Warning("Failed to save redirect hits: %v", err)
+	h.mu.Lock()
+	for key, count := range pending {
+		h.pending[key] += count
+	}
+	h.mu.Unlock()
+}
+
+func (h *redirectHits) save(pending map[string]int64) error {
+	db, err := h.db()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for key, count := range pending {
+		if _, err := tx.Exec(`INSERT INTO redirect_hits (rule, hits, last_hit_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(rule) DO UPDATE SET hits = hits + excluded.hits, last_hit_at = excluded.last_hit_at`, key, count); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// counts returns the saved hits plus the ones not saved yet
+func (h *redirectHits) counts() map[string]int64 {
+	counts := make(map[string]int64)
+	if h.db != nil {
+		if db, err := h.db(); err != nil {
+			common.Warning("Failed to open the database of redirect hits: %v", err)
+		} else if rows, err := db.Query("SELECT rule, hits FROM redirect_hits"); err != nil {
+			common.Warning("Failed to read redirect hits: %v", err)
+		} else {
+			defer rows.Close()
+			for rows.Next() {
+				var key string
+				var hits int64
+				if err := rows.Scan(&key, &hits); err == nil {
+					counts[key] = hits
+				}
+			}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, count := range h.pending {
+		counts[key] += count
+	}
+	return counts
+}
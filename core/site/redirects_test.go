@@ -0,0 +1,232 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRedirectMatcher(t *testing.T) {
+	matcher, err := compileRedirects([]RedirectRule{
+		{From: "/old-about/", To: "/about"},
+		{From: "/blog", To: "/news", Match: MatchPrefix},
+		{From: "/blog/archive", To: "https://archive.example.com/", Match: MatchPrefix},
+		{From: "/shop/*/item-*", To: "/store/$1/${2}", Match: MatchWildcard},
+		{From: `/p/(?P<id>\d+)`, To: "/posts/${id}", Match: MatchRegex},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path       string
+		wantTarget string
+		wantRule   string
+	}{
+		{"/old-about", "/about", "exact /old-about"},
+		{"/old-about/", "/about", "exact /old-about"},
+		{"/blog", "/news", "prefix /blog"},
+		{"/blog/2024/post", "/news/2024/post", "prefix /blog"},
+		{"/blog/archive/2019", "https://archive.example.com/2019", "prefix /blog/archive"},
+		{"/shop/shoes/item-42", "/store/shoes/42", "wildcard /shop/*/item-*"},
+		{"/p/7", "/posts/7", `regex /p/(?P<id>\d+)`},
+	}
+	for _, tt := range tests {
+		rule, target, ok := matcher.match(tt.path)
+		if !ok {
+			t.Errorf("match(%s) found no rule", tt.path)
+			continue
+		}
+		if target != tt.wantTarget || rule.rule.Key() != tt.wantRule {
+			t.Errorf("match(%s) = %s, %q, want %s, %q", tt.path, rule.rule.Key(), target, tt.wantRule, tt.wantTarget)
+		}
+	}
+
+	for _, path := range []string{"/blogroll", "/p/x", "/shop/shoes"} {
+		if rule, _, ok := matcher.match(path); ok {
+			t.Errorf("match(%s) found %s", path, rule.rule.Key())
+		}
+	}
+
+	// A prefix of the root catches every path, before any pattern
+	matcher, _ = compileRedirects([]RedirectRule{
+		{From: `/p/(?P<id>\d+)`, To: "/posts/${id}", Match: MatchRegex},
+		{From: "/", To: "https://example.com", Match: MatchPrefix},
+	})
+	if _, target, ok := matcher.match("/p/7"); !ok || target != "https://example.com/p/7" {
+		t.Errorf("match(/p/7) = %q, %v, want https://example.com/p/7", target, ok)
+	}
+}
+
+func TestRedirectMatcherStaysOnSite(t *testing.T) {
+	matcher, err := compileRedirects([]RedirectRule{
+		{From: "/old", To: "/", Match: MatchPrefix},
+		{From: "/w/*", To: "/$1", Match: MatchWildcard},
+		{From: "/go/(.*)", To: "$1", Match: MatchRegex},
+		{From: "/ext", To: "https://example.com/", Match: MatchPrefix},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path       string
+		wantTarget string
+		wantOk     bool
+	}{
+		{"/old//evil.example/x", "/evil.example/x", true},
+		{"/old/\\evil.example", "/evil.example", true},
+		{"/old", "/", true},
+		{"/w//evil.example/x", "/evil.example/x", true},
+		{"/w/a", "/a", true},
+		{"/go/https://evil.example", "", false},
+		// Absolute targets of the rule itself are kept
+		{"/ext//a", "https://example.com//a", true},
+	}
+	for _, tt := range tests {
+		_, target, ok := matcher.match(tt.path)
+		if target != tt.wantTarget || ok != tt.wantOk {
+			t.Errorf("match(%s) = %q, %v, want %q, %v", tt.path, target, ok, tt.wantTarget, tt.wantOk)
+		}
+	}
+}
+
+func TestCompileRedirectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RedirectRule
+		wantErr string
+	}{
+		{name: "No target", rule: RedirectRule{From: "/a"}, wantErr: "from and to are required"},
+		{name: "Relative path", rule: RedirectRule{From: "a", To: "/b"}, wantErr: "must be a path"},
+		{name: "Status", rule: RedirectRule{From: "/a", To: "/b", Status: 200}, wantErr: "status 200"},
+		{name: "Rewrite elsewhere", rule: RedirectRule{From: "/a", To: "https://example.com", Rewrite: true}, wantErr: "path of the site"},
+		{name: "Loop", rule: RedirectRule{From: "/a/", To: "/a"}, wantErr: "redirects to itself"},
+		{name: "Regex", rule: RedirectRule{From: "/(a", To: "/b", Match: MatchRegex}, wantErr: "invalid regex"},
+		{name: "Match", rule: RedirectRule{From: "/a", To: "/b", Match: "glob"}, wantErr: `unknown match "glob"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Source = "config.toml"
+			_, err := compileRedirects([]RedirectRule{tt.rule})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := compileRedirects([]RedirectRule{{From: "/a", To: "/b", Source: "config.toml"}, {From: "/a/", To: "/c", Source: "redirects.toml"}})
+	if err == nil || !strings.Contains(err.Error(), "already a rule of config.toml") {
+		t.Errorf("error = %v, want a duplicate rule", err)
+	}
+}
+
+func TestRedirectsHandler(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"config.toml": `
+[[redirects]]
+from = "/old"
+to = "/new"
+[[redirects]]
+from = "/moved"
+to = "/new?from=moved"
+status = 308
+drop_query = true
+[[redirects]]
+from = "/docs/*"
+to = "/guides/$1"
+match = "wildcard"
+rewrite = true`,
+	})
+	redirects, err := newRedirects(root, newConfigFile(root), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Use(redirects.Handler)
+	router.Get("/guides/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("guide " + chi.URLParam(r, "name") + " " + r.URL.RawQuery))
+	})
+
+	tests := []struct {
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{path: "/old?utm=1", wantStatus: http.StatusMovedPermanently, wantLocation: "/new?utm=1"},
+		{path: "/moved/?utm=1", wantStatus: http.StatusPermanentRedirect, wantLocation: "/new?from=moved"},
+		{path: "/docs/setup?v=2", wantStatus: http.StatusOK, wantBody: "guide setup v=2"},
+		{path: "/other", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	hits := redirects.Hits()
+	if hits["exact /old"] != 1 || hits["wildcard /docs/*"] != 1 || hits["exact /other"] != 0 {
+		t.Errorf("Hits() = %v", hits)
+	}
+}
+
+func TestRedirectsAddRemove(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"config.toml": "[[redirects]]\nfrom = \"/old\"\nto = \"/new\"",
+	})
+	redirects, err := newRedirects(root, newConfigFile(root), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := redirects.Add(RedirectRule{From: "/old/", To: "/elsewhere"}); err == nil {
+		t.Error("Add() of a rule of config.toml succeeded")
+	}
+	if err := redirects.Add(RedirectRule{From: "/shop", To: "/store", Match: MatchPrefix, Status: 302}); err != nil {
+		t.Fatal(err)
+	}
+	rules := redirects.Rules()
+	if len(rules) != 2 || rules[1].Source != redirectsFileName || rules[1].Status != 302 {
+		t.Fatalf("Rules() = %+v", rules)
+	}
+	data, _ := os.ReadFile(filepath.Join(root, redirectsFileName))
+	if !strings.Contains(string(data), "from = '/shop'") {
+		t.Errorf("%s does not have the rule:\n%s", redirectsFileName, data)
+	}
+
+	// Rules are reloaded from the file, so a new instance sees the same rules
+	reloaded, err := newRedirects(root, newConfigFile(root), nil)
+	if err != nil || len(reloaded.Rules()) != 2 {
+		t.Fatalf("reloaded rules = %+v, %v", reloaded.Rules(), err)
+	}
+
+	if err := redirects.Remove("exact /old"); err == nil {
+		t.Error("Remove() of a rule of config.toml succeeded")
+	}
+	if err := redirects.Remove("prefix /shop"); err != nil {
+		t.Fatal(err)
+	}
+	if rules := redirects.Rules(); len(rules) != 1 {
+		t.Errorf("Rules() after Remove = %+v", rules)
+	}
+}
@@ -0,0 +1,156 @@
+package site
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"wispy-core/common"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// dataCheckInterval is how often a site's files are checked for changes
+const dataCheckInterval = 2 * time.Second
+
+// reloadable is a value loaded from files, reloaded when one of them changes. The
+// files are checked at most once every dataCheckInterval, and a reload that fails
+// keeps the value loaded before.
+type reloadable[T any] struct {
+	name  string // what is loaded, for the logs
+	paths []string
+	load  func() (T, error)
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	signature string
+	value     T
+}
+
+// newReloadable loads a value from the files in paths, which may be directories
+func newReloadable[T any](name string, load func() (T, error), paths ...string) (*reloadable[T], error) {
+	rl := &reloadable[T]{name: name, paths: paths, load: load}
+	rl.signature = signFiles(paths...)
+	rl.checkedAt = time.Now()
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	rl.value = value
+	return rl, nil
+}
+
+// current returns the value, reloading it when a file changed
+func (rl *reloadable[T]) current() T {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if time.Since(rl.checkedAt) >= dataCheckInterval {
+		rl.checkedAt = time.Now()
+		if signature := signFiles(rl.paths...); signature != rl.signature {
+			rl.signature = signature
+			if value, err := rl.load(); err != nil {
+				common.Error("Failed to reload %s, keeping what was loaded before: %v", rl.name, err)
+			} else {
+				rl.value = value
+				common.Debug("Reloaded %s", rl.name)
+			}
+		}
+	}
+	return rl.value
+}
+
+// update replaces the value with the one change makes of it, for changes written
+// to the files by the site itself
+func (rl *reloadable[T]) update(change func(T) (T, error)) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	value, err := change(rl.value)
+	if err != nil {
+		return err
+	}
+	rl.value = value
+	rl.signature = signFiles(rl.paths...)
+	return nil
+}
+
+// signFiles describes files, and the files under directories, by name, size and
+// modification time, so a change to any of them changes the result
+func signFiles(paths ...string) string {
+	var sig strings.Builder
+	for _, root := range paths {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				fmt.Fprintf(&sig, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	return sig.String()
+}
+
+// configTables are the tables of config.toml that are reloaded while the site runs
+type configTables struct {
+	Params      map[string]interface{} `toml:"params"`
+	Redirects   []RedirectRule         `toml:"redirects"`
+	Maintenance maintenanceConfig      `toml:"maintenance"`
+}
+
+// configFile is a site's config.toml, shared by the parts of the site that reload
+// one of its tables. It is parsed again only when it changed, so the reloads that
+// follow a change read it once.
+type configFile struct {
+	path string
+
+	mu        sync.Mutex
+	read      bool
+	signature string
+	tables    configTables
+	err       error
+}
+
+// newConfigFile returns the config.toml of the site in sitePath
+func newConfigFile(sitePath string) *configFile {
+	return &configFile{path: filepath.Join(sitePath, "config.toml")}
+}
+
+// current returns the tables of the file, parsing it when it changed since it was
+// last parsed. A missing file has empty tables.
+func (cf *configFile) current() (configTables, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if signature := signFiles(cf.path); !cf.read || signature != cf.signature {
+		cf.read = true
+		cf.signature = signature
+		cf.tables, cf.err = readConfigTables(cf.path)
+	}
+	return cf.tables, cf.err
+}
+
+// readConfigTables parses the reloaded tables of a config.toml
+func readConfigTables(path string) (configTables, error) {
+	var tables configTables
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return tables, err
+	}
+	if err := toml.Unmarshal(data, &tables); err != nil {
+		return tables, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	if tables.Params == nil {
+		tables.Params = make(map[string]interface{})
+	}
+	for i := range tables.Redirects {
+		tables.Redirects[i].Source = filepath.Base(path)
+	}
+	return tables, nil
+}
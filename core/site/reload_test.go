@@ -0,0 +1,64 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigFileReload(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"config.toml": "[params]\ntagline = \"Hi\"\n[[redirects]]\nfrom = \"/old\"\nto = \"/new\"",
+	})
+	config := newConfigFile(root)
+	sd, err := newSiteData(root, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirects, err := newRedirects(root, config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorPages, err := newErrorPages(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change rewrites config.toml with a later modification time and lets the next
+	// calls look at it
+	change := func(content string) {
+		writeDataFiles(t, root, map[string]string{"config.toml": content})
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(filepath.Join(root, "config.toml"), later, later); err != nil {
+			t.Fatal(err)
+		}
+		sd.files.checkedAt = time.Time{}
+		redirects.matcher.checkedAt = time.Time{}
+		errorPages.config.checkedAt = time.Time{}
+	}
+
+	change("[params]\ntagline = \"Hello\"\n[[redirects]]\nfrom = \"/older\"\nto = \"/new\"\n[maintenance]\nenabled = true")
+	if _, params := sd.current(); params["tagline"] != "Hello" {
+		t.Errorf("tagline after change = %v, want Hello", params["tagline"])
+	}
+	if rules := redirects.Rules(); len(rules) != 1 || rules[0].From != "/older" || rules[0].Source != "config.toml" {
+		t.Errorf("rules after change = %+v", rules)
+	}
+	if !errorPages.InMaintenance() {
+		t.Error("InMaintenance() after change = false")
+	}
+
+	// A config that fails to parse keeps what every part loaded before
+	change("[params")
+	if _, params := sd.current(); params["tagline"] != "Hello" {
+		t.Errorf("tagline after invalid change = %v, want Hello", params["tagline"])
+	}
+	if rules := redirects.Rules(); len(rules) != 1 || rules[0].From != "/older" {
+		t.Errorf("rules after invalid change = %+v", rules)
+	}
+	if !errorPages.InMaintenance() {
+		t.Error("InMaintenance() after invalid change = false")
+	}
+}
@@ -0,0 +1,100 @@
+package site
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"wispy-core/common"
+)
+
+// RobotsRules are the paths a crawler may and may not visit
+type RobotsRules struct {
+	Allow      []string `toml:"allow"`
+	Disallow   []string `toml:"disallow"`
+	CrawlDelay int      `toml:"crawl_delay"` // seconds
+}
+
+// RobotsConfig is the [robots] table of config.toml, the rules of every crawler
+// with rules of its own for some:
+//
+//	[robots]
+//	disallow = ["/drafts"]
+//	[robots.agents.GPTBot]
+//	disallow = ["/"]
+type RobotsConfig struct {
+	RobotsRules
+	Agents map[string]RobotsRules `toml:"agents"`
+}
+
+// Validate reports rules that are not paths
+func (rc RobotsConfig) Validate() error {
+	check := func(agent string, rules RobotsRules) error {
+		for _, path := range slices.Concat(rules.Allow, rules.Disallow) {
+			if !strings.HasPrefix(path, "/") {
+				return fmt.Errorf("%s: %q must be a path", agent, path)
+			}
+		}
+		if rules.CrawlDelay < 0 {
+			return fmt.Errorf("%s: crawl_delay must not be negative", agent)
+		}
+		return nil
+	}
+	if err := check("*", rc.RobotsRules); err != nil {
+		return err
+	}
+	for agent, rules := range rc.Agents {
+		if err := check(agent, rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// robotsHandler serves the robots.txt of a site. Outside production every crawler
+// is kept out, so staging sites do not show up in search results.
+func robotsHandler(s Site) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !common.IsProduction() {
+			w.Write([]byte("User-agent: *\nDisallow: /\n"))
+			return
+		}
+		w.Write([]byte(robotsTxt(s.GetRobots(), strings.TrimSuffix(siteBaseURL(s, r), "/")+"/sitemap.xml")))
+	}
+}
+
+// robotsTxt writes the rules of a site's robots.txt, followed by its sitemap
+func robotsTxt(config RobotsConfig, sitemapURL string) string {
+	var b strings.Builder
+	writeGroup := func(agent string, rules RobotsRules) {
+		b.WriteString("User-agent: " + agent + "\n")
+		for _, path := range rules.Allow {
+			b.WriteString("Allow: " + path + "\n")
+		}
+		for _, path := range rules.Disallow {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		if len(rules.Allow) == 0 && len(rules.Disallow) == 0 {
+			// An empty Disallow allows everything
+			b.WriteString("Disallow:\n")
+		}
+		if rules.CrawlDelay > 0 {
+			b.WriteString("Crawl-delay: " + strconv.Itoa(rules.CrawlDelay) + "\n")
+		}
+		b.WriteString("\n")
+	}
+
+	writeGroup("*", config.RobotsRules)
+	agents := make([]string, 0, len(config.Agents))
+	for agent := range config.Agents {
+		agents = append(agents, agent)
+	}
+	slices.Sort(agents)
+	for _, agent := range agents {
+		writeGroup(agent, config.Agents[agent])
+	}
+	b.WriteString("Sitemap: " + sitemapURL + "\n")
+	return b.String()
+}
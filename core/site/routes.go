@@ -8,8 +8,21 @@ import (
 
 	"wispy-core/common"
 	"wispy-core/tpl"
+
+	"github.com/go-chi/chi/v5"
 )
 
+// TemplateFuncsFactory builds template functions bound to a tenant site
+type TemplateFuncsFactory func(s Site) tpl.FuncProvider
+
+var templateFuncsFactories []TemplateFuncsFactory
+
+// RegisterTemplateFuncs adds template functions to every tenant site's template engine.
+// It must be called before the sites are scaffolded, typically from a package init.
+func RegisterTemplateFuncs(factory TemplateFuncsFactory) {
+	templateFuncsFactories = append(templateFuncsFactories, factory)
+}
+
 // ScaffoldAllSites sets up routes for all sites
 func ScaffoldAllTenantSites(sites map[string]Site) {
 	for domain, site := range sites {
@@ -18,12 +31,17 @@ func ScaffoldAllTenantSites(sites map[string]Site) {
 	}
 }
 
-// ScaffoldSiteRoutes sets up routes based on pages found in the site's directory
-func ScaffoldTenantSiteRoutes(tenantSite Site) {
-	router := tenantSite.GetRouter()
+// defaultPageLayout is the layout pages are rendered with
+const defaultPageLayout = "default.html"
+
+// tenantSitePath is the directory of a tenant site's files
+func tenantSitePath(tenantSite Site) string {
+	return filepath.Join("_data", "tenants", tenantSite.GetDomain())
+}
 
-	// Get site paths
-	sitePath := filepath.Join("_data", "tenants", tenantSite.GetDomain())
+// newTemplateEngine creates the template engine of a tenant site with its files in
+// sitePath, with its supporting templates loaded, and the manager of its assets
+func newTemplateEngine(tenantSite Site, sitePath string) (tpl.TemplateEngine, *tpl.AssetManager, []error) {
 	layoutsDir := filepath.Join(sitePath, "layouts")
 	pagesDir := filepath.Join(sitePath, "pages")
 	supportingTemplatesDirs := []string{
@@ -32,15 +50,59 @@ func ScaffoldTenantSiteRoutes(tenantSite Site) {
 		filepath.Join(sitePath, "design/partials"),
 	}
 
-	// Create template engine for this site
 	templateEngine := tpl.NewTemplateEngine(layoutsDir, pagesDir)
-	_, suppTmplErrs := templateEngine.LoadSupportingTemplates(supportingTemplatesDirs)
+	// Layouts the site does not have come from the design system, then the CMS templates
+	templateEngine.AddLayoutDirs(
+		filepath.Join("_data", "design", "systems", "layouts"),
+		filepath.Join("_data", "design", "templates", "cms", "layouts"),
+	)
+	assets := tpl.NewAssetManager(filepath.Join(sitePath, "assets"), "/assets/")
+	templateEngine.SetAssets(assets)
+	templateEngine.RegisterFuncs(translateFuncs(tenantSite))
+	for _, factory := range templateFuncsFactories {
+		templateEngine.RegisterFuncs(factory(tenantSite))
+	}
+	_, errs := templateEngine.LoadSupportingTemplates(supportingTemplatesDirs)
+	return templateEngine, assets, errs
+}
+
+// CheckSite parses every layout, page and supporting template of a tenant site
+// and returns the problems found, see tpl.TemplateEngine.Check
+func CheckSite(tenantSite Site) []tpl.CheckIssue {
+	// Templates that fail to load are reported by the check itself
+	templateEngine, _, _ := newTemplateEngine(tenantSite, tenantSitePath(tenantSite))
+	return templateEngine.Check(defaultPageLayout)
+}
+
+// ScaffoldSiteRoutes sets up routes based on pages found in the site's directory
+func ScaffoldTenantSiteRoutes(tenantSite Site) {
+	scaffoldRoutes(tenantSite.GetRouter(), tenantSite, tenantSitePath(tenantSite))
+}
+
+// scaffoldRoutes sets up the routes of a site with its files in sitePath on router
+func scaffoldRoutes(router chi.Router, tenantSite Site, sitePath string) {
+	// Maintenance answers before anything else, then redirects run before the page
+	// routes, rewrites pass on to them
+	errorPages := tenantSite.GetErrorPages()
+	if errorPages != nil {
+		router.Use(errorPages.Handler)
+		router.NotFound(errorPages.NotFound)
+	}
+	if redirects := tenantSite.GetRedirects(); redirects != nil {
+		router.Use(redirects.Handler)
+	}
+	pagesDir := filepath.Join(sitePath, "pages")
+
+	templateEngine, assets, suppTmplErrs := newTemplateEngine(tenantSite, sitePath)
 	if len(suppTmplErrs) > 0 {
 		common.Error("Failed to load supporting templates!")
 		for _, err := range suppTmplErrs {
 			common.Warning("-->: %v", err)
 		}
 	}
+	if errorPages != nil {
+		errorPages.setEngine(templateEngine)
+	}
 
 	// Scan for pages and create routes
 	pages, err := ScanPages(pagesDir)
@@ -50,17 +112,51 @@ func ScaffoldTenantSiteRoutes(tenantSite Site) {
 		return
 	}
 
-	// Create routes for each page
-	for _, pagePath := range pages {
-		CreatePageRoute(router, tenantSite, templateEngine, pagePath)
+	// Create routes for each page, in each locale of the site
+	routes := make(map[string]string) // route shape -> page
+	var routable []localizedPage
+	for _, page := range localizePages(pages, tenantSite.GetLocales()) {
+		// Error pages answer failed requests rather than a route, e.g. 404/index.html
+		if status, ok := errorPageStatus(page.path); ok {
+			addErrorPage(errorPages, templateEngine, tenantSite.GetLocales(), status, page)
+			continue
+		}
+		if route, err := parsePageRoute(page.path); err == nil {
+			if other, ok := routes[route.shape()]; ok {
+				common.Warning("Skipping page %s: its route %s is the route of %s", page.path, route.pattern, other)
+				continue
+			}
+			routes[route.shape()] = page.path
+		}
+		createPageRoutes(router, tenantSite, templateEngine, page)
+		routable = append(routable, page)
 	}
 
+	// sitemap.xml of the pages and robots.txt
+	setupSitemapRoutes(router, tenantSite, pagesDir, routable)
+
+	// Feeds of the content types
+	setupFeedRoutes(router, tenantSite, feedEntries)
+
 	// Setup static file routes for site assets
-	SetupStaticRoutes(router, tenantSite)
+	SetupStaticRoutes(router, sitePath, assets)
 
 	common.Info("Scaffolded routes for site: %s (%d pages)", tenantSite.GetName(), len(pages))
 }
 
+// addErrorPage compiles an error page and adds it to the site's error pages
+func addErrorPage(errorPages *ErrorPages, templateEngine tpl.TemplateEngine, locales Locales, status int, page localizedPage) {
+	if errorPages == nil {
+		return
+	}
+	for _, pagePath := range page.files(locales) {
+		if err := templateEngine.Precompile(pagePath, defaultPageLayout); err != nil {
+			common.Warning("Failed to compile the %d page %s, the built-in page is used when it fails: %v", status, pagePath, err)
+		}
+	}
+	errorPages.add(status, page)
+}
+
 // ScanPages scans the pages directory and returns a list of available pages
 func ScanPages(pagesDir string) ([]string, error) {
 	var pages []string
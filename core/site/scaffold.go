@@ -36,6 +36,7 @@ func Scaffold(rootDir string, cfg ScaffoldConfig) (Site, error) {
 		"content",
 		"data",
 		"databases",
+		"locales",
 		"assets/css",
 		"assets/js",
 		"design/partials",
@@ -74,16 +75,39 @@ func Scaffold(rootDir string, cfg ScaffoldConfig) (Site, error) {
 		}
 	}
 
+	config := newConfigFile(sitePath)
+	files, err := newSiteData(sitePath, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load site data: %w", err)
+	}
+	locales, _ := newLocales(i18nConfig{})
+	translations, err := newTranslations(sitePath, locales)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %w", err)
+	}
+
+	redirects, err := newRedirects(sitePath, config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load redirects: %w", err)
+	}
+
 	// Initialize the site instance
 	siteInstance := &site{
 		mu: sync.RWMutex{},
 		// ID:         cfg.ID,
-		Name:      cfg.Name,
-		Domain:    cfg.Domain,
-		BaseURL:   cfg.BaseURL,
-		Data:      make(map[string]interface{}),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Name:         cfg.Name,
+		Domain:       cfg.Domain,
+		BaseURL:      cfg.BaseURL,
+		Data:         make(map[string]interface{}),
+		files:        files,
+		locales:      locales,
+		translations: translations,
+		redirects:    redirects,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if siteInstance.errorPages, err = newErrorPages(siteInstance, config); err != nil {
+		return nil, fmt.Errorf("failed to load the maintenance config: %w", err)
 	}
 
 	return siteInstance, nil
@@ -160,11 +184,59 @@ base_url = "{{.BaseURL}}"
 created_at = {{.CreatedAt | formatTime}}
 updated_at = {{.CreatedAt | formatTime}}
 
-# Content Types
+# Custom values for templates, available as .Site.Params
+[params]
+
+# Locales the site is served in, with translations in locales/<locale>.toml
+# [i18n]
+# default_locale = "en"
+# locales = ["en", "fr"]
+
+# Head tags of every page, which pages override in their +++ front matter
+# [seo]
+# description = "{{.Name}}"
+# image = "/assets/images/share.png"
+# [seo.twitter]
+# site = "@example"
+# [seo.sitemap]
+# changefreq = "weekly"
+# [[seo.icons]]
+# href = "/assets/favicon.svg"
+# type = "image/svg+xml"
+
+# Redirects, run before the pages. Rules added in the CMS go to redirects.toml
+# [[redirects]]
+# from = "/old-about"
+# to = "/about"
+# [[redirects]]
+# from = "/blog/*"
+# to = "/news/$1"
+# match = "wildcard"  # exact, prefix, wildcard or regex
+# status = 302         # 301 by default, or 307, 308
+
+# Rules of robots.txt, which keeps every crawler out outside production
+# [robots]
+# disallow = ["/drafts"]
+# [robots.agents.GPTBot]
+# disallow = ["/"]
+
+# Maintenance answers every page with pages/503.html, or a built-in page
+# [maintenance]
+# enabled = true
+# retry_after = 3600  # seconds
+# allow = ["/status"]
+
+# Content Types, each with feeds at /<name>/feed.xml, atom.xml and feed.json
 {{- range $index, $type := .ContentTypes}}
 [[content_types]]
 name = "{{$type}}"
 {{- end}}
+# path = "/blog"        # entries are at /blog/<slug>, /<name>/<slug> by default
+# [content_types.feed]
+# title = "Our blog"
+# full_content = true   # the whole entries rather than their summary
+# limit = 20
+# disabled = false
 `
 
 	// Create template function map for formatting
@@ -24,8 +24,23 @@ type site struct {
 	//
 	CssThemes map[string]string // Maps theme name to CSS file path
 	// ContentDir         string                 `toml:"content_dir" json:"content_dir"`
-	Data   map[string]interface{} `toml:"data" json:"data"`
+	Data   map[string]interface{} `toml:"data" json:"data"`     // Values set with SetData, on top of the data files
 	Config map[string]interface{} `toml:"config" json:"config"` // Site configuration from config.toml
+	// Files under data/ and the [params] of config.toml, reloaded on change
+	files *siteData
+	// Locales of the [i18n] table of config.toml and their translation catalogs
+	locales      Locales
+	translations *translations
+	// Defaults for the head tags of pages, the [seo] table of config.toml
+	seo tpl.PageMeta
+	// Rules of robots.txt, the [robots] table of config.toml
+	robots RobotsConfig
+	// Content types of the [[content_types]] tables of config.toml
+	contentTypes []ContentType
+	// Redirect rules of config.toml and redirects.toml
+	redirects *Redirects
+	// Pages for failed requests and the [maintenance] table of config.toml
+	errorPages *ErrorPages
 	//
 	Router         chi.Router         `toml:"-" json:"-"`
 	TemplateEngine tpl.TemplateEngine `toml:"-" json:"-"`
@@ -50,6 +65,14 @@ type Site interface {
 	GetConfig() map[string]interface{}
 	GetData() map[string]interface{}
 	SetData(key string, value interface{})
+	GetParams() map[string]interface{}
+	GetLocales() Locales
+	Translate(locale, key string, args ...interface{}) string
+	GetSEO() tpl.PageMeta
+	GetRobots() RobotsConfig
+	GetContentTypes() []ContentType
+	GetRedirects() *Redirects
+	GetErrorPages() *ErrorPages
 	GetCreatedAt() time.Time
 	GetUpdatedAt() time.Time
 	SetUpdatedAt(t time.Time)
@@ -134,15 +157,90 @@ func (s *site) GetTemplateEngine() tpl.TemplateEngine {
 	return s.TemplateEngine
 }
 
+// GetData returns the tree of data files under data/, with the values set by SetData
 func (s *site) GetData() map[string]interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	// Return a copy to prevent external modification
 	dataCopy := make(map[string]interface{})
+	if s.files != nil {
+		files, _ := s.files.current()
+		maps.Copy(dataCopy, files)
+	}
 	maps.Copy(dataCopy, s.Data)
 	return dataCopy
 }
 
+// GetParams returns the custom [params] of the site's config.toml
+func (s *site) GetParams() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	paramsCopy := make(map[string]interface{})
+	if s.files != nil {
+		_, params := s.files.current()
+		maps.Copy(paramsCopy, params)
+	}
+	return paramsCopy
+}
+
+// GetLocales returns the locales the site is served in
+func (s *site) GetLocales() Locales {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.locales.All) == 0 {
+		return Locales{Default: defaultLocale, All: []string{defaultLocale}}
+	}
+	return s.locales
+}
+
+// Translate formats the message of key from the site's translation catalogs in a
+// locale, see translations.translate
+func (s *site) Translate(locale, key string, args ...interface{}) string {
+	s.mu.RLock()
+	tr := s.translations
+	s.mu.RUnlock()
+	if tr == nil {
+		return key
+	}
+	return tr.translate(locale, key, args...)
+}
+
+// GetSEO returns the defaults for the head tags of the site's pages
+func (s *site) GetSEO() tpl.PageMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seo
+}
+
+// GetRobots returns the rules of the site's robots.txt
+func (s *site) GetRobots() RobotsConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.robots
+}
+
+// GetContentTypes returns the content types the site declares
+func (s *site) GetContentTypes() []ContentType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.contentTypes
+}
+
+// GetRedirects returns the redirect rules of the site, nil if it has none loaded
+func (s *site) GetRedirects() *Redirects {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.redirects
+}
+
+// GetErrorPages returns the pages the site answers failed requests with, nil if it
+// has none loaded
+func (s *site) GetErrorPages() *ErrorPages {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.errorPages
+}
+
 func (s *site) SetData(key string, value interface{}) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,426 @@
+package site
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wispy-core/common"
+	"wispy-core/tpl"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// sitemapMaxURLs is the most URLs a sitemap file may list; larger sites get a
+	// sitemap index of files of this size
+	sitemapMaxURLs = 50000
+	// sitemapCacheDuration is how long a built sitemap is served before it is rebuilt
+	sitemapCacheDuration = time.Minute
+	// sitemapXMLNS is the namespace of sitemap files
+	sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// SitemapEntry is a URL of the sitemap that is not a static page: an entry of a
+// dynamic page, given by the values of its params, or another routable item, given
+// by its path. Both are in a locale, so paths do not have a locale prefix.
+type SitemapEntry struct {
+	Params  map[string]string // e.g. {"slug": "hello-world"} for pages/blog/[slug].html
+	Path    string            // e.g. /feeds/news.xml, for entries of a SitemapSource
+	LastMod time.Time
+}
+
+// SitemapLister lists the sitemap entries of a site in a locale
+type SitemapLister func(s Site, locale string) ([]SitemapEntry, error)
+
+var (
+	sitemapListersMu sync.RWMutex
+	sitemapListers   = make(map[string]SitemapLister)
+	sitemapSources   []SitemapLister
+)
+
+// RegisterSitemapEntries sets the lister of the entries of a dynamic page, named
+// like in RegisterPageLoader. Dynamic pages without one are not in the sitemap.
+func RegisterSitemapEntries(page string, lister SitemapLister) {
+	sitemapListersMu.Lock()
+	defer sitemapListersMu.Unlock()
+	sitemapListers[page] = lister
+}
+
+// RegisterSitemapSource adds a lister of routable items that are not pages, whose
+// entries set Path
+func RegisterSitemapSource(lister SitemapLister) {
+	sitemapListersMu.Lock()
+	defer sitemapListersMu.Unlock()
+	sitemapSources = append(sitemapSources, lister)
+}
+
+func sitemapLister(page string) SitemapLister {
+	sitemapListersMu.RLock()
+	defer sitemapListersMu.RUnlock()
+	return sitemapListers[page]
+}
+
+// siteSitemapSources returns the sitemap sources of a site with the given routable
+// pages: the entries of its content types, then the registered sources
+func siteSitemapSources(pages []localizedPage) []SitemapLister {
+	sitemapListersMu.RLock()
+	defer sitemapListersMu.RUnlock()
+	return append([]SitemapLister{contentTypeEntries(pages)}, sitemapSources...)
+}
+
+// ContentSitemapEntries lists the published entries of a content type of the
+// site's content database, with their slug as the value of param:
+//
+//	site.RegisterSitemapEntries("blog/[slug].html", site.ContentSitemapEntries("post", "slug"))
+func ContentSitemapEntries(contentType, param string) SitemapLister {
+	return func(s Site, locale string) ([]SitemapEntry, error) {
+		published, err := publishedContent(s, contentType)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]SitemapEntry, len(published))
+		for i, c := range published {
+			entries[i] = SitemapEntry{Params: map[string]string{param: c.slug}, LastMod: c.lastMod}
+		}
+		return entries, nil
+	}
+}
+
+// contentTypeEntries lists the published entries of the site's [[content_types]]
+// at their EntryPath, for the content types one of the pages serves. Content is
+// not translated, so it is listed in the default locale only.
+func contentTypeEntries(pages []localizedPage) SitemapLister {
+	return func(s Site, locale string) ([]SitemapEntry, error) {
+		contentTypes := s.GetContentTypes()
+		if len(contentTypes) == 0 || locale != s.GetLocales().Default {
+			return nil, nil
+		}
+		var entries []SitemapEntry
+		for _, ct := range contentTypes {
+			if !servesContentType(pages, ct) {
+				continue
+			}
+			published, err := publishedContent(s, ct.Name)
+			if err != nil {
+				return nil, fmt.Errorf("content type %s: %w", ct.Name, err)
+			}
+			for _, c := range published {
+				entries = append(entries, SitemapEntry{Path: ct.EntryPath(c.slug), LastMod: c.lastMod})
+			}
+		}
+		return entries, nil
+	}
+}
+
+// servesContentType reports whether one of the pages is routed at the entries of
+// a content type, e.g. pages/blog/[slug].html for a content type at /blog. The
+// entries of a content type no page serves would all be 404s.
+func servesContentType(pages []localizedPage, ct ContentType) bool {
+	shape := strings.TrimSuffix(ct.basePath(), "/") + "/{}"
+	for _, page := range pages {
+		route, err := parsePageRoute(page.path)
+		if err != nil || len(route.params) != 1 || route.params[0].catchAll {
+			continue
+		}
+		if route.shape() == shape {
+			return true
+		}
+	}
+	return false
+}
+
+// contentListing is a published entry of the content database
+type contentListing struct {
+	slug    string
+	lastMod time.Time
+}
+
+// publishedContent lists the published entries of a content type of the site's
+// content database, with when each last changed
+func publishedContent(s Site, contentType string) ([]contentListing, error) {
+	manager := s.GetDatabaseManager()
+	if manager == nil {
+		return nil, errors.New("the site has no databases")
+	}
+	db, err := manager.GetOrCreateConnection("content")
+	if err != nil {
+		return nil, err
+	}
+	return queryPublishedContent(db, contentType)
+}
+
+func queryPublishedContent(db *sql.DB, contentType string) ([]contentListing, error) {
+	rows, err := db.Query(`SELECT slug, updated_at, published_at FROM content
+		WHERE status = 'published' AND content_type = ? ORDER BY id`, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var listings []contentListing
+	for rows.Next() {
+		var slug string
+		var updatedAt, publishedAt sql.NullTime
+		if err := rows.Scan(&slug, &updatedAt, &publishedAt); err != nil {
+			return nil, err
+		}
+		listing := contentListing{slug: slug, lastMod: publishedAt.Time}
+		if updatedAt.Valid {
+			listing.lastMod = updatedAt.Time
+		}
+		listings = append(listings, listing)
+	}
+	return listings, rows.Err()
+}
+
+// sitemapURL is a URL listed in a sitemap
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// sitemapRef is a sitemap file listed in a sitemap index
+type sitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapRef `xml:"sitemap"`
+}
+
+// sitemap lists the pages of a site and the entries of its dynamic pages and
+// sitemap sources, rebuilt at most every sitemapCacheDuration
+type sitemap struct {
+	site     Site
+	pagesDir string
+	pages    []localizedPage
+
+	mu      sync.Mutex
+	builtAt time.Time
+	baseURL string
+	urls    []sitemapURL
+}
+
+// setupSitemapRoutes serves the sitemap of the routable pages and robots.txt
+func setupSitemapRoutes(router chi.Router, s Site, pagesDir string, pages []localizedPage) {
+	sm := &sitemap{site: s, pagesDir: pagesDir, pages: pages}
+	router.Get("/sitemap.xml", sm.serveIndex)
+	router.Get("/sitemap-{n}.xml", sm.servePart)
+	router.Get("/robots.txt", robotsHandler(s))
+}
+
+// current returns the URLs of the sitemap with baseURL
+func (sm *sitemap) current(baseURL string) []sitemapURL {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.urls == nil || baseURL != sm.baseURL || time.Since(sm.builtAt) >= sitemapCacheDuration {
+		sm.urls = sm.build(baseURL)
+		sm.baseURL = baseURL
+		sm.builtAt = time.Now()
+	}
+	return sm.urls
+}
+
+// build lists the URLs of the pages in each of their locales, except those the
+// front matter or robots exclude, then the entries of the sitemap sources
+func (sm *sitemap) build(baseURL string) []sitemapURL {
+	s := sm.site
+	locales := s.GetLocales()
+	seo := s.GetSEO()
+	urls := []sitemapURL{}
+
+	for _, page := range sm.pages {
+		route, err := parsePageRoute(page.path)
+		if err != nil {
+			continue
+		}
+		lister := sitemapLister(page.path)
+		if len(route.params) > 0 && lister == nil {
+			continue
+		}
+		for _, locale := range locales.All {
+			pagePath, ok := page.file(locale)
+			if !ok {
+				continue
+			}
+			meta, err := tpl.ReadPageMeta(filepath.Join(sm.pagesDir, pagePath))
+			if err != nil {
+				common.Warning("Leaving page %s out of the sitemap: %v", pagePath, err)
+				continue
+			}
+			listing, ok := sitemapListing(seo, meta)
+			if !ok {
+				continue
+			}
+
+			if len(route.params) == 0 {
+				listing.Loc = locales.URL(baseURL, locale, route.path(nil))
+				if info, err := os.Stat(filepath.Join(sm.pagesDir, pagePath)); err == nil {
+					listing.LastMod = sitemapTime(info.ModTime())
+				}
+				urls = append(urls, listing)
+				continue
+			}
+
+			entries, err := lister(s, locale)
+			if err != nil {
+				common.Error("Failed to list the sitemap entries of page %s: %v", pagePath, err)
+				continue
+			}
+			for _, entry := range entries {
+				if !sitemapEntryComplete(route, entry) {
+					continue
+				}
+				entryURL := listing
+				entryURL.Loc = locales.URL(baseURL, locale, route.path(entry.Params))
+				entryURL.LastMod = sitemapTime(entry.LastMod)
+				urls = append(urls, entryURL)
+			}
+		}
+	}
+
+	listed := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		listed[u.Loc] = true
+	}
+	for _, source := range siteSitemapSources(sm.pages) {
+		for _, locale := range locales.All {
+			entries, err := source(s, locale)
+			if err != nil {
+				common.Error("Failed to list sitemap entries of site %s: %v", s.GetName(), err)
+				continue
+			}
+			for _, entry := range entries {
+				loc := locales.URL(baseURL, locale, entry.Path)
+				// Content may also be listed by the dynamic page serving it
+				if !strings.HasPrefix(entry.Path, "/") || listed[loc] {
+					continue
+				}
+				listed[loc] = true
+				urls = append(urls, sitemapURL{Loc: loc, LastMod: sitemapTime(entry.LastMod)})
+			}
+		}
+	}
+	return urls
+}
+
+// sitemapListing returns how a page is listed, from its front matter over the
+// site's [seo] defaults, and false for pages left out of the sitemap
+func sitemapListing(seo, meta tpl.PageMeta) (sitemapURL, bool) {
+	robots := meta.Robots
+	if robots == "" {
+		robots = seo.Robots
+	}
+	if meta.Sitemap.Exclude || strings.Contains(robots, "noindex") {
+		return sitemapURL{}, false
+	}
+
+	listing := sitemapURL{ChangeFreq: seo.Sitemap.ChangeFreq}
+	if meta.Sitemap.ChangeFreq != "" {
+		listing.ChangeFreq = meta.Sitemap.ChangeFreq
+	}
+	priority := seo.Sitemap.Priority
+	if meta.Sitemap.Priority != 0 {
+		priority = meta.Sitemap.Priority
+	}
+	if priority != 0 {
+		listing.Priority = strconv.FormatFloat(priority, 'f', 1, 64)
+	}
+	return listing, true
+}
+
+// sitemapEntryComplete reports whether an entry has a value for every param of route
+func sitemapEntryComplete(route pageRoute, entry SitemapEntry) bool {
+	for _, param := range route.params {
+		if entry.Params[param.name] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// sitemapTime formats a lastmod, empty when it is not known
+func sitemapTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// siteBaseURL returns the base URL of absolute URLs of the site, like those of its
+// sitemap and feeds: the site's, or that of the request when it has none configured
+func siteBaseURL(s Site, r *http.Request) string {
+	if baseURL := s.GetBaseURL(); baseURL != "" {
+		return baseURL
+	}
+	return common.RequestBaseURL(r)
+}
+
+// serveIndex serves the sitemap, or an index of its parts once it has more URLs
+// than a sitemap file may list
+func (sm *sitemap) serveIndex(w http.ResponseWriter, r *http.Request) {
+	baseURL := siteBaseURL(sm.site, r)
+	urls := sm.current(baseURL)
+	if len(urls) <= sitemapMaxURLs {
+		writeSitemapXML(w, sitemapURLSet{XMLNS: sitemapXMLNS, URLs: urls})
+		return
+	}
+
+	index := sitemapIndex{XMLNS: sitemapXMLNS}
+	for part := 0; part*sitemapMaxURLs < len(urls); part++ {
+		ref := sitemapRef{Loc: strings.TrimSuffix(baseURL, "/") + "/sitemap-" + strconv.Itoa(part+1) + ".xml"}
+		for _, u := range sitemapPart(urls, part) {
+			if u.LastMod > ref.LastMod {
+				ref.LastMod = u.LastMod
+			}
+		}
+		index.Sitemaps = append(index.Sitemaps, ref)
+	}
+	writeSitemapXML(w, index)
+}
+
+// servePart serves a part of a sitemap with an index, numbered from 1
+func (sm *sitemap) servePart(w http.ResponseWriter, r *http.Request) {
+	urls := sm.current(siteBaseURL(sm.site, r))
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || n < 1 || len(urls) <= sitemapMaxURLs || (n-1)*sitemapMaxURLs >= len(urls) {
+		sm.site.GetErrorPages().Serve(w, r, http.StatusNotFound, nil)
+		return
+	}
+	writeSitemapXML(w, sitemapURLSet{XMLNS: sitemapXMLNS, URLs: sitemapPart(urls, n-1)})
+}
+
+// sitemapPart returns the URLs of a part of the sitemap, numbered from 0
+func sitemapPart(urls []sitemapURL, part int) []sitemapURL {
+	start := part * sitemapMaxURLs
+	return urls[start:min(start+sitemapMaxURLs, len(urls))]
+}
+
+// writeSitemapXML writes a sitemap or sitemap index
+func writeSitemapXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	if err := encoder.Encode(v); err != nil {
+		common.Error("Failed to write sitemap: %v", err)
+	}
+}
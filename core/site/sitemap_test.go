@@ -0,0 +1,239 @@
+package site
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wispy-core/tpl"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSitemapListing(t *testing.T) {
+	seo := tpl.PageMeta{Sitemap: tpl.SitemapMeta{ChangeFreq: "weekly", Priority: 0.5}}
+	tests := []struct {
+		name   string
+		seo    tpl.PageMeta
+		meta   tpl.PageMeta
+		want   sitemapURL
+		wantOk bool
+	}{
+		{"defaults", seo, tpl.PageMeta{}, sitemapURL{ChangeFreq: "weekly", Priority: "0.5"}, true},
+		{"front matter", seo, tpl.PageMeta{Sitemap: tpl.SitemapMeta{ChangeFreq: "daily", Priority: 0.9}}, sitemapURL{ChangeFreq: "daily", Priority: "0.9"}, true},
+		{"excluded", seo, tpl.PageMeta{Sitemap: tpl.SitemapMeta{Exclude: true}}, sitemapURL{}, false},
+		{"noindex", seo, tpl.PageMeta{Robots: "noindex, nofollow"}, sitemapURL{}, false},
+		{"noindex site", tpl.PageMeta{Robots: "noindex"}, tpl.PageMeta{}, sitemapURL{}, false},
+		{"indexed over site", tpl.PageMeta{Robots: "noindex"}, tpl.PageMeta{Robots: "index"}, sitemapURL{}, true},
+	}
+	for _, tt := range tests {
+		got, ok := sitemapListing(tt.seo, tt.meta)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("%s: sitemapListing() = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"pages/index.html":          `{{define "body"}}{{end}}`,
+		"pages/about.html":          "+++\n[sitemap]\npriority = 0.8\n+++\n{{define \"body\"}}{{end}}",
+		"pages/about.fr.html":       `{{define "body"}}{{end}}`,
+		"pages/drafts.html":         "+++\n[sitemap]\nexclude = true\n+++\n{{define \"body\"}}{{end}}",
+		"pages/blog/[slug].html":    `{{define "body"}}{{end}}`,
+		"pages/tags/[tag].html":     `{{define "body"}}{{end}}`,
+		"pages/docs/[...path].html": `{{define "body"}}{{end}}`,
+	})
+	updated := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	RegisterSitemapEntries("blog/[slug].html", func(s Site, locale string) ([]SitemapEntry, error) {
+		return []SitemapEntry{
+			{Params: map[string]string{"slug": "hello-" + locale}, LastMod: updated},
+			{Params: map[string]string{}},
+		}, nil
+	})
+	RegisterSitemapEntries("docs/[...path].html", func(s Site, locale string) ([]SitemapEntry, error) {
+		if locale != "en" {
+			return nil, nil
+		}
+		return []SitemapEntry{{Params: map[string]string{"path": "guides/setup"}}}, nil
+	})
+	t.Cleanup(func() {
+		sitemapListersMu.Lock()
+		delete(sitemapListers, "blog/[slug].html")
+		delete(sitemapListers, "docs/[...path].html")
+		sitemapListersMu.Unlock()
+	})
+	_, router := newTestSite(t, root)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("status = %d, content type = %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+		"<loc>https://example.com/</loc><lastmod>",
+		"<loc>https://example.com/fr</loc>",
+		"<loc>https://example.com/about</loc><lastmod>",
+		"<priority>0.8</priority>",
+		"<loc>https://example.com/fr/about</loc>",
+		"<loc>https://example.com/blog/hello-en</loc><lastmod>2026-03-01T12:00:00Z</lastmod>",
+		"<loc>https://example.com/fr/blog/hello-fr</loc>",
+		"<loc>https://example.com/docs/guides/setup</loc>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("sitemap does not contain %s\n%s", want, body)
+		}
+	}
+	for _, unwanted := range []string{"drafts", "/tags/", "/blog/</loc>", "/fr/docs"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("sitemap contains %s\n%s", unwanted, body)
+		}
+	}
+
+	// Without an index there are no parts
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/sitemap-1.xml", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/sitemap-1.xml status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	s := &site{Domain: "example.com", BaseURL: "https://example.com"}
+	urls := make([]sitemapURL, sitemapMaxURLs+10)
+	for i := range urls {
+		urls[i] = sitemapURL{Loc: fmt.Sprintf("https://example.com/p/%d", i)}
+	}
+	urls[sitemapMaxURLs+1].LastMod = "2026-03-01T12:00:00Z"
+	sm := &sitemap{site: s, urls: urls, baseURL: "https://example.com", builtAt: time.Now()}
+	router := chi.NewRouter()
+	router.Get("/sitemap.xml", sm.serveIndex)
+	router.Get("/sitemap-{n}.xml", sm.servePart)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	want := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap><sitemap><loc>https://example.com/sitemap-2.xml</loc><lastmod>2026-03-01T12:00:00Z</lastmod></sitemap></sitemapindex>`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("sitemap index = %s, want %s", w.Body.String(), want)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantURLs   int
+	}{
+		{"/sitemap-1.xml", http.StatusOK, sitemapMaxURLs},
+		{"/sitemap-2.xml", http.StatusOK, 10},
+		{"/sitemap-3.xml", http.StatusNotFound, 0},
+		{"/sitemap-0.xml", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s status = %d, want %d", tt.path, w.Code, tt.wantStatus)
+			continue
+		}
+		if got := strings.Count(w.Body.String(), "<url>"); tt.wantStatus == http.StatusOK && got != tt.wantURLs {
+			t.Errorf("%s lists %d URLs, want %d", tt.path, got, tt.wantURLs)
+		}
+	}
+}
+
+func TestRobots(t *testing.T) {
+	config := RobotsConfig{
+		RobotsRules: RobotsRules{Disallow: []string{"/drafts"}, CrawlDelay: 5},
+		Agents: map[string]RobotsRules{
+			"GPTBot":    {Disallow: []string{"/"}},
+			"Googlebot": {},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := "User-agent: *\nDisallow: /drafts\nCrawl-delay: 5\n\n" +
+		"User-agent: GPTBot\nDisallow: /\n\n" +
+		"User-agent: Googlebot\nDisallow:\n\n" +
+		"Sitemap: https://example.com/sitemap.xml\n"
+	if got := robotsTxt(config, "https://example.com/sitemap.xml"); got != want {
+		t.Errorf("robotsTxt() = %q, want %q", got, want)
+	}
+
+	for _, invalid := range []RobotsConfig{
+		{RobotsRules: RobotsRules{Allow: []string{"drafts"}}},
+		{Agents: map[string]RobotsRules{"GPTBot": {CrawlDelay: -1}}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Validate() accepted %+v", invalid)
+		}
+	}
+
+	s := &site{Domain: "example.com", BaseURL: "https://example.com/", robots: config}
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"local", "User-agent: *\nDisallow: /\n"},
+		{"staging", "User-agent: *\nDisallow: /\n"},
+		{"production", want},
+	}
+	for _, tt := range tests {
+		t.Setenv("ENV", tt.env)
+		w := httptest.NewRecorder()
+		robotsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+		if w.Body.String() != tt.want {
+			t.Errorf("ENV=%s: robots.txt = %q, want %q", tt.env, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestSitemapContentTypes(t *testing.T) {
+	root := t.TempDir()
+	writeDataFiles(t, root, map[string]string{
+		"pages/index.html":       `{{define "body"}}{{end}}`,
+		"pages/blog/[slug].html": `{{define "body"}}{{end}}`,
+	})
+	s, router := newTestSite(t, root, ContentType{Name: "post", Path: "/blog"}, ContentType{Name: "page"})
+	s.DbManager = NewDatabaseManagerInDir(s.Domain, t.TempDir())
+	t.Cleanup(func() { s.DbManager.Close() })
+	db, err := s.DbManager.GetOrCreateConnection("content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO content (uuid, slug, title, content, content_type, status, published_at, updated_at) VALUES
+		('a1', 'first', 'First', '', 'post', 'published', '2026-01-01 10:00:00', '2026-01-02 10:00:00'),
+		('b2', 'draft', 'Draft', '', 'post', 'draft', NULL, '2026-01-03 10:00:00'),
+		('c3', 'about', 'About', '', 'page', 'published', '2026-02-01 10:00:00', NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dynamic page listing the same entries does not list them twice
+	RegisterSitemapEntries("blog/[slug].html", ContentSitemapEntries("post", "slug"))
+	t.Cleanup(func() {
+		sitemapListersMu.Lock()
+		delete(sitemapListers, "blog/[slug].html")
+		sitemapListersMu.Unlock()
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"<loc>https://example.com/blog/first</loc><lastmod>2026-01-02T10:00:00Z</lastmod>",
+	} {
+		if strings.Count(body, want) != 1 {
+			t.Errorf("sitemap does not contain %s once\n%s", want, body)
+		}
+	}
+	// No page serves the entries of page, they would be 404s
+	for _, unwanted := range []string{"draft", "/page/about"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("sitemap contains %s\n%s", unwanted, body)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 	"wispy-core/common"
 	"wispy-core/config"
+	"wispy-core/core/tenant/databases"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -170,7 +171,7 @@ func (dp *CMSDataProvider) initializeFormsDB(db *sql.DB) error {
 		}
 	}
 
-	return nil
+	return databases.ApplyMigrations(db, "forms")
 }
 
 // GetDashboardStats returns statistics for the dashboard
@@ -297,12 +298,22 @@ func (dp *CMSDataProvider) GetSubmissionsStats(ctx context.Context) (*Submission
 		stats.WeeklyChange = "↗︎ New"
 	}
 
-	// For now, all submissions are considered "read" by default
-	// In a real implementation, you'd add a "read" column to track this
-	stats.UnreadSubmissions = 0
+	// Get inbox counts
+	err = db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM form_submissions WHERE status = 'new'",
+	).Scan(&stats.UnreadSubmissions)
+	if err != nil && err != sql.ErrNoRows {
+		common.Error("Failed to get unread submissions: %v", err)
+		stats.UnreadSubmissions = 0
+	}
 
-	// Spam filtering would require additional logic/integration
-	stats.SpamFiltered = 0
+	err = db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM form_submissions WHERE status = 'spam'",
+	).Scan(&stats.SpamFiltered)
+	if err != nil && err != sql.ErrNoRows {
+		common.Error("Failed to get spam submissions: %v", err)
+		stats.SpamFiltered = 0
+	}
 
 	return stats, nil
 }
@@ -425,7 +436,7 @@ func (dp *CMSDataProvider) GetSubmissions(ctx context.Context, formFilter, statu
 
 	query := `
 		SELECT fs.uuid, f.name, fs.first_name, fs.last_name, fs.email, 
-		       fs.subject, fs.message, fs.created_at
+		       fs.subject, fs.message, fs.created_at, fs.status
 		FROM form_submissions fs
 		JOIN forms f ON fs.form_id = f.id
 		WHERE 1=1
@@ -439,6 +450,17 @@ func (dp *CMSDataProvider) GetSubmissions(ctx context.Context, formFilter, statu
 		args = append(args, formFilter)
 	}
 
+	// The inbox hides archived and spam submissions unless asked for
+	switch statusFilter {
+	case "":
+		query += " AND fs.status NOT IN ('archived', 'spam')"
+	case "unread":
+		query += " AND fs.status = 'new'"
+	default:
+		query += " AND fs.status = ?"
+		args = append(args, statusFilter)
+	}
+
 	query += " ORDER BY fs.created_at DESC"
 
 	if limit > 0 {
@@ -456,6 +478,7 @@ func (dp *CMSDataProvider) GetSubmissions(ctx context.Context, formFilter, statu
 		var submission SubmissionItem
 		var firstName, lastName, subject, message sql.NullString
 		var createdAt time.Time
+		var status string
 
 		err := rows.Scan(
 			&submission.ID,
@@ -466,6 +489,7 @@ func (dp *CMSDataProvider) GetSubmissions(ctx context.Context, formFilter, statu
 			&subject,
 			&message,
 			&createdAt,
+			&status,
 		)
 		if err != nil {
 			common.Error("Failed to scan submission: %v", err)
@@ -505,8 +529,7 @@ func (dp *CMSDataProvider) GetSubmissions(ctx context.Context, formFilter, statu
 
 		submission.Date = createdAt.Format("Jan 02, 2006")
 		submission.TimeAgo = formatTimeAgo(createdAt)
-		submission.Status = "New" // Simplified for now
-		submission.StatusStyle = "badge-warning"
+		submission.Status, submission.StatusStyle = submissionStatusDisplay(status)
 
 		submissions = append(submissions, submission)
 	}
@@ -514,6 +537,24 @@ func (dp *CMSDataProvider) GetSubmissions(ctx context.Context, formFilter, statu
 	return submissions, nil
 }
 
+// submissionStatusDisplay returns the label and badge style for an inbox status
+func submissionStatusDisplay(status string) (string, string) {
+	switch status {
+	case "new":
+		return "New", "badge-warning"
+	case "read":
+		return "Read", "badge-success"
+	case "replied":
+		return "Replied", "badge-info"
+	case "archived":
+		return "Archived", "badge-ghost"
+	case "spam":
+		return "Spam", "badge-error"
+	default:
+		return "New", "badge-warning"
+	}
+}
+
 // formatTimeAgo formats a time as a human-readable "time ago" string
 func formatTimeAgo(t time.Time) string {
 	now := time.Now()
@@ -2,9 +2,15 @@ package app
 
 import (
 	"fmt"
+	"html"
+	"html/template"
 	"net/http"
+	"strconv"
+	"strings"
 	"wispy-core/auth"
 	"wispy-core/common"
+	"wispy-core/core/apiv1/forms"
+	"wispy-core/core/site"
 	"wispy-core/core/tenant/app/providers"
 	"wispy-core/tpl"
 
@@ -205,57 +211,32 @@ func FormSubmissionsHandler(cms WispyCms) http.HandlerFunc {
 
 		// Convert submissions to table format
 		submissionRows := make([]map[string]interface{}, 0, len(submissions))
-		for _, submission := range submissions {
-			statusBadge := ""
-			if submission.Status == "New" {
-				statusBadge = `<span class="badge badge-warning">New</span>`
-			} else if submission.Status == "Read" {
-				statusBadge = `<span class="badge badge-success">Read</span>`
-			} else {
-				statusBadge = `<span class="badge badge-info">Processed</span>`
+		searchEngine := ""
+		if searchQuery != "" {
+			submissionRows, searchEngine, err = searchSubmissionRows(siteInstance, searchQuery, formFilter, statusFilter)
+			if err != nil {
+				common.Error("Failed to search submissions: %v", err)
 			}
-
-			nameWithInitials := fmt.Sprintf(`<div class="flex items-center gap-3">
-				<div class="avatar placeholder">
-					<div class="bg-neutral text-neutral-content rounded-full w-8 h-8">
-						<span class="text-xs">%s</span>
-					</div>
-				</div>
-				<div>
-					<div class="font-medium">%s</div>
-					<div class="text-sm text-base-content/70">%s</div>
-				</div>
-			</div>`, submission.Initials, submission.Name, submission.Email)
-
-			submissionRows = append(submissionRows, map[string]interface{}{
-				"id": submission.ID,
-				"columns": []map[string]interface{}{
-					{
-						"text": submission.FormName,
-					},
-					{
-						"html": nameWithInitials,
-					},
-					{
-						"text": submission.Email,
-					},
-					{
-						"text": submission.Subject,
-					},
-					{
-						"text": submission.Date,
-						"html": fmt.Sprintf(`<div>
-							<div>%s</div>
-							<div class="text-sm text-base-content/70">%s</div>
-						</div>`, submission.Date, submission.TimeAgo),
-					},
-					{
-						"html": statusBadge,
-					},
-				},
-			})
+			submissions = nil
+		}
+		for _, submission := range submissions {
+			submissionRows = append(submissionRows, submissionRow{
+				ID:          submission.ID,
+				FormName:    submission.FormName,
+				Name:        submission.Name,
+				Initials:    submission.Initials,
+				Email:       submission.Email,
+				Subject:     submission.Subject,
+				Date:        submission.Date,
+				TimeAgo:     submission.TimeAgo,
+				Status:      submission.Status,
+				StatusStyle: submission.StatusStyle,
+				Unread:      submission.Status == "New",
+			}.tableRow())
 		}
 
+		submissionRows, pagination := paginateRows(r, submissionRows, submissionsPageSize)
+
 		data := tpl.TemplateData{
 			Title:       "Form Submissions",
 			Description: "View Form Submissions",
@@ -282,13 +263,9 @@ func FormSubmissionsHandler(cms WispyCms) http.HandlerFunc {
 				"DateRange":    dateRange,
 				"StatusFilter": statusFilter,
 				"Search":       searchQuery,
+				"SearchEngine": searchEngine,
 				"Submissions":  submissionRows,
-				"Pagination": map[string]interface{}{
-					"current": 1,
-					"total":   1,
-					"hasPrev": false,
-					"hasNext": false,
-				},
+				"Pagination":   pagination,
 			},
 		}
 
@@ -298,6 +275,11 @@ func FormSubmissionsHandler(cms WispyCms) http.HandlerFunc {
 			data.Data[key] = value
 		}
 
+		// Filtering and paging only swap the submissions table
+		if serveCMSFragment(w, r, engine, pagePath, layoutPath, data) {
+			return
+		}
+
 		state, err := renderCMSTemplate(engine, pagePath, layoutPath, data, cms.GetTheme())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -309,6 +291,42 @@ func FormSubmissionsHandler(cms WispyCms) http.HandlerFunc {
 	}
 }
 
+// submissionsPageSize is the number of submissions per page of the inbox
+const submissionsPageSize = 25
+
+// paginateRows returns one page of table rows, picked by the page query parameter,
+// and the table's pagination with links that keep the request's filters
+func paginateRows(r *http.Request, rows []map[string]interface{}, pageSize int) ([]map[string]interface{}, map[string]interface{}) {
+	total := max(1, (len(rows)+pageSize-1)/pageSize)
+	current, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || current < 1 {
+		current = 1
+	}
+	current = min(current, total)
+
+	pageURL := func(page int) string {
+		query := r.URL.Query()
+		query.Del(tpl.FragmentParam)
+		query.Set("page", strconv.Itoa(page))
+		return r.URL.Path + "?" + query.Encode()
+	}
+	pagination := map[string]interface{}{
+		"current": current,
+		"total":   total,
+		"hasPrev": current > 1,
+		"hasNext": current < total,
+	}
+	if current > 1 {
+		pagination["prevUrl"] = pageURL(current - 1)
+	}
+	if current < total {
+		pagination["nextUrl"] = pageURL(current + 1)
+	}
+
+	start := (current - 1) * pageSize
+	return rows[start:min(start+pageSize, len(rows))], pagination
+}
+
 func FormSubmissionByIdHandler(cms WispyCms) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get current user from context
@@ -376,3 +394,124 @@ func FormSubmissionByIdHandler(cms WispyCms) http.HandlerFunc {
 		tpl.HtmlBaseRender(w, state)
 	}
 }
+
+// searchSubmissionRows runs a full-text search and converts the results to table
+// rows, showing the highlighted snippet in place of the subject
+func searchSubmissionRows(siteInstance site.Site, query, formFilter, statusFilter string) ([]map[string]interface{}, string, error) {
+	rows := []map[string]interface{}{}
+
+	dbManager := siteInstance.GetDatabaseManager()
+	if dbManager == nil {
+		return rows, "", common.NewError("database manager not available")
+	}
+	db, err := dbManager.GetOrCreateConnection("forms")
+	if err != nil {
+		return rows, "", err
+	}
+
+	results, err := forms.FindSubmissions(db, siteInstance.GetDomain(), query, forms.InboxFilter{
+		Status: statusFilter,
+		FormID: formFilter,
+	})
+	if err != nil {
+		return rows, "", err
+	}
+
+	for _, result := range results.Results {
+		name := strings.TrimSpace(derefString(result.FirstName) + " " + derefString(result.LastName))
+		if name == "" {
+			name = "Anonymous"
+		}
+		initials := "A"
+		if result.FirstName != nil || result.LastName != nil {
+			initials = ""
+			for _, field := range strings.Fields(name)[:min(len(strings.Fields(name)), 2)] {
+				initials += strings.ToUpper(string([]rune(field)[0]))
+			}
+		}
+		status, statusStyle := submissionStatusDisplay(result.Status)
+
+		rows = append(rows, submissionRow{
+			ID:       result.ID,
+			FormName: result.FormName,
+			Name:     name,
+			Initials: initials,
+			Email:    result.Email,
+			Subject:  derefString(result.Subject),
+			// The snippet is escaped by the search, only <mark> tags are added
+			Snippet:     template.HTML(result.Snippet),
+			Date:        result.CreatedAt.Format("Jan 02, 2006"),
+			TimeAgo:     formatTimeAgo(result.CreatedAt),
+			Status:      status,
+			StatusStyle: statusStyle,
+			Unread:      result.Status == forms.StatusNew,
+		}.tableRow())
+	}
+
+	return rows, results.Engine, nil
+}
+
+// submissionRow is a submission as shown in the inbox table
+type submissionRow struct {
+	ID, FormName, Name, Initials, Email, Subject string
+	Snippet                                      template.HTML // matched text of a search, shown below the subject
+	Date, TimeAgo                                string
+	Status, StatusStyle                          string
+	Unread                                       bool
+}
+
+// tableRow returns the row of the table component
+func (row submissionRow) tableRow() map[string]interface{} {
+	rowClass := ""
+	if row.Unread {
+		rowClass = "font-semibold"
+	}
+	return map[string]interface{}{
+		"id":    row.ID,
+		"class": rowClass,
+		"columns": []map[string]interface{}{
+			{
+				"text": row.FormName,
+			},
+			{
+				"html": template.HTML(fmt.Sprintf(`<div class="flex items-center gap-3">
+					<div class="avatar placeholder">
+						<div class="bg-neutral text-neutral-content rounded-full w-8 h-8">
+							<span class="text-xs">%s</span>
+						</div>
+					</div>
+					<div>
+						<div class="font-medium">%s</div>
+						<div class="text-sm text-base-content/70">%s</div>
+					</div>
+				</div>`, html.EscapeString(row.Initials), html.EscapeString(row.Name), html.EscapeString(row.Email))),
+			},
+			{
+				"text": row.Email,
+			},
+			{
+				"html": template.HTML(fmt.Sprintf(`<div>
+					<div>%s</div>
+					<div class="text-sm text-base-content/70">%s</div>
+				</div>`, html.EscapeString(row.Subject), row.Snippet)),
+			},
+			{
+				"text": row.Date,
+				"html": template.HTML(fmt.Sprintf(`<div>
+					<div>%s</div>
+					<div class="text-sm text-base-content/70">%s</div>
+				</div>`, html.EscapeString(row.Date), html.EscapeString(row.TimeAgo))),
+			},
+			{
+				"html": template.HTML(fmt.Sprintf(`<span class="badge %s">%s</span>`, html.EscapeString(row.StatusStyle), html.EscapeString(row.Status))),
+			},
+		},
+	}
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
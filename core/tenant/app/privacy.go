@@ -0,0 +1,179 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"wispy-core/auth"
+	"wispy-core/common"
+	"wispy-core/core/apiv1/privacy"
+	"wispy-core/core/site"
+	"wispy-core/tpl"
+)
+
+// PrivacyHandler lets CMS users answer data subject access and erasure requests
+func PrivacyHandler(cms WispyCms) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get current user from context
+		user, err := auth.UserFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		domain := common.NormalizeHost(r.Host)
+		siteInstance, err := cms.GetSiteManager().GetSite(domain)
+		if err != nil {
+			http.Error(w, "Site not found for domain "+domain, http.StatusNotFound)
+			return
+		}
+
+		pageData := map[string]interface{}{
+			"__styles":    []string{},
+			"__scripts":   []string{},
+			"__inlineCSS": "",
+			"user":        user,
+			"pageTitle":   "Privacy Requests",
+		}
+
+		if r.Method == http.MethodPost {
+			email := strings.TrimSpace(r.FormValue("email"))
+			pageData["Email"] = email
+
+			switch action := r.FormValue("action"); action {
+			case "lookup":
+				report, err := privacy.Find(siteInstance, email)
+				if err != nil {
+					pageData["hasError"] = true
+					pageData["errorMessage"] = err.Error()
+					break
+				}
+				pageData["Report"] = true
+				pageData["Counts"] = privacyCountRows(report.Counts)
+				pageData["TotalRecords"] = len(report.Records)
+				pageData["TotalFiles"] = len(report.Files)
+			case privacy.FormatJSON, privacy.FormatZip:
+				report, err := privacy.Find(siteInstance, email)
+				if err != nil {
+					pageData["hasError"] = true
+					pageData["errorMessage"] = err.Error()
+					break
+				}
+				privacy.RecordExport(siteInstance, report, privacy.SourceCMS, user.ID)
+				privacy.ServeExport(w, r, siteInstance, report, action)
+				return
+			case privacy.ActionErase, privacy.ActionAnonymise:
+				if !strings.EqualFold(strings.TrimSpace(r.FormValue("confirm")), email) {
+					pageData["hasError"] = true
+					pageData["errorMessage"] = "Type the email address again to confirm."
+					break
+				}
+				request, err := privacy.Erase(siteInstance, email, action, privacy.SourceCMS, user.ID)
+				if err != nil {
+					pageData["hasError"] = true
+					pageData["errorMessage"] = err.Error()
+					break
+				}
+				total := 0
+				for _, count := range request.Summary {
+					total += count
+				}
+				pageData["hasSuccess"] = true
+				pageData["successMessage"] = fmt.Sprintf("Request %s completed: %d record(s) %s.", request.ID, total, pastTense(action))
+				pageData["Email"] = ""
+			default:
+				pageData["hasError"] = true
+				pageData["errorMessage"] = "Unknown action"
+			}
+		}
+
+		pageData["Requests"] = privacyRequestRows(siteInstance)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := tpl.TemplateData{
+			Title:       "Privacy Requests",
+			Description: "Data subject access and erasure",
+			Site: tpl.SiteData{
+				Name:    "Wispy CMS",
+				Domain:  domain,
+				BaseURL: "https://" + domain,
+			},
+			Content: "",
+			Data:    pageData,
+		}
+
+		state, err := renderCMSTemplate(cms.GetTemplateEngine(), "privacy/index.html", "default.html", data, cms.GetTheme())
+		if err != nil {
+			http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		state.SetHeadTitle("Wispy CMS ~ Privacy Requests")
+		tpl.HtmlBaseRender(w, state)
+	}
+}
+
+// privacyCountRows converts "database.table" counts to table rows
+func privacyCountRows(counts map[string]int) []map[string]interface{} {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		database, table, _ := strings.Cut(key, ".")
+		rows = append(rows, map[string]interface{}{
+			"id": key,
+			"columns": []map[string]interface{}{
+				{"text": database},
+				{"text": table},
+				{"text": fmt.Sprintf("%d", counts[key])},
+			},
+		})
+	}
+	return rows
+}
+
+// privacyRequestRows converts the audit log to table rows
+func privacyRequestRows(siteInstance site.Site) []map[string]interface{} {
+	requests, err := privacy.ListRequests(siteInstance, "", 50)
+	if err != nil {
+		common.Error("Failed to list data subject requests: %v", err)
+		return []map[string]interface{}{}
+	}
+
+	rows := make([]map[string]interface{}, 0, len(requests))
+	for _, request := range requests {
+		total := 0
+		for _, count := range request.Summary {
+			total += count
+		}
+		status := request.Status
+		if request.Error != "" {
+			status += ": " + request.Error
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"id": request.ID,
+			"columns": []map[string]interface{}{
+				{"text": request.CreatedAt.Format("Jan 02, 2006 15:04")},
+				{"text": request.Action},
+				{"text": request.EmailHash[:12]},
+				{"text": fmt.Sprintf("%d", total)},
+				{"text": request.Source + " / " + request.Actor},
+				{"text": status},
+			},
+		})
+	}
+	return rows
+}
+
+func pastTense(action string) string {
+	if action == privacy.ActionAnonymise {
+		return "anonymised"
+	}
+	return "erased"
+}
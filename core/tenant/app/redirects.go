@@ -0,0 +1,144 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"wispy-core/auth"
+	"wispy-core/common"
+	"wispy-core/core/site"
+	"wispy-core/tpl"
+)
+
+// RedirectsHandler lists the redirect rules of a site with their hits, and adds
+// and removes the rules managed from the CMS
+func RedirectsHandler(cms WispyCms) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get current user from context
+		user, err := auth.UserFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		domain := common.NormalizeHost(r.Host)
+		siteInstance, err := cms.GetSiteManager().GetSite(domain)
+		if err != nil {
+			http.Error(w, "Site not found for domain "+domain, http.StatusNotFound)
+			return
+		}
+		redirects := siteInstance.GetRedirects()
+		if redirects == nil {
+			http.Error(w, "Redirects are not available for "+domain, http.StatusNotFound)
+			return
+		}
+
+		pageData := map[string]interface{}{
+			"__styles":    []string{},
+			"__scripts":   []string{},
+			"__inlineCSS": "",
+			"user":        user,
+			"pageTitle":   "Redirects",
+			"Rule":        site.RedirectRule{Match: site.MatchExact}, // values of the add form
+		}
+
+		if r.Method == http.MethodPost {
+			switch r.FormValue("action") {
+			case "add":
+				status, _ := strconv.Atoi(r.FormValue("status"))
+				rule := site.RedirectRule{
+					From:      strings.TrimSpace(r.FormValue("from")),
+					To:        strings.TrimSpace(r.FormValue("to")),
+					Match:     r.FormValue("match"),
+					Status:    status,
+					Rewrite:   r.FormValue("status") == "rewrite",
+					DropQuery: r.FormValue("drop_query") == "on",
+				}
+				if err := redirects.Add(rule); err != nil {
+					pageData["hasError"] = true
+					pageData["errorMessage"] = err.Error()
+					pageData["Rule"] = rule
+					break
+				}
+				pageData["hasSuccess"] = true
+				pageData["successMessage"] = "Added the redirect from " + rule.From
+			case "remove":
+				if err := redirects.Remove(r.FormValue("rule")); err != nil {
+					pageData["hasError"] = true
+					pageData["errorMessage"] = err.Error()
+					break
+				}
+				pageData["hasSuccess"] = true
+				pageData["successMessage"] = "Removed the redirect"
+			default:
+				pageData["hasError"] = true
+				pageData["errorMessage"] = "Unknown action"
+			}
+		}
+
+		rules := redirects.Rules()
+		pageData["Rules"] = redirectRows(rules, redirects.Hits())
+		pageData["TotalRules"] = len(rules)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := tpl.TemplateData{
+			Title:       "Redirects",
+			Description: "Manage redirects and rewrites",
+			Site: tpl.SiteData{
+				Name:    "Wispy CMS",
+				Domain:  domain,
+				BaseURL: "https://" + domain,
+			},
+			Content: "",
+			Data:    pageData,
+		}
+
+		state, err := renderCMSTemplate(cms.GetTemplateEngine(), "redirects/index.html", "default.html", data, cms.GetTheme())
+		if err != nil {
+			http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		state.SetHeadTitle("Wispy CMS ~ Redirects")
+		tpl.HtmlBaseRender(w, state)
+	}
+}
+
+// redirectRows converts redirect rules to table rows. Rules of redirects.toml can
+// be removed, those of config.toml are edited in the file.
+func redirectRows(rules []site.RedirectRule, hits map[string]int64) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		status := strconv.Itoa(rule.Status)
+		if rule.Rewrite {
+			status = "rewrite"
+		}
+		if rule.DropQuery {
+			status += ", drops query"
+		}
+
+		action := template.HTML(`<span class="text-sm text-base-content/70">` + html.EscapeString(rule.Source) + `</span>`)
+		if rule.Source == "redirects.toml" {
+			action = template.HTML(fmt.Sprintf(`<form method="POST" action="/wispy-cms/redirects">
+				<input type="hidden" name="rule" value="%s" />
+				<button type="submit" name="action" value="remove" class="btn btn-ghost btn-xs text-error">Remove</button>
+			</form>`, html.EscapeString(rule.Key())))
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"id": rule.Key(),
+			"columns": []map[string]interface{}{
+				{"text": rule.From},
+				{"text": rule.To},
+				{"text": rule.Match},
+				{"text": status},
+				{"text": fmt.Sprintf("%d", hits[rule.Key()])},
+				{"html": action},
+			},
+		})
+	}
+	return rows
+}
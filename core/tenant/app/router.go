@@ -31,6 +31,11 @@ func RegisterAppRoutes(router chi.Router, siteManager site.SiteManager) chi.Rout
 		r.Get("/forms", FormsHandler(cms))
 		r.Get("/forms/submissions", FormSubmissionsHandler(cms))
 		r.Get("/forms/submissions/{formID}", FormSubmissionByIdHandler(cms))
+		r.Get("/subscribers", SubscribersHandler(cms))
+		r.Get("/privacy", PrivacyHandler(cms))
+		r.Post("/privacy", PrivacyHandler(cms))
+		r.Get("/redirects", RedirectsHandler(cms))
+		r.Post("/redirects", RedirectsHandler(cms))
 		r.Get("/debug", DebugHandler(cms))
 	})
 
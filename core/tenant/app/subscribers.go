@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"wispy-core/auth"
+	"wispy-core/common"
+	"wispy-core/core/apiv1/subscribers"
+	"wispy-core/tpl"
+)
+
+func SubscribersHandler(cms WispyCms) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get current user from context
+		user, err := auth.UserFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		engine := cms.GetTemplateEngine()
+		pagePath := "subscribers/index.html"
+		layoutPath := "default.html"
+
+		domain := common.NormalizeHost(r.Host)
+		siteInstance, err := cms.GetSiteManager().GetSite(domain)
+		if err != nil {
+			http.Error(w, "Site not found for domain "+domain, http.StatusNotFound)
+			return
+		}
+
+		lists := []subscribers.List{}
+		if db, err := subscribers.GetDB(siteInstance); err != nil {
+			common.Error("Failed to open subscribers database: %v", err)
+		} else if lists, err = subscribers.GetLists(db); err != nil {
+			common.Error("Failed to get subscriber lists: %v", err)
+			lists = []subscribers.List{}
+		}
+
+		// Convert lists to table format
+		totalSubscribed, totalPending := 0, 0
+		listRows := make([]map[string]interface{}, 0, len(lists))
+		for _, list := range lists {
+			totalSubscribed += list.Subscribed
+			totalPending += list.Pending
+			exportURL := "/api/v1/subscribers/lists/" + url.PathEscape(list.ID) + "/export"
+
+			listRows = append(listRows, map[string]interface{}{
+				"id": list.ID,
+				"columns": []map[string]interface{}{
+					{
+						"text": list.Title,
+						"html": template.HTML(fmt.Sprintf(`<div><strong>%s</strong><br><span class="text-sm text-base-content/70">%s</span></div>`, html.EscapeString(list.Title), html.EscapeString(list.Name))),
+					},
+					{
+						"text": fmt.Sprintf("%d", list.Subscribed),
+					},
+					{
+						"text": fmt.Sprintf("%d", list.Pending),
+					},
+					{
+						"text": fmt.Sprintf("%d", list.Unsubscribed),
+					},
+					{
+						"html": template.HTML(fmt.Sprintf(`<div class="flex gap-2">
+							<a class="btn btn-outline btn-xs" href="%s?status=subscribed">Export confirmed</a>
+							<a class="btn btn-ghost btn-xs" href="%s">Export all</a>
+						</div>`, html.EscapeString(exportURL), html.EscapeString(exportURL))),
+					},
+				},
+			})
+		}
+
+		data := tpl.TemplateData{
+			Title:       "Subscribers",
+			Description: "Manage Mailing Lists",
+			Site: tpl.SiteData{
+				Name:    "Wispy CMS",
+				Domain:  domain,
+				BaseURL: "https://" + domain,
+			},
+			Content: "",
+			Data: map[string]interface{}{
+				"__styles":    []string{},
+				"__scripts":   []string{},
+				"__inlineCSS": "",
+				"user":        user,
+				"pageTitle":   "Subscribers",
+				"Stats": map[string]interface{}{
+					"totalLists": len(lists),
+					"subscribed": totalSubscribed,
+					"pending":    totalPending,
+				},
+				"Lists": listRows,
+			},
+		}
+
+		state, err := renderCMSTemplate(engine, pagePath, layoutPath, data, cms.GetTheme())
+		if err != nil {
+			http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		state.SetHeadTitle("Wispy CMS ~ Subscribers")
+		tpl.HtmlBaseRender(w, state)
+	}
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"errors"
+	"net/http"
 	"os"
 	"path/filepath"
 	"wispy-core/common"
@@ -40,3 +42,45 @@ func renderCMSTemplate(engine tpl.TemplateEngine, pagePath, layoutPath string, d
 
 	return state, nil
 }
+
+// serveCMSFragment answers a request for a fragment of a CMS page, see
+// tpl.RequestedFragment. It reports false when the whole page should be sent.
+func serveCMSFragment(w http.ResponseWriter, r *http.Request, engine tpl.TemplateEngine, pagePath, layoutPath string, data tpl.TemplateData) bool {
+	w.Header().Add("Vary", tpl.FragmentVary)
+	fragment, explicit := tpl.RequestedFragment(r)
+	if fragment == "" {
+		return false
+	}
+
+	state, err := renderCMSFragment(engine, pagePath, layoutPath, fragment, data)
+	switch {
+	case err == nil:
+		tpl.FragmentRender(w, state)
+		return true
+	case errors.Is(err, tpl.ErrFragmentNotFound) && !explicit:
+		// The htmx target is not a fragment of this page
+		return false
+	case errors.Is(err, tpl.ErrFragmentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return true
+	default:
+		common.Error("Failed to render fragment %s of %s: %v", fragment, pagePath, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+}
+
+// renderCMSFragment renders one block or partial of a CMS page for a partial page
+// update. Only the CSS for the fragment's classes is added, the page it is swapped
+// into already has the theme.
+func renderCMSFragment(engine tpl.TemplateEngine, pagePath, layoutPath, fragment string, data tpl.TemplateData) (tpl.RenderState, error) {
+	state, err := engine.RenderFragment(pagePath, layoutPath, fragment, data)
+	if err != nil {
+		return state, err
+	}
+
+	css := wispytail.Generate(state.GetBody(), wispytail.DefaultThemeConfig(), engine.GetWispyTailTrie())
+	state.AddHeadInlineCSS(css)
+
+	return state, nil
+}
@@ -63,3 +63,18 @@ func ScaffoldAnalyticsDatabase(db *sql.DB) error {
 
 	return nil
 }
+
+// analyticsMigrations holds schema changes applied to existing analytics databases
+var analyticsMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_redirect_hits",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS redirect_hits (
+				rule TEXT PRIMARY KEY, -- match type and source path of the rule
+				hits INTEGER NOT NULL DEFAULT 0,
+				last_hit_at DATETIME
+			);`,
+		},
+	},
+}
@@ -26,11 +26,13 @@ type Manager interface {
 
 // DatabaseScaffolds contains the mapping of database names to their scaffolding functions
 var DatabaseScaffolds = map[string]DatabaseScaffoldFunc{
-	"forms":     ScaffoldFormsDatabase,
-	"users":     ScaffoldUsersDatabase,
-	"analytics": ScaffoldAnalyticsDatabase,
-	"content":   ScaffoldContentDatabase,
-	"media":     ScaffoldMediaDatabase,
+	"forms":       ScaffoldFormsDatabase,
+	"users":       ScaffoldUsersDatabase,
+	"analytics":   ScaffoldAnalyticsDatabase,
+	"content":     ScaffoldContentDatabase,
+	"media":       ScaffoldMediaDatabase,
+	"subscribers": ScaffoldSubscribersDatabase,
+	"privacy":     ScaffoldPrivacyDatabase,
 }
 
 // GetDatabaseScaffoldFunc returns the scaffolding function for a given database name
@@ -66,7 +66,7 @@ func ScaffoldFormsDatabase(db *sql.DB) error {
 			'Email Collection',
 			'Collect email addresses from users',
 			'[{"type": "email", "label": "Email Address", "required": true}]',
-			'{"confirmation_message": "Thank you for subscribing!"}'
+			'{"confirmation_message": "Thank you! Please check your inbox to confirm your subscription.", "subscribe_list": "newsletter"}'
 		);
 	`
 
@@ -92,3 +92,89 @@ func ScaffoldFormsDatabase(db *sql.DB) error {
 
 	return nil
 }
+
+// formsMigrations holds schema changes applied to existing forms databases
+var formsMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_form_submission_files",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS form_submission_files (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				uuid TEXT NOT NULL UNIQUE,
+				submission_id INTEGER NOT NULL,
+				field_name TEXT NOT NULL,
+				original_name TEXT NOT NULL,
+				stored_path TEXT NOT NULL, -- path relative to the tenant uploads directory
+				content_type TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (submission_id) REFERENCES form_submissions(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_submission_files_submission_id ON form_submission_files(submission_id);`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_submission_inbox",
+		Statements: []string{
+			`ALTER TABLE form_submissions ADD COLUMN status TEXT NOT NULL DEFAULT 'new'; -- new, read, replied, archived, spam`,
+			`ALTER TABLE form_submissions ADD COLUMN assigned_to TEXT; -- CMS user id`,
+			`ALTER TABLE form_submissions ADD COLUMN read_at DATETIME;`,
+			`ALTER TABLE form_submissions ADD COLUMN updated_at DATETIME;`,
+			`CREATE INDEX IF NOT EXISTS idx_submissions_status ON form_submissions(status);`,
+			`CREATE INDEX IF NOT EXISTS idx_submissions_assigned_to ON form_submissions(assigned_to);`,
+			`CREATE TABLE IF NOT EXISTS form_submission_notes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				uuid TEXT NOT NULL UNIQUE,
+				submission_id INTEGER NOT NULL,
+				author_id TEXT NOT NULL,
+				author_name TEXT,
+				body TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (submission_id) REFERENCES form_submissions(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_submission_notes_submission_id ON form_submission_notes(submission_id);`,
+		},
+	}, {
+		Version: 3,
+		Name:    "subscribe_example_form_to_newsletter",
+		Statements: []string{
+			`UPDATE forms
+			SET settings = json_set(COALESCE(NULLIF(settings, ''), '{}'), '$.subscribe_list', 'newsletter')
+			WHERE uuid = 'example-email-form' AND json_valid(COALESCE(NULLIF(settings, ''), '{}'))
+			AND json_extract(COALESCE(NULLIF(settings, ''), '{}'), '$.subscribe_list') IS NULL;`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_form_submission_drafts",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS form_submission_drafts (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				token TEXT NOT NULL UNIQUE, -- resume token handed to the visitor
+				form_id INTEGER NOT NULL,
+				step INTEGER NOT NULL DEFAULT 0, -- last completed step
+				data TEXT NOT NULL, -- JSON object of the values entered so far
+				email TEXT,
+				ip_address TEXT,
+				user_agent TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				expires_at DATETIME NOT NULL,
+				FOREIGN KEY (form_id) REFERENCES forms(id) ON DELETE CASCADE
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_submission_drafts_form_id ON form_submission_drafts(form_id);`,
+			`CREATE INDEX IF NOT EXISTS idx_submission_drafts_expires_at ON form_submission_drafts(expires_at);`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_submission_idempotency_keys",
+		Statements: []string{
+			`ALTER TABLE form_submissions ADD COLUMN idempotency_key TEXT; -- client supplied Idempotency-Key header`,
+			`ALTER TABLE form_submissions ADD COLUMN request_hash TEXT; -- fingerprint of the submitted values`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_submissions_idempotency_key ON form_submissions(form_id, idempotency_key) WHERE idempotency_key IS NOT NULL;`,
+		},
+	},
+}
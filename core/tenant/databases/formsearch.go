@@ -0,0 +1,109 @@
+package databases
+
+import (
+	"database/sql"
+	"fmt"
+	"wispy-core/common"
+)
+
+// SubmissionSearchTable is the FTS5 index over form submissions. Its rowid is
+// the id of the submission it indexes.
+const SubmissionSearchTable = "form_submissions_fts"
+
+// submissionSearchTriggers keep the FTS5 index in sync with form_submissions
+var submissionSearchTriggers = map[string]string{
+	"form_submissions_fts_ai": `
+    CREATE TRIGGER IF NOT EXISTS form_submissions_fts_ai AFTER INSERT ON form_submissions BEGIN
+        INSERT INTO form_submissions_fts (rowid, name, email, subject, message, data)
+        VALUES (new.id, TRIM(COALESCE(new.first_name, '') || ' ' || COALESCE(new.last_name, '')), new.email, new.subject, new.message, new.data);
+    END;`,
+	"form_submissions_fts_ad": `
+    CREATE TRIGGER IF NOT EXISTS form_submissions_fts_ad AFTER DELETE ON form_submissions BEGIN
+        DELETE FROM form_submissions_fts WHERE rowid = old.id;
+    END;`,
+	"form_submissions_fts_au": `
+    CREATE TRIGGER IF NOT EXISTS form_submissions_fts_au AFTER UPDATE OF first_name, last_name, email, subject, message, data ON form_submissions BEGIN
+        DELETE FROM form_submissions_fts WHERE rowid = old.id;
+        INSERT INTO form_submissions_fts (rowid, name, email, subject, message, data)
+        VALUES (new.id, TRIM(COALESCE(new.first_name, '') || ' ' || COALESCE(new.last_name, '')), new.email, new.subject, new.message, new.data);
+    END;`,
+}
+
+const submissionSearchTableSQL = `
+    CREATE VIRTUAL TABLE IF NOT EXISTS form_submissions_fts USING fts5(
+        name, email, subject, message, data,
+        tokenize = 'unicode61 remove_diacritics 2'
+    );`
+
+const submissionSearchBackfillSQL = `
+    INSERT INTO form_submissions_fts (rowid, name, email, subject, message, data)
+    SELECT id, TRIM(COALESCE(first_name, '') || ' ' || COALESCE(last_name, '')), email, subject, message, data
+    FROM form_submissions;`
+
+// FTS5Available reports whether the SQLite driver was built with FTS5
+// (go build -tags sqlite_fts5)
+func FTS5Available(db *sql.DB) bool {
+	var used bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used); err != nil {
+		return false
+	}
+	return used
+}
+
+// EnsureSubmissionSearchIndex creates the submission FTS5 index and its triggers,
+// rebuilding the index whenever the triggers were missing. Without FTS5 support
+// the triggers are dropped so inserts keep working and search falls back to LIKE.
+func EnsureSubmissionSearchIndex(db *sql.DB) error {
+	if !FTS5Available(db) {
+		for name := range submissionSearchTriggers {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return fmt.Errorf("failed to drop trigger %s: %v", name, err)
+			}
+		}
+		return nil
+	}
+
+	if SubmissionSearchReady(db) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin search index transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(submissionSearchTableSQL); err != nil {
+		return fmt.Errorf("failed to create %s table: %v", SubmissionSearchTable, err)
+	}
+	// The index may be stale if submissions were added while the triggers were gone
+	if _, err := tx.Exec("DELETE FROM " + SubmissionSearchTable); err != nil {
+		return fmt.Errorf("failed to clear %s: %v", SubmissionSearchTable, err)
+	}
+	if _, err := tx.Exec(submissionSearchBackfillSQL); err != nil {
+		return fmt.Errorf("failed to index existing submissions: %v", err)
+	}
+	for name, triggerSQL := range submissionSearchTriggers {
+		if _, err := tx.Exec(triggerSQL); err != nil {
+			return fmt.Errorf("failed to create trigger %s: %v", name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit search index: %v", err)
+	}
+
+	common.Info("Built submission search index")
+	return nil
+}
+
+// SubmissionSearchReady reports whether the FTS5 index and all of its triggers exist
+func SubmissionSearchReady(db *sql.DB) bool {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE (type = 'table' AND name = ?) OR (type = 'trigger' AND name IN (?, ?, ?))`,
+		SubmissionSearchTable, "form_submissions_fts_ai", "form_submissions_fts_ad", "form_submissions_fts_au",
+	).Scan(&count)
+	return err == nil && count == len(submissionSearchTriggers)+1
+}
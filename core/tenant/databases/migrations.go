@@ -0,0 +1,115 @@
+package databases
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"wispy-core/common"
+)
+
+// Migration represents a versioned schema change for a tenant database.
+// Scaffold functions create the initial schema; migrations bring databases
+// that were created by an older release up to date.
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// DatabaseMigrations contains the mapping of database names to their migrations
+var DatabaseMigrations = map[string][]Migration{
+	"forms":     formsMigrations,
+	"analytics": analyticsMigrations,
+}
+
+// DatabaseOpenHooks run every time a connection to the named database is opened,
+// after migrations. They keep derived structures such as search indexes in sync
+// with the capabilities of the running binary.
+var DatabaseOpenHooks = map[string]func(db *sql.DB) error{
+	"forms": EnsureSubmissionSearchIndex,
+}
+
+const schemaMigrationsTableSQL = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+
+// RegisterDatabaseMigrations appends migrations for the given database name
+func RegisterDatabaseMigrations(dbName string, migrations ...Migration) {
+	DatabaseMigrations[dbName] = append(DatabaseMigrations[dbName], migrations...)
+	common.Info("Registered %d migration(s) for: %s", len(migrations), dbName)
+}
+
+// ApplyMigrations runs every migration for dbName that has not been applied yet.
+// Each migration runs in its own transaction and is recorded in schema_migrations.
+func ApplyMigrations(db *sql.DB, dbName string) error {
+	migrations := DatabaseMigrations[dbName]
+	if len(migrations) == 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(schemaMigrationsTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan migration version: %v", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for _, m := range sorted {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %v", m.Version, err)
+		}
+
+		for _, stmt := range m.Statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+			}
+		}
+
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %v", m.Version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %v", m.Version, err)
+		}
+
+		common.Info("Applied migration %d (%s) to %s database", m.Version, m.Name, dbName)
+	}
+
+	return nil
+}
+
+// RunOpenHook runs the open hook registered for dbName, if any
+func RunOpenHook(db *sql.DB, dbName string) error {
+	hook, exists := DatabaseOpenHooks[dbName]
+	if !exists {
+		return nil
+	}
+	return hook(db)
+}
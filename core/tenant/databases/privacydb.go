@@ -0,0 +1,48 @@
+package databases
+
+import (
+	"database/sql"
+	"fmt"
+	"wispy-core/common"
+)
+
+// ScaffoldPrivacyDatabase creates the schema for the data-subject request audit log
+func ScaffoldPrivacyDatabase(db *sql.DB) error {
+	common.Info("Scaffolding privacy database")
+
+	// Create data subject requests table. The email is only kept as a SHA-256
+	// hash so the log itself does not hold on to erased personal data.
+	requestsTableSQL := `
+    CREATE TABLE IF NOT EXISTS data_subject_requests (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        uuid TEXT NOT NULL UNIQUE,
+        email_hash TEXT NOT NULL,
+        action TEXT NOT NULL, -- export, erase, anonymise
+        source TEXT NOT NULL, -- cms, api, cli
+        actor TEXT NOT NULL, -- CMS user id or CLI operator
+        status TEXT NOT NULL, -- completed, failed
+        summary TEXT NOT NULL DEFAULT '{}', -- JSON record counts per database table
+        error TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+
+	// Create indexes
+	indexesSQL := []string{
+		`CREATE INDEX IF NOT EXISTS idx_data_subject_requests_email_hash ON data_subject_requests(email_hash);`,
+		`CREATE INDEX IF NOT EXISTS idx_data_subject_requests_created_at ON data_subject_requests(created_at);`,
+	}
+
+	// Execute table creation
+	if _, err := db.Exec(requestsTableSQL); err != nil {
+		return fmt.Errorf("failed to create data_subject_requests table: %v", err)
+	}
+
+	// Execute indexes
+	for _, indexSQL := range indexesSQL {
+		if _, err := db.Exec(indexSQL); err != nil {
+			return fmt.Errorf("failed to create index: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package databases
+
+import (
+	"database/sql"
+	"fmt"
+	"wispy-core/common"
+)
+
+// ScaffoldSubscribersDatabase creates the schema for the mailing list subscribers database
+func ScaffoldSubscribersDatabase(db *sql.DB) error {
+	common.Info("Scaffolding subscribers database")
+
+	// Create lists table
+	listsTableSQL := `
+    CREATE TABLE IF NOT EXISTS subscriber_lists (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        uuid TEXT NOT NULL UNIQUE,
+        name TEXT NOT NULL UNIQUE,
+        title TEXT NOT NULL,
+        description TEXT,
+        welcome_url TEXT, -- where visitors land after confirming
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+
+	// Create subscribers table
+	subscribersTableSQL := `
+    CREATE TABLE IF NOT EXISTS subscribers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        uuid TEXT NOT NULL UNIQUE,
+        email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+        status TEXT NOT NULL DEFAULT 'pending', -- pending, confirmed, unsubscribed
+        unsubscribe_token TEXT NOT NULL UNIQUE,
+        consent_ip TEXT,
+        consent_user_agent TEXT,
+        consent_at DATETIME,
+        source_form TEXT, -- name of the form the visitor subscribed through
+        confirmed_at DATETIME,
+        confirmed_ip TEXT,
+        unsubscribed_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+
+	// Create list memberships table
+	membershipsTableSQL := `
+    CREATE TABLE IF NOT EXISTS subscriber_list_members (
+        subscriber_id INTEGER NOT NULL,
+        list_id INTEGER NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending', -- pending, subscribed, unsubscribed
+        confirm_token TEXT UNIQUE, -- each list is confirmed from its own email
+        confirm_sent_at DATETIME,
+        consent_ip TEXT,
+        consent_user_agent TEXT,
+        consent_at DATETIME,
+        source_form TEXT,
+        confirmed_at DATETIME,
+        confirmed_ip TEXT,
+        subscribed_at DATETIME,
+        unsubscribed_at DATETIME,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (subscriber_id, list_id),
+        FOREIGN KEY (subscriber_id) REFERENCES subscribers(id) ON DELETE CASCADE,
+        FOREIGN KEY (list_id) REFERENCES subscriber_lists(id) ON DELETE CASCADE
+    );`
+
+	// Create indexes
+	indexesSQL := []string{
+		`CREATE INDEX IF NOT EXISTS idx_subscribers_status ON subscribers(status);`,
+		`CREATE INDEX IF NOT EXISTS idx_subscriber_list_members_list_id ON subscriber_list_members(list_id);`,
+	}
+
+	// Add default newsletter list used by the email collection form
+	defaultListSQL := `
+		INSERT INTO subscriber_lists (uuid, name, title, description, welcome_url)
+		VALUES (
+			'default-newsletter-list',
+			'newsletter',
+			'Newsletter',
+			'Visitors who signed up through the email collection form',
+			'/notified-welcome'
+		);
+	`
+
+	// Execute table creation
+	if _, err := db.Exec(listsTableSQL); err != nil {
+		return fmt.Errorf("failed to create subscriber_lists table: %v", err)
+	}
+
+	if _, err := db.Exec(subscribersTableSQL); err != nil {
+		return fmt.Errorf("failed to create subscribers table: %v", err)
+	}
+
+	if _, err := db.Exec(membershipsTableSQL); err != nil {
+		return fmt.Errorf("failed to create subscriber_list_members table: %v", err)
+	}
+
+	if _, err := db.Exec(defaultListSQL); err != nil {
+		return fmt.Errorf("failed to insert default list: %v", err)
+	}
+
+	// Execute indexes
+	for _, indexSQL := range indexesSQL {
+		if _, err := db.Exec(indexSQL); err != nil {
+			return fmt.Errorf("failed to create index: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/go-playground/validator/v10 v10.26.0
 	github.com/lmittmann/tint v1.1.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wispy-core/tpl"
+)
+
+const benchLayout = `<!DOCTYPE html>
+<html>
+<head><title>{{.Name}}</title></head>
+<body>
+	<header>{{template "partials/nav" .}}</header>
+	<main>{{block "body" .}}<h3>Failed to load page body</h3>{{end}}</main>
+	<footer>&copy; {{.Email}}</footer>
+</body>
+</html>
+`
+
+const benchPage = `{{define "body"}}
+<h1>{{upper .Name}}</h1>
+<ul>{{range .Friends}}<li>{{.}}</li>{{end}}</ul>
+{{range .Jobs}}<section><h2>{{.Title}}</h2><p>{{.Company}}, {{.Location.City}}</p></section>{{end}}
+<p>{{range .Tags}}<span>{{.}}</span>{{end}}</p>
+{{end}}
+`
+
+const benchNav = `<nav>{{range .Addresses}}<a href="/{{.Zip}}">{{.City}}</a>{{end}}</nav>`
+
+// newBenchEngine writes a layout, a page and a supporting partial to a temp dir
+// and returns an engine that renders them
+func newBenchEngine(b *testing.B) (tpl.TemplateEngine, string, string) {
+	b.Helper()
+	root := b.TempDir()
+	files := map[string]string{
+		"layouts/default.html": benchLayout,
+		"pages/index.html":     benchPage,
+		"partials/nav.html":    benchNav,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	engine := tpl.NewTemplateEngine(filepath.Join(root, "layouts"), filepath.Join(root, "pages"))
+	if _, errs := engine.LoadSupportingTemplates([]string{filepath.Join(root, "partials")}); len(errs) > 0 {
+		b.Fatal(errs)
+	}
+	return engine, "index.html", "default.html"
+}
+
+var benchData = tpl.TemplateData{Data: map[string]interface{}{
+	"Name":      testPerson.Name,
+	"Email":     testPerson.Email,
+	"Friends":   testPerson.Friends,
+	"Jobs":      testPerson.Jobs,
+	"Tags":      testPerson.Tags,
+	"Addresses": testPerson.Addresses,
+}}
+
+// BenchmarkEngineCloneAndParse is what a page render used to cost: clone the
+// supporting templates, parse the layout and page, then execute
+func BenchmarkEngineCloneAndParse(b *testing.B) {
+	engine, page, layout := newBenchEngine(b)
+	layoutData, err := engine.LoadLayout(layout)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pageData, err := engine.LoadTemplate(page)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tmpl, err := engine.GetSupportingTemplates().Clone()
+		if err != nil {
+			b.Fatal(err)
+		}
+		tmpl.Funcs(engine.GetFuncMap())
+		if _, err := tmpl.Parse(string(layoutData)); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := tmpl.Parse(string(pageData)); err != nil {
+			b.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, benchData.Data); err != nil {
+			b.Fatal(err)
+		}
+		_ = buf.String()
+	}
+}
+
+// BenchmarkEngineRenderWithLayout renders through the compiled template cache
+func BenchmarkEngineRenderWithLayout(b *testing.B) {
+	engine, page, layout := newBenchEngine(b)
+	if err := engine.Precompile(page, layout); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.RenderWithLayout(page, layout, benchData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEngineRenderWithLayoutParallel(b *testing.B) {
+	engine, page, layout := newBenchEngine(b)
+	if err := engine.Precompile(page, layout); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := engine.RenderWithLayout(page, layout, benchData); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// listingData has friends rows, like a large listing page
+func listingData(rows int) tpl.TemplateData {
+	friends := make([]string, rows)
+	for i := range friends {
+		friends[i] = testPerson.Friends[i%len(testPerson.Friends)]
+	}
+	data := make(map[string]interface{}, len(benchData.Data))
+	for k, v := range benchData.Data {
+		data[k] = v
+	}
+	data["Friends"] = friends
+	return tpl.TemplateData{Data: data}
+}
+
+var listingSizes = []int{10, 2000}
+
+// BenchmarkEngineRenderDocument renders into the render state and then writes the document
+func BenchmarkEngineRenderDocument(b *testing.B) {
+	engine, page, layout := newBenchEngine(b)
+	if err := engine.Precompile(page, layout); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, rows := range listingSizes {
+		data := listingData(rows)
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rs, err := engine.RenderWithLayout(page, layout, data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := tpl.HtmlBaseRender(io.Discard, rs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEngineStreamDocument streams the document without holding the body
+func BenchmarkEngineStreamDocument(b *testing.B) {
+	engine, page, layout := newBenchEngine(b)
+	if err := engine.Precompile(page, layout); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, rows := range listingSizes {
+		data := listingData(rows)
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := engine.RenderWithLayoutTo(io.Discard, page, layout, data, tpl.StreamHooks{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ set -euo pipefail
 
 echo "Building server..."
 
-go build -o ./bin/wispy-core ../cmd/server/main.go
+# sqlite_fts5 enables full-text search over form submissions
+go build -tags sqlite_fts5 -o ./bin/wispy-core ../cmd/server/main.go
 
 echo "Server build complete."
\ No newline at end of file
@@ -148,7 +148,7 @@ go mod tidy
 
 # Run the server from the cmd/server directory
 # echo "Starting server from project root: ${PROJECT_ROOT}"
-go run ./server/server.go
+go run -tags sqlite_fts5 ./server/server.go
 
 # Exit with the same status code as the server
 exit $?
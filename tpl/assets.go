@@ -0,0 +1,206 @@
+package tpl
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fingerprintLength is the number of hex characters of the content hash in asset URLs
+	fingerprintLength = 10
+	// immutableCacheControl is sent for fingerprinted URLs, whose content never changes
+	immutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+// AssetManager fingerprints the files below a site's assets directory, e.g.
+// /assets/css/site.css becomes /assets/css/site.3f2a9c1b04.css, and computes their
+// Subresource Integrity hashes. Files are hashed when first referenced and again
+// when they change on disk.
+type AssetManager struct {
+	root      string // directory on disk
+	urlPrefix string // URL the directory is served under, e.g. "/assets/"
+
+	mu    sync.Mutex
+	files map[string]*assetFile // by path relative to root, with forward slashes
+}
+
+// assetFile is a hashed file below the assets directory
+type assetFile struct {
+	fingerprint string
+	integrity   string
+	modTime     time.Time
+	size        int64
+	checkedAt   time.Time
+}
+
+// NewAssetManager creates an asset manager for the files in root, served under urlPrefix
+func NewAssetManager(root, urlPrefix string) *AssetManager {
+	if !strings.HasSuffix(urlPrefix, "/") {
+		urlPrefix += "/"
+	}
+	return &AssetManager{
+		root:      root,
+		urlPrefix: urlPrefix,
+		files:     make(map[string]*assetFile),
+	}
+}
+
+// Resolve returns the fingerprinted URL and integrity attribute of an asset reference.
+// References outside the assets directory, with a query string or to missing files
+// are returned unchanged without integrity.
+func (am *AssetManager) Resolve(src string) (string, string) {
+	if am == nil || !strings.HasPrefix(src, am.urlPrefix) || strings.ContainsAny(src, "?#") {
+		return src, ""
+	}
+	rel, ok := am.relPath(strings.TrimPrefix(src, am.urlPrefix))
+	if !ok {
+		return src, ""
+	}
+	file := am.file(rel)
+	if file == nil {
+		return src, ""
+	}
+	return am.urlPrefix + fingerprintedPath(rel, file.fingerprint), file.integrity
+}
+
+// URL returns the fingerprinted URL of an asset, given relative to the assets
+// directory ("css/site.css") or as a URL ("/assets/css/site.css")
+func (am *AssetManager) URL(src string) string {
+	if am != nil && !strings.HasPrefix(src, "/") && !strings.Contains(src, "://") {
+		src = am.urlPrefix + src
+	}
+	url, _ := am.Resolve(src)
+	return url
+}
+
+// relPath cleans a path below the assets directory, rejecting ones that leave it
+func (am *AssetManager) relPath(p string) (string, bool) {
+	rel := strings.TrimPrefix(path.Clean("/"+p), "/")
+	return rel, rel != "" && rel != "."
+}
+
+func (am *AssetManager) fsPath(rel string) string {
+	return filepath.Join(am.root, filepath.FromSlash(rel))
+}
+
+// file returns the hashes of a file, rehashing it when it changed. Files are
+// checked at most once per sourceCheckInterval.
+func (am *AssetManager) file(rel string) *assetFile {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	now := time.Now()
+	cached := am.files[rel]
+	if cached != nil && now.Sub(cached.checkedAt) < sourceCheckInterval {
+		return cached
+	}
+
+	info, err := os.Stat(am.fsPath(rel))
+	if err != nil || info.IsDir() {
+		delete(am.files, rel)
+		return nil
+	}
+	if cached != nil && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		cached.checkedAt = now
+		return cached
+	}
+
+	file, err := hashAsset(am.fsPath(rel))
+	if err != nil {
+		delete(am.files, rel)
+		return nil
+	}
+	file.modTime = info.ModTime()
+	file.size = info.Size()
+	file.checkedAt = now
+	am.files[rel] = file
+	return file
+}
+
+// hashAsset computes the fingerprint and the sha384 integrity of a file
+func hashAsset(fsPath string) (*assetFile, error) {
+	f, err := os.Open(fsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fingerprint := sha256.New()
+	integrity := sha512.New384()
+	if _, err := io.Copy(io.MultiWriter(fingerprint, integrity), f); err != nil {
+		return nil, err
+	}
+	return &assetFile{
+		fingerprint: hex.EncodeToString(fingerprint.Sum(nil))[:fingerprintLength],
+		integrity:   "sha384-" + base64.StdEncoding.EncodeToString(integrity.Sum(nil)),
+	}, nil
+}
+
+// fingerprintedPath inserts a fingerprint before the extension: css/site.css -> css/site.<fp>.css
+func fingerprintedPath(rel, fingerprint string) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + "." + fingerprint + ext
+}
+
+// splitFingerprint undoes fingerprintedPath
+func splitFingerprint(rel string) (string, string, bool) {
+	ext := path.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	dot := strings.LastIndexByte(base, '.')
+	if dot < 0 || len(base)-dot-1 != fingerprintLength {
+		return "", "", false
+	}
+	fingerprint := base[dot+1:]
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return "", "", false
+	}
+	return base[:dot] + ext, fingerprint, true
+}
+
+// ServeHTTP serves the assets directory. Fingerprinted URLs of the current file
+// content are cached for good; anything else must be revalidated, including
+// fingerprinted URLs of an older version, which get the current file.
+func (am *AssetManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rel, ok := am.relPath(strings.TrimPrefix(r.URL.Path, am.urlPrefix))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	cacheControl := "no-cache"
+	if original, fingerprint, ok := splitFingerprint(rel); ok {
+		if file := am.file(original); file != nil {
+			if file.fingerprint == fingerprint {
+				cacheControl = immutableCacheControl
+				w.Header().Set("ETag", `"`+fingerprint+`"`)
+			}
+			rel = original
+		}
+	}
+
+	f, err := os.Open(am.fsPath(rel))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
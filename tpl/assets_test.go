@@ -0,0 +1,177 @@
+package tpl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const siteCSS = "body{color:red}"
+
+func newTestAssets(t *testing.T) (*AssetManager, string) {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "assets", "css", "site.css"), siteCSS)
+	writeTestFile(t, filepath.Join(root, "assets", "js", "app.js"), "console.log(1)")
+	writeTestFile(t, filepath.Join(root, "secret.txt"), "secret")
+	return NewAssetManager(filepath.Join(root, "assets"), "/assets"), root
+}
+
+func testFingerprint(content string) (string, string) {
+	fp := sha256.Sum256([]byte(content))
+	sri := sha512.Sum384([]byte(content))
+	return hex.EncodeToString(fp[:])[:fingerprintLength], "sha384-" + base64.StdEncoding.EncodeToString(sri[:])
+}
+
+func TestAssetManagerResolve(t *testing.T) {
+	am, _ := newTestAssets(t)
+	fp, sri := testFingerprint(siteCSS)
+
+	tests := []struct {
+		name          string
+		src           string
+		wantURL       string
+		wantIntegrity string
+	}{
+		{name: "Local file", src: "/assets/css/site.css", wantURL: "/assets/css/site." + fp + ".css", wantIntegrity: sri},
+		{name: "Cleaned path", src: "/assets/js/../css/site.css", wantURL: "/assets/css/site." + fp + ".css", wantIntegrity: sri},
+		{name: "External URL", src: "https://cdn.example.com/x.css", wantURL: "https://cdn.example.com/x.css"},
+		{name: "Outside the assets directory", src: "/public/site.css", wantURL: "/public/site.css"},
+		{name: "Missing file", src: "/assets/css/missing.css", wantURL: "/assets/css/missing.css"},
+		{name: "Directory", src: "/assets/css", wantURL: "/assets/css"},
+		{name: "Query string", src: "/assets/css/site.css?v=2", wantURL: "/assets/css/site.css?v=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, integrity := am.Resolve(tt.src)
+			if url != tt.wantURL || integrity != tt.wantIntegrity {
+				t.Errorf("Resolve(%q) = %q, %q, want %q, %q", tt.src, url, integrity, tt.wantURL, tt.wantIntegrity)
+			}
+		})
+	}
+
+	if got := am.URL("css/site.css"); got != "/assets/css/site."+fp+".css" {
+		t.Errorf("URL() = %q", got)
+	}
+}
+
+func TestAssetManagerRehashesChangedFiles(t *testing.T) {
+	am, root := newTestAssets(t)
+	before, _ := am.Resolve("/assets/css/site.css")
+
+	path := filepath.Join(root, "assets", "css", "site.css")
+	writeTestFile(t, path, "body{color:blue}")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	am.files["css/site.css"].checkedAt = time.Time{}
+
+	fp, _ := testFingerprint("body{color:blue}")
+	if after, _ := am.Resolve("/assets/css/site.css"); after == before || after != "/assets/css/site."+fp+".css" {
+		t.Errorf("after change: %q, before %q", after, before)
+	}
+}
+
+func TestAssetManagerServeHTTP(t *testing.T) {
+	am, _ := newTestAssets(t)
+	fp, _ := testFingerprint(siteCSS)
+
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantCache string
+		wantBody  string
+	}{
+		{name: "Fingerprinted", path: "/assets/css/site." + fp + ".css", wantCode: http.StatusOK, wantCache: immutableCacheControl, wantBody: siteCSS},
+		{name: "Plain path", path: "/assets/css/site.css", wantCode: http.StatusOK, wantCache: "no-cache", wantBody: siteCSS},
+		{name: "Old fingerprint gets the current file", path: "/assets/css/site.0123456789.css", wantCode: http.StatusOK, wantCache: "no-cache", wantBody: siteCSS},
+		{name: "Missing", path: "/assets/css/missing.css", wantCode: http.StatusNotFound},
+		{name: "Directory", path: "/assets/css", wantCode: http.StatusNotFound},
+		{name: "Outside the assets directory", path: "/assets/../secret.txt", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.URL.Path = tt.path
+			am.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHtmlBaseRenderAssets(t *testing.T) {
+	am, _ := newTestAssets(t)
+	cssFP, cssSRI := testFingerprint(siteCSS)
+	jsFP, jsSRI := testFingerprint("console.log(1)")
+
+	rs := NewRenderState()
+	rs.SetAssets(am)
+	rs.AddStyles(StyleAsset{Src: "/theme.css", Priority: 10})
+	rs.AddStyles(StyleAsset{Src: "/assets/css/site.css"})
+	rs.AddStyles(StyleAsset{Src: "/theme.css", Priority: 10}) // duplicate
+	rs.AddStyles(StyleAsset{Src: "/print.css", Location: LocationBodyEnd, Attrs: map[string]string{"media": "print"}})
+	rs.AddStyles(StyleAsset{Src: "/fonts.css", Type: StyleAsync, Priority: -1})
+	rs.AddScripts(ScriptAsset{Src: "/assets/js/app.js", Module: true, Location: LocationBodyEnd})
+	rs.AddScripts(ScriptAsset{Src: "/vendor.js", Defer: true, Attrs: map[string]string{"crossorigin": "anonymous"}})
+	rs.AddScripts(ScriptAsset{Src: "/vendor.js", Defer: true})
+	rs.SetBody("<body></body>")
+
+	var buf bytes.Buffer
+	if err := HtmlBaseRender(&buf, rs); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	want := []string{
+		`<link rel="preload" as="style" href="/print.css">`,
+		`<link rel="modulepreload" href="/assets/js/app.` + jsFP + `.js" integrity="` + jsSRI + `">`,
+		`<link rel="preload" as="style" onload="this.onload=null;this.rel='stylesheet'" href="/fonts.css"><noscript><link rel="stylesheet" href="/fonts.css"></noscript>`,
+		`<link rel="stylesheet" href="/assets/css/site.` + cssFP + `.css" integrity="` + cssSRI + `">`,
+		`<link rel="stylesheet" href="/theme.css">`,
+		`<script src="/vendor.js" defer crossorigin="anonymous"></script>`,
+		`</head>`,
+		`<body></body>`,
+		`<link rel="stylesheet" href="/print.css" media="print">`,
+		`<script src="/assets/js/app.` + jsFP + `.js" type="module" integrity="` + jsSRI + `"></script>`,
+		`</html>`,
+	}
+	pos := 0
+	for _, part := range want {
+		i := strings.Index(got[pos:], part)
+		if i < 0 {
+			t.Fatalf("missing or out of order: %s\nin: %s", part, got)
+		}
+		pos += i + len(part)
+	}
+	for _, src := range []string{`href="/theme.css"`, `src="/vendor.js"`} {
+		if n := strings.Count(got, src); n != 1 {
+			t.Errorf("%s written %d times", src, n)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wispy-core/common"
+)
+
+const (
+	// sourceCheckInterval is how often cached templates look for changed files
+	sourceCheckInterval = 2 * time.Second
+	// maxPooledBufferSize keeps unusually large pages from pinning memory in the buffer pool
+	maxPooledBufferSize = 1 << 20
+)
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+type cacheKey struct {
+	page   string
+	layout string // empty for RenderTemplate
+}
+
+// sourceFile is a template file a compiled set was built from
+type sourceFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func statSource(path string) sourceFile {
+	src := sourceFile{path: path}
+	if info, err := os.Stat(path); err == nil {
+		src.modTime = info.ModTime()
+		src.size = info.Size()
+	}
+	return src
+}
+
+func (src sourceFile) changed() bool {
+	current := statSource(src.path)
+	return !current.modTime.Equal(src.modTime) || current.size != src.size
+}
+
+// dirsSignature summarises the files below dirs so changes can be detected
+// without keeping a list of every file
+type dirsSignature struct {
+	files  int
+	size   int64
+	newest time.Time
+}
+
+func signDirs(dirs []string) dirsSignature {
+	var sig dirsSignature
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			sig.files++
+			sig.size += info.Size()
+			if info.ModTime().After(sig.newest) {
+				sig.newest = info.ModTime()
+			}
+			return nil
+		})
+	}
+	return sig
+}
+
+// compiledSet is a page parsed together with its layout and the supporting templates.
+// The master is never executed so it can be cloned; clones are escaped on their first
+// execution and then reused from the pool, so a render neither clones nor parses.
+type compiledSet struct {
+	master     *template.Template
+	generation uint64
+	sources    []sourceFile
+	checkedAt  atomic.Int64 // unix nanoseconds of the last source check
+	funcTypes  map[string]reflect.Type
+	providers  []FuncProvider
+	components *componentSet
+	used       []string // components the page renders by name
+	meta       PageMeta // front matter of the page
+	layouts    []string // the layout chain, root first
+	fragments  sync.Map // fragment name -> components it renders by name, see fragmentComponents
+	pool       sync.Pool
+}
+
+// instance is a ready to execute copy of a compiled set. Its template functions
+// dispatch to the functions built for the render it is currently used by, which
+// keeps stateful functions such as the form helpers bound to the right request.
+type instance struct {
+	tmpl  *template.Template
+	funcs template.FuncMap
+}
+
+// stale reports whether a source file changed, checking at most once per sourceCheckInterval
+func (cs *compiledSet) stale() bool {
+	now := time.Now().UnixNano()
+	last := cs.checkedAt.Load()
+	if now-last < int64(sourceCheckInterval) || !cs.checkedAt.CompareAndSwap(last, now) {
+		return false
+	}
+	for _, src := range cs.sources {
+		if src.changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire takes an instance from the pool, cloning the master when the pool is empty
+func (cs *compiledSet) acquire() (*instance, error) {
+	if inst, ok := cs.pool.Get().(*instance); ok {
+		return inst, nil
+	}
+
+	tmpl, err := cs.master.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone compiled template: %w", err)
+	}
+
+	inst := &instance{tmpl: tmpl}
+	dispatch := make(template.FuncMap, len(cs.funcTypes))
+	for name, typ := range cs.funcTypes {
+		dispatch[name] = inst.dispatcher(name, typ)
+	}
+	tmpl.Funcs(dispatch)
+	return inst, nil
+}
+
+func (cs *compiledSet) release(inst *instance) {
+	inst.funcs = nil
+	cs.pool.Put(inst)
+}
+
+// dispatcher returns a function of type typ that calls the instance's current function name
+func (inst *instance) dispatcher(name string, typ reflect.Type) interface{} {
+	return reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		fn, ok := inst.funcs[name]
+		if !ok {
+			panic(fmt.Sprintf("template function %q is not available in this render", name))
+		}
+		if typ.IsVariadic() {
+			return reflect.ValueOf(fn).CallSlice(args)
+		}
+		return reflect.ValueOf(fn).Call(args)
+	}).Interface()
+}
+
+// addComponentAssets adds the assets of the components the page is known to use
+func (cs *compiledSet) addComponentAssets(rs RenderState) {
+	for _, name := range cs.used {
+		cs.components.addAssets(rs, name)
+	}
+}
+
+// applyMeta sets the front matter of the page on a render, before its templates run
+func (cs *compiledSet) applyMeta(rs RenderState) error {
+	if err := cs.meta.Apply(rs); err != nil {
+		return fmt.Errorf("failed to apply front matter: %w", err)
+	}
+	return nil
+}
+
+// execute renders the set for one request into rs
+func (cs *compiledSet) execute(rs RenderState, data TemplateData) error {
+	cs.addComponentAssets(rs)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := cs.executeTo(buf, rs, "", data); err != nil {
+		return err
+	}
+
+	rs.SetBody(buf.String())
+	return nil
+}
+
+// executeTo renders the set for one request straight to w. A name renders only
+// that template of the set, e.g. a block of the page.
+func (cs *compiledSet) executeTo(w io.Writer, rs RenderState, name string, data TemplateData) error {
+	inst, err := cs.acquire()
+	if err != nil {
+		return err
+	}
+	inst.funcs = buildFuncMap(rs, inst.tmpl, cs.providers, cs.components)
+
+	if name == "" {
+		err = inst.tmpl.Execute(w, data.Data)
+	} else {
+		err = inst.tmpl.ExecuteTemplate(w, name, data.Data)
+	}
+	if err != nil {
+		// The instance may be left half escaped, let it go
+		return err
+	}
+	cs.release(inst)
+	return nil
+}
+
+// compiled returns the cached set for a page and layout, compiling it when it is
+// missing, one of its files changed or the supporting templates were reloaded
+func (te *templateEngine) compiled(templatePath, layoutPath string) (*compiledSet, error) {
+	te.checkSupportingTemplates()
+
+	key := cacheKey{page: templatePath, layout: layoutPath}
+	generation := te.generation.Load()
+
+	te.cacheMu.RLock()
+	cached, ok := te.cache[key]
+	te.cacheMu.RUnlock()
+	if ok && cached.generation == generation {
+		if !cached.stale() {
+			return cached, nil
+		}
+		common.Debug("Template %s changed, recompiling", templatePath)
+		te.forgetSources(templatePath, cached.layouts)
+	}
+
+	te.cacheMu.Lock()
+	defer te.cacheMu.Unlock()
+
+	// Another request may have compiled it in the meantime
+	if current, ok := te.cache[key]; ok && current != cached && current.generation == generation {
+		return current, nil
+	}
+
+	cs, err := te.compile(templatePath, layoutPath, generation)
+	if err != nil {
+		delete(te.cache, key)
+		return nil, err
+	}
+	te.cache[key] = cs
+	return cs, nil
+}
+
+// compile parses the layout and page into a copy of the supporting templates
+func (te *templateEngine) compile(templatePath, layoutPath string, generation uint64) (*compiledSet, error) {
+	cs := &compiledSet{generation: generation}
+
+	var chain []layoutSource
+	if layoutPath != "" {
+		var err error
+		if chain, err = te.layoutChain(layoutPath); err != nil {
+			return nil, err
+		}
+		for _, layout := range chain {
+			cs.layouts = append(cs.layouts, layout.name)
+			cs.sources = append(cs.sources, statSource(layout.file))
+		}
+	}
+
+	contentData, err := te.LoadTemplate(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template %s: %w", templatePath, err)
+	}
+	cs.sources = append(cs.sources, statSource(te.templateFile(templatePath)))
+	frontMatter, contentData := splitFrontMatter(contentData)
+	if cs.meta, err = parseFrontMatter(frontMatter); err != nil {
+		return nil, fmt.Errorf("invalid front matter of %s: %w", templatePath, err)
+	}
+	cs.checkedAt.Store(time.Now().UnixNano())
+
+	te.mu.RLock()
+	supporting := te.supportingTemplates
+	cs.providers = te.funcProviders
+	cs.components = te.components
+	te.mu.RUnlock()
+
+	funcMap := buildFuncMap(nil, nil, cs.providers, cs.components)
+	cs.funcTypes = make(map[string]reflect.Type, len(funcMap))
+	for name, fn := range funcMap {
+		cs.funcTypes[name] = reflect.TypeOf(fn)
+	}
+
+	cs.master, err = supporting.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone supporting templates: %w", err)
+	}
+	cs.master.Funcs(funcMap)
+
+	// The root layout is the document; the layouts extending it are parsed after it
+	// so their blocks override its blocks, and the content last so it can define
+	// the blocks the layouts reference. Only the definitions of child layouts are
+	// used, anything outside them is kept out of the document.
+	for i, layout := range chain {
+		tmpl := cs.master
+		if i > 0 {
+			tmpl = cs.master.New("layouts/" + layout.name)
+		}
+		if _, err := tmpl.Parse(string(layout.data)); err != nil {
+			return nil, fmt.Errorf("failed to parse layout template %s: %w", layout.name, err)
+		}
+	}
+	if _, err := cs.master.Parse(string(contentData)); err != nil {
+		return nil, fmt.Errorf("failed to parse content template %s: %w", templatePath, err)
+	}
+	cs.used = usedComponents(cs.master, cs.master.Name())
+
+	return cs, nil
+}
+
+// forgetSources drops the cached file contents of a page and its layouts
+func (te *templateEngine) forgetSources(templatePath string, layouts []string) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	delete(te.templates, templatePath)
+	for _, layout := range layouts {
+		delete(te.layouts, layout)
+	}
+}
+
+// checkSupportingTemplates reloads the supporting templates when their files
+// changed, checking at most once per sourceCheckInterval
+func (te *templateEngine) checkSupportingTemplates() {
+	now := time.Now().UnixNano()
+	last := te.supportingCheckedAt.Load()
+	if now-last < int64(sourceCheckInterval) || !te.supportingCheckedAt.CompareAndSwap(last, now) {
+		return
+	}
+
+	te.mu.RLock()
+	dirs := te.supportingDirs
+	signature := te.supportingSignature
+	te.mu.RUnlock()
+	if len(dirs) == 0 || signDirs(dirs) == signature {
+		return
+	}
+
+	common.Info("Supporting templates changed, reloading")
+	if _, errs := te.LoadSupportingTemplates(dirs); len(errs) > 0 {
+		for _, err := range errs {
+			common.Warning("-->: %v", err)
+		}
+	}
+}
+
+// Invalidate drops every compiled template and cached file, e.g. after templates were edited
+func (te *templateEngine) Invalidate() {
+	te.mu.Lock()
+	te.templates = make(map[string][]byte)
+	te.layouts = make(map[string][]byte)
+	te.mu.Unlock()
+
+	te.generation.Add(1)
+
+	te.cacheMu.Lock()
+	te.cache = make(map[cacheKey]*compiledSet)
+	te.cacheMu.Unlock()
+}
+
+// Precompile compiles a page ahead of its first request so template errors show up at startup
+func (te *templateEngine) Precompile(templatePath, layoutPath string) error {
+	_, err := te.compiled(templatePath, layoutPath)
+	return err
+}
@@ -0,0 +1,354 @@
+package tpl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"wispy-core/common"
+	"wispy-core/wispytail"
+)
+
+// CheckIssue is a problem Check found in a template file
+type CheckIssue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (issue CheckIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", issue.File, issue.Line, issue.Column, issue.Message)
+}
+
+// builtinFuncs are the functions every template has
+var builtinFuncs = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or", "print", "printf",
+	"println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// parseErrorLine matches the line of a parse error: "template: name:12: unexpected EOF"
+var parseErrorLine = regexp.MustCompile(`(?s)^template: .*?:(\d+): (.*)$`)
+
+// checkClassAttr matches a class attribute in the HTML of a template, up to the
+// end of the text when an action follows: class="card {{.Extra}}"
+var checkClassAttr = regexp.MustCompile(`class\s*=\s*"([^"]*)("|$)`)
+
+// checkFile is a template file parsed by Check
+type checkFile struct {
+	path  string
+	text  string
+	trees map[string]*parse.Tree
+}
+
+// position returns the line and column of a byte offset of the file
+func (f *checkFile) position(offset int) (line, column int) {
+	offset = min(offset, len(f.text))
+	line = 1 + strings.Count(f.text[:offset], "\n")
+	column = offset - strings.LastIndex(f.text[:offset], "\n")
+	return line, column
+}
+
+// checker collects the issues of a Check
+type checker struct {
+	funcs  map[string]bool
+	trie   *common.Trie
+	files  map[string]*checkFile
+	issues map[CheckIssue]bool
+}
+
+func (c *checker) report(file string, line, column int, format string, args ...interface{}) {
+	c.issues[CheckIssue{File: file, Line: line, Column: column, Message: fmt.Sprintf(format, args...)}] = true
+}
+
+// parse reads and parses a template file once, reporting why it cannot be parsed
+func (c *checker) parse(path, name string) *checkFile {
+	if f, ok := c.files[path]; ok {
+		return f
+	}
+	c.files[path] = nil
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.report(path, 1, 1, "%v", err)
+		return nil
+	}
+	frontMatter, data := splitFrontMatter(data)
+	if _, err := parseFrontMatter(frontMatter); err != nil {
+		c.report(path, 1, 1, "invalid front matter: %v", err)
+	}
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(string(data), "", "", trees); err != nil {
+		line, message := 1, err.Error()
+		if match := parseErrorLine.FindStringSubmatch(message); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+		c.report(path, line, 1, "%s", message)
+		return nil
+	}
+
+	f := &checkFile{path: path, text: string(data), trees: trees}
+	c.files[path] = f
+	return f
+}
+
+// walk checks the templates of a file. Template names are looked up in defined,
+// unless it is nil; page names the page the file is rendered with, if any.
+func (c *checker) walk(f *checkFile, defined map[string]bool, page string) {
+	if f == nil {
+		return
+	}
+	reference := func(node parse.Node, name string) {
+		if defined == nil || defined[name] {
+			return
+		}
+		line, column := f.position(int(node.Position()))
+		if page != "" {
+			c.report(f.path, line, column, "template %q is not defined when rendering page %s", name, page)
+		} else {
+			c.report(f.path, line, column, "template %q is not defined", name)
+		}
+	}
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.TextNode:
+			c.checkClasses(f, int(n.Position()), n.Text)
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			// Template names passed as literals to component, include and slot
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok {
+				arg := 1
+				if ident.Ident == "slot" {
+					arg = 2
+				}
+				if ident.Ident == "component" || ident.Ident == "include" || ident.Ident == "slot" {
+					if len(n.Args) > arg {
+						if str, ok := n.Args[arg].(*parse.StringNode); ok {
+							reference(str, str.Text)
+						}
+					}
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.IdentifierNode:
+			if !c.funcs[n.Ident] {
+				line, column := f.position(int(n.Position()))
+				c.report(f.path, line, column, "function %q is not defined", n.Ident)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			reference(n, n.Name)
+			walk(n.Pipe)
+		}
+	}
+
+	for _, tree := range f.trees {
+		walk(tree.Root)
+	}
+}
+
+// checkClasses reports the classes of the HTML at offset that look like utilities
+// but that wispytail cannot generate CSS for
+func (c *checker) checkClasses(f *checkFile, offset int, text []byte) {
+	for _, match := range checkClassAttr.FindAllSubmatchIndex(text, -1) {
+		value := string(text[match[2]:match[3]])
+		classes := strings.Fields(value)
+		// A class right before an action may be completed by it
+		if match[4] == match[5] && len(classes) > 0 && strings.TrimRight(value, " \t\n") == value {
+			classes = classes[:len(classes)-1]
+		}
+		start := 0
+		for _, class := range classes {
+			at := start + strings.Index(value[start:], class)
+			start = at + len(class)
+			if len(wispytail.UnresolvedClasses([]string{class}, c.trie)) == 0 {
+				continue
+			}
+			line, column := f.position(offset + match[2] + at)
+			c.report(f.path, line, column, "class %q cannot be resolved by wispytail", class)
+		}
+	}
+}
+
+// definitions adds the names of the templates of a file to defined
+func definitions(defined map[string]bool, f *checkFile) {
+	if f == nil {
+		return
+	}
+	for name := range f.trees {
+		defined[name] = true
+	}
+}
+
+// htmlFiles returns the .html files under dir, sorted
+func htmlFiles(dir string) []string {
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && filepath.Ext(path) == ".html" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// Check parses every supporting template, layout and page of the engine and
+// reports template calls of templates that are not defined, functions that do not
+// exist, layouts that cannot be found and classes wispytail cannot resolve. Pages
+// are checked as rendered with layoutPath.
+func (te *templateEngine) Check(layoutPath string) []CheckIssue {
+	te.mu.RLock()
+	layoutsDir, templatesDir := te.layoutsDir, te.templatesDir
+	layoutDirs := append([]string{te.layoutsDir}, te.layoutDirs...)
+	supportingDirs := te.supportingDirs
+	c := &checker{
+		funcs:  make(map[string]bool),
+		trie:   te.wispyTailTrie,
+		files:  make(map[string]*checkFile),
+		issues: make(map[CheckIssue]bool),
+	}
+	for name := range te.funcMap {
+		c.funcs[name] = true
+	}
+	te.mu.RUnlock()
+	for _, name := range builtinFuncs {
+		c.funcs[name] = true
+	}
+
+	// Partials, components and atoms, with the names LoadSupportingTemplates gives them
+	var supporting []*checkFile
+	supportingDefs := make(map[string]bool)
+	for _, dir := range supportingDirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || isComponentAsset(path) {
+				return nil
+			}
+			f := c.parse(path, filepath.Base(dir)+"/"+common.NormalizeTemplateName(dir, path))
+			definitions(supportingDefs, f)
+			supporting = append(supporting, f)
+			return nil
+		})
+	}
+
+	// Layouts, and the layouts they extend
+	for _, path := range htmlFiles(layoutsDir) {
+		rel, _ := filepath.Rel(layoutsDir, path)
+		f := c.parse(path, "layouts/"+rel)
+		if f == nil {
+			continue
+		}
+		if match := extendsHeader.FindStringSubmatchIndex(f.text); match != nil {
+			parent := layoutName(f.text[match[2]:match[3]])
+			if _, ok := findLayout(layoutDirs, parent); !ok {
+				line, column := f.position(match[2])
+				c.report(path, line, column, "unknown layout %q", parent)
+				continue
+			}
+		}
+		if _, err := te.layoutChain(rel); err != nil {
+			c.report(path, 1, 1, "%v", err)
+		}
+	}
+
+	// Pages, as rendered with their layouts
+	var chain []*checkFile
+	layouts, err := te.layoutChain(layoutPath)
+	if err != nil {
+		c.report(filepath.Join(layoutsDir, layoutName(layoutPath)), 1, 1, "unknown layout %q: %v", layoutName(layoutPath), err)
+	}
+	for _, layout := range layouts {
+		chain = append(chain, c.parse(layout.file, "layouts/"+layout.name))
+	}
+	allDefs := make(map[string]bool)
+	for name := range supportingDefs {
+		allDefs[name] = true
+	}
+	for _, path := range htmlFiles(templatesDir) {
+		rel, _ := filepath.Rel(templatesDir, path)
+		page := c.parse(path, rel)
+		if page == nil {
+			continue
+		}
+		defined := make(map[string]bool)
+		for name := range supportingDefs {
+			defined[name] = true
+		}
+		for _, f := range append(chain, page) {
+			definitions(defined, f)
+			definitions(allDefs, f)
+		}
+		c.walk(page, defined, "")
+		for _, f := range chain {
+			c.walk(f, defined, rel)
+		}
+	}
+
+	// Supporting templates may use the blocks of the pages they are rendered in
+	for _, f := range supporting {
+		c.walk(f, allDefs, "")
+	}
+	// Layouts no page is rendered with are checked for everything but template calls
+	for _, path := range htmlFiles(layoutsDir) {
+		c.walk(c.files[path], nil, "")
+	}
+
+	issues := make([]CheckIssue, 0, len(c.issues))
+	for issue := range c.issues {
+		issues = append(issues, issue)
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Message < b.Message
+	})
+	return issues
+}
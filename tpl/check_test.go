@@ -0,0 +1,122 @@
+package tpl
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	// Files every case starts with, which have no issues
+	base := map[string]string{
+		"layouts/default.html": `<html><body class="p-4">{{block "body" .}}{{end}}</body></html>`,
+		"atoms/button.html":    `<button class="btn btn-primary">{{.text}}</button>`,
+		"partials/nav.html":    `<nav>{{block "nav-links" .}}{{end}}</nav>`,
+		"pages/index.html":     `{{define "body"}}{{template "partials/nav" .}}{{component "atoms/button" "text" (upper "Go")}}{{end}}`,
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []CheckIssue
+	}{
+		{
+			name: "No issues",
+		},
+		{
+			name: "Missing templates",
+			files: map[string]string{
+				"pages/about.html": "{{define \"body\"}}\n  {{template \"partials/footer\" .}}{{component \"atoms/link\"}}\n{{end}}",
+			},
+			want: []CheckIssue{
+				{File: "pages/about.html", Line: 2, Column: 14, Message: `template "partials/footer" is not defined`},
+				{File: "pages/about.html", Line: 2, Column: 47, Message: `template "atoms/link" is not defined`},
+			},
+		},
+		{
+			name: "Undefined functions",
+			files: map[string]string{
+				"pages/about.html":  `{{define "body"}}{{shout .Title | lower}}{{end}}`,
+				"partials/bad.html": `{{if (missing .)}}x{{end}}`,
+			},
+			want: []CheckIssue{
+				{File: "pages/about.html", Line: 1, Column: 20, Message: `function "shout" is not defined`},
+				{File: "partials/bad.html", Line: 1, Column: 7, Message: `function "missing" is not defined`},
+			},
+		},
+		{
+			name: "Parse error",
+			files: map[string]string{
+				"pages/about.html": "{{define \"body\"}}\n{{if .Title}}\n{{end}}",
+			},
+			want: []CheckIssue{
+				{File: "pages/about.html", Line: 3, Column: 1, Message: `unexpected EOF`},
+			},
+		},
+		{
+			name: "Unknown layouts",
+			files: map[string]string{
+				"layouts/post.html": "\n{{/* extends \"blog\" */}}",
+				"layouts/a.html":    `{{/* extends "b" */}}`,
+				"layouts/b.html":    `{{/* extends "a" */}}`,
+			},
+			want: []CheckIssue{
+				{File: "layouts/a.html", Line: 1, Column: 1, Message: `circular layout chain: a.html -> b.html -> a.html`},
+				{File: "layouts/b.html", Line: 1, Column: 1, Message: `circular layout chain: b.html -> a.html -> b.html`},
+				{File: "layouts/post.html", Line: 2, Column: 15, Message: `unknown layout "blog.html"`},
+			},
+		},
+		{
+			name: "Block a layout expects from the page",
+			files: map[string]string{
+				"layouts/default.html": `<html>{{template "body" .}}</html>`,
+				"pages/about.html":     `<p>about</p>`,
+			},
+			want: []CheckIssue{
+				{File: "layouts/default.html", Line: 1, Column: 18, Message: `template "body" is not defined when rendering page about.html`},
+			},
+		},
+		{
+			name: "Unresolved classes",
+			files: map[string]string{
+				"pages/about.html": "{{define \"body\"}}\n<p class=\"card md:text-lgg bg-primary {{.Extra}}\">\n<i class=\"p-{{.Size}} text-lgg{{.Suffix}}\"></i>\n<span class=\"p-4 bg-primry\"></span>{{end}}",
+			},
+			want: []CheckIssue{
+				{File: "pages/about.html", Line: 2, Column: 16, Message: `class "md:text-lgg" cannot be resolved by wispytail`},
+				{File: "pages/about.html", Line: 4, Column: 18, Message: `class "bg-primry" cannot be resolved by wispytail`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range base {
+				writeTestFile(t, filepath.Join(root, name), content)
+			}
+			for name, content := range tt.files {
+				writeTestFile(t, filepath.Join(root, name), content)
+			}
+			te := NewTemplateEngine(filepath.Join(root, "layouts"), filepath.Join(root, "pages")).(*templateEngine)
+			te.LoadSupportingTemplates([]string{filepath.Join(root, "atoms"), filepath.Join(root, "partials")})
+
+			got := te.Check("default.html")
+			for i := range got {
+				got[i].File, _ = filepath.Rel(root, got[i].File)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIssueString(t *testing.T) {
+	issue := CheckIssue{File: "pages/about.html", Line: 2, Column: 3, Message: `template "x" is not defined`}
+	if got, want := issue.String(), `pages/about.html:2:3: template "x" is not defined`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"text/template/parse"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// propsBlock matches the default props a component declares at the top of its file:
+//
+//	{{/* props
+//	style = "btn-primary"
+//	size = "btn-md"
+//	*/}}
+var propsBlock = regexp.MustCompile(`\A\s*\{\{-?\s*/\*\s*props\s*\n([\s\S]*?)\*/\s*-?\}\}`)
+
+// componentSet holds what LoadSupportingTemplates found for each component:
+// default props and the CSS and JS files next to the template. It is not
+// changed once loaded, reloading builds a new set.
+type componentSet struct {
+	props map[string]map[string]interface{}
+	css   map[string]string
+	js    map[string]string
+}
+
+func newComponentSet() *componentSet {
+	return &componentSet{
+		props: make(map[string]map[string]interface{}),
+		css:   make(map[string]string),
+		js:    make(map[string]string),
+	}
+}
+
+// isComponentAsset reports whether a file in a supporting templates dir is a
+// component's co-located CSS or JS rather than a template
+func isComponentAsset(path string) bool {
+	switch filepath.Ext(path) {
+	case ".css", ".js":
+		return true
+	}
+	return false
+}
+
+// addAsset stores a co-located asset under its component's template name
+func (cs *componentSet) addAsset(name, path string, data []byte) {
+	if filepath.Ext(path) == ".css" {
+		cs.css[name] = string(data)
+	} else {
+		cs.js[name] = string(data)
+	}
+}
+
+// addProps reads the default props block of a component template, if it has one
+func (cs *componentSet) addProps(name string, data []byte) error {
+	match := propsBlock.FindSubmatch(data)
+	if match == nil {
+		return nil
+	}
+	props := make(map[string]interface{})
+	if err := toml.Unmarshal(match[1], &props); err != nil {
+		return fmt.Errorf("invalid props of component %s: %w", name, err)
+	}
+	cs.props[name] = props
+	return nil
+}
+
+// addAssets adds the CSS and JS of a component to the render, once per page
+func (cs *componentSet) addAssets(rs RenderState, name string) {
+	if cs == nil || rs == nil || !rs.MarkAsset("component:"+name) {
+		return
+	}
+	if css, ok := cs.css[name]; ok {
+		rs.AddHeadInlineCSS("\n/* " + name + " */\n" + css)
+	}
+	if js, ok := cs.js[name]; ok {
+		// Component scripts may end up in the head, so they wait for the document
+		rs.AddHeadInlineJS("\n/* " + name + " */\n(function(){var run=function(){\n" + js +
+			"\n};if(document.readyState===\"loading\"){document.addEventListener(\"DOMContentLoaded\",run)}else{run()}})();")
+	}
+}
+
+// componentSlot is slot content passed to a component, see slotFunc
+type componentSlot struct {
+	name    string
+	content template.HTML
+}
+
+// componentProps merges the default props of a component with the arguments of a
+// component call: key and value pairs, maps of props and slots
+func componentProps(defaults map[string]interface{}, args []interface{}) (map[string]interface{}, error) {
+	props := make(map[string]interface{}, len(defaults)+len(args)/2+1)
+	for key, value := range defaults {
+		props[key] = value
+	}
+	slots := make(map[string]template.HTML)
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i].(type) {
+		case componentSlot:
+			slots[arg.name] = arg.content
+		case map[string]interface{}:
+			for key, value := range arg {
+				props[key] = value
+			}
+		case string:
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("prop %q has no value", arg)
+			}
+			props[arg] = args[i+1]
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected component argument %v, want a prop name, a dict or a slot", arg)
+		}
+	}
+
+	props["slots"] = slots
+	// The default slot is also .children, as in the atomic design docs
+	if children, ok := slots["default"]; ok {
+		if _, set := props["children"]; !set {
+			props["children"] = children
+		}
+	}
+	return props, nil
+}
+
+// componentFunc returns the component template function:
+//
+//	{{component "atoms/button" "text" "Save" "style" "btn-ghost"}}
+//	{{component "components/card" (dict "title" .Title) (slot "actions" "partials/card-actions" .)}}
+func componentFunc(rs RenderState, tmpl *template.Template, components *componentSet) func(string, ...interface{}) (template.HTML, error) {
+	return func(name string, args ...interface{}) (template.HTML, error) {
+		if tmpl == nil {
+			return "", fmt.Errorf("component %q called outside of a render", name)
+		}
+		var defaults map[string]interface{}
+		if components != nil {
+			defaults = components.props[name]
+		}
+		props, err := componentProps(defaults, args)
+		if err != nil {
+			return "", fmt.Errorf("component %q: %w", name, err)
+		}
+
+		components.addAssets(rs, name)
+
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, props); err != nil {
+			return "", err
+		}
+		return template.HTML(buf.String()), nil
+	}
+}
+
+// slotFunc returns the slot template function, which fills a named slot of a
+// component with a template rendered with data, or with HTML such as another component:
+//
+//	(slot "footer" "partials/footer-links" .)
+//	(slot "actions" (component "atoms/button" "text" "Save"))
+func slotFunc(tmpl *template.Template) func(string, interface{}, ...interface{}) (componentSlot, error) {
+	return func(name string, content interface{}, data ...interface{}) (componentSlot, error) {
+		switch c := content.(type) {
+		case template.HTML:
+			return componentSlot{name: name, content: c}, nil
+		case string:
+			if tmpl == nil {
+				return componentSlot{}, fmt.Errorf("slot %q filled outside of a render", name)
+			}
+			var dot interface{}
+			if len(data) > 0 {
+				dot = data[0]
+			}
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, c, dot); err != nil {
+				return componentSlot{}, err
+			}
+			return componentSlot{name: name, content: template.HTML(buf.String())}, nil
+		default:
+			return componentSlot{}, fmt.Errorf("slot %q must be filled with a template name or HTML", name)
+		}
+	}
+}
+
+// usedComponents finds the components the named template of a set renders by name,
+// following {{template}} calls and nested components, so their assets can go in the
+// head before the page executes. Components picked at render time are found as they run.
+func usedComponents(tmpl *template.Template, name string) []string {
+	var found []string
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var walkTemplate func(name string)
+	var walk func(node parse.Node)
+
+	walkTemplate = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		if t := tmpl.Lookup(name); t != nil && t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) > 1 {
+				if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "component" {
+					if str, ok := n.Args[1].(*parse.StringNode); ok {
+						if !seen[str.Text] {
+							seen[str.Text] = true
+							found = append(found, str.Text)
+						}
+						walkTemplate(str.Text)
+					}
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+			walkTemplate(n.Name)
+		}
+	}
+
+	walkTemplate(name)
+	return found
+}
@@ -0,0 +1,132 @@
+package tpl
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var componentTemplates = map[string]string{
+	"layouts/default.html": `{{block "body" .}}{{end}}`,
+	"atoms/button.html": `{{/* props
+style = "btn-primary"
+type = "button"
+*/}}<button type="{{.type}}" class="btn {{.style}}">{{.text}}</button>`,
+	"atoms/button.css": `.btn{cursor:pointer}`,
+	"components/card.html": `<div class="card"><h2>{{.title}}</h2>{{.children}}` +
+		`{{with .slots.actions}}<footer>{{.}}</footer>{{end}}</div>`,
+	"components/card.js":   `console.log("card")`,
+	"partials/body.html":   `<p>{{.}}</p>`,
+	"pages/card.html":      `{{define "body"}}{{component "components/card" "title" .Title (slot "default" "partials/body" .Text) (slot "actions" (component "atoms/button" "text" "Buy"))}}{{end}}`,
+	"pages/buttons.html":   `{{define "body"}}{{component "atoms/button" "text" "A"}}{{component "atoms/button" (dict "text" "B" "style" "btn-ghost")}}{{end}}`,
+	"pages/dynamic.html":   `{{define "body"}}{{component .Name "text" "X"}}{{end}}`,
+	"pages/bad-props.html": `{{define "body"}}{{component "atoms/button" "text"}}{{end}}`,
+}
+
+func TestComponent(t *testing.T) {
+	te, _ := newTestEngine(t, componentTemplates, "atoms", "components", "partials")
+
+	tests := []struct {
+		name     string
+		page     string
+		data     map[string]interface{}
+		wantBody string
+		wantCSS  string
+		wantJS   bool
+		wantErr  bool
+	}{
+		{
+			name:     "Default props and overrides",
+			page:     "buttons.html",
+			wantBody: `<button type="button" class="btn btn-primary">A</button><button type="button" class="btn btn-ghost">B</button>`,
+			wantCSS:  "\n/* atoms/button */\n.btn{cursor:pointer}",
+		},
+		{
+			name: "Named and default slots",
+			page: "card.html",
+			data: map[string]interface{}{"Title": "Plan", "Text": "<b>"},
+			wantBody: `<div class="card"><h2>Plan</h2><p>&lt;b&gt;</p>` +
+				`<footer><button type="button" class="btn btn-primary">Buy</button></footer></div>`,
+			wantCSS: "\n/* atoms/button */\n.btn{cursor:pointer}",
+			wantJS:  true,
+		},
+		{
+			name:     "Component picked at render time",
+			page:     "dynamic.html",
+			data:     map[string]interface{}{"Name": "atoms/button"},
+			wantBody: `<button type="button" class="btn btn-primary">X</button>`,
+			wantCSS:  "\n/* atoms/button */\n.btn{cursor:pointer}",
+		},
+		{
+			name:    "Prop without a value",
+			page:    "bad-props.html",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := te.RenderWithLayout(tt.page, "default.html", TemplateData{Data: tt.data})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := rs.GetBody(); got != tt.wantBody {
+				t.Errorf("body =\n%s\nwant\n%s", got, tt.wantBody)
+			}
+			// Assets are added once however often a component is used
+			if got := rs.GetHeadInlineCSS(); got != tt.wantCSS {
+				t.Errorf("inline CSS = %q, want %q", got, tt.wantCSS)
+			}
+			if got := strings.Contains(rs.GetHeadInlineJS(), `console.log("card")`); got != tt.wantJS {
+				t.Errorf("inline JS has card script = %v, want %v", got, tt.wantJS)
+			}
+		})
+	}
+}
+
+func TestComponentAssetsInStreamedHead(t *testing.T) {
+	te, _ := newTestEngine(t, componentTemplates, "atoms", "components", "partials")
+
+	tests := []struct {
+		name       string
+		page       string
+		data       map[string]interface{}
+		wantInHead bool
+	}{
+		{name: "Known components go in the head", page: "card.html", wantInHead: true},
+		{name: "Components picked at render time go after the body", page: "dynamic.html", data: map[string]interface{}{"Name": "atoms/button"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if _, err := te.RenderWithLayoutTo(w, tt.page, "default.html", TemplateData{Data: tt.data}, StreamHooks{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := w.Body.String()
+			css := strings.Index(out, ".btn{cursor:pointer}")
+			if css < 0 || strings.Count(out, ".btn{cursor:pointer}") != 1 {
+				t.Fatalf("component CSS missing or repeated in %s", out)
+			}
+			if inHead := css < strings.Index(out, "</head>"); inHead != tt.wantInHead {
+				t.Errorf("CSS in head = %v, want %v", inHead, tt.wantInHead)
+			}
+		})
+	}
+}
+
+func TestUsedComponents(t *testing.T) {
+	te, _ := newTestEngine(t, componentTemplates, "atoms", "components", "partials")
+	cs, err := te.compiled("card.html", "default.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"components/card", "atoms/button"}
+	if !reflect.DeepEqual(cs.used, want) {
+		t.Errorf("used = %v, want %v", cs.used, want)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"io"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"wispy-core/common"
 	"wispy-core/wispytail"
@@ -21,30 +23,60 @@ import (
 type templateEngine struct {
 	mu                  sync.RWMutex
 	layoutsDir          string
+	layoutDirs          []string // searched after layoutsDir, see AddLayoutDirs
 	layouts             map[string][]byte
 	templatesDir        string
 	templates           map[string][]byte
 	supportingTemplates *template.Template
 	wispyTailTrie       *common.Trie
 	funcMap             template.FuncMap
+	funcProviders       []FuncProvider
+	components          *componentSet
+	assets              *AssetManager
+
+	// Compiled page and layout sets, see compiled
+	cacheMu             sync.RWMutex
+	cache               map[cacheKey]*compiledSet
+	generation          atomic.Uint64 // bumped whenever every compiled set must be rebuilt
+	supportingDirs      []string
+	supportingSignature dirsSignature
+	supportingCheckedAt atomic.Int64
 }
 
+// FuncProvider returns additional template functions for a render.
+// rs and tmpl are the render state and template set being executed; both are nil
+// when the provider is only asked for its function names at parse time.
+type FuncProvider func(rs RenderState, tmpl *template.Template) template.FuncMap
+
 type TemplateEngine interface {
 	LoadSupportingTemplates(supportingTemplatesDirs []string) (*template.Template, []error)
 	// TODO: Add support for walking directories and loading templates
 	// ScanAndLoadAllTemplates(rootDir string) error
 	LoadTemplate(templatePathName string) ([]byte, error)
 	LoadLayout(layoutPathName string) ([]byte, error)
+	AddLayoutDirs(dirs ...string)
 	//
 	GetTemplatesMap() map[string][]byte
 	GetSupportingTemplates() *template.Template
 	GetWispyTailTrie() *common.Trie
 	GetFuncMap() template.FuncMap
 	UpdateFuncMap(rs RenderState) // Update function map with render state for stateful functions
+	RegisterFuncs(provider FuncProvider)
 	// With layout support
 	RenderWithLayout(templatePathName, layoutPathName string, data TemplateData) (RenderState, error)
 	// Basic rendering
 	RenderTemplate(templatePathName string, data TemplateData) (RenderState, error)
+	// Streaming rendering to a response
+	RenderWithLayoutTo(w io.Writer, templatePathName, layoutPathName string, data TemplateData, hooks StreamHooks) (RenderState, error)
+	// Rendering a single block or partial of a page for partial page updates
+	RenderFragment(templatePathName, layoutPathName, fragment string, data TemplateData) (RenderState, error)
+	// Compiled template cache
+	Precompile(templatePathName, layoutPathName string) error
+	Invalidate()
+	// Asset manager used to fingerprint the styles and scripts of rendered pages
+	SetAssets(assets *AssetManager)
+	// Linting every template, e.g. in CI
+	Check(layoutPathName string) []CheckIssue
 }
 
 // NewTemplateEngine creates a new template engine
@@ -56,8 +88,44 @@ func NewTemplateEngine(layoutsDir, templatesDir string) TemplateEngine {
 		templates:           make(map[string][]byte),
 		supportingTemplates: template.New("supporting"),
 		wispyTailTrie:       wispytail.GetBaseTrie(),
-		funcMap:             getDefaultFuncMap(nil), // Initialize with default functions
+		funcMap:             buildFuncMap(nil, nil, nil, nil), // Initialize with default functions
+		components:          newComponentSet(),
+		cache:               make(map[cacheKey]*compiledSet),
+	}
+}
+
+// buildFuncMap combines the default functions, the built-in template helpers and
+// the registered providers into one function map
+func buildFuncMap(rs RenderState, tmpl *template.Template, providers []FuncProvider, components *componentSet) template.FuncMap {
+	funcMap := getDefaultFuncMap(rs)
+	funcMap["component"] = componentFunc(rs, tmpl, components)
+	funcMap["slot"] = slotFunc(tmpl)
+	funcMap["include"] = func(name string, data interface{}) (template.HTML, error) {
+		if tmpl == nil {
+			return "", fmt.Errorf("include %q called outside of a render", name)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return template.HTML(buf.String()), nil
+	}
+	for _, provider := range providers {
+		for name, fn := range provider(rs, tmpl) {
+			funcMap[name] = fn
+		}
+	}
+	return funcMap
+}
+
+// pageLanguage returns the language of the page being rendered, English when unknown
+func pageLanguage(rs RenderState) language.Tag {
+	if rs != nil {
+		if tag, err := language.Parse(rs.GetTemplateData().Locale); err == nil {
+			return tag
+		}
 	}
+	return language.English
 }
 
 // getDefaultFuncMap returns a map of default template functions
@@ -70,7 +138,7 @@ func getDefaultFuncMap(rs RenderState) template.FuncMap {
 			return strings.ToLower(s)
 		},
 		"title": func(s string) string {
-			return cases.Title(language.English).String(s)
+			return cases.Title(pageLanguage(rs)).String(s)
 		},
 		"join": func(sep string, items []string) string {
 			return strings.Join(items, sep)
@@ -127,6 +195,13 @@ func getDefaultFuncMap(rs RenderState) template.FuncMap {
 		"sub": func(a, b int) int {
 			return a - b
 		},
+		// asset returns the fingerprinted URL of a file in the site's assets directory
+		"asset": func(src string) string {
+			if rs == nil {
+				return src
+			}
+			return rs.GetAssets().URL(src)
+		},
 	}
 }
 
@@ -156,15 +231,45 @@ func (te *templateEngine) GetFuncMap() template.FuncMap {
 func (te *templateEngine) UpdateFuncMap(rs RenderState) {
 	te.mu.Lock()
 	defer te.mu.Unlock()
-	te.funcMap = getDefaultFuncMap(rs)
+	te.funcMap = buildFuncMap(rs, nil, te.funcProviders, te.components)
 }
 
-// LoadTemplate loads and caches a template from the given path.
-func (te *templateEngine) LoadTemplate(templatePath string) ([]byte, error) {
-	fullPath := filepath.Join(te.templatesDir, templatePath)
+// RegisterFuncs adds a provider of template functions to every render.
+// Register providers before loading supporting templates so they can use the functions.
+func (te *templateEngine) RegisterFuncs(provider FuncProvider) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	te.funcProviders = append(te.funcProviders, provider)
+	te.funcMap = buildFuncMap(nil, nil, te.funcProviders, te.components)
+	te.generation.Add(1)
+}
+
+// templateFile returns the file a template path is read from
+func (te *templateEngine) templateFile(templatePath string) string {
 	if te.templatesDir == "" {
-		fullPath = templatePath
+		return templatePath
 	}
+	return filepath.Join(te.templatesDir, templatePath)
+}
+
+// layoutFile returns the file a layout path is read from: the first one found in
+// the layouts directory and then the added layout directories
+func (te *templateEngine) layoutFile(layoutPath string) string {
+	if te.templatesDir == "" {
+		return layoutPath
+	}
+	te.mu.RLock()
+	dirs := append([]string{te.layoutsDir}, te.layoutDirs...)
+	te.mu.RUnlock()
+	if file, ok := findLayout(dirs, layoutPath); ok {
+		return file
+	}
+	return filepath.Join(te.layoutsDir, layoutPath)
+}
+
+// LoadTemplate loads and caches a template from the given path.
+func (te *templateEngine) LoadTemplate(templatePath string) ([]byte, error) {
+	fullPath := te.templateFile(templatePath)
 
 	te.mu.Lock()
 	defer te.mu.Unlock()
@@ -187,10 +292,7 @@ func (te *templateEngine) LoadTemplate(templatePath string) ([]byte, error) {
 
 // LoadLayout loads and caches a layout from the given path.
 func (te *templateEngine) LoadLayout(layoutPath string) ([]byte, error) {
-	fullPath := filepath.Join(te.layoutsDir, layoutPath)
-	if te.templatesDir == "" {
-		fullPath = layoutPath
-	}
+	fullPath := te.layoutFile(layoutPath)
 
 	te.mu.Lock()
 	defer te.mu.Unlock()
@@ -219,6 +321,11 @@ func (te *templateEngine) LoadSupportingTemplates(dirs []string) (*template.Temp
 
 	// Reset supporting templates with function map
 	te.supportingTemplates = template.New("supporting").Funcs(te.funcMap)
+	components := newComponentSet()
+	defer func() { te.components = components }()
+	te.supportingDirs = dirs
+	te.supportingSignature = signDirs(dirs)
+	defer te.generation.Add(1) // Pages compiled against the previous set are rebuilt
 
 	common.Debug("Loading supporting templates")
 	for _, dir := range dirs {
@@ -238,7 +345,15 @@ func (te *templateEngine) LoadSupportingTemplates(dirs []string) (*template.Temp
 			}
 			name := common.NormalizeTemplateName(dir, path)
 			name = filepath.Base(dir) + "/" + name // Ensure unique names based on directory
+			// CSS and JS next to a template belong to that component
+			if isComponentAsset(path) {
+				components.addAsset(name, path, data)
+				return nil
+			}
 			common.Debug("-- [%s](%s)", name, path)
+			if propsErr := components.addProps(name, data); propsErr != nil {
+				errs = append(errs, propsErr)
+			}
 			if _, parseErr := te.supportingTemplates.New(name).Parse(string(data)); parseErr != nil {
 				errs = append(errs, fmt.Errorf("failed to parse supporting template %s: %w", path, parseErr))
 			}
@@ -251,89 +366,65 @@ func (te *templateEngine) LoadSupportingTemplates(dirs []string) (*template.Temp
 	return te.supportingTemplates, errs
 }
 
-// RenderWithLayoutTo renders a template with the given layout to a writer.
-func (te *templateEngine) RenderWithLayout(templatePath, layoutPath string, data TemplateData) (RenderState, error) {
-	layoutData, err := te.LoadLayout(layoutPath)
-	if err != nil {
-		common.Error("Failed to load layout %s: %v", layoutPath, err)
-		return nil, err
-	}
+// SetAssets sets the asset manager of the pages this engine renders
+func (te *templateEngine) SetAssets(assets *AssetManager) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	te.assets = assets
+}
 
-	contentData, err := te.LoadTemplate(templatePath)
-	if err != nil {
-		common.Error("Failed to load template %s: %v", templatePath, err)
-		return nil, fmt.Errorf("failed to load template %s: %w", templatePath, err)
-	}
-	// Create a render state to store rendering information
+// newRenderState creates the render state of a render and fills it from data
+func (te *templateEngine) newRenderState(data TemplateData) RenderState {
 	rs := NewRenderState()
+	te.mu.RLock()
+	rs.SetAssets(te.assets)
+	te.mu.RUnlock()
 
-	// Clone supporting templates
-	tmpl, err := te.supportingTemplates.Clone()
-	tmpl.Funcs(getDefaultFuncMap(rs)) // Pass render state to function map
-	if err != nil {
-		return nil, fmt.Errorf("failed to clone supporting templates: %w", err)
-	}
+	// Populate render state with data from template
+	PopulateRenderStateFromTemplateData(rs, data)
+	return rs
+}
 
-	// Parse the layout template
-	_, err = tmpl.Parse(string(layoutData))
+// RenderWithLayout renders a template inside the given layout. The pair is compiled
+// once and reused until one of its files or the supporting templates change.
+func (te *templateEngine) RenderWithLayout(templatePath, layoutPath string, data TemplateData) (RenderState, error) {
+	cs, err := te.compiled(templatePath, layoutPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse layout template %s: %w", layoutPath, err)
+		common.Error("Failed to compile template %s with layout %s: %v", templatePath, layoutPath, err)
+		return nil, err
 	}
 
-	// Parse the content template and associate it with the layout template
-	// This allows the content template to define blocks that the layout references
-	_, err = tmpl.Parse(string(contentData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse content template %s: %w", templatePath, err)
+	// Create a render state to store rendering information
+	rs := te.newRenderState(data)
+	if err := cs.applyMeta(rs); err != nil {
+		return nil, err
 	}
 
-	// Populate render state with data from template
-	PopulateRenderStateFromTemplateData(rs, data)
-
 	// Execute the combined template (layout + content blocks)
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data.Data); err != nil {
+	if err := cs.execute(rs, data); err != nil {
 		return nil, fmt.Errorf("failed to render template with layout: %w", err)
 	}
 
-	// Set the rendered content in the render state
-	rs.SetBody(buf.String())
-
 	return rs, nil
 }
 
-// RenderWithLayoutTo renders a template with the given layout to a writer.
+// RenderTemplate renders a template without a layout.
 func (te *templateEngine) RenderTemplate(templatePath string, data TemplateData) (RenderState, error) {
-	result, err := te.LoadTemplate(templatePath)
+	cs, err := te.compiled(templatePath, "")
 	if err != nil {
-		common.Error("Failed to load template %s: %v", templatePath, err)
-		return nil, fmt.Errorf("failed to load template %s: %w", templatePath, err)
+		common.Error("Failed to compile template %s: %v", templatePath, err)
+		return nil, err
 	}
 
 	// Create a render state to store rendering information
-	rs := NewRenderState()
-
-	// Clone supporting templates
-	tmpl, err := te.supportingTemplates.Clone()
-	tmpl.Funcs(getDefaultFuncMap(rs)) // Pass render state to function map
-	if err != nil {
-		return nil, fmt.Errorf("failed to clone supporting templates: %w", err)
+	rs := te.newRenderState(data)
+	if err := cs.applyMeta(rs); err != nil {
+		return nil, err
 	}
 
-	// Parse the template
-	_, err = tmpl.Parse(string(result))
-
-	// Populate render state with data from template
-	PopulateRenderStateFromTemplateData(rs, data)
-
-	var contentBuf bytes.Buffer
-	if err := tmpl.Execute(&contentBuf, data.Data); err != nil {
+	if err := cs.execute(rs, data); err != nil {
 		return nil, fmt.Errorf("failed to render body template %s: %w", templatePath, err)
 	}
 
-	// Set the body content in the render state
-	rs.SetBody(contentBuf.String())
-
-	// Convert our RenderState to core/render.RenderState and render the complete HTML page
-	return rs, err
+	return rs, nil
 }
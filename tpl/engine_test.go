@@ -0,0 +1,219 @@
+package tpl
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestEngine writes files below a temp dir and returns an engine reading
+// layouts/ and pages/ with the supporting templates of dirs, e.g. partials/
+func newTestEngine(t *testing.T, files map[string]string, dirs ...string) (*templateEngine, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(root, name), content)
+	}
+
+	te := NewTemplateEngine(filepath.Join(root, "layouts"), filepath.Join(root, "pages")).(*templateEngine)
+	supporting := make([]string, len(dirs))
+	for i, dir := range dirs {
+		supporting[i] = filepath.Join(root, dir)
+	}
+	if _, errs := te.LoadSupportingTemplates(supporting); len(errs) > 0 {
+		t.Fatalf("LoadSupportingTemplates() errors = %v", errs)
+	}
+	return te, root
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var testTemplates = map[string]string{
+	"layouts/default.html": `<main>{{template "partials/nav" .}}{{block "body" .}}missing{{end}}</main>`,
+	"pages/index.html":     `{{define "body"}}<p>{{upper .Name}}</p>{{end}}`,
+	"pages/plain.html":     `<p>{{.Name}}</p>`,
+	"partials/nav.html":    `<nav>{{.Name}}</nav>`,
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   string
+		layout string
+		want   string
+	}{
+		{
+			name:   "Page with layout",
+			page:   "index.html",
+			layout: "default.html",
+			want:   "<main><nav>a &amp; b</nav><p>A &amp; B</p></main>",
+		},
+		{
+			name: "Page without layout",
+			page: "plain.html",
+			want: "<p>a &amp; b</p>",
+		},
+	}
+
+	te, _ := newTestEngine(t, testTemplates, "partials")
+	data := TemplateData{Data: map[string]interface{}{"Name": "a & b"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Render twice so the second render uses a pooled instance
+			for i := 0; i < 2; i++ {
+				var rs RenderState
+				var err error
+				if tt.layout != "" {
+					rs, err = te.RenderWithLayout(tt.page, tt.layout, data)
+				} else {
+					rs, err = te.RenderTemplate(tt.page, data)
+				}
+				if err != nil {
+					t.Fatalf("render %d: unexpected error: %v", i, err)
+				}
+				if got := rs.GetBody(); got != tt.want {
+					t.Errorf("render %d: body = %q, want %q", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderBindsFuncsToEachRender(t *testing.T) {
+	te, root := newTestEngine(t, testTemplates, "partials")
+	writeTestFile(t, filepath.Join(root, "pages", "title.html"), `{{define "body"}}{{setTitle .Name}}{{end}}`)
+
+	// A stateful provider like the form helpers, bound to the render state it is built for
+	te.RegisterFuncs(func(rs RenderState, tmpl *template.Template) template.FuncMap {
+		return template.FuncMap{
+			"setTitle": func(title string) string {
+				if rs != nil {
+					rs.SetHeadTitle(title)
+				}
+				return ""
+			},
+		}
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("page %d", i)
+			rs, err := te.RenderWithLayout("title.html", "default.html", TemplateData{Data: map[string]interface{}{"Name": name}})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if rs.GetHeadTitle() != name {
+				errs <- fmt.Errorf("title = %q, want %q", rs.GetHeadTitle(), name)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRenderPicksUpChanges(t *testing.T) {
+	te, root := newTestEngine(t, testTemplates, "partials")
+	data := TemplateData{Data: map[string]interface{}{"Name": "x"}}
+
+	render := func() string {
+		t.Helper()
+		rs, err := te.RenderWithLayout("index.html", "default.html", data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return rs.GetBody()
+	}
+	// expireChecks makes the next render look at the files again
+	expireChecks := func() {
+		te.supportingCheckedAt.Store(0)
+		te.cacheMu.RLock()
+		for _, cs := range te.cache {
+			cs.checkedAt.Store(0)
+		}
+		te.cacheMu.RUnlock()
+	}
+	edit := func(name, content string) {
+		path := filepath.Join(root, name)
+		writeTestFile(t, path, content)
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+		expireChecks()
+	}
+
+	if got, want := render(), "<main><nav>x</nav><p>X</p></main>"; got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+
+	edit("pages/index.html", `{{define "body"}}<h1>{{.Name}}</h1>{{end}}`)
+	if got, want := render(), "<main><nav>x</nav><h1>x</h1></main>"; got != want {
+		t.Errorf("after page edit: body = %q, want %q", got, want)
+	}
+
+	edit("partials/nav.html", `<header>{{.Name}}</header>`)
+	if got, want := render(), "<main><header>x</header><h1>x</h1></main>"; got != want {
+		t.Errorf("after partial edit: body = %q, want %q", got, want)
+	}
+
+	// Without an expired check the cached set is used as is
+	writeTestFile(t, filepath.Join(root, "layouts", "default.html"), `<div>{{block "body" .}}{{end}}</div>`)
+	if got, want := render(), "<main><header>x</header><h1>x</h1></main>"; got != want {
+		t.Errorf("before Invalidate: body = %q, want %q", got, want)
+	}
+	te.Invalidate()
+	if got, want := render(), "<div><h1>x</h1></div>"; got != want {
+		t.Errorf("after Invalidate: body = %q, want %q", got, want)
+	}
+}
+
+func TestPrecompile(t *testing.T) {
+	te, root := newTestEngine(t, testTemplates, "partials")
+	writeTestFile(t, filepath.Join(root, "pages", "broken.html"), `{{define "body"}}{{if}}{{end}}`)
+
+	tests := []struct {
+		name    string
+		page    string
+		wantErr bool
+	}{
+		{name: "Valid page", page: "index.html"},
+		{name: "Missing page", page: "missing.html", wantErr: true},
+		{name: "Parse error", page: "broken.html", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := te.Precompile(tt.page, "default.html")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Precompile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			te.cacheMu.RLock()
+			_, cached := te.cache[cacheKey{page: tt.page, layout: "default.html"}]
+			te.cacheMu.RUnlock()
+			if cached == tt.wantErr {
+				t.Errorf("cached = %v, want %v", cached, !tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package tpl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"wispy-core/common"
+)
+
+// FragmentParam is the query parameter that asks for a fragment of a page, e.g. ?fragment=results
+const FragmentParam = "fragment"
+
+// FragmentVary lists the request headers a page's response depends on once it can
+// answer with fragments
+const FragmentVary = "HX-Request, HX-Target"
+
+// ErrFragmentNotFound is returned by RenderFragment when the page has no template
+// of the requested name
+var ErrFragmentNotFound = errors.New("fragment not found")
+
+// RequestedFragment returns the fragment a request asks for: the fragment query
+// parameter or, for htmx requests, the id of the element being swapped (HX-Target).
+// explicit is false for the latter, as the target may be an element of the page
+// that is not a fragment, in which case the whole page should be sent.
+func RequestedFragment(r *http.Request) (name string, explicit bool) {
+	if name := r.URL.Query().Get(FragmentParam); name != "" {
+		return name, true
+	}
+	if r.Header.Get("HX-Request") == "true" {
+		return r.Header.Get("HX-Target"), false
+	}
+	return "", false
+}
+
+// fragmentComponents returns the components a fragment renders by name, found on
+// first use
+func (cs *compiledSet) fragmentComponents(name string) []string {
+	if used, ok := cs.fragments.Load(name); ok {
+		return used.([]string)
+	}
+	used := usedComponents(cs.master, name)
+	cs.fragments.Store(name, used)
+	return used
+}
+
+// RenderFragment renders one named template of a page compiled with its layout,
+// e.g. a block the page defines or a partial, for a partial page update. Only the
+// assets of the components the fragment uses are added to the render state.
+func (te *templateEngine) RenderFragment(templatePath, layoutPath, fragment string, data TemplateData) (RenderState, error) {
+	cs, err := te.compiled(templatePath, layoutPath)
+	if err != nil {
+		common.Error("Failed to compile template %s with layout %s: %v", templatePath, layoutPath, err)
+		return nil, err
+	}
+	if cs.master.Lookup(fragment) == nil {
+		return nil, fmt.Errorf("%w: %s in %s", ErrFragmentNotFound, fragment, templatePath)
+	}
+
+	rs := te.newRenderState(data)
+	for _, name := range cs.fragmentComponents(fragment) {
+		cs.components.addAssets(rs, name)
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := cs.executeTo(buf, rs, fragment, data); err != nil {
+		return nil, fmt.Errorf("failed to render fragment %s of %s: %w", fragment, templatePath, err)
+	}
+	rs.SetBody(buf.String())
+
+	return rs, nil
+}
+
+// FragmentRender writes a rendered fragment without HtmlBaseRender's document shell.
+// Its styles come first so the swapped in markup is never unstyled, its scripts
+// last so they find the markup they work on.
+func FragmentRender(w io.Writer, rs RenderState) error {
+	assets := newPageAssets(rs.GetAssets())
+	assets.writeLate(w, rs.GetHeadStyles(), rs.GetHeadInlineCSS(), nil, "")
+	writeBody(w, rs)
+	assets.writeLate(w, nil, "", rs.GetHeadScripts(), rs.GetHeadInlineJS())
+
+	return nil
+}
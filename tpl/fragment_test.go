@@ -0,0 +1,135 @@
+package tpl
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var fragmentTemplates = map[string]string{
+	"layouts/default.html": `<main>{{block "body" .}}{{end}}</main>{{block "footer" .}}<footer>site</footer>{{end}}`,
+	"atoms/button.html":    `<button class="btn">{{.text}}</button>`,
+	"atoms/button.css":     `.btn{cursor:pointer}`,
+	"atoms/badge.html":     `<span class="badge">{{.}}</span>`,
+	"atoms/badge.css":      `.badge{display:inline}`,
+	"pages/list.html": `{{define "body"}}{{component "atoms/button" "text" "Top"}}{{block "results" .}}<ul id="results">` +
+		`{{range .Items}}<li>{{template "atoms/badge" .}}</li>{{end}}</ul>{{end}}{{end}}`,
+}
+
+func TestRenderFragment(t *testing.T) {
+	te, _ := newTestEngine(t, fragmentTemplates, "atoms")
+	data := TemplateData{Data: map[string]interface{}{"Items": []string{"a", "<b>"}}}
+
+	tests := []struct {
+		name     string
+		fragment string
+		wantBody string
+		wantCSS  string
+		wantErr  error
+	}{
+		{
+			name:     "Block of the page",
+			fragment: "results",
+			wantBody: `<ul id="results"><li><span class="badge">a</span></li><li><span class="badge">&lt;b&gt;</span></li></ul>`,
+		},
+		{
+			name:     "Block of the layout",
+			fragment: "footer",
+			wantBody: `<footer>site</footer>`,
+		},
+		{
+			name:     "Only the assets of components in the fragment",
+			fragment: "body",
+			wantBody: `<button class="btn">Top</button><ul id="results"><li><span class="badge">a</span></li><li><span class="badge">&lt;b&gt;</span></li></ul>`,
+			wantCSS:  "\n/* atoms/button */\n.btn{cursor:pointer}",
+		},
+		{
+			name:     "Partial",
+			fragment: "atoms/button",
+			wantBody: `<button class="btn"></button>`,
+		},
+		{
+			name:     "Unknown fragment",
+			fragment: "sidebar",
+			wantErr:  ErrFragmentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := te.RenderFragment("list.html", "default.html", tt.fragment, data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := rs.GetBody(); got != tt.wantBody {
+				t.Errorf("body =\n%s\nwant\n%s", got, tt.wantBody)
+			}
+			if got := rs.GetHeadInlineCSS(); got != tt.wantCSS {
+				t.Errorf("inline CSS = %q, want %q", got, tt.wantCSS)
+			}
+		})
+	}
+
+	// Rendering fragments leaves the whole page intact
+	rs, err := te.RenderWithLayout("list.html", "default.html", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rs.GetBody(), `<main><button class="btn">Top</button><ul id="results">`) {
+		t.Errorf("page body = %s", rs.GetBody())
+	}
+}
+
+func TestRequestedFragment(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		headers      map[string]string
+		wantName     string
+		wantExplicit bool
+	}{
+		{name: "Whole page", url: "/list"},
+		{name: "Query parameter", url: "/list?fragment=results", wantName: "results", wantExplicit: true},
+		{name: "htmx target", url: "/list", headers: map[string]string{"HX-Request": "true", "HX-Target": "results"}, wantName: "results"},
+		{name: "Query parameter wins", url: "/list?fragment=footer", headers: map[string]string{"HX-Request": "true", "HX-Target": "results"}, wantName: "footer", wantExplicit: true},
+		{name: "Target without htmx", url: "/list", headers: map[string]string{"HX-Target": "results"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			name, explicit := RequestedFragment(r)
+			if name != tt.wantName || explicit != tt.wantExplicit {
+				t.Errorf("RequestedFragment() = %q, %v, want %q, %v", name, explicit, tt.wantName, tt.wantExplicit)
+			}
+		})
+	}
+}
+
+func TestFragmentRender(t *testing.T) {
+	rs := NewRenderState()
+	rs.AddHeadInlineCSS(".btn{cursor:pointer}")
+	rs.AddHeadInlineJS("init()")
+	rs.AddStyles(StyleAsset{Src: "/table.css"})
+	rs.SetBody(`<ul id="results"></ul>`)
+
+	var buf bytes.Buffer
+	if err := FragmentRender(&buf, rs); err != nil {
+		t.Fatal(err)
+	}
+	want := `<link rel="stylesheet" href="/table.css"><style>.btn{cursor:pointer}</style><ul id="results"></ul><script>init()</script>`
+	if got := buf.String(); got != want {
+		t.Errorf("FragmentRender() =\n%s\nwant\n%s", got, want)
+	}
+}
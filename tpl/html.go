@@ -2,7 +2,9 @@ package tpl
 
 import (
 	"io"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -22,19 +24,27 @@ func HtmlBaseRenderResponse(w http.ResponseWriter, rs RenderState) error {
 }
 
 func HtmlBaseRender(w io.Writer, rs RenderState) (err error) {
+	assets := newPageAssets(rs.GetAssets())
 	writeDocStart(w, rs)
-	writeHead(w, rs)
+	writeHead(w, rs, assets)
 	writeBody(w, rs)
+	assets.writeBodyEnd(w, rs.GetHeadStyles(), rs.GetHeadScripts())
 	writeDocEnd(w)
 
 	return nil
 }
 
 func writeDocStart(w io.Writer, rs RenderState) {
-	w.Write([]byte(`<!DOCTYPE html><html lang="en">`))
+	lang := rs.GetTemplateData().Locale
+	if lang == "" {
+		lang = "en"
+	}
+	w.Write([]byte(`<!DOCTYPE html><html`))
+	writeAttribute(w, "lang", lang)
+	w.Write([]byte(`>`))
 }
 
-func writeHead(w io.Writer, rs RenderState) {
+func writeHead(w io.Writer, rs RenderState, assets *pageAssets) {
 	w.Write([]byte(`<head>`))
 	w.Write([]byte(`<meta charset="UTF-8">`))
 	w.Write([]byte(`<meta name="viewport" content="width=device-width,initial-scale=1">`))
@@ -44,68 +54,272 @@ func writeHead(w io.Writer, rs RenderState) {
 	htmlEscaper.WriteString(w, rs.GetHeadTitle())
 	w.Write([]byte(`</title>`))
 
-	// Stylesheets
-	for _, style := range rs.GetHeadStyles() {
-		// TODO: Handle style priority if needed
-		w.Write([]byte(`<link rel="stylesheet" href="`))
-		w.Write([]byte(style.Src))
-		if len(style.Attrs) > 0 {
-			writeAttributes(w, style.Attrs)
+	// Search engines and link previews
+	for _, tag := range headMeta(rs) {
+		w.Write([]byte(`<meta`))
+		if tag.Property != "" {
+			writeAttribute(w, "property", tag.Property)
+		} else {
+			writeAttribute(w, "name", tag.Name)
 		}
+		writeAttribute(w, "content", tag.Content)
+		w.Write([]byte(`>`))
+	}
+	if canonical := rs.GetHeadCanonical(); canonical != "" {
+		w.Write([]byte(`<link rel="canonical"`))
+		writeAttribute(w, "href", canonical)
+		w.Write([]byte(`>`))
+	}
+
+	// The page in other languages
+	for _, alternate := range rs.GetTemplateData().Alternates {
+		w.Write([]byte(`<link rel="alternate"`))
+		writeAttribute(w, "hreflang", alternate.Locale)
+		writeAttribute(w, "href", alternate.URL)
 		w.Write([]byte(`>`))
 	}
 
+	for _, icon := range rs.GetHeadIcons() {
+		assets.writeIcon(w, icon)
+	}
+
+	assets.writeHead(w, rs.GetHeadStyles(), rs.GetHeadInlineCSS(), rs.GetHeadScripts(), rs.GetHeadInlineJS())
+
+	// Structured data, encoded with <, > and & escaped
+	for _, data := range rs.GetHeadJSONLD() {
+		w.Write([]byte(`<script type="application/ld+json">`))
+		w.Write([]byte(data))
+		w.Write([]byte(`</script>`))
+	}
+
+	w.Write([]byte(`</head>`))
+}
+
+func writeBody(w io.Writer, rs RenderState) {
+	// w.Write([]byte(`<body>`))
+	// Body content
+	w.Write([]byte(rs.GetBody()))
+	// w.Write([]byte(`</body>`))
+}
+
+func writeDocEnd(w io.Writer) {
+	w.Write([]byte(`</html>`))
+}
+
+// pageAssets writes the style and script tags of a page, each src once, with
+// local files fingerprinted and given integrity attributes by the asset manager
+type pageAssets struct {
+	assets  *AssetManager
+	written map[string]bool
+}
+
+func newPageAssets(assets *AssetManager) *pageAssets {
+	return &pageAssets{assets: assets, written: make(map[string]bool)}
+}
+
+// sortStyles orders styles by priority, keeping the order they were added in otherwise
+func sortStyles(styles []StyleAsset) []StyleAsset {
+	sorted := slices.Clone(styles)
+	slices.SortStableFunc(sorted, func(a, b StyleAsset) int { return a.Priority - b.Priority })
+	return sorted
+}
+
+// writeHead writes the assets that belong in the head, and preload hints for
+// the ones placed at the end of the body
+func (pa *pageAssets) writeHead(w io.Writer, styles []StyleAsset, inlineCSS string, scripts []ScriptAsset, inlineJS string) {
+	styles = sortStyles(styles)
+
+	// Hints first so the browser starts fetching while it parses the head
+	for _, style := range styles {
+		if style.Location == LocationBodyEnd {
+			pa.writePreload(w, style.Src, "style")
+		}
+	}
+	for _, script := range scripts {
+		if script.Location == LocationBodyEnd {
+			pa.writePreload(w, script.Src, scriptPreloadKind(script))
+		}
+	}
+
+	// Stylesheets
+	for _, style := range styles {
+		if style.Location != LocationBodyEnd {
+			pa.writeStyle(w, style)
+		}
+	}
+
 	// Inline CSS
-	if inlineCSS := rs.GetHeadInlineCSS(); inlineCSS != "" {
+	if inlineCSS != "" {
 		w.Write([]byte(`<style>`))
 		w.Write([]byte(inlineCSS))
 		w.Write([]byte(`</style>`))
 	}
 
 	// Scripts
-	for _, script := range rs.GetHeadScripts() {
-		w.Write([]byte(`<script src="`))
-		w.Write([]byte(script.Src))
-		if script.Async {
-			w.Write([]byte(`" async`))
+	for _, script := range scripts {
+		if script.Location != LocationBodyEnd {
+			pa.writeScript(w, script)
 		}
-		if script.Defer {
-			w.Write([]byte(`" defer`))
-		}
-		w.Write([]byte(`></script>`))
 	}
 
 	// Inline JS
-	if inlineJS := rs.GetHeadInlineJS(); inlineJS != "" {
+	if inlineJS != "" {
 		w.Write([]byte(`<script>`))
 		w.Write([]byte(inlineJS))
 		w.Write([]byte(`</script>`))
 	}
+}
 
-	w.Write([]byte(`</head>`))
+// writeBodyEnd writes the assets placed at the end of the body
+func (pa *pageAssets) writeBodyEnd(w io.Writer, styles []StyleAsset, scripts []ScriptAsset) {
+	for _, style := range sortStyles(styles) {
+		if style.Location == LocationBodyEnd {
+			pa.writeStyle(w, style)
+		}
+	}
+	for _, script := range scripts {
+		if script.Location == LocationBodyEnd {
+			pa.writeScript(w, script)
+		}
+	}
 }
 
-func writeBody(w io.Writer, rs RenderState) {
-	// w.Write([]byte(`<body>`))
-	// Body content
-	w.Write([]byte(rs.GetBody()))
-	// w.Write([]byte(`</body>`))
+// writeLate writes assets added after the head was sent, wherever they were meant to go
+func (pa *pageAssets) writeLate(w io.Writer, styles []StyleAsset, inlineCSS string, scripts []ScriptAsset, inlineJS string) {
+	for _, style := range sortStyles(styles) {
+		pa.writeStyle(w, style)
+	}
+	if inlineCSS != "" {
+		w.Write([]byte(`<style>`))
+		w.Write([]byte(inlineCSS))
+		w.Write([]byte(`</style>`))
+	}
+	for _, script := range scripts {
+		pa.writeScript(w, script)
+	}
+	if inlineJS != "" {
+		w.Write([]byte(`<script>`))
+		w.Write([]byte(inlineJS))
+		w.Write([]byte(`</script>`))
+	}
 }
 
-func writeDocEnd(w io.Writer) {
-	w.Write([]byte(`</html>`))
+func scriptPreloadKind(script ScriptAsset) string {
+	if script.Module {
+		return "module"
+	}
+	return "script"
+}
+
+// writePreload writes a preload hint, or a modulepreload hint when kind is "module"
+func (pa *pageAssets) writePreload(w io.Writer, src, kind string) {
+	if src == "" || pa.written["preload:"+src] || pa.written[src] {
+		return
+	}
+	pa.written["preload:"+src] = true
+
+	url, integrity := pa.assets.Resolve(src)
+	if kind == "module" {
+		w.Write([]byte(`<link rel="modulepreload"`))
+	} else {
+		w.Write([]byte(`<link rel="preload" as="`))
+		w.Write([]byte(kind))
+		w.Write([]byte(`"`))
+	}
+	writeAttribute(w, "href", url)
+	if integrity != "" {
+		writeAttribute(w, "integrity", integrity)
+	}
+	w.Write([]byte(`>`))
+}
+
+func (pa *pageAssets) writeStyle(w io.Writer, style StyleAsset) {
+	if style.Src == "" || pa.written[style.Src] {
+		return
+	}
+	pa.written[style.Src] = true
+
+	url, integrity := pa.assets.Resolve(style.Src)
+	if style.Type == StyleAsync {
+		w.Write([]byte(`<link rel="preload" as="style" onload="this.onload=null;this.rel='stylesheet'"`))
+	} else {
+		w.Write([]byte(`<link rel="stylesheet"`))
+	}
+	writeAttribute(w, "href", url)
+	if _, set := style.Attrs["integrity"]; integrity != "" && !set {
+		writeAttribute(w, "integrity", integrity)
+	}
+	writeAttributes(w, style.Attrs)
+	w.Write([]byte(`>`))
+
+	if style.Type == StyleAsync {
+		w.Write([]byte(`<noscript><link rel="stylesheet"`))
+		writeAttribute(w, "href", url)
+		w.Write([]byte(`></noscript>`))
+	}
+}
+
+func (pa *pageAssets) writeIcon(w io.Writer, icon IconAsset) {
+	if icon.Href == "" {
+		return
+	}
+	rel := icon.Rel
+	if rel == "" {
+		rel = "icon"
+	}
+	url, _ := pa.assets.Resolve(icon.Href)
+	w.Write([]byte(`<link`))
+	writeAttribute(w, "rel", rel)
+	if icon.Type != "" {
+		writeAttribute(w, "type", icon.Type)
+	}
+	if icon.Sizes != "" {
+		writeAttribute(w, "sizes", icon.Sizes)
+	}
+	writeAttribute(w, "href", url)
+	w.Write([]byte(`>`))
 }
 
+func (pa *pageAssets) writeScript(w io.Writer, script ScriptAsset) {
+	if script.Src == "" || pa.written[script.Src] {
+		return
+	}
+	pa.written[script.Src] = true
+
+	url, integrity := pa.assets.Resolve(script.Src)
+	w.Write([]byte(`<script`))
+	writeAttribute(w, "src", url)
+	if script.Module {
+		w.Write([]byte(` type="module"`))
+	}
+	if script.Async {
+		w.Write([]byte(` async`))
+	}
+	if script.Defer {
+		w.Write([]byte(` defer`))
+	}
+	if _, set := script.Attrs["integrity"]; integrity != "" && !set {
+		writeAttribute(w, "integrity", integrity)
+	}
+	writeAttributes(w, script.Attrs)
+	w.Write([]byte(`></script>`))
+}
+
+func writeAttribute(w io.Writer, key, value string) {
+	w.Write([]byte(` `))
+	w.Write([]byte(key))
+	w.Write([]byte(`="`))
+	htmlEscaper.WriteString(w, value)
+	w.Write([]byte(`"`))
+}
+
+// writeAttributes writes attributes sorted by name so the output is stable
 func writeAttributes(w io.Writer, attrs map[string]string) {
 	if len(attrs) == 0 {
 		return
 	}
 
-	for key, value := range attrs {
-		w.Write([]byte(` `))
-		w.Write([]byte(key))
-		w.Write([]byte(`="`))
-		htmlEscaper.WriteString(w, value)
-		w.Write([]byte(`"`))
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		writeAttribute(w, key, attrs[key])
 	}
 }
@@ -0,0 +1,97 @@
+package tpl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxLayoutDepth guards against unreasonably deep layout chains
+const maxLayoutDepth = 16
+
+// extendsHeader matches the parent a layout declares at the top of its file:
+//
+//	{{/* extends "base.html" */}}
+var extendsHeader = regexp.MustCompile(`\A\s*\{\{-?\s*/\*\s*extends\s+"([^"]+)"\s*\*/\s*-?\}\}`)
+
+// layoutSource is one layout of a chain
+type layoutSource struct {
+	name string
+	file string
+	data []byte
+}
+
+// layoutName adds the .html extension to layout names given without one, e.g. "blog"
+func layoutName(name string) string {
+	if filepath.Ext(name) == "" {
+		return name + ".html"
+	}
+	return name
+}
+
+// layoutParent returns the layout a layout extends, if any
+func layoutParent(data []byte) string {
+	match := extendsHeader.FindSubmatch(data)
+	if match == nil {
+		return ""
+	}
+	return layoutName(string(match[1]))
+}
+
+// AddLayoutDirs adds directories that are searched, in order, for layouts that are
+// not in the engine's own layouts directory, e.g. the design system's layouts
+func (te *templateEngine) AddLayoutDirs(dirs ...string) {
+	te.mu.Lock()
+	te.layoutDirs = append(te.layoutDirs, dirs...)
+	te.mu.Unlock()
+
+	te.Invalidate()
+}
+
+// layoutChain loads a layout and the layouts it extends, root first. The names
+// in a chain are resolved through the layout directories independently.
+func (te *templateEngine) layoutChain(layoutPath string) ([]layoutSource, error) {
+	var chain []layoutSource
+	seen := make(map[string]bool)
+
+	for name := layoutName(layoutPath); name != ""; {
+		if seen[name] {
+			names := make([]string, 0, len(chain)+1)
+			for _, layout := range chain {
+				names = append(names, layout.name)
+			}
+			return nil, fmt.Errorf("circular layout chain: %s -> %s", strings.Join(names, " -> "), name)
+		}
+		if len(chain) >= maxLayoutDepth {
+			return nil, fmt.Errorf("layout chain of %s is deeper than %d layouts", layoutPath, maxLayoutDepth)
+		}
+		seen[name] = true
+
+		data, err := te.LoadLayout(name)
+		if err != nil {
+			if len(chain) > 0 {
+				return nil, fmt.Errorf("layout %s extends %s: %w", chain[len(chain)-1].name, name, err)
+			}
+			return nil, err
+		}
+		chain = append(chain, layoutSource{name: name, file: te.layoutFile(name), data: data})
+		name = layoutParent(data)
+	}
+
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// findLayout returns the first file for a layout in the layout directories
+func findLayout(dirs []string, layoutPath string) (string, bool) {
+	for _, dir := range dirs {
+		file := filepath.Join(dir, layoutPath)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+	return "", false
+}
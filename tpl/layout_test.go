@@ -0,0 +1,137 @@
+package tpl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLayoutEngine writes a site, a design system and a CMS layouts directory, in
+// the order they are searched
+func newLayoutEngine(t *testing.T) (*templateEngine, string) {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		// CMS
+		"cms/layouts/base.html": `<html>{{block "head" .}}<title>site</title>{{end}}<body>{{block "main" .}}{{end}}</body></html>`,
+		// Design system
+		"system/layouts/blog.html": `{{/* extends "base" */}}
+{{define "main"}}<article>{{block "post" .}}no post{{end}}</article>{{block "sidebar" .}}<aside>blog</aside>{{end}}{{end}}`,
+		// Site
+		"site/layouts/blog-post.html": `{{/* extends "blog.html" */}}
+ignored text outside of the definitions
+{{define "sidebar"}}<aside>related</aside>{{end}}`,
+		"site/layouts/loop-a.html": `{{/* extends "loop-b" */}}`,
+		"site/layouts/loop-b.html": `{{/* extends "loop-a" */}}`,
+		"site/layouts/self.html":   `{{/* extends "self" */}}`,
+		"site/layouts/orphan.html": `{{/* extends "missing" */}}`,
+		"site/pages/post.html":     `{{define "post"}}<h1>{{.Title}}</h1>{{end}}`,
+		"site/pages/head.html":     `{{define "head"}}<title>{{.Title}}</title>{{end}}`,
+		"site/partials/.keep":      ``,
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(root, name), content)
+	}
+
+	te := NewTemplateEngine(filepath.Join(root, "site", "layouts"), filepath.Join(root, "site", "pages")).(*templateEngine)
+	te.AddLayoutDirs(filepath.Join(root, "system", "layouts"), filepath.Join(root, "cms", "layouts"))
+	return te, root
+}
+
+func TestNestedLayouts(t *testing.T) {
+	te, _ := newLayoutEngine(t)
+
+	tests := []struct {
+		name    string
+		page    string
+		layout  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "Blocks cascade through the chain",
+			page:   "post.html",
+			layout: "blog-post.html",
+			want:   `<html><title>site</title><body><article><h1>Hello</h1></article><aside>related</aside></body></html>`,
+		},
+		{
+			name:   "Layout from a fallback directory",
+			page:   "post.html",
+			layout: "blog",
+			want:   `<html><title>site</title><body><article><h1>Hello</h1></article><aside>blog</aside></body></html>`,
+		},
+		{
+			name:   "Page overrides a block of the root layout",
+			page:   "head.html",
+			layout: "blog-post.html",
+			want:   `<html><title>Hello</title><body><article>no post</article><aside>related</aside></body></html>`,
+		},
+		{
+			name:    "Circular chain",
+			page:    "post.html",
+			layout:  "loop-a.html",
+			wantErr: "circular layout chain: loop-a.html -> loop-b.html -> loop-a.html",
+		},
+		{
+			name:    "Layout extending itself",
+			page:    "post.html",
+			layout:  "self.html",
+			wantErr: "circular layout chain: self.html -> self.html",
+		},
+		{
+			name:    "Missing parent",
+			page:    "post.html",
+			layout:  "orphan.html",
+			wantErr: "layout orphan.html extends missing.html",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := te.RenderWithLayout(tt.page, tt.layout, TemplateData{Data: map[string]interface{}{"Title": "Hello"}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.TrimSpace(rs.GetBody()); got != tt.want {
+				t.Errorf("body =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedLayoutsRecompileWhenParentChanges(t *testing.T) {
+	te, root := newLayoutEngine(t)
+	data := TemplateData{Data: map[string]interface{}{"Title": "Hello"}}
+
+	if _, err := te.RenderWithLayout("post.html", "blog-post.html", data); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(root, "cms", "layouts", "base.html")
+	writeTestFile(t, path, `<main>{{block "main" .}}{{end}}</main>`)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	te.cacheMu.RLock()
+	for _, cs := range te.cache {
+		cs.checkedAt.Store(0)
+	}
+	te.cacheMu.RUnlock()
+
+	rs, err := te.RenderWithLayout("post.html", "blog-post.html", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<main><article><h1>Hello</h1></article><aside>related</aside></main>`; rs.GetBody() != want {
+		t.Errorf("body = %q, want %q", rs.GetBody(), want)
+	}
+}
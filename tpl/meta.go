@@ -0,0 +1,212 @@
+package tpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// frontMatterDelim opens and closes the front matter of a page
+const frontMatterDelim = "+++"
+
+// PageMeta describes a page for search engines and link previews. Pages set it
+// in TOML front matter, sites set defaults in the [seo] table of config.toml:
+//
+//	+++
+//	title = "About us"
+//	description = "Who we are"
+//	image = "/assets/team.jpg"
+//	[og]
+//	type = "article"
+//	[[json_ld]]
+//	"@context" = "https://schema.org"
+//	"@type" = "AboutPage"
+//	+++
+type PageMeta struct {
+	Title       string                   `toml:"title"`
+	Description string                   `toml:"description"`
+	Robots      string                   `toml:"robots"`    // e.g. "noindex, nofollow"
+	Canonical   string                   `toml:"canonical"` // absolute, or relative to the site's base URL
+	Image       string                   `toml:"image"`     // og:image, absolute or relative to the base URL
+	OpenGraph   map[string]string        `toml:"og"`        // og: properties without the prefix, e.g. type = "article"
+	Twitter     map[string]string        `toml:"twitter"`   // twitter: names without the prefix, e.g. site = "@wispy"
+	Icons       []IconAsset              `toml:"icons"`
+	JSONLD      []map[string]interface{} `toml:"json_ld"`
+	Sitemap     SitemapMeta              `toml:"sitemap"`
+}
+
+// SitemapMeta is how a page is listed in the site's sitemap.xml
+type SitemapMeta struct {
+	Exclude    bool    `toml:"exclude"`
+	ChangeFreq string  `toml:"changefreq"` // always, hourly, daily, weekly, monthly, yearly or never
+	Priority   float64 `toml:"priority"`   // 0.0 to 1.0
+}
+
+// sitemapChangeFreqs are the values changefreq takes in a sitemap
+var sitemapChangeFreqs = []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}
+
+// splitFrontMatter separates the TOML front matter at the top of a page from its
+// template. The front matter is replaced by as many newlines so template errors
+// keep pointing at the right lines.
+func splitFrontMatter(data []byte) (frontMatter []byte, content []byte) {
+	rest, ok := bytes.CutPrefix(data, []byte(frontMatterDelim+"\n"))
+	if !ok {
+		rest, ok = bytes.CutPrefix(data, []byte(frontMatterDelim+"\r\n"))
+	}
+	if !ok {
+		return nil, data
+	}
+	end := bytes.Index(rest, []byte("\n"+frontMatterDelim))
+	if end < 0 {
+		return nil, data
+	}
+	frontMatter = rest[:end+1]
+	after := rest[end+1+len(frontMatterDelim):]
+
+	lines := bytes.Count(data[:len(data)-len(after)], []byte("\n"))
+	content = append(bytes.Repeat([]byte("\n"), lines), after...)
+	return frontMatter, content
+}
+
+// parseFrontMatter reads the front matter of a page
+func parseFrontMatter(frontMatter []byte) (PageMeta, error) {
+	var meta PageMeta
+	if len(frontMatter) == 0 {
+		return meta, nil
+	}
+	decoder := toml.NewDecoder(bytes.NewReader(frontMatter))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&meta); err != nil {
+		return meta, err
+	}
+	return meta, meta.Validate()
+}
+
+// Validate reports structured data that cannot be written as JSON-LD and sitemap
+// values search engines do not know
+func (m PageMeta) Validate() error {
+	for i, data := range m.JSONLD {
+		if _, err := json.Marshal(data); err != nil {
+			return fmt.Errorf("json_ld %d: %w", i+1, err)
+		}
+	}
+	if m.Sitemap.ChangeFreq != "" && !slices.Contains(sitemapChangeFreqs, m.Sitemap.ChangeFreq) {
+		return fmt.Errorf("sitemap changefreq %q must be one of %s", m.Sitemap.ChangeFreq, strings.Join(sitemapChangeFreqs, ", "))
+	}
+	if m.Sitemap.Priority < 0 || m.Sitemap.Priority > 1 {
+		return fmt.Errorf("sitemap priority %v must be between 0 and 1", m.Sitemap.Priority)
+	}
+	return nil
+}
+
+// ReadPageMeta reads the front matter of the page file at path
+func ReadPageMeta(path string) (PageMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PageMeta{}, err
+	}
+	frontMatter, _ := splitFrontMatter(data)
+	return parseFrontMatter(frontMatter)
+}
+
+// Apply sets what the meta says on a render, over what was set before. Relative
+// URLs are resolved against the base URL of the render's site.
+func (m PageMeta) Apply(rs RenderState) error {
+	baseURL := rs.GetTemplateData().Site.BaseURL
+	if m.Title != "" {
+		rs.SetHeadTitle(m.Title)
+	}
+	if m.Description != "" {
+		rs.SetHeadMeta(MetaTag{Name: "description", Content: m.Description})
+	}
+	if m.Robots != "" {
+		rs.SetHeadMeta(MetaTag{Name: "robots", Content: m.Robots})
+	}
+	if m.Canonical != "" {
+		rs.SetHeadCanonical(absoluteURL(baseURL, m.Canonical))
+	}
+	if m.Image != "" {
+		rs.SetHeadMeta(MetaTag{Property: "og:image", Content: absoluteURL(baseURL, m.Image)})
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.OpenGraph)) {
+		value := m.OpenGraph[key]
+		if key == "image" || key == "url" {
+			value = absoluteURL(baseURL, value)
+		}
+		rs.SetHeadMeta(MetaTag{Property: "og:" + strings.TrimPrefix(key, "og:"), Content: value})
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.Twitter)) {
+		rs.SetHeadMeta(MetaTag{Name: "twitter:" + strings.TrimPrefix(key, "twitter:"), Content: m.Twitter[key]})
+	}
+	for _, icon := range m.Icons {
+		rs.AddHeadIcon(icon)
+	}
+	var errs []error
+	for _, data := range m.JSONLD {
+		errs = append(errs, rs.AddHeadJSONLD(data))
+	}
+	return errors.Join(errs...)
+}
+
+// absoluteURL resolves a URL relative to the site's base URL, e.g. "/assets/a.jpg"
+func absoluteURL(baseURL, ref string) string {
+	if baseURL == "" {
+		return ref
+	}
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+	if err != nil {
+		return ref
+	}
+	resolved, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return resolved.String()
+}
+
+// headMeta returns the meta tags of the head. Pages with a canonical URL are
+// public, so their link previews fall back to the title, description and URL.
+func headMeta(rs RenderState) []MetaTag {
+	tags := slices.Clone(rs.GetHeadMeta())
+	canonical := rs.GetHeadCanonical()
+	if canonical == "" {
+		return tags
+	}
+
+	has := func(name, property string) bool {
+		return slices.ContainsFunc(tags, func(tag MetaTag) bool {
+			return tag.Name == name && tag.Property == property
+		})
+	}
+	description := ""
+	for _, tag := range tags {
+		if tag.Name == "description" {
+			description = tag.Content
+		}
+	}
+	fallbacks := []MetaTag{
+		{Property: "og:title", Content: rs.GetHeadTitle()},
+		{Property: "og:description", Content: description},
+		{Property: "og:url", Content: canonical},
+		{Property: "og:type", Content: "website"},
+		{Property: "og:site_name", Content: rs.GetTemplateData().Site.Name},
+		{Name: "twitter:card", Content: "summary"},
+	}
+	if has("", "og:image") {
+		fallbacks[len(fallbacks)-1].Content = "summary_large_image"
+	}
+	for _, tag := range fallbacks {
+		if tag.Content != "" && !has(tag.Name, tag.Property) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
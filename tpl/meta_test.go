@@ -0,0 +1,170 @@
+package tpl
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		wantFrontMatter string
+		wantContent     string
+	}{
+		{name: "No front matter", data: "<p>x</p>", wantContent: "<p>x</p>"},
+		{name: "Front matter", data: "+++\ntitle = \"x\"\n+++\n<p>x</p>", wantFrontMatter: "title = \"x\"\n", wantContent: "\n\n\n<p>x</p>"},
+		{name: "Windows line endings", data: "+++\r\ntitle = \"x\"\r\n+++\r\n<p>x</p>", wantFrontMatter: "title = \"x\"\r\n", wantContent: "\n\n\r\n<p>x</p>"},
+		{name: "Not closed", data: "+++\ntitle = \"x\"\n<p>x</p>", wantContent: "+++\ntitle = \"x\"\n<p>x</p>"},
+		{name: "Not at the top", data: "\n+++\ntitle = \"x\"\n+++", wantContent: "\n+++\ntitle = \"x\"\n+++"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontMatter, content := splitFrontMatter([]byte(tt.data))
+			if string(frontMatter) != tt.wantFrontMatter || string(content) != tt.wantContent {
+				t.Errorf("splitFrontMatter() = %q, %q, want %q, %q", frontMatter, content, tt.wantFrontMatter, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestPageMetaApply(t *testing.T) {
+	rs := NewRenderState()
+	rs.SetTemplateData(TemplateData{Site: SiteData{BaseURL: "https://example.com/"}})
+	rs.SetHeadMeta(MetaTag{Name: "description", Content: "Site"})
+
+	meta := PageMeta{
+		Title:       "About",
+		Description: "Who we are",
+		Canonical:   "/about",
+		Image:       "assets/team.jpg",
+		OpenGraph:   map[string]string{"type": "article", "url": "/about?ref=og"},
+		Twitter:     map[string]string{"site": "@wispy"},
+		JSONLD:      []map[string]interface{}{{"@type": "AboutPage"}},
+	}
+	if err := meta.Apply(rs); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rs.GetHeadTitle(); got != "About" {
+		t.Errorf("title = %q, want About", got)
+	}
+	if got := rs.GetHeadCanonical(); got != "https://example.com/about" {
+		t.Errorf("canonical = %q, want https://example.com/about", got)
+	}
+	wantMeta := []MetaTag{
+		{Name: "description", Content: "Who we are"},
+		{Property: "og:image", Content: "https://example.com/assets/team.jpg"},
+		{Property: "og:type", Content: "article"},
+		{Property: "og:url", Content: "https://example.com/about?ref=og"},
+		{Name: "twitter:site", Content: "@wispy"},
+	}
+	if got := rs.GetHeadMeta(); !reflect.DeepEqual(got, wantMeta) {
+		t.Errorf("meta = %#v, want %#v", got, wantMeta)
+	}
+	if got := rs.GetHeadJSONLD(); !reflect.DeepEqual(got, []string{`{"@type":"AboutPage"}`}) {
+		t.Errorf("JSON-LD = %q", got)
+	}
+
+	rs.SetHeadMeta(MetaTag{Name: "twitter:site"})
+	if got := len(rs.GetHeadMeta()); got != len(wantMeta)-1 {
+		t.Errorf("meta tags after removing one = %d, want %d", got, len(wantMeta)-1)
+	}
+}
+
+func TestHeadTags(t *testing.T) {
+	te, root := newTestEngine(t, testTemplates, "partials")
+	writeTestFile(t, filepath.Join(root, "pages", "about.html"), `+++
+title = "About <us>"
+description = "Tom & Jerry's \"page\""
+robots = "noindex"
+image = "/assets/share.png"
+[[icons]]
+href = "/favicon.svg"
+type = "image/svg+xml"
+[[json_ld]]
+"@context" = "https://schema.org"
+name = "</script><script>alert(1)</script>"
++++
+{{define "body"}}<p>about</p>{{end}}`)
+	writeTestFile(t, filepath.Join(root, "pages", "broken.html"), "+++\ntitel = \"x\"\n+++\n<p>x</p>")
+
+	data := TemplateData{Site: SiteData{Name: "Example", BaseURL: "https://example.com"}, Data: map[string]interface{}{"Name": "x"}}
+	head := func(rs RenderState) {
+		rs.SetHeadTitle("About | Example")
+		rs.SetHeadCanonical("https://example.com/about")
+		rs.AddHeadIcon(IconAsset{Href: "/apple.png", Rel: "apple-touch-icon", Sizes: "180x180"})
+	}
+
+	tests := []struct {
+		name    string
+		page    string
+		head    func(rs RenderState)
+		want    []string
+		notWant []string
+		wantErr string
+	}{
+		{
+			name: "Front matter and escaping",
+			page: "about.html",
+			head: head,
+			want: []string{
+				`<title>About &lt;us&gt;</title>` +
+					`<meta name="description" content="Tom &amp; Jerry&#39;s &#34;page&#34;">` +
+					`<meta name="robots" content="noindex">` +
+					`<meta property="og:image" content="https://example.com/assets/share.png">` +
+					`<meta property="og:title" content="About &lt;us&gt;">` +
+					`<meta property="og:description" content="Tom &amp; Jerry&#39;s &#34;page&#34;">` +
+					`<meta property="og:url" content="https://example.com/about">` +
+					`<meta property="og:type" content="website">` +
+					`<meta property="og:site_name" content="Example">` +
+					`<meta name="twitter:card" content="summary_large_image">` +
+					`<link rel="canonical" href="https://example.com/about">` +
+					`<link rel="apple-touch-icon" sizes="180x180" href="/apple.png">` +
+					`<link rel="icon" type="image/svg+xml" href="/favicon.svg">`,
+				`<script type="application/ld+json">{"@context":"https://schema.org","name":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"}</script></head>`,
+			},
+		},
+		{
+			name:    "Pages without a canonical URL get no link previews",
+			page:    "index.html",
+			want:    []string{`<title></title></head>`},
+			notWant: []string{`og:`, `twitter:`},
+		},
+		{
+			name:    "Invalid front matter",
+			page:    "broken.html",
+			wantErr: "invalid front matter of broken.html",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			_, err := te.RenderWithLayoutTo(w, tt.page, "default.html", data, StreamHooks{Head: tt.head})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("page does not contain\n%s\n%s", want, w.Body.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(w.Body.String(), notWant) {
+					t.Errorf("page contains %s\n%s", notWant, w.Body.String())
+				}
+			}
+		})
+	}
+}
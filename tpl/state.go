@@ -1,21 +1,53 @@
 package tpl
 
 import (
+	"encoding/json"
 	"sync"
 )
 
+// Asset locations
+const (
+	LocationHead    = "head" // default
+	LocationBodyEnd = "body-end"
+)
+
+// Style types
+const (
+	StyleBlocking = iota // a regular stylesheet, the default
+	StyleAsync           // preloaded and applied once loaded, for styles not needed on first paint
+)
+
 type StyleAsset struct {
 	Src      string
-	Location string
-	Priority int
+	Location string // LocationHead or LocationBodyEnd
+	Priority int    // styles are written in ascending priority, so higher ones win in the cascade
 	Attrs    map[string]string
-	Type     int
+	Type     int // StyleBlocking or StyleAsync
 }
 
 type ScriptAsset struct {
-	Src   string
-	Async bool
-	Defer bool
+	Src      string
+	Async    bool
+	Defer    bool
+	Module   bool   // type="module"
+	Location string // LocationHead or LocationBodyEnd
+	Attrs    map[string]string
+}
+
+// MetaTag is a <meta> tag of the head, keyed by Name ("description",
+// "twitter:card") or by Property for OpenGraph ("og:image")
+type MetaTag struct {
+	Name     string
+	Property string
+	Content  string
+}
+
+// IconAsset is a favicon or touch icon link
+type IconAsset struct {
+	Href  string `toml:"href"`
+	Rel   string `toml:"rel"`   // "icon" when empty, or e.g. "apple-touch-icon"
+	Type  string `toml:"type"`  // e.g. "image/svg+xml"
+	Sizes string `toml:"sizes"` // e.g. "32x32"
 }
 
 type renderState struct {
@@ -25,7 +57,14 @@ type renderState struct {
 	inlineJS  string
 	styles    []StyleAsset
 	scripts   []ScriptAsset
+	meta      []MetaTag
+	canonical string
+	icons     []IconAsset
+	jsonLD    []string
 	body      string
+	data      TemplateData
+	marked    map[string]bool
+	assets    *AssetManager
 }
 
 type RenderState interface {
@@ -40,8 +79,27 @@ type RenderState interface {
 	SetHeadTitle(title string)
 	AddHeadInlineCSS(css string)
 	AddHeadInlineJS(js string)
+	// SetHeadMeta sets a meta tag, replacing the one with the same name or
+	// property. A tag without content removes it.
+	SetHeadMeta(tag MetaTag)
+	GetHeadMeta() []MetaTag
+	SetHeadCanonical(url string)
+	GetHeadCanonical() string
+	AddHeadIcon(icon IconAsset)
+	GetHeadIcons() []IconAsset
+	// AddHeadJSONLD adds a block of structured data, encoded as JSON
+	AddHeadJSONLD(data interface{}) error
+	GetHeadJSONLD() []string
 	SetBody(content string)
 	GetBody() string
+	// Template data of the render, for functions that need request specific values
+	SetTemplateData(data TemplateData)
+	GetTemplateData() TemplateData
+	// MarkAsset records an asset and reports whether the page did not have it yet
+	MarkAsset(key string) bool
+	// Asset manager that fingerprints local styles and scripts, may be nil
+	SetAssets(assets *AssetManager)
+	GetAssets() *AssetManager
 }
 
 func NewRenderState() RenderState {
@@ -115,6 +173,73 @@ func (rs *renderState) AddScripts(scripts ScriptAsset) {
 	rs.scripts = append(rs.scripts, scripts)
 }
 
+func (rs *renderState) SetHeadMeta(tag MetaTag) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for i, existing := range rs.meta {
+		if existing.Name == tag.Name && existing.Property == tag.Property {
+			if tag.Content == "" {
+				rs.meta = append(rs.meta[:i:i], rs.meta[i+1:]...)
+			} else {
+				rs.meta[i] = tag
+			}
+			return
+		}
+	}
+	if tag.Content != "" {
+		rs.meta = append(rs.meta, tag)
+	}
+}
+
+func (rs *renderState) GetHeadMeta() []MetaTag {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.meta
+}
+
+func (rs *renderState) SetHeadCanonical(url string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.canonical = url
+}
+
+func (rs *renderState) GetHeadCanonical() string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.canonical
+}
+
+func (rs *renderState) AddHeadIcon(icon IconAsset) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.icons = append(rs.icons, icon)
+}
+
+func (rs *renderState) GetHeadIcons() []IconAsset {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.icons
+}
+
+// AddHeadJSONLD encodes data with json.Marshal, which escapes <, > and &, so
+// the block cannot close its script tag
+func (rs *renderState) AddHeadJSONLD(data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.jsonLD = append(rs.jsonLD, string(encoded))
+	return nil
+}
+
+func (rs *renderState) GetHeadJSONLD() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.jsonLD
+}
+
 func (rs *renderState) SetBody(content string) {
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
@@ -126,3 +251,40 @@ func (rs *renderState) GetBody() string {
 	defer rs.mu.Unlock()
 	return rs.body
 }
+
+func (rs *renderState) SetTemplateData(data TemplateData) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.data = data
+}
+
+func (rs *renderState) GetTemplateData() TemplateData {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.data
+}
+
+func (rs *renderState) MarkAsset(key string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.marked[key] {
+		return false
+	}
+	if rs.marked == nil {
+		rs.marked = make(map[string]bool)
+	}
+	rs.marked[key] = true
+	return true
+}
+
+func (rs *renderState) SetAssets(assets *AssetManager) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.assets = assets
+}
+
+func (rs *renderState) GetAssets() *AssetManager {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.assets
+}
@@ -0,0 +1,142 @@
+package tpl
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sync"
+
+	"wispy-core/common"
+)
+
+// streamBufferSize is how much body is held back before it is written to the response
+const streamBufferSize = 8 << 10
+
+var streamWriterPool = sync.Pool{
+	New: func() any { return bufio.NewWriterSize(io.Discard, streamBufferSize) },
+}
+
+// StreamHooks let the caller of RenderWithLayoutTo take part in a streamed render
+type StreamHooks struct {
+	// Head runs before the head is written, e.g. to add the theme CSS or set the title.
+	// The front matter of the page is applied after it, over what it set. The title
+	// and meta tags cannot change after this.
+	Head func(rs RenderState)
+	// Body, if set, also receives the body as it is written, e.g. to collect class names
+	Body io.Writer
+	// Deferred runs after the body. Assets it adds, like those added while the
+	// template executed, are written to the deferred head slot after the body.
+	Deferred func(rs RenderState)
+}
+
+// StreamError is returned by RenderWithLayoutTo when the template failed after the
+// response was started. The page has been closed with a notice in place of the
+// missing content, so the caller can only log it.
+type StreamError struct {
+	Err error
+}
+
+func (e *StreamError) Error() string {
+	return "render failed mid-stream: " + e.Err.Error()
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// headMark records how much of each head asset list was written with the head
+type headMark struct {
+	styles, inlineCSS, scripts, inlineJS int
+}
+
+func markHead(rs RenderState) headMark {
+	return headMark{
+		styles:    len(rs.GetHeadStyles()),
+		inlineCSS: len(rs.GetHeadInlineCSS()),
+		scripts:   len(rs.GetHeadScripts()),
+		inlineJS:  len(rs.GetHeadInlineJS()),
+	}
+}
+
+// writeDeferredHead writes the head assets added after the head was sent, then the
+// assets placed at the end of the body. Browsers accept stylesheets, styles and
+// scripts at the end of the body.
+func writeDeferredHead(w io.Writer, rs RenderState, mark headMark, assets *pageAssets) {
+	styles, scripts := rs.GetHeadStyles(), rs.GetHeadScripts()
+	assets.writeLate(w,
+		styles[mark.styles:],
+		rs.GetHeadInlineCSS()[mark.inlineCSS:],
+		scripts[mark.scripts:],
+		rs.GetHeadInlineJS()[mark.inlineJS:],
+	)
+	assets.writeBodyEnd(w, styles, scripts)
+}
+
+// writeRenderError ends a body whose template failed part way through
+func writeRenderError(w io.Writer) {
+	w.Write([]byte(`<div role="alert" class="render-error">Part of this page could not be displayed.</div>`))
+}
+
+func flush(w io.Writer) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// RenderWithLayoutTo renders a template inside the given layout straight to w.
+// The head is written and flushed before the template executes so the browser can
+// fetch stylesheets while the body is produced; the body is not kept in the render
+// state. Errors that occur before anything was written are returned as is, failures
+// during execution as a *StreamError.
+func (te *templateEngine) RenderWithLayoutTo(w io.Writer, templatePath, layoutPath string, data TemplateData, hooks StreamHooks) (RenderState, error) {
+	cs, err := te.compiled(templatePath, layoutPath)
+	if err != nil {
+		common.Error("Failed to compile template %s with layout %s: %v", templatePath, layoutPath, err)
+		return nil, err
+	}
+
+	// Create a render state to store rendering information
+	rs := te.newRenderState(data)
+	if hooks.Head != nil {
+		hooks.Head(rs)
+	}
+	if err := cs.applyMeta(rs); err != nil {
+		return nil, err
+	}
+	cs.addComponentAssets(rs)
+
+	assets := newPageAssets(rs.GetAssets())
+	mark := markHead(rs)
+	writeDocStart(w, rs)
+	writeHead(w, rs, assets)
+	flush(w)
+
+	out := streamWriterPool.Get().(*bufio.Writer)
+	out.Reset(w)
+	defer func() {
+		out.Reset(io.Discard)
+		streamWriterPool.Put(out)
+	}()
+
+	var body io.Writer = out
+	if hooks.Body != nil {
+		body = io.MultiWriter(out, hooks.Body)
+	}
+
+	var streamErr error
+	if err := cs.executeTo(body, rs, "", data); err != nil {
+		// Drop the buffered part so a failure early in the body leaves no half written markup
+		out.Reset(w)
+		writeRenderError(out)
+		streamErr = &StreamError{Err: err}
+	}
+	out.Flush()
+
+	if hooks.Deferred != nil {
+		hooks.Deferred(rs)
+	}
+	writeDeferredHead(w, rs, mark, assets)
+	writeDocEnd(w)
+
+	return rs, streamErr
+}
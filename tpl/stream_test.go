@@ -0,0 +1,94 @@
+package tpl
+
+import (
+	"errors"
+	"html/template"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderWithLayoutTo(t *testing.T) {
+	te, root := newTestEngine(t, testTemplates, "partials")
+	writeTestFile(t, filepath.Join(root, "pages", "script.html"), `{{define "body"}}<p>{{addScript "/late.js"}}</p>{{end}}`)
+	writeTestFile(t, filepath.Join(root, "pages", "failing.html"), `{{define "body"}}<p>before</p>{{fail}}{{end}}`)
+
+	te.RegisterFuncs(func(rs RenderState, tmpl *template.Template) template.FuncMap {
+		return template.FuncMap{
+			"addScript": func(src string) string {
+				if rs != nil {
+					rs.AddScripts(ScriptAsset{Src: src, Defer: true})
+				}
+				return ""
+			},
+			"fail": func() (string, error) { return "", errors.New("boom") },
+		}
+	})
+
+	head := func(rs RenderState) {
+		rs.SetHeadTitle("Home")
+		rs.AddHeadInlineCSS("body{}")
+	}
+	const docHead = `<!DOCTYPE html><html lang="en"><head><meta charset="UTF-8">` +
+		`<meta name="viewport" content="width=device-width,initial-scale=1">` +
+		`<title>Home</title><style>body{}</style></head>`
+
+	tests := []struct {
+		name          string
+		page          string
+		want          string
+		wantStreamErr bool
+		wantErr       bool
+	}{
+		{
+			name: "Streams the page",
+			page: "index.html",
+			want: docHead + `<main><nav>x</nav><p>X</p></main></html>`,
+		},
+		{
+			name: "Assets added while rendering go after the body",
+			page: "script.html",
+			want: docHead + `<main><nav>x</nav><p></p></main><script src="/late.js" defer></script></html>`,
+		},
+		{
+			name:          "Failure mid-stream closes the page",
+			page:          "failing.html",
+			want:          docHead + `<div role="alert" class="render-error">Part of this page could not be displayed.</div></html>`,
+			wantStreamErr: true,
+		},
+		{
+			name:    "Missing page writes nothing",
+			page:    "missing.html",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			var body strings.Builder
+			_, err := te.RenderWithLayoutTo(w, tt.page, "default.html", TemplateData{Data: map[string]interface{}{"Name": "x"}}, StreamHooks{
+				Head: head,
+				Body: &body,
+			})
+
+			var streamErr *StreamError
+			if got := errors.As(err, &streamErr); got != tt.wantStreamErr {
+				t.Fatalf("StreamError = %v, want %v (err: %v)", got, tt.wantStreamErr, err)
+			}
+			if (err != nil) != (tt.wantErr || tt.wantStreamErr) {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tt.want)
+			}
+			if tt.want != "" && !w.Flushed {
+				t.Error("head was not flushed")
+			}
+			if !tt.wantErr && !tt.wantStreamErr && !strings.Contains(tt.want, body.String()) {
+				t.Errorf("body hook saw %q", body.String())
+			}
+		})
+	}
+}
@@ -13,6 +13,15 @@ type TemplateData struct {
 	Site        SiteData
 	Content     template.HTML
 	Data        map[string]interface{}
+	Locale      string            // Language of the page, e.g. "fr", defaults to "en"
+	Alternates  []Alternate       // The page in the site's other locales, for hreflang links
+	Params      map[string]string // URL params of a dynamic page, e.g. "slug" for blog/[slug].html
+}
+
+// Alternate is the URL of a page in another locale
+type Alternate struct {
+	Locale string // A language tag, or "x-default" for the page to fall back to
+	URL    string
 }
 
 // SiteData represents site information for templates
@@ -20,6 +29,8 @@ type SiteData struct {
 	Name    string
 	Domain  string
 	BaseURL string
+	Data    map[string]interface{} // Files under the site's data/ directory, e.g. .Site.Data.team.members
+	Params  map[string]interface{} // The [params] of the site's config.toml
 }
 
 func LoadSupportingTemplates(supportingTemplatesDirs []string) (supportingTemplates *template.Template, errs []error) {
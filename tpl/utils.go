@@ -5,6 +5,8 @@ package tpl
 func PopulateRenderStateFromTemplateData(rs RenderState, data TemplateData) {
 	// Set the title from the template data
 	rs.SetHeadTitle(data.Title)
+	rs.SetHeadMeta(MetaTag{Name: "description", Content: data.Description})
+	rs.SetTemplateData(data)
 
 	// Set the body content if it exists in TemplateData.Content
 	if data.Content != "" {
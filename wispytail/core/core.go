@@ -230,7 +230,9 @@ func BuildSelector(originalClass string, prefixes []string) (selector string, me
 	return selector, mediaQuery
 }
 
-func generateRuleForClass(class string, trie *common.Trie) (rule string, mediaQuery string, ok bool) {
+// splitVariants splits a class into its variant prefixes and the base utility,
+// e.g. "md:hover:bg-primary" into ["md", "hover"] and "bg-primary"
+func splitVariants(class string) (prefixes []string, base string) {
 	// Handle colons inside brackets properly - they are not variant separators
 	var parts []string
 	var currentPart strings.Builder
@@ -261,8 +263,11 @@ func generateRuleForClass(class string, trie *common.Trie) (rule string, mediaQu
 		parts = []string{class}
 	}
 
-	base := parts[len(parts)-1]      // get last item
-	prefixes := parts[:len(parts)-1] // all except last item
+	return parts[:len(parts)-1], parts[len(parts)-1]
+}
+
+func generateRuleForClass(class string, trie *common.Trie) (rule string, mediaQuery string, ok bool) {
+	prefixes, base := splitVariants(class)
 
 	// Try a static lookup on the base utility.
 	if ruleBody, ok := trie.Search(base); ok {
@@ -282,6 +287,24 @@ func generateRuleForClass(class string, trie *common.Trie) (rule string, mediaQu
 
 var fallbackTrie = common.NewTrie()
 
+// ResolvesClass reports whether CSS can be generated for a class
+func ResolvesClass(class string, trie *common.Trie) bool {
+	_, _, ok := generateRuleForClass(class, trie)
+	return ok
+}
+
+// LooksLikeUtility reports whether a class starts like a utility of the trie, e.g.
+// "bg-primry" does as the trie has "bg-" utilities, while "btn-primary" does not
+func LooksLikeUtility(class string, trie *common.Trie) bool {
+	_, base := splitVariants(class)
+	base = strings.TrimPrefix(base, "-")
+	stem, _, found := strings.Cut(base, "-")
+	if !found {
+		return false
+	}
+	return trie.HasPrefix(stem + "-")
+}
+
 // GenerateCSS accepts a set of class names and the trie, returning Tailwind v4 compatible CSS with cascade layers.
 func ResolveClasses(classes []string, trie *common.Trie) string {
 	if trie == nil {
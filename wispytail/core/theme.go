@@ -2,6 +2,8 @@ package core
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 )
 
@@ -325,17 +327,20 @@ func (b *cssBuilder) AddProperty(name, value string) CSSBuilder {
 	return b
 }
 
+// AddPropertyFromMap adds the properties of a map in the order of their keys, so
+// the same theme always makes the same CSS
 func (b *cssBuilder) AddPropertyFromMap(prefix string, props map[string]string) CSSBuilder {
-	for key, value := range props {
-		b.AddProperty(fmt.Sprintf("--%s-%s", prefix, key), value)
+	for _, key := range slices.Sorted(maps.Keys(props)) {
+		b.AddProperty(fmt.Sprintf("--%s-%s", prefix, key), props[key])
 	}
 	return b
 }
 
 func (b *cssBuilder) AddPropertyFromNestedMap(prefix string, props map[string]map[string]string) CSSBuilder {
-	for colorName, shades := range props {
-		for shade, value := range shades {
-			b.AddProperty(fmt.Sprintf("--%s-%s-%s", prefix, colorName, shade), value)
+	for _, colorName := range slices.Sorted(maps.Keys(props)) {
+		shades := props[colorName]
+		for _, shade := range slices.Sorted(maps.Keys(shades)) {
+			b.AddProperty(fmt.Sprintf("--%s-%s-%s", prefix, colorName, shade), shades[shade])
 		}
 	}
 	return b
@@ -419,8 +424,8 @@ func GenerateThemeLayer(config *ThemeConfig) string {
 
 		// Text line heights (for text size utilities)
 		b.AddSection("Text line heights")
-		for size, lineHeight := range config.TextLineHeights {
-			b.AddProperty("--text-"+size+"--line-height", lineHeight)
+		for _, size := range slices.Sorted(maps.Keys(config.TextLineHeights)) {
+			b.AddProperty("--text-"+size+"--line-height", config.TextLineHeights[size])
 		}
 		b.AddBlock("")
 
@@ -1,6 +1,7 @@
 package wispytail
 
 import (
+	"bytes"
 	"regexp"
 	"strings"
 	"wispy-core/common"
@@ -99,3 +100,73 @@ func ExtractClasses(input string) []string {
 
 	return classList
 }
+
+// GenerateFromClasses generates CSS for class names that were already extracted
+func GenerateFromClasses(classes []string, themeConfig ThemeConf, trie *common.Trie) string {
+	return core.GenerateCSSFromClasses(classes, themeConfig, trie)
+}
+
+var classAttrRegex = regexp.MustCompile(`class\s*=\s*"([^"]+)"`)
+
+// maxPendingClassAttr bounds how much of a class attribute split across writes is kept
+const maxPendingClassAttr = 4 << 10
+
+// ClassCollector is an io.Writer that extracts unique class names, in order, from
+// the HTML written to it, so CSS can be generated for a page that is streamed
+// instead of held in memory. Attributes split across writes are handled.
+type ClassCollector struct {
+	seen    map[string]bool
+	classes []string
+	pending []byte // start of a class attribute that may continue in the next write
+}
+
+func NewClassCollector() *ClassCollector {
+	return &ClassCollector{seen: make(map[string]bool)}
+}
+
+func (c *ClassCollector) Write(p []byte) (int, error) {
+	buf := append(c.pending, p...)
+
+	end := 0
+	for _, match := range classAttrRegex.FindAllSubmatchIndex(buf, -1) {
+		for _, class := range strings.Fields(string(buf[match[2]:match[3]])) {
+			if !c.seen[class] {
+				c.seen[class] = true
+				c.classes = append(c.classes, class)
+			}
+		}
+		end = match[1]
+	}
+
+	// Keep an unfinished attribute, or a tail that may be the start of "class"
+	rest := buf[end:]
+	keep := len("class") - 1
+	if i := bytes.LastIndex(rest, []byte("class")); i >= 0 && len(rest)-i <= maxPendingClassAttr {
+		keep = len(rest) - i
+	}
+	keep = min(keep, len(rest))
+	c.pending = append(c.pending[:0], rest[len(rest)-keep:]...)
+
+	return len(p), nil
+}
+
+// Classes returns the class names collected so far
+func (c *ClassCollector) Classes() []string {
+	return c.classes
+}
+
+// UnresolvedClasses returns the classes that look like utilities of the trie but for
+// which no CSS can be generated, e.g. a misspelt "bg-primry". Classes that are not
+// utilities, such as component classes, are left out.
+func UnresolvedClasses(classes []string, trie *common.Trie) []string {
+	if trie == nil {
+		trie = GetBaseTrie()
+	}
+	var unresolved []string
+	for _, class := range classes {
+		if core.LooksLikeUtility(class, trie) && !core.ResolvesClass(class, trie) {
+			unresolved = append(unresolved, class)
+		}
+	}
+	return unresolved
+}
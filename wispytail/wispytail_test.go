@@ -0,0 +1,71 @@
+package wispytail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassCollector(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{
+			name:   "Single write",
+			writes: []string{`<div class="p-4 flex"><span class="flex text-sm">x</span></div>`},
+			want:   []string{"p-4", "flex", "text-sm"},
+		},
+		{
+			name:   "Attribute split inside the value",
+			writes: []string{`<div class="p-4 fl`, `ex"></div>`},
+			want:   []string{"p-4", "flex"},
+		},
+		{
+			name:   "Attribute name split",
+			writes: []string{`<div cla`, `ss="m-2"></div>`},
+			want:   []string{"m-2"},
+		},
+		{
+			name:   "Split before the quote",
+			writes: []string{`<div class = `, `"m-2  p-1"></div><p class="m-2">`},
+			want:   []string{"m-2", "p-1"},
+		},
+		{
+			name:   "One byte at a time",
+			writes: []string{`<`, `a`, ` `, `c`, `l`, `a`, `s`, `s`, `=`, `"`, `x`, ` `, `y`, `"`, `>`},
+			want:   []string{"x", "y"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClassCollector()
+			for _, w := range tt.writes {
+				if n, err := c.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if got := c.Classes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Classes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnresolvedClasses(t *testing.T) {
+	classes := []string{"p-4", "md:hover:bg-primary", "bg-primry", "md:text-lgg", "btn", "btn-primary", "card-body", "-mt-2", "w-[10px]"}
+	want := []string{"bg-primry", "md:text-lgg"}
+	if got := UnresolvedClasses(classes, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("UnresolvedClasses() = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateThemeLayerIsStable(t *testing.T) {
+	want := GenerateThemeLayer(nil)
+	for i := 0; i < 10; i++ {
+		if got := GenerateThemeLayer(nil); got != want {
+			t.Fatalf("GenerateThemeLayer() differs between calls")
+		}
+	}
+}